@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// maxParallelUpdates limits how many stacks a batch updates at once with
+// --parallel, to stay clear of API rate limits.
+const maxParallelUpdates = 4
+
+// batchEntry is one stack to update in a batch file.
+type batchEntry struct {
+	StackName      string            `json:"StackName"`
+	TemplateFile   string            `json:"TemplateFile"`
+	ParameterFiles []string          `json:"ParameterFiles"`
+	Parameters     map[string]string `json:"Parameters"`
+}
+
+// readBatch reads a batch file, which lists the stacks to update. Relative
+// paths in it are resolved against its directory.
+func readBatch(path string) ([]batchEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []batchEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || p == stdinPath || filepath.IsAbs(p) || cftool.IsTemplateURL(p) {
+			return p
+		}
+
+		return filepath.Join(dir, p)
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		if entry.TemplateFile == "" {
+			return nil, errors.Errorf("%s: entry %d has no TemplateFile", path, i+1)
+		}
+
+		entry.TemplateFile = resolve(entry.TemplateFile)
+		for j, file := range entry.ParameterFiles {
+			entry.ParameterFiles[j] = resolve(file)
+		}
+	}
+
+	return entries, nil
+}
+
+// options returns the options to update the entry with: those given on the
+// command line, with the stack, template and parameters of the entry.
+func (entry batchEntry) options(updateOpts UpdateOptions) UpdateOptions {
+	updateOpts.StackName = entry.StackName
+	updateOpts.TemplateFile = entry.TemplateFile
+	updateOpts.ParameterFiles = entry.ParameterFiles
+	updateOpts.Parameters = nil
+
+	var keys []string
+	for key := range entry.Parameters {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		updateOpts.Parameters = append(updateOpts.Parameters, key+"="+entry.Parameters[key])
+	}
+
+	return updateOpts
+}
+
+func (entry batchEntry) label() string {
+	if entry.StackName != "" {
+		return entry.StackName
+	}
+
+	return entry.TemplateFile
+}
+
+// updateBatch updates each stack listed in the batch file, and prints the
+// results. With --parallel, several are updated at once; their output is
+// shown as each of them finishes, and prompts can't be answered.
+func updateBatch(c context.Context, globalOpts GlobalOptions, updateOpts UpdateOptions) error {
+	entries, err := readBatch(updateOpts.Batch)
+	if err != nil {
+		return err
+	}
+
+	if err := checkDumpPath(updateOpts.DumpChangeSet, len(entries)); err != nil {
+		return err
+	}
+
+	results := make([][]result, len(entries))
+
+	if updateOpts.Parallel {
+		updateParallel(c, globalOpts, updateOpts, entries, results)
+	} else {
+		for i, entry := range entries {
+			pprint.Header(color.Output, "%s", entry.label())
+			results[i] = updateEntry(c, &globalOpts, entry.options(updateOpts), entry.label(), color.Output)
+			printEntryEnd(color.Output, entry, results[i])
+
+			if summaryError(results[i]) != nil && !updateOpts.KeepGoing {
+				break
+			}
+		}
+	}
+
+	all := flatten(results)
+	printSummary(color.Output, all)
+
+	if err := summaryError(all); err != nil {
+		return err
+	}
+
+	if (updateOpts.DryRun || updateOpts.NoExecute) && globalOpts.DetailedExit && hasChanges(all) {
+		return cftool.ErrChangesPending
+	}
+
+	return nil
+}
+
+func updateParallel(
+	c context.Context,
+	globalOpts GlobalOptions,
+	updateOpts UpdateOptions,
+	entries []batchEntry,
+	results [][]result,
+) {
+	// Output is buffered, so progress can't be redrawn in place.
+	globalOpts.Color = false
+	updateOpts.unattended = true
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, maxParallelUpdates)
+
+	for i, entry := range entries {
+		wg.Add(1)
+
+		go func(i int, entry batchEntry) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			var out bytes.Buffer
+			r := updateEntry(c, &globalOpts, entry.options(updateOpts), entry.label(), &out)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			results[i] = r
+			pprint.Header(color.Output, "%s", entry.label())
+			_, _ = io.Copy(color.Output, &out)
+			printEntryEnd(color.Output, entry, r)
+		}(i, entry)
+	}
+
+	wg.Wait()
+}
+
+// printEntryEnd marks the end of the output for a batch entry with its
+// outcome, which is the first failure if there is one.
+func printEntryEnd(w io.Writer, entry batchEntry, results []result) {
+	r := results[len(results)-1]
+	for _, rr := range results {
+		if rr.Err != nil {
+			r = rr
+			break
+		}
+	}
+
+	pprint.Header(w, "end of %s: %s", entry.label(), r.Status)
+	fmt.Fprintf(w, "\n")
+}
+
+// updateEntry updates the stack of one batch entry. Results are labelled by
+// the entry, and by region if there are several.
+func updateEntry(
+	c context.Context,
+	globalOpts *GlobalOptions,
+	updateOpts UpdateOptions,
+	label string,
+	w io.Writer,
+) []result {
+	results, err := updateStack(c, globalOpts, updateOpts, w)
+	if err != nil {
+		pprint.Errorf(w, "%v", err)
+		return []result{{Label: label, Status: "FAILED", Err: err}}
+	}
+
+	for i := range results {
+		if results[i].Label == "" {
+			results[i].Label = label
+		} else {
+			results[i].Label = label + " " + results[i].Label
+		}
+	}
+
+	return results
+}
+
+func flatten(results [][]result) []result {
+	var all []result
+	for _, r := range results {
+		all = append(all, r...)
+	}
+
+	return all
+}
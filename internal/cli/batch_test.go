@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "batch.yml")
+	data := `
+- StackName: app
+  TemplateFile: app/template.yml
+  ParameterFiles: [app/prod.json, /etc/shared.json]
+  Parameters: {Version: "2", Env: prod}
+- TemplateFile: https://example.com/template.yml
+`
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+
+	entries, err := readBatch(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, filepath.Join(dir, "app/template.yml"), entries[0].TemplateFile)
+	require.Equal(t, []string{filepath.Join(dir, "app/prod.json"), "/etc/shared.json"}, entries[0].ParameterFiles)
+	require.Equal(t, "https://example.com/template.yml", entries[1].TemplateFile)
+	require.Equal(t, "https://example.com/template.yml", entries[1].label())
+
+	opts := entries[0].options(UpdateOptions{Parameters: []string{"Ignored=1"}, Yes: true})
+	require.Equal(t, "app", opts.StackName)
+	require.Equal(t, []string{"Env=prod", "Version=2"}, opts.Parameters)
+	require.True(t, opts.Yes)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("- StackName: app\n"), 0644))
+	_, err = readBatch(path)
+	require.Error(t, err)
+}
+
+// Run with -race: the entries share the lazily created clients of globalOpts.
+func TestUpdateParallel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	template := filepath.Join(dir, "template.yml")
+	require.NoError(t, ioutil.WriteFile(template, []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n"), 0644))
+
+	globalOpts := GlobalOptions{AWS: AWSOptions{Offline: true, Region: "eu-west-1"}}
+	entries := []batchEntry{
+		{StackName: "first", TemplateFile: template},
+		{StackName: "second", TemplateFile: template},
+	}
+
+	results := make([][]result, len(entries))
+	updateParallel(context.Background(), globalOpts, UpdateOptions{Yes: true}, entries, results)
+
+	for i, r := range results {
+		require.Len(t, r, 1)
+		require.NoError(t, r[0].Err, entries[i].StackName)
+		require.Equal(t, "CREATE_COMPLETE", r[0].Status)
+	}
+}
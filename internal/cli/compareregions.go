@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+)
+
+// CompareRegions compares the deployed template and parameters of a stack in
+// two regions, to confirm that they are in sync.
+func CompareRegions(c context.Context, globalOpts GlobalOptions, compareOpts CompareRegionsOptions) error {
+	apiA, err := globalOpts.AWS.CloudFormationClient(compareOpts.RegionA)
+	if err != nil {
+		return err
+	}
+
+	apiB, err := globalOpts.AWS.CloudFormationClient(compareOpts.RegionB)
+	if err != nil {
+		return err
+	}
+
+	pprint.Field(color.Output, "StackName", compareOpts.StackName)
+
+	differ, err := compareRegions(color.Output, apiA, apiB, compareOpts)
+	if err != nil {
+		return err
+	}
+
+	if differ && globalOpts.DetailedExit {
+		return cftool.ErrChangesPending
+	}
+
+	return nil
+}
+
+// compareRegions prints the difference between the stack in the region of
+// apiA and that of apiB, and reports whether there is one.
+func compareRegions(
+	w io.Writer,
+	apiA cloudformationiface.CloudFormationAPI,
+	apiB cloudformationiface.CloudFormationAPI,
+	compareOpts CompareRegionsOptions,
+) (bool, error) {
+	type side struct {
+		template   []string
+		parameters []string
+	}
+
+	sides := make([]side, 2)
+	regions := []string{compareOpts.RegionA, compareOpts.RegionB}
+
+	for i, api := range []cloudformationiface.CloudFormationAPI{apiA, apiB} {
+		body, err := deployedTemplate(api, compareOpts.StackName, compareOpts.Processed)
+		if err != nil {
+			return false, errors.Wrap(err, regions[i])
+		}
+
+		params, err := deployedParameters(api, compareOpts.StackName)
+		if err != nil {
+			return false, errors.Wrap(err, regions[i])
+		}
+
+		sides[i] = side{difflib.SplitLines(body), mapLines("Parameters", params)}
+	}
+
+	a, b := sides[0], sides[1]
+
+	pprint.Header(w, "Template in %s and %s", regions[0], regions[1])
+	if err := diffLines(w, a.template, b.template); err != nil {
+		return false, err
+	}
+
+	pprint.Header(w, "Parameters in %s and %s", regions[0], regions[1])
+	if err := diffLines(w, a.parameters, b.parameters); err != nil {
+		return false, err
+	}
+
+	differ := !equalStrings(a.template, b.template) || !equalStrings(a.parameters, b.parameters)
+	return differ, nil
+}
+
+// deployedParameters returns the parameters the stack is deployed with. NoEcho
+// parameters come back masked, so a difference in their value doesn't show.
+func deployedParameters(api cloudformationiface.CloudFormationAPI, stackName string) (map[string]string, error) {
+	out, err := api.DescribeStacks(&cf.DescribeStacksInput{StackName: aws.String(stackName)})
+	if err != nil {
+		return nil, errors.Wrapf(err, "describe stack %s", stackName)
+	}
+
+	params := make(map[string]string)
+	for _, param := range out.Stacks[0].Parameters {
+		params[aws.StringValue(param.ParameterKey)] = aws.StringValue(param.ParameterValue)
+	}
+
+	return params, nil
+}
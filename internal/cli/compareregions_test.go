@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCompareRegions(t *testing.T) {
+	template := "Parameters:\n  Size: {Type: String}\nResources:\n  Queue: {Type: AWS::SQS::Queue}\n"
+	deploy := func(region string, template string, size string) *internal.OfflineCloudFormation {
+		api := internal.NewOfflineCloudFormation(region)
+		deployment := &cftool.Deployment{
+			StackName:    "app",
+			TemplateBody: []byte(template),
+			Parameters:   map[string]string{"Size": size},
+		}
+
+		_, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+		require.NoError(t, err)
+		return api
+	}
+
+	opts := CompareRegionsOptions{StackName: "app", RegionA: "eu-west-1", RegionB: "us-east-1"}
+	euWest1 := deploy("eu-west-1", template, "1")
+
+	buf := &bytes.Buffer{}
+	differ, err := compareRegions(buf, euWest1, deploy("us-east-1", template, "1"), opts)
+	require.NoError(t, err)
+	require.False(t, differ)
+	require.Contains(t, buf.String(), "No differences.")
+
+	buf.Reset()
+	differ, err = compareRegions(buf, euWest1, deploy("us-east-1", template, "2"), opts)
+	require.NoError(t, err)
+	require.True(t, differ)
+	require.Contains(t, buf.String(), "-Parameters.Size: 1")
+	require.Contains(t, buf.String(), "+Parameters.Size: 2")
+
+	_, err = compareRegions(buf, euWest1, internal.NewOfflineCloudFormation("us-east-1"), opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "us-east-1: get template of stack app")
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"context"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+)
+
+// ContinueRollback continues the rollback of a stack that failed to roll back,
+// optionally skipping resources that can't be rolled back.
+func ContinueRollback(c context.Context, globalOpts GlobalOptions, rollbackOpts ContinueRollbackOptions) error {
+	if rollbackOpts.StackName == "" {
+		return errors.New("expected a stack name (-n)")
+	}
+
+	api, err := globalOpts.AWS.CloudFormationClient("")
+	if err != nil {
+		return err
+	}
+
+	deployer := cftool.NewDeployer(api, &cftool.Deployment{StackName: rollbackOpts.StackName})
+	deployer.Interactive = globalOpts.Interactive()
+	deployer.Log = globalOpts.Log
+	deployer.EventLog = globalOpts.EventLog
+	deployer.Yes = rollbackOpts.Yes
+
+	return deployer.ContinueRollback(c, color.Output, rollbackOpts.SkipResources)
+}
@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"context"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+)
+
+// Delete deletes a stack, after reviewing which of its resources will be
+// deleted and which retained.
+func Delete(c context.Context, globalOpts GlobalOptions, deleteOpts DeleteOptions) error {
+	if deleteOpts.StackName == "" {
+		return errors.New("expected a stack name (-n)")
+	}
+
+	api, err := globalOpts.AWS.CloudFormationClient("")
+	if err != nil {
+		return err
+	}
+
+	deployer := cftool.NewDeployer(api, &cftool.Deployment{StackName: deleteOpts.StackName})
+	deployer.Interactive = globalOpts.Interactive()
+	deployer.Log = globalOpts.Log
+	deployer.EventLog = globalOpts.EventLog
+	deployer.Yes = deleteOpts.Yes
+	deployer.DryRun = deleteOpts.DryRun
+	deployer.RetainOnDelete = deleteOpts.RetainOnDelete
+
+	return deployer.Delete(c, color.Output)
+}
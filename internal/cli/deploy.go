@@ -9,81 +9,681 @@ import (
 	"github.com/tetratom/cftool/pkg/cftool"
 	manifest2 "github.com/tetratom/cftool/pkg/manifest"
 	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 )
 
 func Deploy(c context.Context, globalOpts GlobalOptions, deployOpts DeployOptions) (err error) {
-	stsapi, err := globalOpts.AWS.STSClient()
+	if deployOpts.Timeout > 0 {
+		var cancel context.CancelFunc
+		c, cancel = context.WithTimeout(c, deployOpts.Timeout)
+		defer cancel()
+	}
+
+	manifestPath, manifest, err := loadManifest(deployOpts.ManifestFile, deployOpts.BaseDir)
 	if err != nil {
 		return err
 	}
 
-	manifestPath := deployOpts.ManifestFile
-	if manifestPath == "" {
-		cwd, err := os.Getwd()
-		if err != nil {
+	pprint.Field(color.Output, "Manifest", manifestPath)
+
+	var retry *deployState
+	if deployOpts.RetryFailed != "" {
+		if retry, err = retryOptions(&deployOpts); err != nil {
 			return err
 		}
 
-		manifestPath, err = findManifest(cwd)
-		if err != nil {
+		if len(retry.Failed) == 0 {
+			fmt.Fprintf(color.Output, "No failed stacks to retry.\n")
+			return nil
+		}
+	}
+
+	if deployOpts.Interactive && (deployOpts.Tenant == "" || (len(deployOpts.Stacks) == 0 && !deployOpts.All)) {
+		if pprint.IsInteractiveInput() {
+			if err := pickDeployment(manifest, &deployOpts, color.Output, pprint.PromptChoice); err != nil {
+				return err
+			}
+		} else {
+			pprint.Warningf(color.Output, "--interactive ignored, since stdin is not a terminal")
+		}
+	}
+
+	// A single --region only sets the session default, and the manifest takes
+	// precedence. Repeating it deploys each stack to each region in turn.
+	regions := []string{""}
+	if len(globalOpts.Regions) > 1 {
+		regions = globalOpts.Regions
+	} else if retry != nil && len(retry.Regions) > 1 {
+		regions = retry.Regions
+	}
+
+	// With --each-account, each stack is also deployed to each account, in
+	// every region.
+	accounts := []*manifest2.Account{nil}
+	if deployOpts.EachAccount {
+		if accounts, err = manifest.FindAccounts(deployOpts.Accounts); err != nil {
 			return err
 		}
 	}
 
-	pprint.Field(color.Output, "Manifest", manifestPath)
+	var targets []deployTarget
+	for _, region := range regions {
+		for _, account := range accounts {
+			targets = append(targets, deployTarget{region: region, account: account})
+		}
+	}
 
-	manifest, err := manifest2.ReadFromFile(manifestPath)
-	if err != nil {
-		return
+	// A forgotten --stack shouldn't deploy every stack of the tenant.
+	stacks := deployOpts.Stacks
+	if len(stacks) == 0 {
+		if !deployOpts.All {
+			return errors.New("no stack given: pass -s STACK, or --all to deploy all stacks of the tenant")
+		}
+
+		stacks = manifest.StackLabels(deployOpts.Tenant)
 	}
 
-	if err = os.Chdir(filepath.Dir(manifestPath)); err != nil {
-		return
+	stacks, err = manifest.OrderStacks(stacks)
+	if err != nil {
+		return err
 	}
 
 	var deployments []*cftool.Deployment
+	var skipped []result
+
+	for _, stack := range stacks {
+		enabled, err := manifest.IsStackEnabled(deployOpts.Tenant, stack)
+		if err != nil {
+			return err
+		}
+
+		if !enabled {
+			if len(deployOpts.Stacks) > 0 {
+				return errors.Errorf("stack %s is not enabled for tenant %s", stack, deployOpts.Tenant)
+			}
+
+			skipped = append(skipped, result{Label: stack, Status: "SKIPPED", Note: "not enabled"})
+			continue
+		}
+
+		for _, target := range targets {
+			deployment, ok, err := manifest.FindDeploymentInRegion(deployOpts.Tenant, stack, target.region)
+			if err != nil {
+				return err
+			} else if !ok {
+				return errors.Errorf("no deployment of stack %s for tenant %s", stack, deployOpts.Tenant)
+			}
+
+			if target.account != nil {
+				deployment.AccountId, deployment.RoleArn = target.account.Id, target.account.RoleArn
+			}
+
+			if retry != nil && !retry.includes(deployment) {
+				continue
+			}
 
-	if deployment, ok, err := manifest.FindDeployment(deployOpts.Tenant, deployOpts.Stack); err != nil {
+			if deployOpts.AllowedCapabilities != nil {
+				deployment.AllowedCapabilities = deployOpts.AllowedCapabilities
+			}
+
+			for key, re := range deployOpts.ExpectedOutputs {
+				if deployment.ExpectedOutputs == nil {
+					deployment.ExpectedOutputs = make(map[string]*regexp.Regexp)
+				}
+
+				deployment.ExpectedOutputs[key] = re
+			}
+
+			if err := cftool.StackName(deployment.StackName).Validate(); err != nil {
+				return errors.Wrapf(err, "stack %s for tenant %s", stack, deployOpts.Tenant)
+			}
+
+			if deployOpts.Preprocess {
+				if err := deployment.Preprocess(); err != nil {
+					return errors.Wrap(err, "preprocess template")
+				}
+			}
+
+			// Partials may be in S3, so templates with includes are checked
+			// once the profile is known.
+			if !deployOpts.ResolveIncludes {
+				if err := checkTemplate(deployment, deployOpts, color.Output); err != nil {
+					return err
+				}
+			}
+
+			deployments = append(deployments, deployment)
+		}
+	}
+
+	if len(deployments) == 0 {
+		return errors.Errorf("no stacks to deploy for tenant %s", deployOpts.Tenant)
+	}
+
+	if err := checkDumpPath(deployOpts.DumpChangeSet, len(deployments)); err != nil {
+		return err
+	}
+
+	// With --each-account, the profile is the one to assume the roles with.
+	if !deployOpts.EachAccount {
+		if err := selectProfile(&globalOpts.AWS, deployments); err != nil {
+			return err
+		}
+	}
+
+	// The profile may decide the region, so regions are checked once it is
+	// known.
+	if err := checkRegions(&globalOpts.AWS, manifest, deployments, deployOpts.Force, color.Output); err != nil {
 		return err
-	} else if ok {
-		deployments = append(deployments, deployment)
 	}
 
+	// Parameters are completed once the profile is known, since taking them
+	// from another stack needs AWS.
+	for _, deployment := range deployments {
+		if deployOpts.ResolveIncludes {
+			if err := resolveIncludes(c, &globalOpts.AWS, deployment, filepath.Dir(deployment.Files[0])); err != nil {
+				return errors.Wrapf(err, "stack %s", deployment.StackLabel)
+			}
+
+			if err := checkTemplate(deployment, deployOpts, color.Output); err != nil {
+				return err
+			}
+		}
+
+		if deployOpts.ParametersFromEnv != "" {
+			err := mergeEnvParameters(deployment.Parameters, deployOpts.ParametersFromEnv, deployment.TemplateBody, color.Output)
+			if err != nil {
+				return errors.Wrapf(err, "stack %s", deployment.StackLabel)
+			}
+		}
+
+		if err := cftool.RunParameterCommands(deployment.Parameters, deployOpts.AllowExec); err != nil {
+			return errors.Wrapf(err, "stack %s", deployment.StackLabel)
+		}
+
+		if deployOpts.ParametersFromStack != "" {
+			err := seedParameters(globalOpts.AWS.ForRole(deployment.RoleArn), deployment, deployOpts.ParametersFromStack, color.Output)
+			if err != nil {
+				return errors.Wrapf(err, "stack %s", deployment.StackLabel)
+			}
+		}
+
+		if deployOpts.FillDefaults {
+			if err := deployment.FillDefaults(); err != nil {
+				return errors.Wrap(err, "fill parameter defaults")
+			}
+		}
+
+		if len(deployment.RollbackAlarms) > 0 {
+			cwapi, err := globalOpts.AWS.ForRole(deployment.RoleArn).CloudWatchClient(deployment.Region)
+			if err != nil {
+				return err
+			}
+
+			if err := resolveRollbackAlarms(cwapi, deployment, color.Output); err != nil {
+				return errors.Wrapf(err, "stack %s", deployment.StackLabel)
+			}
+		}
+
+		if deployOpts.DryRun && len(deployment.TemplateBody) > 0 {
+			awsOpts := globalOpts.AWS.ForRole(deployment.RoleArn)
+			if err := validateNestedStacks(c, awsOpts, deployment, filepath.Dir(deployment.Files[0]), color.Output); err != nil {
+				return errors.Wrapf(err, "stack %s", deployment.StackLabel)
+			}
+		}
+
+		// References to outputs are resolved right before deploying, once
+		// the stacks they refer to are, so validation has to wait as well.
+		if cftool.HasOutputRefs(deployment.Parameters) {
+			continue
+		}
+
+		if err := deployment.ValidateParameters(); err != nil {
+			return errors.Wrapf(err, "stack %s for tenant %s", deployment.StackLabel, deployOpts.Tenant)
+		}
+	}
+
+	labels := make([]string, len(deployments))
 	for i, deployment := range deployments {
-		if i > 0 {
-			fmt.Fprint(color.Output, "\n")
+		labels[i] = deploymentLabel(deployment, len(stacks) > 1, len(regions) > 1)
+		if deployOpts.EachAccount {
+			labels[i] = accountName(accounts, deployment.AccountId) + " " + labels[i]
+		}
+	}
+
+	var results []result
+
+	// failed holds the stacks that failed in any region, or were skipped
+	// because of such a failure, so that stacks depending on them are skipped
+	// in turn.
+	failed := make(map[string]bool)
+	outputs := newStackOutputs(&globalOpts.AWS, manifest, deployOpts.Tenant, failed)
+
+	for i, deployment := range deployments {
+		if len(deployments) > 1 {
+			printSection(color.Output, globalOpts.Interactive(), labels, results)
+		}
+
+		if dep := failedDependency(manifest, deployment.StackLabel, failed); dep != "" {
+			note := "depends on failed stack " + dep
+			fmt.Fprintf(color.Output, "Skipped: %s.\n", note)
+			results = append(results, result{Label: labels[i], Status: "SKIPPED", Note: note})
+			failed[deployment.StackLabel] = true
+			continue
+		}
+
+		start := time.Now()
+		deployer, err := deployOne(c, &globalOpts, deployOpts, deployment, outputs)
+		results = append(results, newResult(labels[i], deployer, err))
+		results[i].Elapsed = time.Since(start)
+
+		if err == nil && deployer.Outputs != nil {
+			outputs.add(deployment, deployer.Outputs)
 		}
 
-		api, err := globalOpts.AWS.CloudFormationClient(deployment.Region)
 		if err != nil {
-			return err
+			failed[deployment.StackLabel] = true
+
+			if !deployOpts.KeepGoing {
+				break
+			}
 		}
+	}
+
+	if len(deployments) > 1 {
+		printSection(color.Output, globalOpts.Interactive(), labels[:len(results)], results)
+	}
+
+	if err := saveDeployState(deployOpts, regions, deployments, results, color.Output); err != nil {
+		return err
+	}
+
+	if len(deployments)+len(skipped) > 1 {
+		printSummary(color.Output, append(results, skipped...))
+	}
+
+	if err := summaryError(results); err != nil {
+		return err
+	}
+
+	if (deployOpts.DryRun || deployOpts.NoExecute || deployOpts.DiffOnly) && globalOpts.DetailedExit && hasChanges(results) {
+		return cftool.ErrChangesPending
+	}
 
-		deployer := internal.NewDeployer(api, deployment)
-		deployer.ShowDiff = deployOpts.ShowDiff
+	return nil
+}
+
+// retryOptions reads the --retry-failed state file, and restricts the deploy
+// to the tenant and stacks it lists.
+func retryOptions(deployOpts *DeployOptions) (*deployState, error) {
+	state, err := readDeployState(deployOpts.RetryFailed)
+	if err != nil {
+		return nil, errors.Wrap(err, "--retry-failed")
+	}
+
+	if deployOpts.Tenant != "" && deployOpts.Tenant != state.Tenant {
+		return nil, errors.Errorf("--retry-failed: state is for tenant %s, not %s", state.Tenant, deployOpts.Tenant)
+	}
+
+	if len(deployOpts.Stacks) > 0 {
+		return nil, errors.New("--retry-failed: the stacks to retry come from the state file, and can't be given")
+	}
+
+	deployOpts.Tenant = state.Tenant
+	deployOpts.Stacks = state.stacks()
+	deployOpts.EachAccount = deployOpts.EachAccount || state.EachAccount
+	return state, nil
+}
+
+// saveDeployState writes the stacks that didn't deploy to --state-file, or
+// back to the --retry-failed file, so that they can be retried. A deploy that
+// executes nothing leaves the file as it is, since its stacks still need to be
+// deployed.
+func saveDeployState(
+	deployOpts DeployOptions,
+	regions []string,
+	deployments []*cftool.Deployment,
+	results []result,
+	w io.Writer,
+) error {
+	path := deployOpts.StateFile
+	if path == "" {
+		path = deployOpts.RetryFailed
+	}
+
+	if path == "" {
+		return nil
+	}
+
+	if deployOpts.DryRun || deployOpts.NoExecute || deployOpts.DiffOnly {
+		fmt.Fprintf(w, "\nNothing was deployed, so %s is not updated.\n", path)
+		return nil
+	}
+
+	state := &deployState{
+		Tenant:      deployOpts.Tenant,
+		EachAccount: deployOpts.EachAccount,
+		Failed:      failedDeployments(deployments, results),
+	}
+	if len(regions) > 1 {
+		state.Regions = regions
+	}
+
+	if err := writeDeployState(path, state); err != nil {
+		return errors.Wrap(err, "write state file")
+	}
+
+	if len(state.Failed) > 0 {
+		fmt.Fprintf(w, "\nRecorded %d stack(s) that did not deploy in %s. Retry them with --retry-failed %s.\n", len(state.Failed), path, path)
+	}
+
+	return nil
+}
+
+// checkTemplate runs the checks of the template that don't need AWS.
+func checkTemplate(deployment *cftool.Deployment, deployOpts DeployOptions, w io.Writer) error {
+	if err := deployment.CheckResources(deployOpts.RetainOnDelete); err != nil {
+		return errors.Wrapf(err, "--retain-on-delete for stack %s", deployment.StackLabel)
+	}
+
+	if err := checkResourceCount(deployment, w); err != nil {
+		return err
+	}
 
-		id, err := deployer.Whoami(color.Output, stsapi, getRegion(api))
+	if len(deployOpts.RequiredTags) > 0 {
+		if err := warnUntagged(deployment, w); err != nil {
+			return errors.Wrapf(err, "stack %s", deployment.StackLabel)
+		}
+	}
+
+	return nil
+}
+
+// failedDependency returns a stack that the given stack depends on, and that
+// has failed, if any.
+func failedDependency(manifest *manifest2.Manifest, stack string, failed map[string]bool) string {
+	for _, dep := range manifest.StackDependencies(stack) {
+		if failed[dep] {
+			return dep
+		}
+	}
+
+	return ""
+}
+
+// selectProfile picks the profile for the account the deployments belong to,
+// unless a profile was given with --profile or $AWS_PROFILE, or credentials
+// with $AWS_ACCESS_KEY_ID or $AWS_SESSION_TOKEN, as in CI. It is an error if
+// several profiles in the shared config file lead to that account.
+func selectProfile(awsOpts *AWSOptions, deployments []*cftool.Deployment) error {
+	if awsOpts.Offline || awsOpts.Profile != "" || os.Getenv("AWS_PROFILE") != "" {
+		return nil
+	}
+
+	if os.Getenv("AWS_ACCESS_KEY_ID") != "" || os.Getenv("AWS_SESSION_TOKEN") != "" {
+		return nil
+	}
+
+	accountId := ""
+	for _, deployment := range deployments {
+		if deployment.AccountId == "" || (accountId != "" && deployment.AccountId != accountId) {
+			// All deployments share a session, so there is no single
+			// profile to choose.
+			return nil
+		}
+
+		accountId = deployment.AccountId
+	}
+
+	profiles := internal.ProfilesForAccount(accountId)
+
+	switch len(profiles) {
+	case 0:
+		return nil
+	case 1:
+		awsOpts.Profile = profiles[0]
+		pprint.Field(color.Output, "Profile", awsOpts.Profile)
+		return nil
+	default:
+		return errors.Errorf(
+			"several profiles for account %s (%s); select one with --profile",
+			accountId, strings.Join(profiles, ", "))
+	}
+}
+
+// checkRegions refuses deployments to regions outside the manifest's
+// AllowedRegions, or only warns about them if force is set.
+func checkRegions(
+	awsOpts *AWSOptions,
+	manifest *manifest2.Manifest,
+	deployments []*cftool.Deployment,
+	force bool,
+	w io.Writer,
+) error {
+	for _, deployment := range deployments {
+		api, err := awsOpts.CloudFormationClient(deployment.Region)
 		if err != nil {
 			return err
 		}
 
-		if deployment.AccountId != "" && deployment.AccountId != *id.Account {
-			fmt.Fprintf(color.Output, "\nTenant account mismatch. Has the correct profile been selected?\n")
-			os.Exit(1)
+		err = manifest.CheckRegion(getRegion(api))
+		switch {
+		case err == nil:
+		case force:
+			pprint.Warningf(w, "stack %s: %v", deployment.StackLabel, err)
+		default:
+			return errors.Errorf("stack %s: %v; use --force to deploy anyway", deployment.StackLabel, err)
 		}
+	}
+
+	return nil
+}
+
+// deploymentLabel identifies a deployment among several, by stack and/or by
+// region.
+func deploymentLabel(d *cftool.Deployment, byStack bool, byRegion bool) string {
+	switch {
+	case byStack && byRegion:
+		return d.StackLabel + " " + d.Region
+	case byRegion:
+		return d.Region
+	default:
+		return d.StackLabel
+	}
+}
+
+// deployTarget is where a stack is deployed: a region, or the manifest's
+// with an empty one, and with --each-account an account.
+type deployTarget struct {
+	region  string
+	account *manifest2.Account
+}
 
-		if !deployment.Protected && !deployOpts.Yes {
-			deployment.Protected = true
+// accountName returns the name of the account with the id.
+func accountName(accounts []*manifest2.Account, id string) string {
+	for _, account := range accounts {
+		if account != nil && account.Id == id {
+			return account.Name()
 		}
+	}
 
-		if err = deployer.Deploy(c, color.Output); err != nil {
-			return errors.Wrapf(err, "deploy stack: %s", deployment.StackName)
+	return id
+}
+
+func deployOne(
+	c context.Context,
+	globalOpts *GlobalOptions,
+	deployOpts DeployOptions,
+	deployment *cftool.Deployment,
+	outputs *stackOutputs,
+) (*cftool.Deployer, error) {
+	if cftool.HasOutputRefs(deployment.Parameters) {
+		if err := outputs.resolve(deployment); err != nil {
+			return nil, errors.Wrapf(err, "stack %s", deployment.StackLabel)
+		}
+
+		if err := deployment.ValidateParameters(); err != nil {
+			return nil, errors.Wrapf(err, "stack %s", deployment.StackLabel)
 		}
 	}
 
-	return nil
+	awsOpts := globalOpts.AWS.ForRole(deployment.RoleArn)
+	api, err := awsOpts.CloudFormationClient(deployment.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	stsapi, err := awsOpts.STSClient()
+	if err != nil {
+		return nil, err
+	}
+
+	deployer := cftool.NewDeployer(api, deployment)
+	deployer.Options = cftool.Options{
+		ShowDiff:            deployOpts.ShowDiff,
+		DiffOnly:            deployOpts.DiffOnly,
+		DiffMode:            globalOpts.DiffMode,
+		IgnoreWhitespace:    globalOpts.IgnoreWhitespace,
+		SemanticDiff:        globalOpts.SemanticDiff,
+		Interactive:         globalOpts.Interactive(),
+		Log:                 globalOpts.Log,
+		EventLog:            globalOpts.EventLog,
+		Trace:               globalOpts.newTrace(),
+		RateLimiter:         globalOpts.RateLimiter,
+		DryRun:              deployOpts.DryRun,
+		NoExecute:           deployOpts.NoExecute,
+		SortOutputs:         deployOpts.SortOutputs,
+		Yes:                 deployOpts.Yes,
+		IUnderstand:         deployOpts.IUnderstand,
+		KeepFailedChangeSet: deployOpts.KeepFailed,
+		CancelOnTimeout:     deployOpts.CancelOnTimeout,
+		Heartbeat:           deployOpts.Heartbeat,
+		ChangeSetMaxWait:    deployOpts.MaxWait,
+		ChangeSetMaxPending: deployOpts.MaxPending,
+		FailOnDrift:         deployOpts.FailOnDrift,
+		WaitIfBusy:          deployOpts.WaitIfBusy,
+		RetainOnDelete:      deployOpts.RetainOnDelete,
+		DeleteFailedCreates: deployOpts.DeleteFailedCreates,
+		NoDeleteOnRollback:  deployOpts.NoDeleteOnRollback,
+		ReplaceOnFailure:    deployOpts.ReplaceOnFailure,
+		ChangeFilter:        deployOpts.ChangeFilter,
+		DetailedChangeSet:   deployOpts.DetailedChangeSet,
+		Comment:             deployOpts.Comment,
+		TrackTemplate:       deployOpts.TrackTemplate,
+		RequiredTags:        deployOpts.RequiredTags,
+		OnlyChanged:         deployOpts.OnlyChanged,
+		HandleInterrupts:    true,
+	}
+
+	id, err := deployer.Whoami(color.Output, stsapi, getRegion(api))
+	if err != nil {
+		return deployer, err
+	}
+
+	deployer.Description = changeSetDescription(deployOpts.Description, *id.Arn, deployment.Files)
+	deployer.DumpChangeSet = dumpPath(deployOpts.DumpChangeSet, getRegion(api), *id.Account, deployment.StackName)
+
+	// Offline, only roles lead to accounts other than the simulated one.
+	offline := globalOpts.AWS.Offline && deployment.RoleArn == ""
+	if deployment.AccountId != "" && deployment.AccountId != *id.Account && !offline {
+		return deployer, errors.Errorf(
+			"tenant account mismatch (expected %s). Has the correct profile been selected?",
+			deployment.AccountId)
+	}
+
+	if deployOpts.LockTable != "" {
+		err := useLock(&globalOpts.AWS, deployer, deployOpts.LockTable, deployOpts.ForceUnlock, id, getRegion(api))
+		if err != nil {
+			return deployer, err
+		}
+	}
+
+	err = deployer.Deploy(c, color.Output)
+	if err != nil && c.Err() == context.DeadlineExceeded {
+		err = errors.Errorf("timed out after %s", deployOpts.Timeout)
+	}
+
+	printTrace(color.Output, globalOpts.Log, deployer)
+
+	notify(globalOpts, deployer, *id.Arn, err)
+	if err != nil {
+		return deployer, errors.Wrapf(err, "deploy stack: %s", deployment.StackName)
+	}
+
+	return deployer, nil
+}
+
+// loadManifest reads the manifest at path, or the one found in an enclosing
+// directory if path is empty. Paths in the manifest are relative to its
+// directory, unless baseDir is given. The path may also be "-" for stdin, or
+// an HTTP(S) URL, in which case relative paths need baseDir.
+func loadManifest(path string, baseDir string) (string, *manifest2.Manifest, error) {
+	if path == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", nil, err
+		}
+
+		path, err = findManifest(cwd)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	var manifest *manifest2.Manifest
+	var err error
+
+	if path == stdinPath || isManifestURL(path) {
+		manifest, err = readManifest(path)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "read manifest %s", path)
+		}
+
+		manifest.BaseDirRequired = true
+	} else {
+		manifest, err = manifest2.ReadFromFile(path)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	if baseDir != "" {
+		manifest.BaseDir = baseDir
+	}
+
+	return path, manifest, nil
+}
+
+// manifestClient fetches manifests given by URL.
+var manifestClient = &http.Client{Timeout: 30 * time.Second}
+
+func isManifestURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// readManifest reads a manifest from stdin, or fetches it from a URL.
+func readManifest(path string) (*manifest2.Manifest, error) {
+	if path == stdinPath {
+		return manifest2.Read(os.Stdin)
+	}
+
+	resp, err := manifestClient.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return manifest2.Read(resp.Body)
 }
 
 func findManifest(startdir string) (result string, err error) {
@@ -129,3 +729,87 @@ func fileExists(path string) (ok bool, err error) {
 
 	return true, nil
 }
+
+// pickDeployment asks for the tenant to deploy for, unless given, and then for
+// one of its enabled stacks or all of them, unless given.
+func pickDeployment(
+	manifest *manifest2.Manifest,
+	deployOpts *DeployOptions,
+	w io.Writer,
+	choose func(w io.Writer, text string, choices []string) (int, bool),
+) error {
+	if deployOpts.Tenant == "" {
+		var tenants []string
+		for _, tenant := range manifest.Tenants {
+			tenants = append(tenants, tenant.Label)
+		}
+
+		if len(tenants) == 0 {
+			return errors.New("no tenants in manifest")
+		}
+
+		i, ok := choose(w, "Tenant to deploy for:", tenants)
+		if !ok {
+			return cftool.ErrAbortedByUser
+		}
+
+		deployOpts.Tenant = tenants[i]
+	}
+
+	if len(deployOpts.Stacks) > 0 || deployOpts.All {
+		return nil
+	}
+
+	var stacks []string
+	for _, stack := range manifest.StackLabels(deployOpts.Tenant) {
+		enabled, err := manifest.IsStackEnabled(deployOpts.Tenant, stack)
+		if err != nil {
+			return err
+		}
+
+		if enabled {
+			stacks = append(stacks, stack)
+		}
+	}
+
+	if len(stacks) == 0 {
+		return errors.Errorf("no stacks to deploy for tenant %s", deployOpts.Tenant)
+	}
+
+	i, ok := choose(w, fmt.Sprintf("Stack to deploy for %s:", deployOpts.Tenant), append([]string{"all"}, stacks...))
+	if !ok {
+		return cftool.ErrAbortedByUser
+	} else if i > 0 {
+		deployOpts.Stacks = []string{stacks[i-1]}
+	} else {
+		deployOpts.All = true
+	}
+
+	return nil
+}
+
+// dumpPath is the file to write the change set of a stack to with
+// --dump-changeset: the path given, or STACK.ACCOUNT.REGION.json in it if it
+// is a directory, so that the same stack in several regions or accounts gets
+// a file for each.
+func dumpPath(path string, region string, accountId string, stackName string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, fmt.Sprintf("%s.%s.%s.json", stackName, accountId, region))
+	}
+
+	return path
+}
+
+// checkDumpPath refuses to write several change sets to the same file with
+// --dump-changeset.
+func checkDumpPath(path string, changeSets int) error {
+	if path == "" || changeSets < 2 {
+		return nil
+	}
+
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return errors.Errorf("--dump-changeset %s must be an existing directory for %d change sets", path, changeSets)
+	}
+
+	return nil
+}
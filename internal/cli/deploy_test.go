@@ -1,8 +1,17 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
+	manifest2 "github.com/tetratom/cftool/pkg/manifest"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -37,3 +46,367 @@ func TestFindManifest(t *testing.T) {
 		require.Equal(t, manifestPath, result)
 	})
 }
+
+func TestLoadManifest_NotFromFile(t *testing.T) {
+	manifest := `
+Version: "1.1"
+Tenants:
+  - Label: test
+Stacks:
+  - Label: mystack
+    Default:
+      Template: templates/mystack.yml
+      StackName: mystack
+    Targets:
+      - Tenant: test
+`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.cftool.yml" {
+			http.NotFound(w, r)
+			return
+		}
+
+		io.WriteString(w, manifest)
+	}))
+	defer server.Close()
+
+	// Without a directory of its own, relative paths need a base directory.
+	path, m, err := loadManifest(server.URL+"/.cftool.yml", "")
+	require.NoError(t, err)
+	require.Equal(t, server.URL+"/.cftool.yml", path)
+	_, _, err = m.FindDeployment("test", "mystack")
+	require.EqualError(t, err, "cannot resolve relative path templates/mystack.yml: the manifest was not read from a file, and no base directory was given")
+
+	_, m, err = loadManifest(server.URL+"/.cftool.yml", "../../pkg/manifest/testdata")
+	require.NoError(t, err)
+	_, _, err = m.FindDeployment("test", "mystack")
+	require.NoError(t, err)
+
+	_, _, err = loadManifest(server.URL+"/missing.yml", "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "404 Not Found")
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	go func() {
+		io.WriteString(w, manifest)
+		w.Close()
+	}()
+
+	_, m, err = loadManifest(stdinPath, "")
+	require.NoError(t, err)
+	require.True(t, m.BaseDirRequired)
+}
+
+func TestCheckRegions(t *testing.T) {
+	manifest := &manifest2.Manifest{}
+	manifest.Global.AllowedRegions = []string{"eu-west-1"}
+	awsOpts := &AWSOptions{Offline: true}
+	deployments := []*cftool.Deployment{
+		{StackLabel: "network", Region: "eu-west-1"},
+		{StackLabel: "database", Region: "us-east-2"},
+	}
+
+	err := checkRegions(awsOpts, manifest, deployments, false, ioutil.Discard)
+	require.EqualError(t, err, "stack database: region us-east-2 is not in AllowedRegions (eu-west-1); use --force to deploy anyway")
+
+	require.NoError(t, checkRegions(awsOpts, manifest, deployments, true, ioutil.Discard))
+	require.NoError(t, checkRegions(awsOpts, manifest, deployments[:1], false, ioutil.Discard))
+}
+
+func TestSelectProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+[profile prod]
+role_arn = arn:aws:iam::222222222222:role/deploy
+source_profile = default
+`), 0600))
+
+	for _, key := range []string{"AWS_CONFIG_FILE", "AWS_PROFILE", "AWS_ACCESS_KEY_ID", "AWS_SESSION_TOKEN"} {
+		defer os.Setenv(key, os.Getenv(key))
+		require.NoError(t, os.Unsetenv(key))
+	}
+
+	require.NoError(t, os.Setenv("AWS_CONFIG_FILE", configPath))
+	deployments := []*cftool.Deployment{{StackName: "app", AccountId: "222222222222"}}
+
+	awsOpts := &AWSOptions{}
+	require.NoError(t, selectProfile(awsOpts, deployments))
+	require.Equal(t, "prod", awsOpts.Profile)
+
+	awsOpts = &AWSOptions{Profile: "other"}
+	require.NoError(t, selectProfile(awsOpts, deployments))
+	require.Equal(t, "other", awsOpts.Profile)
+
+	// Credentials in the environment, e.g. in CI, are used as they are.
+	require.NoError(t, os.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE"))
+	awsOpts = &AWSOptions{}
+	require.NoError(t, selectProfile(awsOpts, deployments))
+	require.Equal(t, "", awsOpts.Profile)
+
+	require.NoError(t, os.Unsetenv("AWS_ACCESS_KEY_ID"))
+	require.NoError(t, os.Setenv("AWS_SESSION_TOKEN", "token"))
+	require.NoError(t, selectProfile(awsOpts, deployments))
+	require.Equal(t, "", awsOpts.Profile)
+}
+
+func TestDeploy_NoStack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	manifestPath := filepath.Join(dir, ".cftool.yml")
+	require.NoError(t, ioutil.WriteFile(manifestPath, []byte(`
+Version: "1.1"
+Tenants:
+  - Label: live
+Stacks:
+  - Label: queue
+    Default:
+      Template: queue.yml
+      StackName: live-queue
+    Targets:
+      - Tenant: live
+`), 0600))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "queue.yml"), []byte("Resources: {Queue: {Type: AWS::SQS::Queue}}\n"), 0600))
+
+	globalOpts := GlobalOptions{AWS: AWSOptions{Offline: true, Region: "eu-west-1"}}
+	deployOpts := DeployOptions{ManifestFile: manifestPath, Tenant: "live", DryRun: true}
+	err = Deploy(context.Background(), globalOpts, deployOpts)
+	require.EqualError(t, err, "no stack given: pass -s STACK, or --all to deploy all stacks of the tenant")
+
+	// A misspelt stack isn't taken for one that isn't enabled.
+	deployOpts.Stacks = []string{"queeu"}
+	err = Deploy(context.Background(), globalOpts, deployOpts)
+	require.EqualError(t, err, "no stack queeu in the manifest")
+
+	deployOpts.Stacks = nil
+	deployOpts.All = true
+	require.NoError(t, Deploy(context.Background(), globalOpts, deployOpts))
+}
+
+func TestPickDeployment(t *testing.T) {
+	manifest := &manifest2.Manifest{
+		Tenants: []*manifest2.Tenant{{Label: "dev"}, {Label: "prod"}},
+		Stacks: []*manifest2.Stack{
+			{Label: "network", Targets: []*manifest2.Target{{Tenant: "dev"}, {Tenant: "prod"}}},
+			{Label: "debug", Targets: []*manifest2.Target{{Tenant: "prod"}}, DisabledFor: []string{"prod"}},
+			{Label: "database", Targets: []*manifest2.Target{{Tenant: "prod"}}},
+		},
+	}
+
+	var asked [][]string
+	answers := []int{1, 2}
+	choose := func(w io.Writer, text string, choices []string) (int, bool) {
+		asked = append(asked, choices)
+		if len(answers) == 0 {
+			return 0, false
+		}
+
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, true
+	}
+
+	opts := DeployOptions{}
+	require.NoError(t, pickDeployment(manifest, &opts, ioutil.Discard, choose))
+	require.Equal(t, "prod", opts.Tenant)
+	require.Equal(t, []string{"database"}, opts.Stacks)
+	require.Equal(t, [][]string{{"dev", "prod"}, {"all", "network", "database"}}, asked)
+
+	// Choosing all leaves the stacks empty, and a given tenant isn't asked for.
+	answers = []int{0}
+	opts = DeployOptions{Tenant: "dev"}
+	require.NoError(t, pickDeployment(manifest, &opts, ioutil.Discard, choose))
+	require.Empty(t, opts.Stacks)
+	require.True(t, opts.All)
+
+	opts = DeployOptions{}
+	require.Equal(t, cftool.ErrAbortedByUser, pickDeployment(manifest, &opts, ioutil.Discard, choose))
+}
+
+func TestDumpPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "changeset.json")
+	require.Equal(t, file, dumpPath(file, "eu-west-1", "111111111111", "mystack"))
+	require.Equal(t, filepath.Join(dir, "mystack.111111111111.eu-west-1.json"), dumpPath(dir, "eu-west-1", "111111111111", "mystack"))
+
+	require.NoError(t, checkDumpPath("", 2))
+	require.NoError(t, checkDumpPath(file, 1))
+	require.NoError(t, checkDumpPath(dir, 2))
+	require.EqualError(t, checkDumpPath(file, 2), "--dump-changeset "+file+" must be an existing directory for 2 change sets")
+}
+
+func TestDeploy_ProtectedWithYes(t *testing.T) {
+	api := internal.NewOfflineCloudFormation("eu-west-1")
+	unattended := cftool.Options{Yes: true, Unattended: true}
+	deploy := func(protected bool, resource string, opts cftool.Options) (string, error) {
+		w := &bytes.Buffer{}
+		_, err := cftool.Deploy(context.Background(), api, &cftool.Deployment{
+			StackName:    "app",
+			Protected:    protected,
+			TemplateBody: []byte("Resources:\n  " + resource + ": {Type: AWS::SQS::Queue}\n"),
+		}, opts, w)
+
+		return w.String(), err
+	}
+
+	_, err := deploy(false, "Queue", unattended)
+	require.NoError(t, err)
+
+	// --yes executes change sets of stacks that aren't protected, but not of
+	// protected ones, even where nobody could type the stack name.
+	out, err := deploy(true, "Other", unattended)
+	require.Equal(t, cftool.ErrProtected, errors.Cause(err))
+	require.Contains(t, out, "+ AWS::SQS::Queue Other")
+	require.Equal(t, ExitAborted, ExitCode(err))
+
+	body, err := deployedTemplate(api, "app", false)
+	require.NoError(t, err)
+	require.Contains(t, body, "Queue:")
+
+	// Without --yes, it is refused all the same.
+	_, err = deploy(true, "Other", cftool.Options{Unattended: true})
+	require.Equal(t, cftool.ErrProtected, errors.Cause(err))
+
+	// --i-understand is the explicit way to execute it unattended.
+	out, err = deploy(true, "Other", cftool.Options{Yes: true, Unattended: true, IUnderstand: true})
+	require.NoError(t, err)
+	require.Contains(t, out, "executing change set for protected stack app")
+
+	body, err = deployedTemplate(api, "app", false)
+	require.NoError(t, err)
+	require.Contains(t, body, "Other:")
+}
+
+func TestDeploy_offlineEachAccount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The role of the second account is in another account by mistake.
+	manifestPath := filepath.Join(dir, ".cftool.yml")
+	require.NoError(t, ioutil.WriteFile(manifestPath, []byte(`
+Version: "1.1"
+Tenants:
+  - Label: live
+Accounts:
+  - Id: "111111111111"
+    Label: staging
+    RoleArn: arn:aws:iam::111111111111:role/deploy
+  - Id: "222222222222"
+    Label: prod
+    RoleArn: arn:aws:iam::333333333333:role/deploy
+Stacks:
+  - Label: queue
+    Default:
+      Template: queue.yml
+      StackName: live-queue
+    Targets:
+      - Tenant: live
+`), 0600))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "queue.yml"), []byte("Resources: {Queue: {Type: AWS::SQS::Queue}}\n"), 0600))
+
+	// Nobody is there to answer prompts.
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	globalOpts := GlobalOptions{AWS: AWSOptions{Offline: true, Region: "eu-west-1"}}
+	staging, err := globalOpts.AWS.ForRole("arn:aws:iam::111111111111:role/deploy").CloudFormationClient("")
+	require.NoError(t, err)
+	prod, err := globalOpts.AWS.ForRole("arn:aws:iam::333333333333:role/deploy").CloudFormationClient("")
+	require.NoError(t, err)
+
+	statePath := filepath.Join(dir, "state.json")
+	deployOpts := DeployOptions{
+		ManifestFile: manifestPath,
+		Tenant:       "live",
+		Stacks:       []string{"queue"},
+		EachAccount:  true,
+		Yes:          true,
+		KeepGoing:    true,
+		StateFile:    statePath,
+	}
+
+	err = Deploy(context.Background(), globalOpts, deployOpts)
+	require.EqualError(t, err, "1 of 2 deployments failed: tenant account mismatch (expected 222222222222). Has the correct profile been selected?")
+
+	// Each account is deployed to with the clients of its role, which are
+	// created once.
+	body, err := deployedTemplate(staging, "live-queue", false)
+	require.NoError(t, err)
+	require.Contains(t, body, "Queue:")
+
+	_, err = deployedTemplate(prod, "live-queue", false)
+	require.Error(t, err)
+
+	state, err := readDeployState(statePath)
+	require.NoError(t, err)
+	require.True(t, state.EachAccount)
+	require.Equal(t, []failedStack{{Stack: "queue", Account: "222222222222"}}, state.Failed)
+}
+
+func TestDeploy_offlineEachAccountDumpChangeSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	manifestPath := filepath.Join(dir, ".cftool.yml")
+	require.NoError(t, ioutil.WriteFile(manifestPath, []byte(`
+Version: "1.1"
+Tenants:
+  - Label: live
+Accounts:
+  - Id: "111111111111"
+    RoleArn: arn:aws:iam::111111111111:role/deploy
+  - Id: "222222222222"
+    RoleArn: arn:aws:iam::222222222222:role/deploy
+Stacks:
+  - Label: queue
+    Default:
+      Template: queue.yml
+      StackName: live-queue
+    Targets:
+      - Tenant: live
+`), 0600))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "queue.yml"), []byte("Resources: {Queue: {Type: AWS::SQS::Queue}}\n"), 0600))
+
+	dumpDir := filepath.Join(dir, "plan")
+	require.NoError(t, os.Mkdir(dumpDir, 0700))
+
+	globalOpts := GlobalOptions{AWS: AWSOptions{Offline: true, Region: "eu-west-1"}}
+	deployOpts := DeployOptions{
+		ManifestFile:  manifestPath,
+		Tenant:        "live",
+		Stacks:        []string{"queue"},
+		EachAccount:   true,
+		DryRun:        true,
+		DumpChangeSet: dumpDir,
+	}
+	require.NoError(t, Deploy(context.Background(), globalOpts, deployOpts))
+
+	// The change set of each account has a file of its own.
+	for _, account := range []string{"111111111111", "222222222222"} {
+		_, err := os.Stat(filepath.Join(dumpDir, "live-queue."+account+".eu-west-1.json"))
+		require.NoError(t, err, account)
+	}
+}
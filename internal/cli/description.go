@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// changeSetDescription is the description given with --description, or else
+// one that says who created the change set, from which git commit of the
+// template files, and when, e.g. "cftool by arn:aws:sts::1:assumed-role/ci/x
+// at 2019-08-01T12:00:00Z, git 1a2b3c4".
+func changeSetDescription(description string, caller string, files []string) string {
+	if description != "" {
+		return description
+	}
+
+	description = fmt.Sprintf("cftool by %s at %s", caller, time.Now().UTC().Format(time.RFC3339))
+
+	if len(files) > 0 {
+		if revision := gitRevision(filepath.Dir(files[0])); revision != "" {
+			description += ", git " + revision
+		}
+	}
+
+	return description
+}
+
+// gitRevision is the abbreviated commit checked out in the git repository
+// that contains dir, with "-dirty" added if there are uncommitted changes.
+// It is empty if dir isn't in a repository, or git isn't installed.
+func gitRevision(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+
+	revision := strings.TrimSpace(string(out))
+
+	status, err := exec.Command("git", "-C", dir, "status", "--porcelain", "--untracked-files=no").Output()
+	if err == nil && len(bytes.TrimSpace(status)) > 0 {
+		revision += "-dirty"
+	}
+
+	return revision
+}
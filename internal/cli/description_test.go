@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestChangeSetDescription(t *testing.T) {
+	require.Equal(t, "CHG-1234", changeSetDescription("CHG-1234", "arn:caller", nil))
+
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	template := filepath.Join(dir, "template.yml")
+	require.NoError(t, ioutil.WriteFile(template, []byte("Resources: {}\n"), 0600))
+
+	// Outside a repository, there is no commit to name.
+	description := changeSetDescription("", "arn:caller", []string{template})
+	require.Regexp(t, `^cftool by arn:caller at \d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ$`, description)
+
+	git := func(args ...string) {
+		args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	git("init", "-q")
+	git("add", "template.yml")
+	git("commit", "-q", "-m", "template")
+
+	description = changeSetDescription("", "arn:caller", []string{template})
+	require.Regexp(t, `^cftool by arn:caller at \S+, git [0-9a-f]{7,}$`, description)
+
+	require.NoError(t, ioutil.WriteFile(template, []byte("Resources: {Queue: {Type: AWS::SQS::Queue}}\n"), 0600))
+	description = changeSetDescription("", "arn:caller", []string{template})
+	require.Regexp(t, `, git [0-9a-f]{7,}-dirty$`, description)
+
+	// The description ends up on the change set.
+	api := internal.NewOfflineCloudFormation("eu-west-1")
+	deployer, err := cftool.Deploy(context.Background(), api, &cftool.Deployment{
+		StackName:    "app",
+		TemplateBody: []byte("Resources: {Queue: {Type: AWS::SQS::Queue}}\n"),
+	}, cftool.Options{NoExecute: true, Description: "CHG-1234"}, ioutil.Discard)
+	require.NoError(t, err)
+
+	chset, err := api.DescribeChangeSetWithContext(context.Background(), &cf.DescribeChangeSetInput{
+		StackName:     aws.String("app"),
+		ChangeSetName: aws.String(deployer.ChangeSetName),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "CHG-1234", aws.StringValue(chset.Description))
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"path/filepath"
+	"sort"
+)
+
+// Diff shows the difference between the deployed template of a stack from the
+// manifest, and its template on disk or another local template file. With
+// --watch, the diff is shown again whenever one of the files changes.
+func Diff(c context.Context, globalOpts GlobalOptions, diffOpts DiffOptions) error {
+	if diffOpts.Watch && diffOpts.ManifestFile == stdinPath {
+		return errors.New("--watch cannot read the manifest from stdin again")
+	}
+
+	files, err := diff(c, &globalOpts, diffOpts)
+	files = mergeFiles(files, nil)
+	if !diffOpts.Watch || len(files) == 0 {
+		return err
+	}
+
+	for {
+		if err != nil {
+			pprint.Errorf(color.Output, "%v", err)
+		}
+
+		fmt.Fprintf(color.Output, "\nWatching %d files for changes. Press Ctrl-C to stop.\n", len(files))
+		if err := waitForChange(c, files, watchInterval); err != nil {
+			return err
+		}
+
+		if globalOpts.Interactive() {
+			// Clear the screen, so that only the current diff is shown.
+			fmt.Fprintf(color.Output, "\033[H\033[2J")
+		} else {
+			fmt.Fprintf(color.Output, "\n")
+		}
+
+		var changed []string
+		changed, err = diff(c, &globalOpts, diffOpts)
+
+		// Keep watching files that couldn't be read this time, so that
+		// fixing them triggers the next diff.
+		files = mergeFiles(files, changed)
+	}
+}
+
+// diff shows the diff once, and returns the local files it was made from.
+func diff(c context.Context, globalOpts *GlobalOptions, diffOpts DiffOptions) ([]string, error) {
+	path, manifest, err := loadManifest(diffOpts.ManifestFile, diffOpts.BaseDir)
+
+	// A manifest from stdin or a URL is not watched.
+	var files []string
+	if path != stdinPath && !isManifestURL(path) {
+		files = append(files, path)
+	}
+
+	if err != nil {
+		return files, err
+	}
+
+	deployment, ok, err := manifest.FindDeployment(diffOpts.Tenant, diffOpts.Stack)
+	if err != nil {
+		return files, err
+	} else if !ok {
+		return files, errors.Errorf("no deployment of stack %s for tenant %s", diffOpts.Stack, diffOpts.Tenant)
+	}
+
+	files = append(files, deployment.Files...)
+
+	if cftool.IsTemplateURL(diffOpts.TemplateFile) {
+		_, deployment.TemplateBody, err = resolveTemplateURL(c, &globalOpts.AWS, diffOpts.TemplateFile, true)
+		if err != nil {
+			return files, errors.Wrapf(err, "read template: %s", diffOpts.TemplateFile)
+		}
+	} else if diffOpts.TemplateFile != "" {
+		files = append(files, diffOpts.TemplateFile)
+		deployment.TemplateBody, err = readTemplate(diffOpts.TemplateFile)
+		if err != nil {
+			return files, errors.Wrapf(err, "read template: %s", diffOpts.TemplateFile)
+		}
+	}
+
+	if diffOpts.ResolveIncludes {
+		// A template from S3 can only include partials by absolute path or
+		// S3 URL.
+		dir := filepath.Dir(deployment.Files[0])
+		if cftool.IsTemplateURL(diffOpts.TemplateFile) {
+			dir = ""
+		} else if diffOpts.TemplateFile != "" {
+			dir = filepath.Dir(diffOpts.TemplateFile)
+		}
+
+		n := len(deployment.Files)
+		if err := resolveIncludes(c, &globalOpts.AWS, deployment, dir); err != nil {
+			return files, err
+		}
+
+		files = append(files, deployment.Files[n:]...)
+	}
+
+	api, err := globalOpts.AWS.CloudFormationClient(deployment.Region)
+	if err != nil {
+		return files, err
+	}
+
+	deployer := cftool.NewDeployer(api, deployment)
+	deployer.DiffMode = globalOpts.DiffMode
+	deployer.IgnoreWhitespace = globalOpts.IgnoreWhitespace
+	deployer.SemanticDiff = globalOpts.SemanticDiff
+	deployer.Interactive = globalOpts.Interactive()
+	pprint.Field(color.Output, "StackName", deployment.StackName)
+
+	return files, deployer.TemplateDiff(color.Output)
+}
+
+// mergeFiles returns the files in either list, sorted and without duplicates.
+func mergeFiles(a []string, b []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+
+	for _, path := range append(append([]string{}, a...), b...) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			result = append(result, path)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	manifest2 "github.com/tetratom/cftool/pkg/manifest"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"sort"
+)
+
+// DiffTenants compares how the manifest resolves for two tenants: their
+// constants and tags, and the parameters of each stack. It doesn't call AWS.
+func DiffTenants(c context.Context, globalOpts GlobalOptions, diffOpts DiffTenantsOptions) error {
+	_, manifest, err := loadManifest(diffOpts.ManifestFile, diffOpts.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	return diffTenants(color.Output, manifest, diffOpts)
+}
+
+func diffTenants(w io.Writer, manifest *manifest2.Manifest, diffOpts DiffTenantsOptions) error {
+	a, b := diffOpts.TenantA, diffOpts.TenantB
+	for _, tenant := range []string{a, b} {
+		if !hasTenant(manifest, tenant) {
+			return errors.Errorf("no tenant %s in the manifest", tenant)
+		}
+	}
+
+	stacks := diffOpts.Stacks
+	if len(stacks) == 0 {
+		stacks = tenantsStackLabels(manifest, a, b)
+	}
+
+	type pair struct{ a, b *cftool.Deployment }
+	pairs := make([]pair, len(stacks))
+	var common *pair
+
+	for i, stack := range stacks {
+		var err error
+		if pairs[i].a, err = enabledDeployment(manifest, a, stack); err != nil {
+			return err
+		}
+
+		if pairs[i].b, err = enabledDeployment(manifest, b, stack); err != nil {
+			return err
+		}
+
+		if pairs[i].a == nil && pairs[i].b == nil {
+			return errors.Errorf("stack %s is deployed for neither %s nor %s", stack, a, b)
+		}
+
+		if common == nil && pairs[i].a != nil && pairs[i].b != nil {
+			common = &pairs[i]
+		}
+	}
+
+	// Constants and tags are the same for all stacks of a tenant, so any stack
+	// both have will do.
+	if common != nil {
+		pprint.Header(w, "Tenants %s and %s", a, b)
+		if err := diffLines(w, tenantLines(common.a), tenantLines(common.b)); err != nil {
+			return err
+		}
+	}
+
+	for i, stack := range stacks {
+		pprint.Header(w, "Stack %s", stack)
+
+		switch {
+		case pairs[i].a == nil:
+			fmt.Fprintf(w, "Only deployed for tenant %s.\n", b)
+		case pairs[i].b == nil:
+			fmt.Fprintf(w, "Only deployed for tenant %s.\n", a)
+		default:
+			err := diffLines(w,
+				stackLines(pairs[i].a, diffOpts.StackNames),
+				stackLines(pairs[i].b, diffOpts.StackNames))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func hasTenant(manifest *manifest2.Manifest, label string) bool {
+	for _, tenant := range manifest.Tenants {
+		if tenant.Label == label {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tenantsStackLabels lists the stacks with a target for either tenant, in the
+// order they appear in the manifest.
+func tenantsStackLabels(manifest *manifest2.Manifest, a string, b string) []string {
+	targeted := make(map[string]bool)
+	for _, label := range append(manifest.StackLabels(a), manifest.StackLabels(b)...) {
+		targeted[label] = true
+	}
+
+	var result []string
+	for _, stack := range manifest.Stacks {
+		if targeted[stack.Label] {
+			result = append(result, stack.Label)
+		}
+	}
+
+	return result
+}
+
+// enabledDeployment resolves the deployment of the stack for the tenant, or
+// returns nil if the stack isn't deployed for it.
+func enabledDeployment(manifest *manifest2.Manifest, tenant string, stack string) (*cftool.Deployment, error) {
+	enabled, err := manifest.IsStackEnabled(tenant, stack)
+	if err != nil {
+		return nil, err
+	} else if !enabled {
+		return nil, nil
+	}
+
+	deployment, ok, err := manifest.FindDeployment(tenant, stack)
+	if err != nil {
+		return nil, errors.Wrapf(err, "stack %s for tenant %s", stack, tenant)
+	} else if !ok {
+		return nil, nil
+	}
+
+	return deployment, nil
+}
+
+func tenantLines(d *cftool.Deployment) []string {
+	return append(mapLines("Constants", d.Constants), mapLines("Tags", d.Tags)...)
+}
+
+func stackLines(d *cftool.Deployment, stackName bool) []string {
+	var lines []string
+	if stackName {
+		lines = append(lines, fmt.Sprintf("StackName: %s\n", d.StackName))
+	}
+
+	return append(lines, mapLines("Parameters", d.Parameters)...)
+}
+
+// mapLines prints a map as lines of the form "Prefix.Key: Value", sorted by
+// key, so that each differing value shows up as a changed line of its own.
+func mapLines(prefix string, m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	lines := make([]string, len(keys))
+	for i, key := range keys {
+		lines[i] = fmt.Sprintf("%s.%s: %s\n", prefix, key, m[key])
+	}
+
+	return lines
+}
+
+func diffLines(w io.Writer, a []string, b []string) error {
+	if equalStrings(a, b) {
+		fmt.Fprintf(w, "No differences.\n")
+		return nil
+	}
+
+	return errors.Wrap(pprint.UnifiedDiff(w, a, b), "unified diff")
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"github.com/stretchr/testify/require"
+	manifest2 "github.com/tetratom/cftool/pkg/manifest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffTenants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	manifestPath := filepath.Join(dir, ".cftool.yml")
+	require.NoError(t, ioutil.WriteFile(manifestPath, []byte(`
+Version: "1.1"
+Tenants:
+  - Label: live
+    Constants:
+      Size: large
+    Tags:
+      Env: live
+  - Label: test
+    Constants:
+      Size: large
+    Tags:
+      Env: tset
+Stacks:
+  - Label: queue
+    Default:
+      Template: queue.yml
+      StackName: "{{.TenantLabel}}-queue"
+      Parameters:
+        - Key: Name
+          Value: "{{.TenantLabel}}"
+        - Key: Size
+          Value: "{{.Constants.Size}}"
+    Targets:
+      - Tenant: live
+      - Tenant: test
+  - Label: monitoring
+    EnabledFor: [live]
+    Default:
+      Template: queue.yml
+      StackName: "{{.TenantLabel}}-monitoring"
+    Targets:
+      - Tenant: live
+      - Tenant: test
+`), 0600))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "queue.yml"), []byte("Resources: {Queue: {Type: AWS::SQS::Queue}}\n"), 0600))
+
+	manifest, err := manifest2.ReadFromFile(manifestPath)
+	require.NoError(t, err)
+
+	w := &strings.Builder{}
+	require.NoError(t, diffTenants(w, manifest, DiffTenantsOptions{TenantA: "live", TenantB: "test", StackNames: true}))
+	require.Equal(t, ""+
+		"== Tenants live and test ==\n"+
+		"@@ -2 +2 @@\n"+
+		"-Tags.Env: live\n"+
+		"+Tags.Env: tset\n"+
+		"== Stack queue ==\n"+
+		"@@ -1,2 +1,2 @@\n"+
+		"-StackName: live-queue\n"+
+		"-Parameters.Name: live\n"+
+		"+StackName: test-queue\n"+
+		"+Parameters.Name: test\n"+
+		"== Stack monitoring ==\n"+
+		"Only deployed for tenant live.\n",
+		w.String())
+
+	w.Reset()
+	require.NoError(t, diffTenants(w, manifest, DiffTenantsOptions{TenantA: "live", TenantB: "live", Stacks: []string{"queue"}}))
+	require.Equal(t, "== Tenants live and live ==\nNo differences.\n== Stack queue ==\nNo differences.\n", w.String())
+
+	err = diffTenants(w, manifest, DiffTenantsOptions{TenantA: "live", TenantB: "prod"})
+	require.EqualError(t, err, "no tenant prod in the manifest")
+}
@@ -6,22 +6,86 @@ import (
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
-	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
 	"github.com/tetratom/cftool/pkg/pprint"
 	"os"
 	"runtime"
 	"runtime/debug"
+	"strings"
 )
 
 var gitVersion string
 
+// Exit codes returned by ExitCode. These are stable, so that pipelines can
+// branch on them.
+const (
+	ExitOK          = 0
+	ExitError       = 1
+	ExitChanges     = 2
+	ExitAborted     = 3
+	ExitStackFailed = 4
+)
+
+// ExitCode maps an error returned by Entry to the process exit code.
+func ExitCode(err error) int {
+	switch errors.Cause(err) {
+	case nil:
+		return ExitOK
+	case cftool.ErrChangesPending:
+		return ExitChanges
+	case cftool.ErrAbortedByUser, cftool.ErrNoConfirmation, cftool.ErrProtected, cftool.ErrConfirmationRequired, cftool.ErrInterrupted:
+		return ExitAborted
+	case cftool.ErrStackFailed:
+		return ExitStackFailed
+	default:
+		return ExitError
+	}
+}
+
+// checkSingleRegion refuses a repeated --region for the commands that work in
+// one region, which would otherwise use the first and ignore the others. Only
+// deploy and update go through several regions in turn.
+func checkSingleRegion(subcommand string, regions []string) error {
+	if len(regions) < 2 || subcommand == "deploy" || subcommand == "update" {
+		return nil
+	}
+
+	return errors.Errorf(
+		"%s works in a single region, but --region was given %d times (%s)",
+		subcommand, len(regions), strings.Join(regions, ", "))
+}
+
 func Entry(c context.Context, args []string) error {
 	options := ParseGlobalOptions(args)
 
+	if err := pprint.SetTheme(os.Getenv(pprint.ThemeEnv)); err != nil {
+		pprint.Warningf(color.Output, "%s: %v; using the default colors", pprint.ThemeEnv, err)
+	}
+
 	if !options.Color {
 		pprint.DisableColor()
 	}
 
+	if options.LogFormat == "json" {
+		options.Log = cftool.NewJSONLogger(os.Stderr)
+	}
+
+	if options.EventLogPath != "" {
+		f, err := os.OpenFile(options.EventLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return errors.Wrap(err, "--event-log")
+		}
+
+		defer f.Close()
+		options.EventLog = cftool.NewJSONLogger(f)
+	}
+
+	if options.APIRate < 0 {
+		return errors.New("--api-rate must not be negative")
+	}
+
+	options.RateLimiter = cftool.NewRateLimiter(options.APIRate)
+
 	if options.Version {
 		fmt.Fprintf(
 			color.Output,
@@ -32,27 +96,81 @@ func Entry(c context.Context, args []string) error {
 
 	if len(options.remainingArgs) < 1 {
 		flag.Usage()
-		fmt.Fprintf(color.Output, "\nExpected subcommand: deploy, update\n")
+		fmt.Fprintf(color.Output, "\nExpected subcommand: deploy, update, wait, delete, continue-rollback, resources, get-template, compare-regions, render, diff, params-diff, export-params, diff-tenants, schema, whoami\n")
 		os.Exit(1) // TODO: Return error instead?
 	}
 
+	subcommand := options.remainingArgs[0]
+	if err := checkSingleRegion(subcommand, options.Regions); err != nil {
+		return err
+	}
+
 	var err error
-	switch subcommand := options.remainingArgs[0]; subcommand {
+	switch subcommand {
 	case "deploy":
 		err = Deploy(c, options, ParseDeployOptions(options.remainingArgs))
 	case "update":
 		err = Update(c, options, ParseUpdateOptions(options.remainingArgs))
+	case "wait":
+		err = Wait(c, options, ParseWaitOptions(options.remainingArgs))
+	case "delete":
+		err = Delete(c, options, ParseDeleteOptions(options.remainingArgs))
+	case "continue-rollback":
+		err = ContinueRollback(c, options, ParseContinueRollbackOptions(options.remainingArgs))
+	case "resources":
+		err = Resources(c, options, ParseResourcesOptions(options.remainingArgs))
+	case "get-template":
+		err = GetTemplate(c, options, ParseGetTemplateOptions(options.remainingArgs))
+	case "compare-regions":
+		err = CompareRegions(c, options, ParseCompareRegionsOptions(options.remainingArgs))
+	case "render":
+		err = Render(c, options, ParseRenderOptions(options.remainingArgs))
+	case "diff":
+		err = Diff(c, options, ParseDiffOptions(options.remainingArgs))
+	case "params-diff":
+		err = ParamsDiff(c, options, ParseParamsDiffOptions(options.remainingArgs))
+	case "export-params":
+		err = ExportParams(c, options, ParseExportParamsOptions(options.remainingArgs))
+	case "diff-tenants":
+		err = DiffTenants(c, options, ParseDiffTenantsOptions(options.remainingArgs))
+	case "schema":
+		err = Schema(c, options, ParseSchemaOptions(options.remainingArgs))
+	case "whoami":
+		err = Whoami(c, options, ParseWhoamiOptions(options.remainingArgs))
 	default:
 		// todo: where to output to?
 		fmt.Fprintf(color.Output, "\nUnrecognized subcommand: %s\n", subcommand)
 	}
 
 	if err != nil {
-		if errors.Cause(err) == internal.ErrAbortedByUser {
+		if errors.Cause(err) == cftool.ErrAbortedByUser {
+			options.Log.Log(cftool.LevelWarning, "", "aborted", nil)
 			fmt.Fprintf(color.Output, "Aborted by user.\n")
-			os.Exit(1)
+			return err
+		}
+
+		if errors.Cause(err) == cftool.ErrInterrupted {
+			options.Log.Log(cftool.LevelWarning, "", "interrupted", nil)
+			return err
+		}
+
+		switch errors.Cause(err) {
+		case cftool.ErrNoConfirmation, cftool.ErrProtected, cftool.ErrConfirmationRequired:
+			options.Log.Log(cftool.LevelWarning, "", "aborted", map[string]interface{}{
+				"error": err.Error(),
+			})
+			fmt.Fprintf(color.Output, "Aborted: %v\n", err)
+			return err
+		}
+
+		if errors.Cause(err) == cftool.ErrChangesPending {
+			return err
 		}
 
+		options.Log.Log(cftool.LevelError, "", "error", map[string]interface{}{
+			"error": err.Error(),
+		})
+
 		return err
 	}
 
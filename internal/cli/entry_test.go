@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		Err    error
+		Expect int
+	}{
+		{nil, ExitOK},
+		{errors.New("oops"), ExitError},
+		{cftool.ErrChangesPending, ExitChanges},
+		{errors.Wrap(cftool.ErrAbortedByUser, "deploy stack: foo"), ExitAborted},
+		{cftool.ErrNoConfirmation, ExitAborted},
+		{errors.Wrap(cftool.ErrProtected, "deploy stack: foo"), ExitAborted},
+		{cftool.ErrConfirmationRequired, ExitAborted},
+		{errors.Wrapf(cftool.ErrStackFailed, "deploy stack: %s", "foo"), ExitStackFailed},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.Expect, ExitCode(test.Err))
+	}
+}
+
+func TestCheckSingleRegion(t *testing.T) {
+	regions := []string{"eu-west-1", "us-east-1"}
+	require.NoError(t, checkSingleRegion("deploy", regions))
+	require.NoError(t, checkSingleRegion("update", regions))
+	require.NoError(t, checkSingleRegion("delete", regions[:1]))
+
+	err := checkSingleRegion("delete", regions)
+	require.EqualError(t, err, "delete works in a single region, but --region was given 2 times (eu-west-1, us-east-1)")
+
+	// Nothing is deleted in either region.
+	err = Entry(context.Background(), []string{"cftool", "--offline", "-r", "eu-west-1", "-r", "us-east-1", "delete", "-n", "app"})
+	require.EqualError(t, err, "delete works in a single region, but --region was given 2 times (eu-west-1, us-east-1)")
+}
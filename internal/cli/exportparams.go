@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"sort"
+)
+
+// ExportParams writes the parameters the manifest resolves for a deployment as
+// a CloudFormation parameter file, for use with the AWS CLI.
+func ExportParams(c context.Context, globalOpts GlobalOptions, exportOpts ExportParamsOptions) error {
+	_, manifest, err := loadManifest(exportOpts.ManifestFile, exportOpts.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	deployment, ok, err := manifest.FindDeployment(exportOpts.Tenant, exportOpts.Stack)
+	if err != nil {
+		return err
+	} else if !ok {
+		return errors.Errorf("no deployment of %s for %s", exportOpts.Stack, exportOpts.Tenant)
+	}
+
+	if exportOpts.Preprocess {
+		if err := deployment.Preprocess(); err != nil {
+			return errors.Wrap(err, "preprocess template")
+		}
+	}
+
+	if err := cftool.RunParameterCommands(deployment.Parameters, exportOpts.AllowExec); err != nil {
+		return err
+	}
+
+	// Outputs are only looked up in AWS if a parameter refers to them.
+	if cftool.HasOutputRefs(deployment.Parameters) {
+		outputs := newStackOutputs(&globalOpts.AWS, manifest, exportOpts.Tenant, nil)
+		if err := outputs.resolve(deployment); err != nil {
+			return err
+		}
+	}
+
+	data, err := exportParameters(deployment, exportOpts.MaskNoEcho)
+	if err != nil {
+		return err
+	}
+
+	if exportOpts.Out == "" {
+		_, err := color.Output.Write(data)
+		return err
+	}
+
+	if err := ioutil.WriteFile(exportOpts.Out, data, 0600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(color.Output, "%s\n", exportOpts.Out)
+	return nil
+}
+
+// parameterFileEntry is a parameter as it appears in the parameter files of
+// the AWS CLI and of update --parameter-file.
+type parameterFileEntry struct {
+	ParameterKey   string
+	ParameterValue string
+}
+
+// exportParameters formats the parameters of the deployment as a parameter
+// file, sorted by name. Template defaults are left out, as CloudFormation
+// applies them anyway. With mask, NoEcho parameters are written as ****.
+func exportParameters(deployment *cftool.Deployment, mask bool) ([]byte, error) {
+	params, err := cftool.ParseTemplateParameters(deployment.TemplateBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range deployment.Parameters {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	entries := []parameterFileEntry{}
+	for _, name := range names {
+		value := deployment.Parameters[name]
+		if param, ok := params[name]; ok && mask && param.IsNoEcho() {
+			value = maskedParameterValue
+		}
+
+		entries = append(entries, parameterFileEntry{name, value})
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/pkg/cftool"
+	manifest2 "github.com/tetratom/cftool/pkg/manifest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportParameters(t *testing.T) {
+	deployment := &cftool.Deployment{
+		StackName: "app",
+		TemplateBody: []byte(`
+Parameters:
+  InstanceType: {Type: String, Default: t3.small}
+  Password: {Type: String, NoEcho: true}
+  Size: {Type: Number}
+Resources:
+  Queue: {Type: AWS::SQS::Queue}
+`),
+		Parameters: map[string]string{"Size": "1", "Password": "hunter2"},
+	}
+
+	data, err := exportParameters(deployment, false)
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{"ParameterKey": "Password", "ParameterValue": "hunter2"},
+		{"ParameterKey": "Size", "ParameterValue": "1"}
+	]`, string(data))
+
+	data, err = exportParameters(deployment, true)
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{"ParameterKey": "Password", "ParameterValue": "****"},
+		{"ParameterKey": "Size", "ParameterValue": "1"}
+	]`, string(data))
+
+	// The file can be read back as an update --parameter-file.
+	params, err := manifest2.ReadParameters(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"Password": "****", "Size": "1"}, params)
+}
+
+func TestExportParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	manifest := `
+Version: "1.1"
+Tenants:
+  - Label: live
+Stacks:
+  - Label: app
+    Default:
+      Template: app.yml
+      StackName: live-app
+      Parameters:
+        - Key: Size
+          Value: "!cmd: echo 3"
+        - Key: Vpc
+          Value: %s
+    Targets:
+      - Tenant: live
+`
+
+	manifestPath := filepath.Join(dir, ".cftool.yml")
+	writeManifest := func(vpc string) {
+		data := []byte(fmt.Sprintf(manifest, vpc))
+		require.NoError(t, ioutil.WriteFile(manifestPath, data, 0600))
+	}
+
+	// Dynamic references look like template actions, so the template is
+	// only preprocessed if asked to.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.yml"), []byte(`
+Parameters:
+  Size: {Type: Number}
+  Vpc: {Type: String}
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      QueueName: "{{resolve:ssm:/app/queue-name:1}}"
+`), 0600))
+
+	out := filepath.Join(dir, "params.json")
+	globalOpts := GlobalOptions{AWS: AWSOptions{Offline: true, Region: "eu-west-1"}}
+	opts := ExportParamsOptions{ManifestFile: manifestPath, Tenant: "live", Stack: "app", Out: out}
+
+	writeManifest("vpc-123")
+	err = ExportParams(context.Background(), globalOpts, opts)
+	require.EqualError(t, err, "parameter Size is a command, which requires --allow-exec: echo 3")
+
+	opts.AllowExec = true
+	require.NoError(t, ExportParams(context.Background(), globalOpts, opts))
+
+	data, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{"ParameterKey": "Size", "ParameterValue": "3"},
+		{"ParameterKey": "Vpc", "ParameterValue": "vpc-123"}
+	]`, string(data))
+
+	opts.Preprocess = true
+	err = ExportParams(context.Background(), globalOpts, opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `function "resolve" not defined`)
+
+	// Outputs are looked up rather than written as they are.
+	opts.Preprocess = false
+	writeManifest("output:network:VpcId")
+	err = ExportParams(context.Background(), globalOpts, opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "parameter Vpc: describe stack network")
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strings"
+)
+
+// GetTemplate prints the template a stack is deployed with, or writes it to a
+// file, for comparison and backup.
+func GetTemplate(c context.Context, globalOpts GlobalOptions, getOpts GetTemplateOptions) error {
+	api, err := globalOpts.AWS.CloudFormationClient("")
+	if err != nil {
+		return err
+	}
+
+	body, err := deployedTemplate(api, getOpts.StackName, getOpts.Processed)
+	if err != nil {
+		return err
+	}
+
+	if getOpts.Out == "" {
+		_, err := fmt.Fprintf(color.Output, "%s", body)
+		return err
+	}
+
+	if err := ioutil.WriteFile(getOpts.Out, []byte(body), 0644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(color.Output, "%s\n", getOpts.Out)
+	return nil
+}
+
+// deployedTemplate fetches the template of a stack as it was submitted, or
+// with processed, after transforms such as AWS::Serverless were applied. The
+// template ends in a line break, so that it can be printed as is.
+func deployedTemplate(api cloudformationiface.CloudFormationAPI, stackName string, processed bool) (string, error) {
+	stage := cf.TemplateStageOriginal
+	if processed {
+		stage = cf.TemplateStageProcessed
+	}
+
+	out, err := api.GetTemplate(&cf.GetTemplateInput{
+		StackName:     aws.String(stackName),
+		TemplateStage: aws.String(stage),
+	})
+
+	if err != nil {
+		return "", errors.Wrapf(err, "get template of stack %s", stackName)
+	}
+
+	body := aws.StringValue(out.TemplateBody)
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+
+	return body, nil
+}
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDeployedTemplate(t *testing.T) {
+	api := internal.NewOfflineCloudFormation("eu-west-1")
+	deployment := &cftool.Deployment{
+		StackName:    "app",
+		TemplateBody: []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}"),
+	}
+
+	_, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+	require.NoError(t, err)
+
+	body, err := deployedTemplate(api, "app", false)
+	require.NoError(t, err)
+	require.Equal(t, "Resources:\n  Queue: {Type: AWS::SQS::Queue}\n", body)
+
+	body, err = deployedTemplate(api, "app", true)
+	require.NoError(t, err)
+	require.Equal(t, "Resources:\n  Queue: {Type: AWS::SQS::Queue}\n", body)
+
+	_, err = deployedTemplate(api, "other", false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "get template of stack other")
+}
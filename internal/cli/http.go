@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// caBundle returns the CA bundle to trust in addition to the system's, and
+// where it was set. The AWS CLI reads the same environment variable.
+func (awsOpts *AWSOptions) caBundle() (string, string) {
+	if awsOpts.CABundle != "" {
+		return awsOpts.CABundle, "--ca-bundle"
+	}
+
+	if path := os.Getenv("AWS_CA_BUNDLE"); path != "" {
+		return path, "$AWS_CA_BUNDLE"
+	}
+
+	return "", ""
+}
+
+// httpClient returns the client to call AWS with, or nil if the SDK's default
+// will do. It goes through the proxy given with --proxy, or otherwise the one
+// in $HTTPS_PROXY, and trusts the certificates in the CA bundle.
+func (awsOpts *AWSOptions) httpClient() (*http.Client, error) {
+	bundle, _ := awsOpts.caBundle()
+	if bundle == "" && awsOpts.Proxy == "" {
+		return nil, nil
+	}
+
+	// The same settings as http.DefaultTransport.
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	if awsOpts.Proxy != "" {
+		proxy, err := url.Parse(awsOpts.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, errors.Errorf("invalid proxy url: %s", awsOpts.Proxy)
+		}
+
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if bundle != "" {
+		pool, err := loadCABundle(bundle)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// loadCABundle returns the system's certificate pool with the PEM encoded
+// certificates in the file added, so that a corporate CA doesn't need to be
+// bundled with the public ones.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read ca bundle")
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("%s: no PEM encoded certificates found", path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"encoding/pem"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAWSOptions_httpClient(t *testing.T) {
+	defer os.Setenv("AWS_CA_BUNDLE", os.Getenv("AWS_CA_BUNDLE"))
+	require.NoError(t, os.Unsetenv("AWS_CA_BUNDLE"))
+
+	client, err := (&AWSOptions{}).httpClient()
+	require.NoError(t, err)
+	require.Nil(t, client)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "cftool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(bundle, cert, 0644))
+
+	client, err = (&AWSOptions{CABundle: bundle}).httpClient()
+	require.NoError(t, err)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.NoError(t, os.Setenv("AWS_CA_BUNDLE", bundle))
+	client, err = (&AWSOptions{}).httpClient()
+	require.NoError(t, err)
+	require.NotNil(t, client)
+
+	require.NoError(t, os.Setenv("AWS_CA_BUNDLE", filepath.Join(dir, "missing.pem")))
+	_, err = (&AWSOptions{}).httpClient()
+	require.Error(t, err)
+	require.NoError(t, os.Unsetenv("AWS_CA_BUNDLE"))
+
+	client, err = (&AWSOptions{Proxy: "http://proxy.example.com:3128"}).httpClient()
+	require.NoError(t, err)
+	req, err := http.NewRequest("GET", "https://cloudformation.eu-west-1.amazonaws.com", nil)
+	require.NoError(t, err)
+	proxy, err := client.Transport.(*http.Transport).Proxy(req)
+	require.NoError(t, err)
+	require.Equal(t, "proxy.example.com:3128", proxy.Host)
+
+	_, err = (&AWSOptions{Proxy: "proxy"}).httpClient()
+	require.Error(t, err)
+}
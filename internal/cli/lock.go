@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
+)
+
+// useLock makes the deployer lock the stack in the DynamoDB table while it
+// deploys. The lock is held by the caller.
+func useLock(
+	awsOpts *AWSOptions,
+	deployer *cftool.Deployer,
+	table string,
+	force bool,
+	id *sts.GetCallerIdentityOutput,
+	region string,
+) error {
+	api, err := awsOpts.DynamoDBClient()
+	if err != nil {
+		return err
+	}
+
+	deployer.Lock = internal.NewDynamoDBLock(api, table, aws.StringValue(id.Arn))
+	deployer.LockKey = stackLockKey(region, aws.StringValue(id.Account), deployer.StackName)
+	deployer.ForceUnlock = force
+	return nil
+}
+
+// stackLockKey identifies a stack by its ARN, up to the unique suffix that
+// CloudFormation only assigns once the stack is created.
+func stackLockKey(region string, accountId string, stackName string) string {
+	return fmt.Sprintf("arn:aws:cloudformation:%s:%s:stack/%s", region, accountId, stackName)
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"github.com/tetratom/cftool/pkg/pprint"
+)
+
+// notify publishes the outcome of a deployment to the SNS topic and webhook
+// given on the command line. Failures to notify are reported, but they never
+// change the outcome of the deployment itself.
+func notify(globalOpts *GlobalOptions, deployer *cftool.Deployer, caller string, deployErr error) {
+	if errors.Cause(deployErr) == cftool.ErrAbortedByUser {
+		return
+	}
+
+	var notifiers []internal.Notifier
+
+	if globalOpts.NotifySNS != "" {
+		api, err := globalOpts.AWS.SNSClient(globalOpts.NotifySNS)
+		if err != nil {
+			notifyFailed(globalOpts, deployer.StackName, err)
+		} else {
+			notifiers = append(notifiers, internal.NewSNSNotifier(api, globalOpts.NotifySNS))
+		}
+	}
+
+	if globalOpts.NotifyWebhook != "" {
+		notifiers = append(notifiers, internal.NewWebhookNotifier(globalOpts.NotifyWebhook))
+	}
+
+	n := internal.NewNotification(deployer, caller, deployErr)
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(n); err != nil {
+			notifyFailed(globalOpts, deployer.StackName, err)
+		}
+	}
+}
+
+func notifyFailed(globalOpts *GlobalOptions, stackName string, err error) {
+	pprint.Warningf(color.Output, "notify: %v", err)
+	globalOpts.Log.Log(cftool.LevelWarning, stackName, "notify-failed", map[string]interface{}{
+		"error": err.Error(),
+	})
+}
@@ -3,37 +3,163 @@ package cli
 import (
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/fatih/color"
 	"github.com/pborman/getopt/v2"
 	"github.com/pkg/errors"
 	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"github.com/tetratom/cftool/pkg/pprint"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 )
 
 type GlobalOptions struct {
-	AWS           AWSOptions
-	Color         bool
-	Version       bool
-	remainingArgs []string
+	AWS              AWSOptions
+	Regions          []string
+	Color            bool
+	DetailedExit     bool
+	LogFormat        string
+	DiffMode         string
+	IgnoreWhitespace bool
+	SemanticDiff     bool
+	NotifySNS        string
+	NotifyWebhook    string
+	EventLogPath     string
+	Trace            bool
+	APIRate          float64
+	Version          bool
+	remainingArgs    []string
+
+	// Log is set up by Entry when --log-format is json.
+	Log *cftool.Logger
+
+	// EventLog is set up by Entry when --event-log is given.
+	EventLog *cftool.Logger
+
+	// RateLimiter is set up by Entry when --api-rate is given, and shared by
+	// all deployments, also those running in parallel.
+	RateLimiter *cftool.RateLimiter
+}
+
+// Interactive reports whether output goes to a color-capable terminal, in
+// which case progress can be redrawn in place.
+func (opts *GlobalOptions) Interactive() bool {
+	return opts.Color && !color.NoColor
+}
+
+// newTrace returns a Trace to record a deployment in with --trace, and nil
+// otherwise.
+func (opts *GlobalOptions) newTrace() *cftool.Trace {
+	if !opts.Trace {
+		return nil
+	}
+
+	return &cftool.Trace{}
 }
 
 type AWSOptions struct {
 	Profile  string
 	Region   string
 	Endpoint string
+	CABundle string
+	Proxy    string
+
+	// Offline replaces CloudFormation and STS with in-memory simulations, and
+	// makes every other AWS service unavailable.
+	Offline bool
 
 	sess *session.Session
-	cfn  cloudformationiface.CloudFormationAPI
+	cfn  map[string]cloudformationiface.CloudFormationAPI
 	sts  stsiface.STSAPI
+	sns  snsiface.SNSAPI
+	s3   s3iface.S3API
+	ddb  dynamodbiface.DynamoDBAPI
+	cw   map[string]cloudwatchiface.CloudWatchAPI
+
+	// roleArn, if set, is assumed with the credentials of parent. roles
+	// holds the options for the roles assumed from these ones.
+	roleArn string
+	parent  *AWSOptions
+	roles   map[string]*AWSOptions
 }
 
+// ForRole returns options whose clients assume the role, with the credentials
+// of these options. They are created once per role, and an empty role gives
+// these options. Offline, each role leads to a simulated account of its own,
+// the one in its ARN.
+func (awsOpts *AWSOptions) ForRole(roleArn string) *AWSOptions {
+	if roleArn == "" {
+		return awsOpts
+	}
+
+	awsMu.Lock()
+	defer awsMu.Unlock()
+
+	if awsOpts.roles == nil {
+		awsOpts.roles = make(map[string]*AWSOptions)
+	}
+
+	if _, ok := awsOpts.roles[roleArn]; !ok {
+		awsOpts.roles[roleArn] = &AWSOptions{
+			Profile:  awsOpts.Profile,
+			Region:   awsOpts.Region,
+			Endpoint: awsOpts.Endpoint,
+			CABundle: awsOpts.CABundle,
+			Proxy:    awsOpts.Proxy,
+			Offline:  awsOpts.Offline,
+			roleArn:  roleArn,
+			parent:   awsOpts,
+		}
+	}
+
+	return awsOpts.roles[roleArn]
+}
+
+// awsMu guards the sessions and clients that AWSOptions create on first use,
+// since the stacks of a batch are updated in parallel with the same options.
+var awsMu sync.Mutex
+
 func (awsOpts *AWSOptions) Session() (*session.Session, error) {
+	awsMu.Lock()
+	defer awsMu.Unlock()
+
+	return awsOpts.session()
+}
+
+func (awsOpts *AWSOptions) session() (*session.Session, error) {
+	if awsOpts.Offline {
+		return nil, errors.New("not available with --offline")
+	}
+
+	if awsOpts.sess == nil && awsOpts.roleArn != "" {
+		parent, err := awsOpts.parent.session()
+		if err != nil {
+			return nil, err
+		}
+
+		awsOpts.sess = parent.Copy(&aws.Config{
+			Credentials: stscreds.NewCredentials(parent, awsOpts.roleArn),
+		})
+	}
+
 	if awsOpts.sess == nil {
 		opts := session.Options{}
 		opts.SharedConfigState = session.SharedConfigEnable
@@ -48,6 +174,15 @@ func (awsOpts *AWSOptions) Session() (*session.Session, error) {
 			opts.Config.Region = aws.String(awsOpts.Region)
 		}
 
+		client, err := awsOpts.httpClient()
+		if err != nil {
+			return nil, err
+		}
+
+		if client != nil {
+			opts.Config.HTTPClient = client
+		}
+
 		sess, err := session.NewSessionWithOptions(opts)
 		if err != nil {
 			return nil, errors.Wrap(err, "create aws session")
@@ -66,56 +201,215 @@ func (awsOpts *AWSOptions) Session() (*session.Session, error) {
 	return awsOpts.sess, nil
 }
 
+// CloudFormationClient returns a client for the region, which is created once
+// and then reused. An empty region means the session's default region.
 func (awsOpts *AWSOptions) CloudFormationClient(region string) (cloudformationiface.CloudFormationAPI, error) {
+	awsMu.Lock()
+	defer awsMu.Unlock()
+
+	if awsOpts.Offline {
+		return awsOpts.offlineCloudFormationClient(region), nil
+	}
+
+	sess, err := awsOpts.session()
+	if err != nil {
+		return nil, err
+	}
+
+	if region == "" {
+		region = aws.StringValue(sess.Config.Region)
+	}
+
+	if awsOpts.cfn == nil {
+		awsOpts.cfn = make(map[string]cloudformationiface.CloudFormationAPI)
+	}
+
+	if api, ok := awsOpts.cfn[region]; ok {
+		return api, nil
+	}
+
+	var config []*aws.Config
+	if awsOpts.Endpoint != "" {
+		config = append(config, &aws.Config{Endpoint: &awsOpts.Endpoint})
+	}
+
+	if region != "" {
+		config = append(config, &aws.Config{Region: aws.String(region)})
+	}
+
+	api := cloudformation.New(sess, config...)
+	awsOpts.cfn[region] = api
+	return api, nil
+}
+
+// offlineCloudFormationClient returns the simulation of CloudFormation for the
+// region, which defaults to --region or us-east-1.
+func (awsOpts *AWSOptions) offlineCloudFormationClient(region string) cloudformationiface.CloudFormationAPI {
+	if region == "" {
+		region = awsOpts.Region
+	}
+
+	if region == "" {
+		region = "us-east-1"
+	}
+
 	if awsOpts.cfn == nil {
-		sess, err := awsOpts.Session()
+		awsOpts.cfn = make(map[string]cloudformationiface.CloudFormationAPI)
+	}
+
+	if _, ok := awsOpts.cfn[region]; !ok {
+		awsOpts.cfn[region] = internal.NewOfflineCloudFormation(region)
+	}
+
+	return awsOpts.cfn[region]
+}
+
+func (awsOpts *AWSOptions) STSClient() (stsiface.STSAPI, error) {
+	awsMu.Lock()
+	defer awsMu.Unlock()
+
+	if awsOpts.Offline && awsOpts.sts == nil {
+		awsOpts.sts = &internal.OfflineSTS{RoleArn: awsOpts.roleArn}
+	}
+
+	if awsOpts.sts == nil {
+		sess, err := awsOpts.session()
 		if err != nil {
 			return nil, err
 		}
 
-		var config []*aws.Config
-		if awsOpts.Endpoint != "" {
-			config = append(config, &aws.Config{Endpoint: &awsOpts.Endpoint})
+		awsOpts.sts = sts.New(sess)
+	}
+
+	return awsOpts.sts, nil
+}
+
+func (awsOpts *AWSOptions) S3Client() (s3iface.S3API, error) {
+	awsMu.Lock()
+	defer awsMu.Unlock()
+
+	if awsOpts.s3 == nil {
+		sess, err := awsOpts.session()
+		if err != nil {
+			return nil, err
 		}
 
-		if region != "" {
-			config = append(config, &aws.Config{Region: &region})
+		awsOpts.s3 = s3.New(sess)
+	}
+
+	return awsOpts.s3, nil
+}
+
+func (awsOpts *AWSOptions) DynamoDBClient() (dynamodbiface.DynamoDBAPI, error) {
+	awsMu.Lock()
+	defer awsMu.Unlock()
+
+	if awsOpts.ddb == nil {
+		sess, err := awsOpts.session()
+		if err != nil {
+			return nil, err
 		}
 
-		awsOpts.cfn = cloudformation.New(sess, config...)
+		awsOpts.ddb = dynamodb.New(sess)
 	}
 
-	return awsOpts.cfn, nil
+	return awsOpts.ddb, nil
 }
 
-func (awsOpts *AWSOptions) STSClient() (stsiface.STSAPI, error) {
-	if awsOpts.sts == nil {
-		sess, err := awsOpts.Session()
+// CloudWatchClient returns a client for the region, which is created once and
+// then reused. An empty region means the session's default region.
+func (awsOpts *AWSOptions) CloudWatchClient(region string) (cloudwatchiface.CloudWatchAPI, error) {
+	awsMu.Lock()
+	defer awsMu.Unlock()
+
+	if awsOpts.cw == nil {
+		awsOpts.cw = make(map[string]cloudwatchiface.CloudWatchAPI)
+	}
+
+	if api, ok := awsOpts.cw[region]; ok {
+		return api, nil
+	}
+
+	if awsOpts.Offline {
+		awsOpts.cw[region] = &internal.OfflineCloudWatch{Region: region}
+		return awsOpts.cw[region], nil
+	}
+
+	sess, err := awsOpts.session()
+	if err != nil {
+		return nil, err
+	}
+
+	var config []*aws.Config
+	if region != "" {
+		config = append(config, &aws.Config{Region: aws.String(region)})
+	}
+
+	awsOpts.cw[region] = cloudwatch.New(sess, config...)
+	return awsOpts.cw[region], nil
+}
+
+// SNSClient returns a client for the region of the given topic.
+func (awsOpts *AWSOptions) SNSClient(topicArn string) (snsiface.SNSAPI, error) {
+	awsMu.Lock()
+	defer awsMu.Unlock()
+
+	if awsOpts.sns == nil {
+		sess, err := awsOpts.session()
 		if err != nil {
 			return nil, err
 		}
 
-		awsOpts.sts = sts.New(sess)
+		parsed, err := arn.Parse(topicArn)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse topic arn %s", topicArn)
+		}
+
+		awsOpts.sns = sns.New(sess, &aws.Config{Region: &parsed.Region})
 	}
 
-	return awsOpts.sts, nil
+	return awsOpts.sns, nil
 }
 
 func ParseGlobalOptions(args []string) GlobalOptions {
 	var options GlobalOptions
 
 	flags := getopt.New()
-	flags.FlagLong(&options.AWS.Region, "region", 'r', "AWS region")
+	flags.FlagLong(&options.Regions, "region", 'r', "AWS region (repeat to deploy to several regions)")
 	flags.FlagLong(&options.AWS.Profile, "profile", 'p', "AWS credential profile")
 	flags.FlagLong(&options.AWS.Endpoint, "endpoint", 'e', "AWS API endpoint")
+	flags.FlagLong(&options.AWS.CABundle, "ca-bundle", 0, "PEM file of CA certificates to trust in addition to the system's (default $AWS_CA_BUNDLE)")
+	flags.FlagLong(&options.AWS.Proxy, "proxy", 0, "HTTP proxy to reach AWS through (default $HTTPS_PROXY)")
+	flags.FlagLong(&options.AWS.Offline, "offline", 0, "simulate CloudFormation in memory instead of calling AWS")
 	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
 	color := flags.EnumLong(
 		"color", 'c', []string{"on", "off"}, "on",
 		"'on' or 'off'. pass 'off' to disable colors.")
+	logFormat := flags.EnumLong(
+		"log-format", 0, []string{"text", "json"}, "text",
+		"'text' or 'json'. pass 'json' to also log events as JSON lines to stderr.")
+	diffMode := flags.EnumLong(
+		"diff-mode", 0, []string{cftool.DiffModeUnified, cftool.DiffModeSideBySide}, cftool.DiffModeUnified,
+		"'unified' or 'side-by-side'. layout of template diffs on a terminal.")
+	flags.FlagLong(&options.IgnoreWhitespace, "ignore-whitespace", 0, "ignore whitespace-only changes in template diffs")
+	flags.FlagLong(&options.SemanticDiff, "semantic-diff", 0, "diff templates in a canonical form, ignoring how intrinsic functions are written")
+	flags.FlagLong(&options.DetailedExit, "detailed-exit-code", 0, "exit with code 2 if a dry run, --no-execute or --diff-only has pending changes, or params-diff or compare-regions finds differences")
+	flags.FlagLong(&options.NotifySNS, "notify-sns", 0, "SNS topic ARN to publish deploy results to")
+	flags.FlagLong(&options.NotifyWebhook, "notify-webhook", 0, "URL to POST deploy results to")
+	flags.FlagLong(&options.EventLogPath, "event-log", 0, "append every stack event as a JSON line to this file")
+	flags.FlagLong(&options.Trace, "trace", 0, "show how long change sets and stack operations took, and how often they were polled")
+	flags.FlagLong(&options.APIRate, "api-rate", 0, "poll CloudFormation at most this many times a second, across all stacks (default: no limit)")
 	flags.FlagLong(&options.Version, "version", 'V', "show version and exit")
 	flags.SetProgram("cftool")
 	flags.Parse(args)
 	options.Color = color == nil || *color == "on"
+	options.LogFormat = *logFormat
+	options.DiffMode = *diffMode
+
+	if len(options.Regions) > 0 {
+		options.AWS.Region = options.Regions[0]
+	}
+
 	options.remainingArgs = flags.Args()
 
 	if *showHelp {
@@ -127,11 +421,74 @@ func ParseGlobalOptions(args []string) GlobalOptions {
 }
 
 type DeployOptions struct {
-	Yes          bool
-	ManifestFile string
-	Stack        string
-	Tenant       string
-	ShowDiff     bool
+	Yes                 bool
+	IUnderstand         bool
+	ManifestFile        string
+	BaseDir             string
+	Stacks              []string
+	All                 bool
+	Tenant              string
+	ShowDiff            bool
+	DiffOnly            bool
+	DryRun              bool
+	NoExecute           bool
+	DumpChangeSet       string
+	KeepGoing           bool
+	Preprocess          bool
+	ResolveIncludes     bool
+	KeepFailed          bool
+	OnlyChanged         bool
+	SortOutputs         bool
+	Timeout             time.Duration
+	FillDefaults        bool
+	RetainOnDelete      []string
+	DeleteFailedCreates bool
+	NoDeleteOnRollback  bool
+	ReplaceOnFailure    bool
+	CancelOnTimeout     bool
+	Heartbeat           time.Duration
+	MaxWait             time.Duration
+	MaxPending          time.Duration
+	FailOnDrift         bool
+	WaitIfBusy          bool
+	ChangeFilter        pprint.ChangeFilter
+	DetailedChangeSet   bool
+	Comment             string
+	Description         string
+	RequiredTags        map[string]string
+	ExpectedOutputs     map[string]*regexp.Regexp
+	AllowedCapabilities []string
+	AllowExec           bool
+	TrackTemplate       bool
+
+	// LockTable is a DynamoDB table to lock the stack in while deploying.
+	LockTable   string
+	ForceUnlock bool
+
+	// ParametersFromStack names a stack whose parameter values are used
+	// for parameters not given otherwise.
+	ParametersFromStack string
+
+	// ParametersFromEnv is the prefix of environment variables that give
+	// parameter values.
+	ParametersFromEnv string
+
+	// Force deploys to regions outside the manifest's AllowedRegions.
+	Force bool
+
+	// EachAccount deploys to each of the Accounts of the manifest, or those
+	// of them given, instead of the tenant's account.
+	EachAccount bool
+	Accounts    []string
+
+	// Interactive picks the tenant and stack from a menu when they are not
+	// given.
+	Interactive bool
+
+	// StateFile is where the stacks that didn't deploy are recorded, and
+	// RetryFailed a state file whose stacks are deployed again.
+	StateFile   string
+	RetryFailed string
 }
 
 func ParseDeployOptions(args []string) DeployOptions {
@@ -139,15 +496,78 @@ func ParseDeployOptions(args []string) DeployOptions {
 
 	flags := getopt.New()
 	flags.FlagLong(&options.Yes, "yes", 'y', "do not prompt for confirmation")
-	flags.FlagLong(&options.ManifestFile, "manifest", 'f', "manifest path")
-	flags.FlagLong(&options.Stack, "stack", 's', "stack to deploy")
+	flags.FlagLong(&options.IUnderstand, "i-understand", 0, "execute change sets of protected stacks without typed confirmation, and of Confirm: always stacks without asking")
+	flags.FlagLong(&options.ManifestFile, "manifest", 'f', "manifest path, - for stdin, or an HTTP(S) URL")
+	flags.FlagLong(&options.BaseDir, "base-dir", 0, "resolve template and parameter paths against this directory (default: the manifest's)")
+	flags.FlagLong(&options.Stacks, "stack", 's', "stack to deploy (repeat for several)")
+	flags.FlagLong(&options.All, "all", 0, "deploy all stacks of the tenant")
 	flags.FlagLong(&options.Tenant, "tenant", 't', "tenant to deploy for")
+	flags.FlagLong(&options.OnlyChanged, "only-changed", 0, "skip stacks without changes without further output")
+	flags.FlagLong(&options.DryRun, "dry-run", 0, "show the change set without executing it")
+	flags.FlagLong(&options.NoExecute, "no-execute", 0, "create and show the change set, and leave it without executing it")
+	flags.FlagLong(&options.DumpChangeSet, "dump-changeset", 0, "write the change set as JSON to this file (or directory, for several stacks, regions or accounts) before executing it")
+	flags.FlagLong(&options.KeepGoing, "keep-going", 0, "continue with other deployments if one fails")
+	flags.FlagLong(&options.SortOutputs, "sort-outputs", 0, "print stack outputs sorted by key")
+	flags.FlagLong(&options.Preprocess, "preprocess", 0, "render the template with Go text/template first")
+	flags.FlagLong(&options.ResolveIncludes, "resolve-includes", 0, "replace cftool::Include partials in the template, after --preprocess")
+	flags.FlagLong(&options.KeepFailed, "keep-failed-changeset", 0, "do not delete change sets that fail to create")
+	flags.FlagLong(&options.DeleteFailedCreates, "delete-failed-creates", 0, "delete a stack that failed creation without asking")
+	flags.FlagLong(&options.NoDeleteOnRollback, "no-delete-on-rollback", 0, "leave a stack that failed creation in place without asking")
+	flags.FlagLong(&options.ReplaceOnFailure, "replace-on-failure", 0, "delete a stack that failed creation, also in an earlier run, and create it again once")
+	flags.FlagLong(&options.RetainOnDelete, "retain-on-delete", 0, "logical id of a resource to keep when deleting a stack that failed creation (repeatable)")
+	flags.FlagLong(&options.FillDefaults, "fill-defaults", 0, "pass template parameter defaults explicitly")
+	flags.FlagLong(&options.Timeout, "timeout", 0, "abort if the whole operation takes longer than this, e.g. 30m")
+	flags.FlagLong(&options.CancelOnTimeout, "cancel-on-timeout", 0, "cancel the stack update in progress on timeout")
+	flags.FlagLong(&options.Heartbeat, "heartbeat", 0, "print the stack status this often while waiting, e.g. 1m")
+	flags.FlagLong(&options.MaxWait, "max-wait", 0, "fail if the change set takes longer than this to create (default 15m)")
+	flags.FlagLong(&options.MaxPending, "max-pending", 0, "fail if the change set stays CREATE_PENDING longer than this (default 2m)")
+	flags.FlagLong(&options.FailOnDrift, "fail-on-drift", 0, "detect drift first, and do not deploy if resources have drifted")
+	flags.FlagLong(&options.WaitIfBusy, "wait-if-busy", 0, "wait for an operation already in progress on the stack to finish, instead of failing")
+	flags.FlagLong(&options.Comment, "comment", 0, "reason for the deployment, recorded in the log and the cftool:last-approval stack tag")
+	flags.FlagLong(&options.Description, "description", 0, "description of the change set (default: the caller, git commit and time)")
+	flags.FlagLong(&options.ParametersFromStack, "parameters-from-stack", 0, "take parameters not given otherwise from this stack")
+	flags.FlagLong(&options.ParametersFromEnv, "parameters-from-env", 0, "take parameters from environment variables named PREFIX_NAME")
+	flags.FlagLong(&options.AllowExec, "allow-exec", 0, "run parameter values of the form '!cmd: COMMAND' and use their output")
+	flags.FlagLong(&options.TrackTemplate, "track-template", 0, "record the template hash in a stack tag, to detect changes made outside cftool")
+	flags.FlagLong(&options.LockTable, "lock-table", 0, "DynamoDB table to lock the stack in while deploying")
+	flags.FlagLong(&options.ForceUnlock, "force-unlock", 0, "take the stack lock even if another deployment holds it")
+	flags.FlagLong(&options.Force, "force", 0, "deploy even to regions not in the manifest's AllowedRegions")
+	flags.FlagLong(&options.EachAccount, "each-account", 0, "deploy to each of the manifest's Accounts in turn, assuming their roles")
+	flags.FlagLong(&options.Accounts, "account", 0, "with --each-account, only deploy to this account id or label (repeatable)")
+	flags.FlagLong(&options.Interactive, "interactive", 0, "choose the tenant and stack from a menu if not given (terminals only)")
+	flags.FlagLong(&options.StateFile, "state-file", 0, "record the stacks that did not deploy in this file, for --retry-failed")
+	flags.FlagLong(&options.RetryFailed, "retry-failed", 0, "deploy only the stacks recorded in this state file, and update it")
+	requireTags := flags.ListLong("require-tag", 0, "KEY=VALUE stack tag to set, and warn about resources that won't inherit it (repeatable)")
+	capabilities := flags.ListLong("allowed-capabilities", 0, "only deploy templates that need no capabilities but these, e.g. none or IAM,NAMED_IAM")
+	var expectOutputs repeatedString
+	flags.FlagLong(&expectOutputs, "expect-output", 0, "KEY[=REGEX] output the stack must have after deploying, with a value matching REGEX (repeatable)")
+	flags.FlagLong(&options.ChangeFilter.ResourceType, "filter-resource-type", 0, "only show changes to resources whose type starts with this, e.g. AWS::RDS::")
+	filterLogicalId := flags.StringLong("filter-logical-id", 0, "", "only show changes to resources whose logical id matches this regular expression")
+	flags.FlagLong(&options.DetailedChangeSet, "detailed-changeset", 0, "show the values before and after of the properties the change set modifies, where they can be resolved")
 	showDiff := flags.BoolLong("diff", 'd', "show template diff when updating a stack")
+	flags.FlagLong(&options.DiffOnly, "diff-only", 0, "show the template diff, and stop without creating a change set")
 	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
 	flags.SetProgram("cftool [options ...] deploy")
 	flags.Parse(args)
-	options.ShowDiff = *showDiff
+	options.ShowDiff = *showDiff || options.DiffOnly
 	rest := flags.Args()
+	options.ChangeFilter.LogicalId = parseLogicalIdFilter(flags, *filterLogicalId)
+	options.RequiredTags = parseTags(flags, "require-tag", *requireTags)
+	options.AllowedCapabilities = parseCapabilities(flags, *capabilities)
+	options.ExpectedOutputs = parseExpectedOutputs(flags, expectOutputs)
+	checkFailedCreateOptions(flags, options.NoDeleteOnRollback, options.DeleteFailedCreates || options.ReplaceOnFailure)
+
+	if len(options.Accounts) > 0 && !options.EachAccount {
+		fmt.Printf("error: --account needs --each-account.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	if options.All && len(options.Stacks) > 0 {
+		fmt.Printf("error: --all and --stack are mutually exclusive.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
 
 	if len(rest) != 0 {
 		fmt.Printf("error: did not expect positional parameters.\n")
@@ -164,12 +584,71 @@ func ParseDeployOptions(args []string) DeployOptions {
 }
 
 type UpdateOptions struct {
-	Parameters     []string
-	ParameterFiles []string
-	Yes            bool
-	StackName      string
-	TemplateFile   string
-	ShowDiff       bool
+	Batch    string
+	Parallel bool
+
+	// unattended is set when nobody can answer prompts, as in parallel
+	// batch updates.
+	unattended bool
+
+	Parameters          []string
+	ParameterFiles      []string
+	Yes                 bool
+	StackName           string
+	TemplateFile        string
+	ShowDiff            bool
+	DiffOnly            bool
+	DryRun              bool
+	NoExecute           bool
+	DumpChangeSet       string
+	KeepGoing           bool
+	SortOutputs         bool
+	Preprocess          bool
+	ResolveIncludes     bool
+	KeepFailed          bool
+	Timeout             time.Duration
+	FillDefaults        bool
+	RetainOnDelete      []string
+	DeleteFailedCreates bool
+	NoDeleteOnRollback  bool
+	ReplaceOnFailure    bool
+	CancelOnTimeout     bool
+	Heartbeat           time.Duration
+	MaxWait             time.Duration
+	MaxPending          time.Duration
+	FailOnDrift         bool
+	WaitIfBusy          bool
+	ChangeFilter        pprint.ChangeFilter
+	DetailedChangeSet   bool
+	Comment             string
+	Description         string
+	RequiredTags        map[string]string
+	ExpectedOutputs     map[string]*regexp.Regexp
+	AllowedCapabilities []string
+	AllowExec           bool
+	TrackTemplate       bool
+
+	// LockTable is a DynamoDB table to lock the stack in while deploying.
+	LockTable   string
+	ForceUnlock bool
+
+	// ParametersFromStack names a stack whose parameter values are used
+	// for parameters not given otherwise.
+	ParametersFromStack string
+
+	// ParametersFromEnv is the prefix of environment variables that give
+	// parameter values.
+	ParametersFromEnv string
+
+	// OverridesFile is a parameter file whose values take precedence over
+	// all others, including -P.
+	OverridesFile string
+
+	// Manifest is the manifest whose AllowedRegions apply, instead of the
+	// one in an enclosing directory, and Force updates stacks outside of
+	// them anyway.
+	Manifest string
+	Force    bool
 }
 
 func ParseUpdateOptions(args []string) UpdateOptions {
@@ -178,15 +657,61 @@ func ParseUpdateOptions(args []string) UpdateOptions {
 	flags := getopt.New()
 	flags.FlagLong(&options.Parameters, "parameter", 'P', "explicit parameters")
 	flags.FlagLong(&options.ParameterFiles, "parameter-file", 'p', "path to parameter file")
+	flags.FlagLong(&options.OverridesFile, "overrides-file", 0, "parameter file whose values override all others, including -P")
 	flags.FlagLong(&options.Yes, "yes", 'y', "do not prompt for update confirmation (if a stack already exists)")
 	flags.FlagLong(&options.StackName, "stack-name", 'n', "override inferrred stack name")
-	flags.FlagLong(&options.TemplateFile, "template-file", 't', "template file")
+	flags.FlagLong(&options.Batch, "batch", 0, "update the stacks listed in this YAML file instead")
+	flags.FlagLong(&options.Parallel, "parallel", 0, "with --batch, update several stacks at once")
+	flags.FlagLong(&options.TemplateFile, "template-file", 't', "template file, or - to read from stdin")
+	flags.FlagLong(&options.DryRun, "dry-run", 0, "show the change set without executing it")
+	flags.FlagLong(&options.NoExecute, "no-execute", 0, "create and show the change set, and leave it without executing it")
+	flags.FlagLong(&options.DumpChangeSet, "dump-changeset", 0, "write the change set as JSON to this file (or directory, for several stacks, regions or accounts) before executing it")
+	flags.FlagLong(&options.KeepGoing, "keep-going", 0, "continue with other deployments if one fails")
+	flags.FlagLong(&options.SortOutputs, "sort-outputs", 0, "print stack outputs sorted by key")
+	flags.FlagLong(&options.Preprocess, "preprocess", 0, "render the template with Go text/template first")
+	flags.FlagLong(&options.ResolveIncludes, "resolve-includes", 0, "replace cftool::Include partials in the template, after --preprocess")
+	flags.FlagLong(&options.KeepFailed, "keep-failed-changeset", 0, "do not delete change sets that fail to create")
+	flags.FlagLong(&options.DeleteFailedCreates, "delete-failed-creates", 0, "delete a stack that failed creation without asking")
+	flags.FlagLong(&options.NoDeleteOnRollback, "no-delete-on-rollback", 0, "leave a stack that failed creation in place without asking")
+	flags.FlagLong(&options.ReplaceOnFailure, "replace-on-failure", 0, "delete a stack that failed creation, also in an earlier run, and create it again once")
+	flags.FlagLong(&options.RetainOnDelete, "retain-on-delete", 0, "logical id of a resource to keep when deleting a stack that failed creation (repeatable)")
+	flags.FlagLong(&options.FillDefaults, "fill-defaults", 0, "pass template parameter defaults explicitly")
+	flags.FlagLong(&options.Timeout, "timeout", 0, "abort if the whole operation takes longer than this, e.g. 30m")
+	flags.FlagLong(&options.CancelOnTimeout, "cancel-on-timeout", 0, "cancel the stack update in progress on timeout")
+	flags.FlagLong(&options.Heartbeat, "heartbeat", 0, "print the stack status this often while waiting, e.g. 1m")
+	flags.FlagLong(&options.MaxWait, "max-wait", 0, "fail if the change set takes longer than this to create (default 15m)")
+	flags.FlagLong(&options.MaxPending, "max-pending", 0, "fail if the change set stays CREATE_PENDING longer than this (default 2m)")
+	flags.FlagLong(&options.FailOnDrift, "fail-on-drift", 0, "detect drift first, and do not deploy if resources have drifted")
+	flags.FlagLong(&options.WaitIfBusy, "wait-if-busy", 0, "wait for an operation already in progress on the stack to finish, instead of failing")
+	flags.FlagLong(&options.Comment, "comment", 0, "reason for the deployment, recorded in the log and the cftool:last-approval stack tag")
+	flags.FlagLong(&options.Description, "description", 0, "description of the change set (default: the caller, git commit and time)")
+	flags.FlagLong(&options.ParametersFromStack, "parameters-from-stack", 0, "take parameters not given otherwise from this stack")
+	flags.FlagLong(&options.ParametersFromEnv, "parameters-from-env", 0, "take parameters from environment variables named PREFIX_NAME")
+	flags.FlagLong(&options.AllowExec, "allow-exec", 0, "run parameter values of the form '!cmd: COMMAND' and use their output")
+	flags.FlagLong(&options.TrackTemplate, "track-template", 0, "record the template hash in a stack tag, to detect changes made outside cftool")
+	flags.FlagLong(&options.LockTable, "lock-table", 0, "DynamoDB table to lock the stack in while deploying")
+	flags.FlagLong(&options.ForceUnlock, "force-unlock", 0, "take the stack lock even if another deployment holds it")
+	flags.FlagLong(&options.Manifest, "manifest", 'f', "manifest whose AllowedRegions apply (default: .cftool.yml in a parent directory, if any)")
+	flags.FlagLong(&options.Force, "force", 0, "update even in regions not in the manifest's AllowedRegions")
+	requireTags := flags.ListLong("require-tag", 0, "KEY=VALUE stack tag to set, and warn about resources that won't inherit it (repeatable)")
+	capabilities := flags.ListLong("allowed-capabilities", 0, "only deploy templates that need no capabilities but these, e.g. none or IAM,NAMED_IAM")
+	var expectOutputs repeatedString
+	flags.FlagLong(&expectOutputs, "expect-output", 0, "KEY[=REGEX] output the stack must have after deploying, with a value matching REGEX (repeatable)")
+	flags.FlagLong(&options.ChangeFilter.ResourceType, "filter-resource-type", 0, "only show changes to resources whose type starts with this, e.g. AWS::RDS::")
+	filterLogicalId := flags.StringLong("filter-logical-id", 0, "", "only show changes to resources whose logical id matches this regular expression")
+	flags.FlagLong(&options.DetailedChangeSet, "detailed-changeset", 0, "show the values before and after of the properties the change set modifies, where they can be resolved")
 	showDiff := flags.BoolLong("diff", 'd', "show template diff when updating a stack")
+	flags.FlagLong(&options.DiffOnly, "diff-only", 0, "show the template diff, and stop without creating a change set")
 	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
 	flags.SetProgram("cftool [options ...] update")
 	flags.Parse(args)
-	options.ShowDiff = *showDiff
+	options.ShowDiff = *showDiff || options.DiffOnly
 	rest := flags.Args()
+	options.ChangeFilter.LogicalId = parseLogicalIdFilter(flags, *filterLogicalId)
+	options.RequiredTags = parseTags(flags, "require-tag", *requireTags)
+	options.AllowedCapabilities = parseCapabilities(flags, *capabilities)
+	options.ExpectedOutputs = parseExpectedOutputs(flags, expectOutputs)
+	checkFailedCreateOptions(flags, options.NoDeleteOnRollback, options.DeleteFailedCreates || options.ReplaceOnFailure)
 
 	if len(rest) != 0 {
 		fmt.Print("error: did not expect positional parameters\n")
@@ -201,3 +726,568 @@ func ParseUpdateOptions(args []string) UpdateOptions {
 
 	return options
 }
+
+type RenderOptions struct {
+	ManifestFile string
+	BaseDir      string
+	Stack        string
+	Tenant       string
+	Parameters   bool
+	All          bool
+	Out          string
+}
+
+func ParseRenderOptions(args []string) RenderOptions {
+	var options RenderOptions
+
+	flags := getopt.New()
+	flags.FlagLong(&options.ManifestFile, "manifest", 'f', "manifest path, - for stdin, or an HTTP(S) URL")
+	flags.FlagLong(&options.BaseDir, "base-dir", 0, "resolve template and parameter paths against this directory (default: the manifest's)")
+	flags.FlagLong(&options.Stack, "stack", 's', "stack to render")
+	flags.FlagLong(&options.Tenant, "tenant", 't', "tenant to render for")
+	flags.FlagLong(&options.Parameters, "parameters", 0, "show effective parameter values instead of the template")
+	flags.FlagLong(&options.All, "all", 0, "render every stack of every tenant (requires --out)")
+	flags.FlagLong(&options.Out, "out", 0, "write the template and deployment.json to DIR/TENANT/STACK")
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] render")
+	flags.Parse(args)
+	rest := flags.Args()
+
+	if len(rest) != 0 {
+		fmt.Printf("error: did not expect positional parameters.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	return options
+}
+
+type DiffTenantsOptions struct {
+	ManifestFile string
+	BaseDir      string
+	Stacks       []string
+	StackNames   bool
+	TenantA      string
+	TenantB      string
+}
+
+func ParseDiffTenantsOptions(args []string) DiffTenantsOptions {
+	var options DiffTenantsOptions
+
+	flags := getopt.New()
+	flags.FlagLong(&options.ManifestFile, "manifest", 'f', "manifest path, - for stdin, or an HTTP(S) URL")
+	flags.FlagLong(&options.BaseDir, "base-dir", 0, "resolve template and parameter paths against this directory (default: the manifest's)")
+	flags.FlagLong(&options.Stacks, "stack", 's', "stack to compare (repeat for several; default: all of either tenant's)")
+	flags.FlagLong(&options.StackNames, "stack-names", 0, "also compare the resolved stack names")
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] diff-tenants")
+	flags.SetParameters("TENANT_A TENANT_B")
+	flags.Parse(args)
+	rest := flags.Args()
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	if len(rest) != 2 {
+		fmt.Printf("error: expected two tenants.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	options.TenantA, options.TenantB = rest[0], rest[1]
+	return options
+}
+
+type ParamsDiffOptions struct {
+	ManifestFile string
+	BaseDir      string
+	Tenant       string
+	Stack        string
+}
+
+func ParseParamsDiffOptions(args []string) ParamsDiffOptions {
+	var options ParamsDiffOptions
+
+	flags := getopt.New()
+	flags.FlagLong(&options.ManifestFile, "manifest", 'f', "manifest path, - for stdin, or an HTTP(S) URL")
+	flags.FlagLong(&options.BaseDir, "base-dir", 0, "resolve template and parameter paths against this directory (default: the manifest's)")
+	flags.FlagLong(&options.Tenant, "tenant", 't', "tenant to diff for")
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] params-diff")
+	flags.SetParameters("STACK")
+	flags.Parse(args)
+	rest := flags.Args()
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	if len(rest) != 1 {
+		fmt.Printf("error: expected one stack.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	options.Stack = rest[0]
+	return options
+}
+
+type ExportParamsOptions struct {
+	ManifestFile string
+	BaseDir      string
+	Tenant       string
+	Stack        string
+	Out          string
+	MaskNoEcho   bool
+	Preprocess   bool
+	AllowExec    bool
+}
+
+func ParseExportParamsOptions(args []string) ExportParamsOptions {
+	var options ExportParamsOptions
+
+	flags := getopt.New()
+	flags.FlagLong(&options.ManifestFile, "manifest", 'f', "manifest path, - for stdin, or an HTTP(S) URL")
+	flags.FlagLong(&options.BaseDir, "base-dir", 0, "resolve template and parameter paths against this directory (default: the manifest's)")
+	flags.FlagLong(&options.Tenant, "tenant", 't', "tenant to export for")
+	flags.FlagLong(&options.Stack, "stack", 's', "stack to export")
+	flags.FlagLong(&options.Out, "out", 0, "write the parameter file to FILE (default: stdout)")
+	flags.FlagLong(&options.MaskNoEcho, "mask-no-echo", 0, "write NoEcho parameters as ****")
+	flags.FlagLong(&options.Preprocess, "preprocess", 0, "render the template with Go text/template first")
+	flags.FlagLong(&options.AllowExec, "allow-exec", 0, "run parameter values of the form '!cmd: COMMAND' and use their output")
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] export-params")
+	flags.Parse(args)
+	rest := flags.Args()
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	if len(rest) != 0 {
+		fmt.Printf("error: did not expect positional parameters.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	if options.Tenant == "" || options.Stack == "" {
+		fmt.Printf("error: --tenant and --stack are required.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	return options
+}
+
+type WaitOptions struct {
+	StackName string
+	Since     string
+
+	// Selector picks the stacks to wait for by their tags instead.
+	Selector map[string]string
+}
+
+func ParseWaitOptions(args []string) WaitOptions {
+	var options WaitOptions
+
+	flags := getopt.New()
+	flags.FlagLong(&options.StackName, "stack-name", 'n', "stack to wait for")
+	flags.FlagLong(&options.Since, "since", 0, "show events from this long ago (e.g. 30m) or this RFC 3339 time (default: start of the current operation)")
+	selector := flags.ListLong("selector", 'l', "KEY=VALUE tag of the stacks to wait for, instead of -n (repeatable; all must match)")
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] wait")
+	flags.Parse(args)
+	rest := flags.Args()
+	options.Selector = parseTags(flags, "selector", *selector)
+
+	if len(rest) != 0 {
+		fmt.Printf("error: did not expect positional parameters.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	return options
+}
+
+type DeleteOptions struct {
+	StackName      string
+	Yes            bool
+	DryRun         bool
+	RetainOnDelete []string
+}
+
+func ParseDeleteOptions(args []string) DeleteOptions {
+	var options DeleteOptions
+
+	flags := getopt.New()
+	flags.FlagLong(&options.StackName, "stack-name", 'n', "stack to delete")
+	flags.FlagLong(&options.Yes, "yes", 'y', "do not prompt for confirmation")
+	flags.FlagLong(&options.DryRun, "dry-run", 0, "show the deletion policies without deleting the stack")
+	flags.FlagLong(&options.RetainOnDelete, "retain-on-delete", 0, "logical id of a resource to keep if the deletion fails (repeatable)")
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] delete")
+	flags.Parse(args)
+	rest := flags.Args()
+
+	if len(rest) != 0 {
+		fmt.Printf("error: did not expect positional parameters.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	return options
+}
+
+type ContinueRollbackOptions struct {
+	StackName     string
+	Yes           bool
+	SkipResources []string
+}
+
+func ParseContinueRollbackOptions(args []string) ContinueRollbackOptions {
+	var options ContinueRollbackOptions
+
+	flags := getopt.New()
+	flags.FlagLong(&options.StackName, "stack-name", 'n', "stack to continue the rollback of")
+	flags.FlagLong(&options.Yes, "yes", 'y', "do not prompt for confirmation before skipping resources")
+	flags.FlagLong(&options.SkipResources, "skip-resources", 0, "logical id of a resource not to roll back, or NESTED.ID for one in a nested stack (repeatable)")
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] continue-rollback")
+	flags.Parse(args)
+	rest := flags.Args()
+
+	if len(rest) != 0 {
+		fmt.Printf("error: did not expect positional parameters.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	return options
+}
+
+type ResourcesOptions struct {
+	StackName string
+	Output    string
+
+	// Selector picks the stacks to list by their tags instead.
+	Selector map[string]string
+}
+
+func ParseResourcesOptions(args []string) ResourcesOptions {
+	var options ResourcesOptions
+
+	flags := getopt.New()
+	output := flags.EnumLong(
+		"output", 'o', []string{"text", "json"}, "text",
+		"'text' or 'json'. pass 'json' to list the resources as a JSON array.")
+	selector := flags.ListLong("selector", 'l', "KEY=VALUE tag of the stacks to list, instead of STACK (repeatable; all must match)")
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] resources")
+	flags.SetParameters("STACK")
+	flags.Parse(args)
+	options.Output = *output
+	options.Selector = parseTags(flags, "selector", *selector)
+	rest := flags.Args()
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	if len(options.Selector) > 0 && len(rest) == 0 {
+		return options
+	}
+
+	if len(rest) != 1 || len(options.Selector) > 0 {
+		fmt.Printf("error: expected a stack name or --selector.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	options.StackName = rest[0]
+	return options
+}
+
+type GetTemplateOptions struct {
+	StackName string
+	Out       string
+	Processed bool
+}
+
+func ParseGetTemplateOptions(args []string) GetTemplateOptions {
+	var options GetTemplateOptions
+
+	flags := getopt.New()
+	flags.FlagLong(&options.Out, "out", 0, "write the template to FILE (default: stdout)")
+	flags.FlagLong(&options.Processed, "processed", 0, "get the template after transforms were applied")
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] get-template")
+	flags.SetParameters("STACK")
+	flags.Parse(args)
+	rest := flags.Args()
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	if len(rest) != 1 {
+		fmt.Printf("error: expected one stack.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	options.StackName = rest[0]
+	return options
+}
+
+type CompareRegionsOptions struct {
+	StackName string
+	Processed bool
+	RegionA   string
+	RegionB   string
+}
+
+func ParseCompareRegionsOptions(args []string) CompareRegionsOptions {
+	var options CompareRegionsOptions
+
+	flags := getopt.New()
+	flags.FlagLong(&options.Processed, "processed", 0, "compare the templates after transforms were applied")
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] compare-regions")
+	flags.SetParameters("STACK REGION_A REGION_B")
+	flags.Parse(args)
+	rest := flags.Args()
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	if len(rest) != 3 {
+		fmt.Printf("error: expected a stack and two regions.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	options.StackName, options.RegionA, options.RegionB = rest[0], rest[1], rest[2]
+	return options
+}
+
+type SchemaOptions struct{}
+
+func ParseSchemaOptions(args []string) SchemaOptions {
+	var options SchemaOptions
+
+	flags := getopt.New()
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] schema")
+	flags.Parse(args)
+	rest := flags.Args()
+
+	if len(rest) != 0 {
+		fmt.Printf("error: did not expect positional parameters.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	return options
+}
+
+type WhoamiOptions struct{}
+
+func ParseWhoamiOptions(args []string) WhoamiOptions {
+	var options WhoamiOptions
+
+	flags := getopt.New()
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] whoami")
+	flags.Parse(args)
+	rest := flags.Args()
+
+	if len(rest) != 0 {
+		fmt.Printf("error: did not expect positional parameters.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	return options
+}
+
+type DiffOptions struct {
+	ManifestFile string
+	BaseDir      string
+	Stack        string
+	Tenant       string
+	TemplateFile string
+	Watch        bool
+
+	ResolveIncludes bool
+}
+
+func ParseDiffOptions(args []string) DiffOptions {
+	var options DiffOptions
+
+	flags := getopt.New()
+	flags.FlagLong(&options.ManifestFile, "manifest", 'f', "manifest path, - for stdin, or an HTTP(S) URL")
+	flags.FlagLong(&options.BaseDir, "base-dir", 0, "resolve template and parameter paths against this directory (default: the manifest's)")
+	flags.FlagLong(&options.Stack, "stack", 's', "stack to diff")
+	flags.FlagLong(&options.Tenant, "tenant", 't', "tenant to diff for")
+	flags.FlagLong(&options.TemplateFile, "template-file", 0, "template to compare against (default: the manifest's)")
+	flags.FlagLong(&options.ResolveIncludes, "resolve-includes", 0, "replace cftool::Include partials in the template")
+	flags.FlagLong(&options.Watch, "watch", 'w', "show the diff again whenever the template, parameter files or manifest change")
+	showHelp := flags.BoolLong("help", 'h', "show usage and exit")
+	flags.SetProgram("cftool [options ...] diff")
+	flags.Parse(args)
+	rest := flags.Args()
+
+	if len(rest) != 0 {
+		fmt.Printf("error: did not expect positional parameters.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	if *showHelp {
+		flags.PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+
+	return options
+}
+
+// checkFailedCreateOptions exits if a stack that failed creation is both to
+// be kept and to be deleted.
+func checkFailedCreateOptions(flags *getopt.Set, keep bool, remove bool) {
+	if keep && remove {
+		fmt.Printf("error: --no-delete-on-rollback cannot be used with --delete-failed-creates or --replace-on-failure.\n")
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+}
+
+// repeatedString collects the values of an option given several times. Unlike
+// a []string option, it doesn't split them on commas, which regular
+// expressions may contain.
+type repeatedString []string
+
+func (r *repeatedString) Set(value string, opt getopt.Option) error {
+	*r = append(*r, value)
+	return nil
+}
+
+func (r *repeatedString) String() string {
+	return strings.Join(*r, " ")
+}
+
+// parseExpectedOutputs parses the KEY[=REGEX] values of --expect-output, or
+// exits if one is malformed. It returns nil if the option wasn't given.
+func parseExpectedOutputs(flags *getopt.Set, values []string) map[string]*regexp.Regexp {
+	if len(values) == 0 {
+		return nil
+	}
+
+	patterns := make(map[string]string)
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		patterns[parts[0]] = ""
+		if len(parts) == 2 {
+			patterns[parts[0]] = parts[1]
+		}
+	}
+
+	expected, err := cftool.ParseExpectedOutputs(patterns)
+	if err != nil {
+		fmt.Printf("error: --expect-output: %v\n", err)
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	return expected
+}
+
+// parseLogicalIdFilter compiles the --filter-logical-id pattern, or exits if
+// it is invalid.
+func parseLogicalIdFilter(flags *getopt.Set, pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		fmt.Printf("error: --filter-logical-id: %v\n", err)
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	return re
+}
+
+// parseCapabilities parses --allowed-capabilities, or exits if it names an
+// unknown capability. It returns nil if the option wasn't given.
+func parseCapabilities(flags *getopt.Set, values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	capabilities, err := cftool.ParseCapabilities(values)
+	if err != nil {
+		fmt.Printf("error: --allowed-capabilities: %v\n", err)
+		flags.PrintUsage(os.Stdout)
+		os.Exit(1)
+	}
+
+	return capabilities
+}
+
+// parseTags parses the KEY=VALUE pairs given to the named option, or exits if
+// one is malformed.
+func parseTags(flags *getopt.Set, name string, tags []string) map[string]string {
+	result := make(map[string]string)
+
+	for _, tag := range tags {
+		if !strings.Contains(tag, "=") {
+			fmt.Printf("error: --%s: expected KEY=VALUE, got %s\n", name, tag)
+			flags.PrintUsage(os.Stdout)
+			os.Exit(1)
+		}
+
+		k, v := parseParameterString(tag)
+		result[k] = v
+	}
+
+	return result
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAWSOptions_CloudFormationClient(t *testing.T) {
+	dirname, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dirname)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	require.NoError(t, os.Setenv("HOME", dirname))
+
+	opts := AWSOptions{Region: "eu-west-1"}
+
+	useast, err := opts.CloudFormationClient("us-east-1")
+	require.NoError(t, err)
+	euwest, err := opts.CloudFormationClient("eu-west-1")
+	require.NoError(t, err)
+	def, err := opts.CloudFormationClient("")
+	require.NoError(t, err)
+	again, err := opts.CloudFormationClient("us-east-1")
+	require.NoError(t, err)
+
+	require.Equal(t, "us-east-1", getRegion(useast))
+	require.Equal(t, "eu-west-1", getRegion(euwest))
+	require.True(t, def == euwest, "default region should reuse the eu-west-1 client")
+	require.True(t, again == useast, "clients should be reused")
+}
+
+func TestParseDeployOptions_ExpectOutput(t *testing.T) {
+	opts := ParseDeployOptions([]string{"deploy", "-t", "test", "--expect-output", "Url=^https://.{1,64}$", "--expect-output", "Arn"})
+	require.Len(t, opts.ExpectedOutputs, 2)
+	require.Equal(t, "^https://.{1,64}$", opts.ExpectedOutputs["Url"].String())
+	require.Equal(t, "", opts.ExpectedOutputs["Arn"].String())
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	manifest2 "github.com/tetratom/cftool/pkg/manifest"
+)
+
+// stackOutputs resolves references to stack outputs in the parameters of a
+// deploy run. Outputs of stacks deployed in the run are remembered, and those
+// of other stacks are looked up once.
+type stackOutputs struct {
+	awsOpts  *AWSOptions
+	manifest *manifest2.Manifest
+	tenant   string
+
+	// cache holds outputs by region and stack name.
+	cache map[string]map[string]string
+
+	// failed holds the labels of the stacks that failed in this run, whose
+	// outputs can't be relied on.
+	failed map[string]bool
+}
+
+func newStackOutputs(
+	awsOpts *AWSOptions,
+	manifest *manifest2.Manifest,
+	tenant string,
+	failed map[string]bool,
+) *stackOutputs {
+	return &stackOutputs{
+		awsOpts:  awsOpts,
+		manifest: manifest,
+		tenant:   tenant,
+		cache:    make(map[string]map[string]string),
+		failed:   failed,
+	}
+}
+
+// outputsKey identifies a stack by its name, region, and the role it is
+// deployed with, which is set for each account with --each-account.
+func outputsKey(roleArn string, region string, stackName string) string {
+	return roleArn + "/" + region + "/" + stackName
+}
+
+// add remembers the outputs of a stack that was just deployed.
+func (o *stackOutputs) add(deployment *cftool.Deployment, outputs map[string]string) {
+	o.cache[outputsKey(deployment.RoleArn, deployment.Region, deployment.StackName)] = outputs
+}
+
+// resolve replaces the references to stack outputs in the parameters of the
+// deployment. A reference names a stack by its label in the manifest, which
+// is looked up in the same region as the deployment, or else by its name.
+func (o *stackOutputs) resolve(deployment *cftool.Deployment) error {
+	return cftool.ResolveOutputRefs(deployment.Parameters, func(stack string, key string) (string, error) {
+		region, stackName := deployment.Region, stack
+
+		if o.failed[stack] {
+			return "", errors.Errorf("stack %s failed in this run", stack)
+		}
+
+		other, ok, err := o.manifest.FindDeploymentInRegion(o.tenant, stack, deployment.Region)
+		if err != nil {
+			return "", errors.Wrapf(err, "stack %s", stack)
+		} else if ok {
+			region, stackName = other.Region, other.StackName
+		}
+
+		outputs, err := o.lookup(deployment.RoleArn, region, stackName)
+		if err != nil {
+			return "", err
+		}
+
+		value, ok := outputs[key]
+		if !ok {
+			return "", errors.Errorf("stack %s has no output %s", stackName, key)
+		}
+
+		return value, nil
+	})
+}
+
+func (o *stackOutputs) lookup(roleArn string, region string, stackName string) (map[string]string, error) {
+	key := outputsKey(roleArn, region, stackName)
+	if outputs, ok := o.cache[key]; ok {
+		return outputs, nil
+	}
+
+	api, err := o.awsOpts.ForRole(roleArn).CloudFormationClient(region)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := api.DescribeStacks(&cf.DescribeStacksInput{StackName: aws.String(stackName)})
+	if err != nil {
+		return nil, errors.Wrapf(err, "describe stack %s", stackName)
+	}
+
+	outputs := make(map[string]string)
+	for _, output := range resp.Stacks[0].Outputs {
+		outputs[aws.StringValue(output.OutputKey)] = aws.StringValue(output.OutputValue)
+	}
+
+	o.cache[key] = outputs
+	return outputs, nil
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/pkg/cftool"
+	manifest2 "github.com/tetratom/cftool/pkg/manifest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStackOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	manifestPath := filepath.Join(dir, ".cftool.yml")
+	require.NoError(t, ioutil.WriteFile(manifestPath, []byte(`
+Version: "1.1"
+Tenants:
+  - Label: test
+Stacks:
+  - Label: network
+    Default:
+      Template: template.yml
+      StackName: test-network
+      Region: eu-west-1
+    Targets:
+      - Tenant: test
+`), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "template.yml"), []byte("Resources: {}\n"), 0600))
+
+	manifest, err := manifest2.ReadFromFile(manifestPath)
+	require.NoError(t, err)
+
+	failed := make(map[string]bool)
+	outputs := newStackOutputs(&AWSOptions{Offline: true}, manifest, "test", failed)
+	outputs.add(&cftool.Deployment{Region: "eu-west-1", StackName: "test-network"}, map[string]string{"VpcId": "vpc-123"})
+
+	deployment := &cftool.Deployment{
+		Region:     "eu-west-1",
+		Parameters: map[string]string{"ByLabel": "output:network:VpcId", "ByName": "output:test-network:VpcId"},
+	}
+
+	require.NoError(t, outputs.resolve(deployment))
+	require.Equal(t, map[string]string{"ByLabel": "vpc-123", "ByName": "vpc-123"}, deployment.Parameters)
+
+	deployment.Parameters = map[string]string{"Subnet": "output:network:SubnetId"}
+	require.EqualError(t, outputs.resolve(deployment), "parameter Subnet: stack test-network has no output SubnetId")
+
+	// Stacks that weren't deployed in this run are looked up.
+	deployment.Parameters = map[string]string{"Vpc": "output:other:VpcId"}
+	require.Error(t, outputs.resolve(deployment))
+
+	failed["network"] = true
+	deployment.Parameters = map[string]string{"Vpc": "output:network:VpcId"}
+	require.EqualError(t, outputs.resolve(deployment), "parameter Vpc: stack network failed in this run")
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+)
+
+// ParamsDiff compares the parameters of a deployed stack with those the
+// manifest resolves for it, without creating a change set.
+func ParamsDiff(c context.Context, globalOpts GlobalOptions, diffOpts ParamsDiffOptions) error {
+	_, manifest, err := loadManifest(diffOpts.ManifestFile, diffOpts.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	deployment, ok, err := manifest.FindDeployment(diffOpts.Tenant, diffOpts.Stack)
+	if err != nil {
+		return err
+	} else if !ok {
+		return errors.Errorf("no deployment of stack %s for tenant %s", diffOpts.Stack, diffOpts.Tenant)
+	}
+
+	api, err := globalOpts.AWS.CloudFormationClient(deployment.Region)
+	if err != nil {
+		return err
+	}
+
+	pprint.Field(color.Output, "StackName", deployment.StackName)
+
+	changed, err := paramsDiff(color.Output, api, deployment)
+	if err != nil {
+		return err
+	}
+
+	if changed && globalOpts.DetailedExit {
+		return cftool.ErrChangesPending
+	}
+
+	return nil
+}
+
+// paramsDiff prints the difference between the deployed parameters of the
+// stack and the resolved ones, including template defaults, and reports
+// whether there is one. NoEcho parameters are masked on both sides, so a
+// change to their value doesn't show.
+func paramsDiff(w io.Writer, api cloudformationiface.CloudFormationAPI, deployment *cftool.Deployment) (bool, error) {
+	out, err := api.DescribeStacks(&cf.DescribeStacksInput{StackName: aws.String(deployment.StackName)})
+	if err != nil {
+		return false, errors.Wrapf(err, "describe stack %s", deployment.StackName)
+	}
+
+	params, err := cftool.ParseTemplateParameters(deployment.TemplateBody)
+	if err != nil {
+		return false, err
+	}
+
+	resolved, err := deployment.ResolveParameters()
+	if err != nil {
+		return false, err
+	}
+
+	mask := func(name string, value string) string {
+		if param, ok := params[name]; ok && param.IsNoEcho() {
+			return maskedParameterValue
+		}
+
+		return value
+	}
+
+	deployed := make(map[string]string)
+	for _, param := range out.Stacks[0].Parameters {
+		name := aws.StringValue(param.ParameterKey)
+		deployed[name] = mask(name, aws.StringValue(param.ParameterValue))
+	}
+
+	local := make(map[string]string)
+	for _, param := range resolved {
+		if param.Source != cftool.ParameterMissing {
+			local[param.Name] = mask(param.Name, param.Value)
+		}
+	}
+
+	a, b := mapLines("Parameters", deployed), mapLines("Parameters", local)
+	return !equalStrings(a, b), diffLines(w, a, b)
+}
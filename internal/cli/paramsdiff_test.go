@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"testing"
+)
+
+func TestParamsDiff(t *testing.T) {
+	api := internal.NewOfflineCloudFormation("eu-west-1")
+	template := []byte(`
+Parameters:
+  InstanceType: {Type: String, Default: t3.small}
+  Password: {Type: String, NoEcho: true}
+  Size: {Type: Number}
+Resources:
+  Queue: {Type: AWS::SQS::Queue}
+`)
+
+	deployment := &cftool.Deployment{
+		StackName:    "app",
+		TemplateBody: template,
+		Parameters:   map[string]string{"InstanceType": "t3.small", "Password": "hunter2", "Size": "1"},
+	}
+
+	_, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	changed, err := paramsDiff(buf, api, deployment)
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Equal(t, "No differences.\n", buf.String())
+
+	// The template default counts as the local value.
+	deployment.Parameters = map[string]string{"Password": "hunter2", "Size": "1"}
+	buf.Reset()
+	changed, err = paramsDiff(buf, api, deployment)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	deployment.Parameters = map[string]string{"InstanceType": "m5.large", "Password": "secret", "Size": "1"}
+	buf.Reset()
+	changed, err = paramsDiff(buf, api, deployment)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Contains(t, buf.String(), "-Parameters.InstanceType: t3.small\n+Parameters.InstanceType: m5.large\n")
+	require.NotContains(t, buf.String(), "Password")
+}
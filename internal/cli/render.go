@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	manifest2 "github.com/tetratom/cftool/pkg/manifest"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Render prints the preprocessed template of a deployment from the manifest,
+// for debugging templates written for --preprocess. With --out, deployments
+// are written to a directory instead, without calling AWS.
+func Render(c context.Context, globalOpts GlobalOptions, renderOpts RenderOptions) error {
+	_, manifest, err := loadManifest(renderOpts.ManifestFile, renderOpts.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	if renderOpts.All {
+		if renderOpts.Out == "" {
+			return errors.New("--all requires --out")
+		}
+
+		return renderAll(manifest, renderOpts.Out)
+	}
+
+	deployment, ok, err := manifest.FindDeployment(renderOpts.Tenant, renderOpts.Stack)
+	if err != nil {
+		return err
+	} else if !ok {
+		return errors.Errorf("no deployment of %s for %s", renderOpts.Stack, renderOpts.Tenant)
+	}
+
+	if err := deployment.Preprocess(); err != nil {
+		return errors.Wrap(err, "preprocess template")
+	}
+
+	if renderOpts.Out != "" {
+		return writeDeployment(renderOpts.Out, deployment)
+	}
+
+	if !renderOpts.Parameters {
+		fmt.Fprintf(color.Output, "%s", deployment.TemplateBody)
+		return printResourceCount(deployment)
+	}
+
+	params, err := deployment.ResolveParameters()
+	if err != nil {
+		return err
+	}
+
+	for _, param := range params {
+		pprint.Parameter(color.Output, param.Name, param.Value, param.Source)
+	}
+
+	return printResourceCount(deployment)
+}
+
+// printResourceCount shows how close the template is to the resource limit of
+// a stack. It goes to stderr, so that the rendered template can be piped.
+func printResourceCount(deployment *cftool.Deployment) error {
+	count, err := deployment.ResourceCount()
+	if err != nil {
+		return err
+	}
+
+	pprint.Field(color.Error, "Resources", fmt.Sprintf("%d of %d", count, cftool.MaxResources))
+
+	if count > cftool.MaxResources {
+		pprint.Warningf(color.Error, "a stack can have at most %d resources; move some into nested stacks", cftool.MaxResources)
+	} else if count >= resourceCountWarning {
+		pprint.Warningf(color.Error, "close to the resource limit; consider moving some into nested stacks")
+	}
+
+	return nil
+}
+
+// renderAll writes every deployment in the manifest to a directory per tenant
+// and stack under out, for review or archival.
+func renderAll(manifest *manifest2.Manifest, out string) error {
+	for _, tenant := range manifest.Tenants {
+		for _, stack := range manifest.StackLabels(tenant.Label) {
+			enabled, err := manifest.IsStackEnabled(tenant.Label, stack)
+			if err != nil {
+				return err
+			} else if !enabled {
+				continue
+			}
+
+			deployment, _, err := manifest.FindDeployment(tenant.Label, stack)
+			if err != nil {
+				return errors.Wrapf(err, "stack %s for tenant %s", stack, tenant.Label)
+			}
+
+			if err := deployment.Preprocess(); err != nil {
+				return errors.Wrapf(err, "preprocess template of stack %s for tenant %s", stack, tenant.Label)
+			}
+
+			if err := writeDeployment(out, deployment); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// renderedDeployment is what render --out writes next to the template.
+type renderedDeployment struct {
+	StackName  string
+	Region     string `json:",omitempty"`
+	AccountId  string `json:",omitempty"`
+	Protected  bool
+	Confirm    string `json:",omitempty"`
+	Resources  int
+	Parameters map[string]string
+	Tags       map[string]string `json:",omitempty"`
+}
+
+// writeDeployment writes the template of a deployment, and the rest of it as
+// JSON, to out/TENANT/STACK.
+func writeDeployment(out string, deployment *cftool.Deployment) error {
+	dir := filepath.Join(out, deployment.TenantLabel, deployment.StackLabel)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	templateName := "template.yml"
+	if bytes.HasPrefix(bytes.TrimSpace(deployment.TemplateBody), []byte("{")) {
+		templateName = "template.json"
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, templateName), deployment.TemplateBody, 0644); err != nil {
+		return err
+	}
+
+	resources, err := deployment.ResourceCount()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(&renderedDeployment{
+		StackName:  deployment.StackName,
+		Region:     deployment.Region,
+		AccountId:  deployment.AccountId,
+		Protected:  deployment.Protected,
+		Confirm:    deployment.Confirm,
+		Resources:  resources,
+		Parameters: deployment.Parameters,
+		Tags:       deployment.Tags,
+	}, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, "deployment.json")
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(color.Output, "%s\n", dir)
+	return nil
+}
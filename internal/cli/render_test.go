@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"github.com/stretchr/testify/require"
+	manifest2 "github.com/tetratom/cftool/pkg/manifest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	manifestPath := filepath.Join(dir, ".cftool.yml")
+	require.NoError(t, ioutil.WriteFile(manifestPath, []byte(`
+Version: "1.1"
+Tenants:
+  - Label: live
+    Tags:
+      Env: live
+  - Label: test
+Stacks:
+  - Label: queue
+    Default:
+      Template: queue.yml
+      StackName: "{{.TenantLabel}}-queue"
+      Parameters:
+        - Key: Name
+          Value: "{{.TenantLabel}}"
+    Targets:
+      - Tenant: live
+      - Tenant: test
+  - Label: monitoring
+    EnabledFor: [live]
+    Default:
+      Template: queue.yml
+      StackName: "{{.TenantLabel}}-monitoring"
+    Targets:
+      - Tenant: live
+      - Tenant: test
+`), 0600))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "queue.yml"), []byte("Description: {{.StackName}}\nResources: {Queue: {Type: AWS::SQS::Queue}}\n"), 0600))
+
+	manifest, err := manifest2.ReadFromFile(manifestPath)
+	require.NoError(t, err)
+
+	out := filepath.Join(dir, "out")
+	require.NoError(t, renderAll(manifest, out))
+
+	template, err := ioutil.ReadFile(filepath.Join(out, "live", "queue", "template.yml"))
+	require.NoError(t, err)
+	require.Equal(t, "Description: live-queue\nResources: {Queue: {Type: AWS::SQS::Queue}}\n", string(template))
+
+	deployment, err := ioutil.ReadFile(filepath.Join(out, "live", "queue", "deployment.json"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"StackName": "live-queue",
+		"Protected": false,
+		"Resources": 1,
+		"Parameters": {"Name": "live"},
+		"Tags": {"Env": "live"}
+	}`, string(deployment))
+
+	require.FileExists(t, filepath.Join(out, "live", "monitoring", "template.yml"))
+	require.FileExists(t, filepath.Join(out, "test", "queue", "template.yml"))
+
+	_, err = os.Stat(filepath.Join(out, "test", "monitoring"))
+	require.True(t, os.IsNotExist(err), "monitoring is not enabled for test")
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"time"
+)
+
+// stackResource is a resource as listed by `resources --output json`. Stack is
+// only set when stacks are selected by tag, and there may be several.
+type stackResource struct {
+	Stack       string `json:",omitempty"`
+	LogicalId   string
+	Type        string
+	Status      string
+	Reason      string     `json:",omitempty"`
+	PhysicalId  string     `json:",omitempty"`
+	LastUpdated *time.Time `json:",omitempty"`
+}
+
+// Resources lists the resources of a stack, or of the stacks selected by tag,
+// with their types, ids and status.
+func Resources(c context.Context, globalOpts GlobalOptions, resourcesOpts ResourcesOptions) error {
+	api, err := globalOpts.AWS.CloudFormationClient("")
+	if err != nil {
+		return err
+	}
+
+	if len(resourcesOpts.Selector) > 0 {
+		return selectedResources(api, resourcesOpts, color.Output)
+	}
+
+	resources, err := listStackResources(api, resourcesOpts.StackName)
+	if err != nil {
+		return err
+	}
+
+	if resourcesOpts.Output == "json" {
+		return printResourcesJSON(color.Output, resources)
+	}
+
+	pprint.ResourceTable(color.Output, resources)
+	return nil
+}
+
+// selectedResources lists the resources of every stack with the tags of the
+// selector, with a header per stack, or as a single JSON array.
+func selectedResources(api cloudformationiface.CloudFormationAPI, resourcesOpts ResourcesOptions, w io.Writer) error {
+	stacks, err := selectStacks(api, resourcesOpts.Selector)
+	if err != nil {
+		return err
+	}
+
+	var all []stackResource
+	for i, stack := range stacks {
+		resources, err := listStackResources(api, stack)
+		if err != nil {
+			return err
+		}
+
+		if resourcesOpts.Output == "json" {
+			all = append(all, stackResources(stack, resources)...)
+			continue
+		}
+
+		if i > 0 {
+			fmt.Fprintf(w, "\n")
+		}
+
+		pprint.Header(w, "%s", stack)
+		pprint.ResourceTable(w, resources)
+	}
+
+	if resourcesOpts.Output == "json" {
+		return printJSON(w, all)
+	}
+
+	return nil
+}
+
+// listStackResources lists all resources of the stack, across pages.
+func listStackResources(api cloudformationiface.CloudFormationAPI, stackName string) ([]*cf.StackResourceSummary, error) {
+	var result []*cf.StackResourceSummary
+
+	err := api.ListStackResourcesPages(
+		&cf.ListStackResourcesInput{StackName: aws.String(stackName)},
+		func(page *cf.ListStackResourcesOutput, lastPage bool) bool {
+			result = append(result, page.StackResourceSummaries...)
+			return true
+		})
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "list resources of stack %s", stackName)
+	}
+
+	return result, nil
+}
+
+func printResourcesJSON(w io.Writer, resources []*cf.StackResourceSummary) error {
+	return printJSON(w, stackResources("", resources))
+}
+
+func stackResources(stack string, resources []*cf.StackResourceSummary) []stackResource {
+	list := make([]stackResource, len(resources))
+	for i, r := range resources {
+		list[i] = stackResource{
+			Stack:       stack,
+			LogicalId:   aws.StringValue(r.LogicalResourceId),
+			Type:        aws.StringValue(r.ResourceType),
+			Status:      aws.StringValue(r.ResourceStatus),
+			Reason:      aws.StringValue(r.ResourceStatusReason),
+			PhysicalId:  aws.StringValue(r.PhysicalResourceId),
+			LastUpdated: r.LastUpdatedTimestamp,
+		}
+	}
+
+	return list
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestListStackResources(t *testing.T) {
+	api := internal.NewOfflineCloudFormation("eu-west-1")
+	deployment := &cftool.Deployment{
+		StackName:    "mystack",
+		TemplateBody: []byte("Resources:\n  Topic: {Type: AWS::SNS::Topic}\n  Queue: {Type: AWS::SQS::Queue}\n"),
+	}
+
+	_, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+	require.NoError(t, err)
+
+	resources, err := listStackResources(api, "mystack")
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+
+	w := &strings.Builder{}
+	require.NoError(t, printResourcesJSON(w, resources))
+	require.Contains(t, w.String(), `"LogicalId": "Queue"`)
+	require.Contains(t, w.String(), `"Type": "AWS::SNS::Topic"`)
+	require.Contains(t, w.String(), `"Status": "CREATE_COMPLETE"`)
+	require.NotContains(t, w.String(), `"Reason"`)
+
+	_, err = listStackResources(api, "other")
+	require.Error(t, err)
+}
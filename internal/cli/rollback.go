@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"strings"
+)
+
+// maxAlarmNames is how many names DescribeAlarms accepts at once.
+const maxAlarmNames = 100
+
+// resolveRollbackAlarms looks up the ARNs of the rollback alarms of the
+// deployment, in its account and region, and sets them as its rollback
+// triggers.
+func resolveRollbackAlarms(api cloudwatchiface.CloudWatchAPI, deployment *cftool.Deployment, w io.Writer) error {
+	if len(deployment.RollbackAlarms) == 0 {
+		return nil
+	}
+
+	if len(deployment.RollbackAlarms) > maxAlarmNames {
+		return errors.Errorf("too many rollback alarms (%d, at most %d)", len(deployment.RollbackAlarms), maxAlarmNames)
+	}
+
+	output, err := api.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{
+		AlarmNames: aws.StringSlice(deployment.RollbackAlarms),
+	})
+
+	if err != nil {
+		return errors.Wrap(err, "describe rollback alarms")
+	}
+
+	arns := make(map[string]string)
+	for _, alarm := range output.MetricAlarms {
+		arns[aws.StringValue(alarm.AlarmName)] = aws.StringValue(alarm.AlarmArn)
+	}
+
+	var missing []string
+	triggers := make([]string, 0, len(deployment.RollbackAlarms))
+	for _, name := range deployment.RollbackAlarms {
+		arn, ok := arns[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+
+		triggers = append(triggers, arn)
+	}
+
+	if len(missing) > 0 {
+		region := deployment.Region
+		if region == "" {
+			region = "the default region"
+		}
+
+		return errors.Errorf("rollback alarm(s) not found in %s: %s", region, strings.Join(missing, ", "))
+	}
+
+	deployment.RollbackTriggers = triggers
+	pprint.Field(w, "Rollback alarms", strings.Join(deployment.RollbackAlarms, ", "))
+	return nil
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"testing"
+)
+
+type fakeCloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+	alarms map[string]string
+}
+
+func (f *fakeCloudWatch) DescribeAlarms(input *cloudwatch.DescribeAlarmsInput) (*cloudwatch.DescribeAlarmsOutput, error) {
+	output := &cloudwatch.DescribeAlarmsOutput{}
+	for _, name := range aws.StringValueSlice(input.AlarmNames) {
+		if arn, ok := f.alarms[name]; ok {
+			output.MetricAlarms = append(output.MetricAlarms, &cloudwatch.MetricAlarm{
+				AlarmName: aws.String(name),
+				AlarmArn:  aws.String(arn),
+			})
+		}
+	}
+
+	return output, nil
+}
+
+func TestResolveRollbackAlarms(t *testing.T) {
+	api := &fakeCloudWatch{alarms: map[string]string{
+		"api-5xx":     "arn:aws:cloudwatch:eu-west-1:123456789012:alarm:api-5xx",
+		"api-latency": "arn:aws:cloudwatch:eu-west-1:123456789012:alarm:api-latency",
+	}}
+
+	deployment := &cftool.Deployment{Region: "eu-west-1", RollbackAlarms: []string{"api-latency", "api-5xx"}}
+	require.NoError(t, resolveRollbackAlarms(api, deployment, ioutil.Discard))
+	require.Equal(t, []string{
+		"arn:aws:cloudwatch:eu-west-1:123456789012:alarm:api-latency",
+		"arn:aws:cloudwatch:eu-west-1:123456789012:alarm:api-5xx",
+	}, deployment.RollbackTriggers)
+
+	deployment = &cftool.Deployment{Region: "eu-west-1", RollbackAlarms: []string{"api-5xx", "db-cpu", "db-disk"}}
+	err := resolveRollbackAlarms(api, deployment, ioutil.Discard)
+	require.EqualError(t, err, "rollback alarm(s) not found in eu-west-1: db-cpu, db-disk")
+	require.Nil(t, deployment.RollbackTriggers)
+}
@@ -0,0 +1,19 @@
+package cli
+
+import (
+	"context"
+	"github.com/fatih/color"
+	manifest2 "github.com/tetratom/cftool/pkg/manifest"
+)
+
+// Schema prints the JSON schema of the manifest format, for editors to
+// complete and check manifests with.
+func Schema(c context.Context, globalOpts GlobalOptions, schemaOpts SchemaOptions) error {
+	data, err := manifest2.JSONSchema()
+	if err != nil {
+		return err
+	}
+
+	_, err = color.Output.Write(data)
+	return err
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// selectStacks lists the names of the stacks in the region of the client that
+// have all the tags of the selector, in alphabetical order. It doesn't use the
+// manifest, so it finds stacks whichever way they were deployed.
+func selectStacks(api cloudformationiface.CloudFormationAPI, selector map[string]string) ([]string, error) {
+	var names []string
+
+	err := api.DescribeStacksPages(
+		&cf.DescribeStacksInput{},
+		func(page *cf.DescribeStacksOutput, lastPage bool) bool {
+			for _, stack := range page.Stacks {
+				if matchesSelector(stack, selector) {
+					names = append(names, aws.StringValue(stack.StackName))
+				}
+			}
+
+			return true
+		})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "list stacks")
+	}
+
+	if len(names) == 0 {
+		return nil, errors.Errorf("no stacks tagged %s", formatSelector(selector))
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func matchesSelector(stack *cf.Stack, selector map[string]string) bool {
+	matched := 0
+	for _, tag := range stack.Tags {
+		if value, ok := selector[aws.StringValue(tag.Key)]; ok && value == aws.StringValue(tag.Value) {
+			matched += 1
+		}
+	}
+
+	return matched == len(selector)
+}
+
+// formatSelector formats the selector as the KEY=VALUE pairs it was given as.
+func formatSelector(selector map[string]string) string {
+	var pairs []string
+	for key, value := range selector {
+		pairs = append(pairs, key+"="+value)
+	}
+
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSelectStacks(t *testing.T) {
+	api := internal.NewOfflineCloudFormation("eu-west-1")
+	deploy := func(name string, tags map[string]string) {
+		deployment := &cftool.Deployment{
+			StackName:    name,
+			TemplateBody: []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n"),
+			Tags:         tags,
+		}
+
+		_, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+		require.NoError(t, err)
+	}
+
+	deploy("payments-db", map[string]string{"team": "payments", "env": "live"})
+	deploy("payments-api", map[string]string{"team": "payments", "env": "test"})
+	deploy("search", map[string]string{"team": "search", "env": "live"})
+
+	stacks, err := selectStacks(api, map[string]string{"team": "payments"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"payments-api", "payments-db"}, stacks)
+
+	stacks, err = selectStacks(api, map[string]string{"team": "payments", "env": "live"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"payments-db"}, stacks)
+
+	_, err = selectStacks(api, map[string]string{"team": "billing", "env": "live"})
+	require.EqualError(t, err, "no stacks tagged env=live, team=billing")
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+)
+
+// deployState is what --state-file records of a deploy, so that the stacks
+// that didn't deploy can be retried with --retry-failed.
+type deployState struct {
+	Tenant string
+
+	// Regions are the regions given with --region, if there were several.
+	Regions []string `json:",omitempty"`
+
+	// EachAccount is set when the deploy was to each account of the manifest.
+	EachAccount bool `json:",omitempty"`
+
+	// Failed are the stacks that failed, were skipped because a dependency
+	// failed, or weren't attempted because an earlier stack failed.
+	Failed []failedStack
+}
+
+type failedStack struct {
+	Stack  string
+	Region string `json:",omitempty"`
+
+	// Account is the id of the account, with --each-account.
+	Account string `json:",omitempty"`
+}
+
+func readDeployState(path string) (*deployState, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state deployState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+
+	return &state, nil
+}
+
+func writeDeployState(path string, state *deployState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// stacks lists the failed stacks once each, whatever their regions.
+func (s *deployState) stacks() []string {
+	seen := make(map[string]bool)
+	var result []string
+
+	for _, failed := range s.Failed {
+		if !seen[failed.Stack] {
+			seen[failed.Stack] = true
+			result = append(result, failed.Stack)
+		}
+	}
+
+	return result
+}
+
+func (s *deployState) includes(deployment *cftool.Deployment) bool {
+	for _, failed := range s.Failed {
+		if failed.Stack == deployment.StackLabel && failed.Region == deployment.Region && failed.Account == accountOf(deployment) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// failedDeployments lists the deployments that didn't succeed. results holds
+// the results of the deployments attempted, in order; those after them
+// weren't attempted.
+func failedDeployments(deployments []*cftool.Deployment, results []result) []failedStack {
+	failed := []failedStack{}
+
+	for i, deployment := range deployments {
+		if i < len(results) && results[i].Err == nil && results[i].Status != "SKIPPED" {
+			continue
+		}
+
+		failed = append(failed, failedStack{
+			Stack:   deployment.StackLabel,
+			Region:  deployment.Region,
+			Account: accountOf(deployment),
+		})
+	}
+
+	return failed
+}
+
+// accountOf returns the account that a deployment was assumed into with
+// --each-account, or nothing.
+func accountOf(deployment *cftool.Deployment) string {
+	if deployment.RoleArn == "" {
+		return ""
+	}
+
+	return deployment.AccountId
+}
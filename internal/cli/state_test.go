@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFailedDeployments(t *testing.T) {
+	deployments := []*cftool.Deployment{
+		{StackLabel: "network", Region: "eu-west-1"},
+		{StackLabel: "db", Region: "eu-west-1"},
+		{StackLabel: "app", Region: "eu-west-1"},
+		{StackLabel: "monitoring", Region: "eu-west-1"},
+		{StackLabel: "dns", Region: "eu-west-1"},
+	}
+
+	results := []result{
+		{Label: "network", Status: "UPDATE_COMPLETE"},
+		{Label: "db", Status: "UPDATE_ROLLBACK_COMPLETE", Err: errors.New("failed")},
+		{Label: "app", Status: "SKIPPED", Note: "depends on failed stack db"},
+		{Label: "monitoring", Status: "NO_CHANGE"},
+	}
+
+	require.Equal(t, []failedStack{
+		{Stack: "db", Region: "eu-west-1"},
+		{Stack: "app", Region: "eu-west-1"},
+		{Stack: "dns", Region: "eu-west-1"},
+	}, failedDeployments(deployments, results))
+}
+
+func TestDeployState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	require.NoError(t, writeDeployState(path, &deployState{
+		Tenant:  "live",
+		Regions: []string{"eu-west-1", "us-east-1"},
+		Failed: []failedStack{
+			{Stack: "db", Region: "eu-west-1"},
+			{Stack: "app", Region: "eu-west-1"},
+			{Stack: "db", Region: "us-east-1"},
+		},
+	}))
+
+	state, err := readDeployState(path)
+	require.NoError(t, err)
+	require.Equal(t, "live", state.Tenant)
+	require.Equal(t, []string{"db", "app"}, state.stacks())
+	require.True(t, state.includes(&cftool.Deployment{StackLabel: "db", Region: "us-east-1"}))
+	require.False(t, state.includes(&cftool.Deployment{StackLabel: "app", Region: "us-east-1"}))
+
+	opts := DeployOptions{RetryFailed: path, Tenant: "test"}
+	_, err = retryOptions(&opts)
+	require.EqualError(t, err, "--retry-failed: state is for tenant live, not test")
+
+	opts = DeployOptions{RetryFailed: path}
+	_, err = retryOptions(&opts)
+	require.NoError(t, err)
+	require.Equal(t, "live", opts.Tenant)
+	require.Equal(t, []string{"db", "app"}, opts.Stacks)
+}
+
+func TestSaveDeployState_NothingDeployed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	require.NoError(t, writeDeployState(path, &deployState{
+		Tenant: "live",
+		Failed: []failedStack{{Stack: "db", Region: "eu-west-1"}},
+	}))
+
+	deployments := []*cftool.Deployment{{StackLabel: "db", Region: "eu-west-1"}}
+	results := []result{{Label: "db", Status: "CHANGES_PENDING", HasChanges: true}}
+
+	for _, opts := range []DeployOptions{
+		{RetryFailed: path, Tenant: "live", DryRun: true},
+		{RetryFailed: path, Tenant: "live", NoExecute: true},
+		{RetryFailed: path, Tenant: "live", DiffOnly: true},
+	} {
+		w := &bytes.Buffer{}
+		require.NoError(t, saveDeployState(opts, nil, deployments, results, w))
+		require.Contains(t, w.String(), "Nothing was deployed, so "+path+" is not updated.")
+
+		state, err := readDeployState(path)
+		require.NoError(t, err)
+		require.Equal(t, []failedStack{{Stack: "db", Region: "eu-west-1"}}, state.Failed)
+	}
+
+	results[0].Status = "UPDATE_COMPLETE"
+	require.NoError(t, saveDeployState(DeployOptions{RetryFailed: path, Tenant: "live"}, nil, deployments, results, &bytes.Buffer{}))
+
+	state, err := readDeployState(path)
+	require.NoError(t, err)
+	require.Empty(t, state.Failed)
+}
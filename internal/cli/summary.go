@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"time"
+)
+
+// result is the outcome of one deployment in a run that covers several.
+type result struct {
+	Label      string
+	Status     string
+	HasChanges bool
+	Elapsed    time.Duration
+	Err        error
+
+	// Note explains a result without an error, e.g. why it was skipped.
+	Note string
+
+	// Exports are the exports of the stack that the deployment changed.
+	Exports []cftool.ExportChange
+}
+
+func newResult(label string, deployer *cftool.Deployer, err error) result {
+	r := result{Label: label, Status: "FAILED", Err: err}
+
+	if deployer != nil {
+		r.HasChanges = deployer.HasChanges
+		r.Exports = deployer.ExportChanges
+
+		if deployer.FinalStatus != "" {
+			r.Status = string(deployer.FinalStatus)
+		}
+	}
+
+	if err == nil && r.Status == "FAILED" {
+		r.Status = "UNKNOWN"
+	}
+
+	if errors.Cause(err) == cftool.ErrAbortedByUser {
+		r.Status = "ABORTED"
+	}
+
+	return r
+}
+
+func (r result) row() pprint.StatusRow {
+	row := pprint.StatusRow{Label: r.Label, Status: r.Status, Elapsed: r.Elapsed, Note: r.Note}
+	if r.Err != nil {
+		row.Note = r.Err.Error()
+	}
+
+	return row
+}
+
+func printSummary(w io.Writer, results []result) {
+	fmt.Fprintf(w, "\n")
+	pprint.Header(w, "Summary")
+
+	updated, unchanged, failed, skipped := 0, 0, 0, 0
+	rows := make([]pprint.StatusRow, len(results))
+
+	for i, r := range results {
+		rows[i] = r.row()
+
+		switch {
+		case r.Err != nil:
+			failed += 1
+		case r.Status == "NO_CHANGE":
+			unchanged += 1
+		case r.Status == "SKIPPED":
+			skipped += 1
+		default:
+			updated += 1
+		}
+	}
+
+	pprint.StatusTable(w, rows)
+	fmt.Fprintf(w, "\n%d updated, %d unchanged, %d failed", updated, unchanged, failed)
+	if skipped > 0 {
+		fmt.Fprintf(w, ", %d skipped", skipped)
+	}
+	fmt.Fprintf(w, ".\n")
+
+	printExportChanges(w, results)
+}
+
+// printExportChanges lists the exports that the deployments changed, which
+// can affect the stacks that import them.
+func printExportChanges(w io.Writer, results []result) {
+	header := false
+
+	for _, r := range results {
+		for _, change := range r.Exports {
+			if !header {
+				fmt.Fprintf(w, "\n")
+				pprint.Warningf(w, "exports changed, which affects the stacks that import them:")
+				header = true
+			}
+
+			fmt.Fprintf(w, "%s: ", r.Label)
+			pprint.ExportChange(w, change.Action, change.Name, change.Before, change.After)
+		}
+	}
+}
+
+// printProgress shows where a run of several deployments stands before the
+// next one starts: the outcome of those done so far, and which are pending.
+func printProgress(w io.Writer, labels []string, results []result) {
+	rows := make([]pprint.StatusRow, len(labels))
+
+	for i, label := range labels {
+		switch {
+		case i < len(results):
+			rows[i] = results[i].row()
+		case i == len(results):
+			rows[i] = pprint.StatusRow{Label: label, Status: "IN_PROGRESS"}
+		default:
+			rows[i] = pprint.StatusRow{Label: label, Status: "PENDING"}
+		}
+	}
+
+	pprint.StatusTable(w, rows)
+	fmt.Fprintf(w, "\n")
+}
+
+// printSection marks the start and the end of each deployment's output in a
+// run of several. On a terminal, the start shows the progress of the whole
+// run; otherwise the end repeats the outcome, so that logs are easy to scan.
+func printSection(w io.Writer, interactive bool, labels []string, results []result) {
+	i := len(results)
+
+	if i > 0 && !interactive {
+		r := results[i-1]
+		pprint.Header(w, "end of %s: %s (%s)", r.Label, r.Status, r.Elapsed.Round(time.Second))
+	}
+
+	if i == len(labels) {
+		return
+	}
+
+	if i > 0 {
+		fmt.Fprint(w, "\n")
+	}
+
+	if interactive {
+		printProgress(w, labels, results)
+	}
+
+	pprint.Header(w, "%s", labels[i])
+}
+
+// summaryError returns the first error among the results. When there are
+// several results, the error also notes how many of them failed.
+func summaryError(results []result) error {
+	var first error
+	failed := 0
+
+	for _, r := range results {
+		if r.Err != nil {
+			failed += 1
+
+			if first == nil {
+				first = r.Err
+			}
+		}
+	}
+
+	if first == nil || len(results) == 1 {
+		return first
+	}
+
+	return errors.Wrapf(first, "%d of %d deployments failed", failed, len(results))
+}
+
+func hasChanges(results []result) bool {
+	for _, r := range results {
+		if r.HasChanges {
+			return true
+		}
+	}
+
+	return false
+}
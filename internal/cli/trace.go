@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// printTrace shows where a deployment spent its time, and how often it polled
+// CloudFormation, if --trace recorded it. It is logged as well.
+func printTrace(w io.Writer, log *cftool.Logger, deployer *cftool.Deployer) {
+	trace := deployer.Trace
+	if trace == nil {
+		return
+	}
+
+	var calls []string
+	for operation, count := range trace.Calls {
+		calls = append(calls, fmt.Sprintf("%s %d", operation, count))
+	}
+
+	sort.Strings(calls)
+	if len(calls) == 0 {
+		calls = []string{"none"}
+	}
+
+	fmt.Fprintf(w, "\n")
+	pprint.Field(w, "Trace", fmt.Sprintf("change set %s, monitoring %s",
+		trace.ChangeSetWait.Round(time.Millisecond), trace.Monitor.Round(time.Millisecond)))
+	pprint.Field(w, "Calls", strings.Join(calls, ", "))
+	log.Log(cftool.LevelInfo, deployer.StackName, "trace", trace.Fields())
+}
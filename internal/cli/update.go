@@ -1,70 +1,342 @@
 package cli
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
 	"github.com/tetratom/cftool/internal"
 	"github.com/tetratom/cftool/pkg/cftool"
 	"github.com/tetratom/cftool/pkg/manifest"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
+// stdinPath is given in place of a file path to read from stdin instead.
+const stdinPath = "-"
+
 func getRegion(api cloudformationiface.CloudFormationAPI) string {
+	if offline, ok := api.(*internal.OfflineCloudFormation); ok {
+		return offline.Region
+	}
+
 	return *api.(*cloudformation.CloudFormation).Config.Region
 }
 
-func Update(c context.Context, globalOpts GlobalOptions, updateOpts UpdateOptions) (err error) {
-	api, err := globalOpts.AWS.CloudFormationClient("")
+// checkUpdateRegions refuses to update the stack in regions outside the
+// AllowedRegions of the manifest given with -f, or else of the one in an
+// enclosing directory. Without a manifest, every region is allowed. A manifest
+// that was only found, and may have nothing to do with the stack, is skipped
+// with a warning if it can't be read.
+func checkUpdateRegions(awsOpts *AWSOptions, updateOpts UpdateOptions, stackName string, regions []string, w io.Writer) error {
+	path := updateOpts.Manifest
+	if path == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		if path, err = findManifest(cwd); err != nil {
+			return nil
+		}
+	}
+
+	_, manifest, err := loadManifest(path, "")
+	if err != nil && updateOpts.Manifest == "" {
+		pprint.Warningf(w, "AllowedRegions of %s not checked: %v", path, err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var deployments []*cftool.Deployment
+	for _, region := range regions {
+		deployments = append(deployments, &cftool.Deployment{StackLabel: stackName, Region: region})
+	}
+
+	return checkRegions(awsOpts, manifest, deployments, updateOpts.Force, w)
+}
+
+func Update(c context.Context, globalOpts GlobalOptions, updateOpts UpdateOptions) error {
+	if updateOpts.Timeout > 0 {
+		var cancel context.CancelFunc
+		c, cancel = context.WithTimeout(c, updateOpts.Timeout)
+		defer cancel()
+	}
+
+	if updateOpts.Batch != "" {
+		return updateBatch(c, globalOpts, updateOpts)
+	}
+
+	results, err := updateStack(c, &globalOpts, updateOpts, color.Output)
 	if err != nil {
-		return
+		return err
+	}
+
+	if err := summaryError(results); err != nil {
+		return err
+	}
+
+	if (updateOpts.DryRun || updateOpts.NoExecute || updateOpts.DiffOnly) && globalOpts.DetailedExit && hasChanges(results) {
+		return cftool.ErrChangesPending
 	}
 
+	return nil
+}
+
+// updateStack updates the stack in each region given, and returns the results.
+// It only returns an error if the update could not be attempted at all.
+func updateStack(c context.Context, globalOpts *GlobalOptions, updateOpts UpdateOptions, w io.Writer) ([]result, error) {
 	stackName, err := deriveStackName(updateOpts)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	parameters, err := parseParameters(updateOpts)
-	if err != nil {
-		return
+	if err = stackName.Validate(); err != nil {
+		return nil, err
+	}
+
+	var templateURL string
+	var templateBody []byte
+
+	if cftool.IsTemplateURL(updateOpts.TemplateFile) {
+		if updateOpts.Preprocess {
+			return nil, errors.New("--preprocess cannot be used with a template url")
+		}
+
+		if updateOpts.ResolveIncludes {
+			return nil, errors.New("--resolve-includes cannot be used with a template url")
+		}
+
+		templateURL, templateBody, err = resolveTemplateURL(c, &globalOpts.AWS, updateOpts.TemplateFile, updateOpts.ShowDiff || updateOpts.FillDefaults || updateOpts.ParametersFromStack != "" || updateOpts.ParametersFromEnv != "")
+	} else {
+		templateBody, err = readTemplate(updateOpts.TemplateFile)
 	}
 
-	templateBody, err := ioutil.ReadFile(updateOpts.TemplateFile)
 	if err != nil {
-		return errors.Wrapf(err, "read template: %s", updateOpts.TemplateFile)
+		return nil, errors.Wrapf(err, "read template: %s", updateOpts.TemplateFile)
 	}
 
-	deployment := cftool.Deployment{
-		AccountId:    "",
-		Region:       "",
-		TemplateBody: templateBody,
-		Parameters:   parameters,
-		StackName:    string(stackName), // todo: type conversion
-		Protected:    !updateOpts.Yes,
+	// A template still to be preprocessed may not parse, and one with
+	// includes may not declare all its parameters yet, so environment
+	// variables are then not matched to its parameters.
+	declared := templateBody
+	if updateOpts.Preprocess || updateOpts.ResolveIncludes {
+		declared = nil
 	}
 
-	deployer := internal.NewDeployer(api, &deployment)
-	deployer.ShowDiff = updateOpts.ShowDiff
+	parameters, err := parseParameters(updateOpts, declared, w)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cftool.RunParameterCommands(parameters, updateOpts.AllowExec); err != nil {
+		return nil, err
+	}
 
 	stsapi, err := globalOpts.AWS.STSClient()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if _, err := deployer.Whoami(color.Output, stsapi, getRegion(api)); err != nil {
-		return err
+	// A single --region is already the session default. Repeating it updates
+	// the stack in each region in turn.
+	regions := []string{""}
+	if len(globalOpts.Regions) > 1 {
+		regions = globalOpts.Regions
 	}
 
-	if err = deployer.Deploy(c, color.Output); err != nil {
-		return errors.Wrapf(err, "deploy stack: %s", stackName)
+	if err := checkUpdateRegions(&globalOpts.AWS, updateOpts, string(stackName), regions, w); err != nil {
+		return nil, err
 	}
 
-	return nil
+	if err := checkDumpPath(updateOpts.DumpChangeSet, len(regions)); err != nil {
+		return nil, err
+	}
+
+	var results []result
+
+	for i, region := range regions {
+		if len(regions) > 1 {
+			printSection(w, globalOpts.Interactive(), regions, results)
+		}
+
+		deployment := cftool.Deployment{
+			AccountId:    "",
+			Region:       region,
+			TemplateBody: templateBody,
+			TemplateURL:  templateURL,
+			Parameters:   parameters,
+			StackName:    string(stackName), // todo: type conversion
+
+			AllowedCapabilities: updateOpts.AllowedCapabilities,
+			ExpectedOutputs:     updateOpts.ExpectedOutputs,
+		}
+
+		if updateOpts.Preprocess {
+			if err := deployment.Preprocess(); err != nil {
+				return nil, errors.Wrap(err, "preprocess template")
+			}
+		}
+
+		if updateOpts.ResolveIncludes {
+			if err := resolveIncludes(c, &globalOpts.AWS, &deployment, filepath.Dir(updateOpts.TemplateFile)); err != nil {
+				return nil, err
+			}
+		}
+
+		if updateOpts.ParametersFromStack != "" {
+			if err := seedParameters(&globalOpts.AWS, &deployment, updateOpts.ParametersFromStack, w); err != nil {
+				return nil, err
+			}
+		}
+
+		if updateOpts.FillDefaults {
+			if err := deployment.FillDefaults(); err != nil {
+				return nil, errors.Wrap(err, "fill parameter defaults")
+			}
+		}
+
+		if len(deployment.TemplateBody) > 0 {
+			if err := deployment.ValidateParameters(); err != nil {
+				return nil, err
+			}
+
+			if err := deployment.CheckResources(updateOpts.RetainOnDelete); err != nil {
+				return nil, errors.Wrap(err, "--retain-on-delete")
+			}
+
+			if err := checkResourceCount(&deployment, w); err != nil {
+				return nil, err
+			}
+
+			if len(updateOpts.RequiredTags) > 0 {
+				if err := warnUntagged(&deployment, w); err != nil {
+					return nil, err
+				}
+			}
+
+			if updateOpts.DryRun {
+				dir := ""
+				if !cftool.IsTemplateURL(updateOpts.TemplateFile) {
+					dir = filepath.Dir(updateOpts.TemplateFile)
+				}
+
+				if err := validateNestedStacks(c, &globalOpts.AWS, &deployment, dir, w); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		start := time.Now()
+		deployer, err := updateOne(c, globalOpts, updateOpts, stsapi, &deployment, w)
+		results = append(results, newResult(region, deployer, err))
+		results[i].Elapsed = time.Since(start)
+
+		if err != nil && !updateOpts.KeepGoing {
+			break
+		}
+	}
+
+	if len(regions) > 1 {
+		printSection(w, globalOpts.Interactive(), regions[:len(results)], results)
+		printSummary(w, results)
+	}
+
+	return results, nil
+}
+
+func updateOne(
+	c context.Context,
+	globalOpts *GlobalOptions,
+	updateOpts UpdateOptions,
+	stsapi stsiface.STSAPI,
+	deployment *cftool.Deployment,
+	w io.Writer,
+) (*cftool.Deployer, error) {
+	api, err := globalOpts.AWS.CloudFormationClient(deployment.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	deployer := cftool.NewDeployer(api, deployment)
+	deployer.Options = cftool.Options{
+		ShowDiff:            updateOpts.ShowDiff,
+		DiffOnly:            updateOpts.DiffOnly,
+		DiffMode:            globalOpts.DiffMode,
+		IgnoreWhitespace:    globalOpts.IgnoreWhitespace,
+		SemanticDiff:        globalOpts.SemanticDiff,
+		Interactive:         globalOpts.Interactive(),
+		Log:                 globalOpts.Log,
+		EventLog:            globalOpts.EventLog,
+		Trace:               globalOpts.newTrace(),
+		RateLimiter:         globalOpts.RateLimiter,
+		DryRun:              updateOpts.DryRun,
+		NoExecute:           updateOpts.NoExecute,
+		SortOutputs:         updateOpts.SortOutputs,
+		Yes:                 updateOpts.Yes,
+		KeepFailedChangeSet: updateOpts.KeepFailed,
+		CancelOnTimeout:     updateOpts.CancelOnTimeout,
+		Heartbeat:           updateOpts.Heartbeat,
+		ChangeSetMaxWait:    updateOpts.MaxWait,
+		ChangeSetMaxPending: updateOpts.MaxPending,
+		FailOnDrift:         updateOpts.FailOnDrift,
+		WaitIfBusy:          updateOpts.WaitIfBusy,
+		RetainOnDelete:      updateOpts.RetainOnDelete,
+		DeleteFailedCreates: updateOpts.DeleteFailedCreates,
+		NoDeleteOnRollback:  updateOpts.NoDeleteOnRollback,
+		ReplaceOnFailure:    updateOpts.ReplaceOnFailure,
+		ChangeFilter:        updateOpts.ChangeFilter,
+		DetailedChangeSet:   updateOpts.DetailedChangeSet,
+		Comment:             updateOpts.Comment,
+		TrackTemplate:       updateOpts.TrackTemplate,
+		RequiredTags:        updateOpts.RequiredTags,
+		Unattended:          updateOpts.unattended,
+		HandleInterrupts:    true,
+	}
+
+	id, err := deployer.Whoami(w, stsapi, getRegion(api))
+	if err != nil {
+		return deployer, err
+	}
+
+	deployer.Description = changeSetDescription(updateOpts.Description, *id.Arn, []string{updateOpts.TemplateFile})
+	deployer.DumpChangeSet = dumpPath(updateOpts.DumpChangeSet, getRegion(api), *id.Account, deployment.StackName)
+
+	if updateOpts.LockTable != "" {
+		err := useLock(&globalOpts.AWS, deployer, updateOpts.LockTable, updateOpts.ForceUnlock, id, getRegion(api))
+		if err != nil {
+			return deployer, err
+		}
+	}
+
+	err = deployer.Deploy(c, w)
+	if err != nil && c.Err() == context.DeadlineExceeded {
+		err = errors.Errorf("timed out after %s", updateOpts.Timeout)
+	}
+
+	printTrace(w, globalOpts.Log, deployer)
+
+	notify(globalOpts, deployer, *id.Arn, err)
+	if err != nil {
+		return deployer, errors.Wrapf(err, "deploy stack: %s", deployment.StackName)
+	}
+
+	return deployer, nil
 }
 
 func deriveStackName(opts UpdateOptions) (cftool.StackName, error) {
@@ -78,7 +350,7 @@ func deriveStackName(opts UpdateOptions) (cftool.StackName, error) {
 	}
 
 	for _, list := range lists {
-		if len(list) == 0 {
+		if len(list) == 0 || list[0] == stdinPath {
 			continue
 		}
 
@@ -89,7 +361,110 @@ func deriveStackName(opts UpdateOptions) (cftool.StackName, error) {
 	return "", errors.New("unable to derive stack name")
 }
 
-func parseParameters(update UpdateOptions) (cftool.Parameters, error) {
+// resolveIncludes replaces the cftool::Include partials of the template.
+// Relative paths are resolved against dir, and partials in S3 are fetched
+// with the AWS options.
+func resolveIncludes(c context.Context, awsOpts *AWSOptions, deployment *cftool.Deployment, dir string) error {
+	fetch := func(url string) ([]byte, error) {
+		_, body, err := resolveTemplateURL(c, awsOpts, url, true)
+		return body, err
+	}
+
+	return errors.Wrap(deployment.ResolveIncludes(dir, fetch), "resolve includes")
+}
+
+// validateNestedStacks validates the templates of the nested stacks of the
+// deployment, which validating the template itself doesn't cover. Relative
+// paths are resolved against dir, and templates in S3 are fetched with the
+// AWS options.
+func validateNestedStacks(c context.Context, awsOpts *AWSOptions, deployment *cftool.Deployment, dir string, w io.Writer) error {
+	api, err := awsOpts.CloudFormationClient(deployment.Region)
+	if err != nil {
+		return err
+	}
+
+	fetch := func(url string) ([]byte, error) {
+		_, body, err := resolveTemplateURL(c, awsOpts, url, true)
+		return body, err
+	}
+
+	nested, err := cftool.ValidateNestedStacks(api, deployment.TemplateBody, dir, fetch)
+	if err != nil {
+		return err
+	}
+
+	if len(nested) > 0 {
+		pprint.Field(w, "Nested", fmt.Sprintf("%d nested stack template(s) valid", len(nested)))
+	}
+
+	return nil
+}
+
+// readTemplate reads a template from a file, or from stdin if the path is "-".
+func readTemplate(path string) ([]byte, error) {
+	if path != stdinPath {
+		return ioutil.ReadFile(path)
+	}
+
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errors.New("no template given on stdin")
+	}
+
+	return data, nil
+}
+
+// resolveTemplateURL validates the url of a template in S3, and downloads the
+// template only if the body is needed, e.g. for diffing.
+func resolveTemplateURL(c context.Context, awsOpts *AWSOptions, rawurl string, needBody bool) (string, []byte, error) {
+	u, err := cftool.ParseTemplateURL(rawurl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !needBody {
+		return u.URL, nil, nil
+	}
+
+	api, err := awsOpts.S3Client()
+	if err != nil {
+		return "", nil, err
+	}
+
+	region, err := s3manager.GetBucketRegionWithClient(c, api, u.Bucket)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "get region of bucket %s", u.Bucket)
+	}
+
+	out, err := api.GetObjectWithContext(c, &s3.GetObjectInput{
+		Bucket: aws.String(u.Bucket),
+		Key:    aws.String(u.Key),
+	}, func(r *request.Request) {
+		r.Config.Region = aws.String(region)
+	})
+
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "get s3://%s/%s", u.Bucket, u.Key)
+	}
+	defer out.Body.Close()
+
+	body, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "get s3://%s/%s", u.Bucket, u.Key)
+	}
+
+	return u.URL, body, nil
+}
+
+// parseParameters merges the parameter files, then the environment, then the
+// -P parameters, then the overrides file, each taking precedence over the ones
+// before. Values replaced by the overrides file are reported, since it is
+// meant to win over everything.
+func parseParameters(update UpdateOptions, templateBody []byte, w io.Writer) (cftool.Parameters, error) {
 	files := update.ParameterFiles
 	params := update.Parameters
 	result := make(map[string]string)
@@ -106,6 +481,12 @@ func parseParameters(update UpdateOptions) (cftool.Parameters, error) {
 		}
 	}
 
+	if update.ParametersFromEnv != "" {
+		if err := mergeEnvParameters(result, update.ParametersFromEnv, templateBody, w); err != nil {
+			return nil, err
+		}
+	}
+
 	if len(update.Parameters) > 0 {
 		for _, param := range params {
 			k, v := parseParameterString(param)
@@ -113,9 +494,127 @@ func parseParameters(update UpdateOptions) (cftool.Parameters, error) {
 		}
 	}
 
+	if update.OverridesFile != "" {
+		overrides, err := manifest.ReadParametersFromFile(update.OverridesFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "--overrides-file")
+		}
+
+		var keys []string
+		for k := range overrides {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+		for _, k := range keys {
+			if old, ok := result[k]; ok && old != overrides[k] {
+				pprint.Field(w, "Override", fmt.Sprintf("%s=%s (was %s)", k, overrides[k], old))
+			}
+
+			result[k] = overrides[k]
+		}
+	}
+
 	return result, nil
 }
 
+// mergeEnvParameters sets the parameters given by environment variables with
+// the prefix. Only their names are shown, since environment variables are a
+// common way to pass secrets.
+func mergeEnvParameters(params map[string]string, prefix string, templateBody []byte, w io.Writer) error {
+	values, err := cftool.EnvParameters(prefix, os.Environ(), templateBody)
+	if err != nil {
+		return errors.Wrap(err, "--parameters-from-env")
+	}
+
+	var names []string
+	for name, value := range values {
+		params[name] = value
+		names = append(names, name)
+	}
+
+	if len(names) > 0 {
+		sort.Strings(names)
+		pprint.Field(w, "FromEnv", strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+// maskedParameterValue is what CloudFormation shows for NoEcho parameters.
+const maskedParameterValue = "****"
+
+// seedParameters sets the parameters of the deployment that have no explicit
+// value to those of another stack in the same region. Only the parameters the
+// template declares are taken.
+func seedParameters(awsOpts *AWSOptions, deployment *cftool.Deployment, stackName string, w io.Writer) error {
+	api, err := awsOpts.CloudFormationClient(deployment.Region)
+	if err != nil {
+		return err
+	}
+
+	out, err := api.DescribeStacks(&cloudformation.DescribeStacksInput{StackName: aws.String(stackName)})
+	if err != nil {
+		return errors.Wrapf(err, "describe stack %s", stackName)
+	}
+
+	values := make(map[string]string)
+	for _, param := range out.Stacks[0].Parameters {
+		key, value := aws.StringValue(param.ParameterKey), aws.StringValue(param.ParameterValue)
+
+		if value == maskedParameterValue {
+			pprint.Warningf(w, "not taking parameter %s from stack %s, as its value is hidden", key, stackName)
+			continue
+		}
+
+		values[key] = value
+	}
+
+	return errors.Wrap(deployment.SeedParameters(values), "--parameters-from-stack")
+}
+
+// resourceCountWarning is the number of resources from which cftool warns
+// that a template is getting close to cftool.MaxResources.
+const resourceCountWarning = cftool.MaxResources * 9 / 10
+
+// checkResourceCount fails if the template of the deployment has more resources
+// than a stack can hold, rather than letting CloudFormation fail the change
+// set, and warns if it is getting close.
+func checkResourceCount(deployment *cftool.Deployment, w io.Writer) error {
+	count, err := deployment.ResourceCount()
+	if err != nil {
+		return err
+	}
+
+	if count > cftool.MaxResources {
+		return errors.Errorf("stack %s: template has %d resources, but a stack can have at most %d; move some into nested stacks",
+			deployment.StackName, count, cftool.MaxResources)
+	}
+
+	if count >= resourceCountWarning {
+		pprint.Warningf(w, "stack %s: template has %d of the %d resources a stack can have; consider moving some into nested stacks",
+			deployment.StackName, count, cftool.MaxResources)
+	}
+
+	return nil
+}
+
+// warnUntagged lists the resources of the deployment that won't inherit the
+// tags of the stack.
+func warnUntagged(deployment *cftool.Deployment, w io.Writer) error {
+	untagged, err := deployment.UntaggedResources()
+	if err != nil {
+		return err
+	}
+
+	if len(untagged) > 0 {
+		pprint.Warningf(w, "stack %s: these resources won't inherit stack tags: %s",
+			deployment.StackName, strings.Join(untagged, ", "))
+	}
+
+	return nil
+}
+
 func parseParameterString(str string) (string, string) {
 	split := strings.SplitN(str, "=", 2)
 	key := split[0]
@@ -1,7 +1,18 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/internal"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -17,3 +28,271 @@ func TestParseParameterFromCommandLine(t *testing.T) {
 	checkParam(t, "a==b", "a", "=b")
 	checkParam(t, "a==", "a", "=")
 }
+
+func TestDeriveStackName(t *testing.T) {
+	name, err := deriveStackName(UpdateOptions{TemplateFile: "templates/network.yml"})
+	assert.NoError(t, err)
+	assert.Equal(t, "network", string(name))
+
+	name, err = deriveStackName(UpdateOptions{
+		TemplateFile:   "-",
+		ParameterFiles: []string{"stacks/live-network.json"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "live-network", string(name))
+
+	_, err = deriveStackName(UpdateOptions{TemplateFile: "-"})
+	assert.Error(t, err)
+}
+
+func TestSeedParameters(t *testing.T) {
+	awsOpts := &AWSOptions{Offline: true}
+	api, err := awsOpts.CloudFormationClient("eu-west-1")
+	require.NoError(t, err)
+
+	// Deploy the stack to copy from.
+	_, err = api.CreateChangeSetWithContext(nil, &cloudformation.CreateChangeSetInput{
+		StackName:     aws.String("live"),
+		ChangeSetName: aws.String("create"),
+		ChangeSetType: aws.String(cloudformation.ChangeSetTypeCreate),
+		TemplateBody:  aws.String("Resources: {}\n"),
+		Parameters: []*cloudformation.Parameter{
+			{ParameterKey: aws.String("InstanceType"), ParameterValue: aws.String("m5.large")},
+			{ParameterKey: aws.String("Password"), ParameterValue: aws.String(maskedParameterValue)},
+			{ParameterKey: aws.String("Environment"), ParameterValue: aws.String("live")},
+		},
+	})
+	require.NoError(t, err)
+	_, err = api.ExecuteChangeSetWithContext(nil, &cloudformation.ExecuteChangeSetInput{
+		StackName:     aws.String("live"),
+		ChangeSetName: aws.String("create"),
+	})
+	require.NoError(t, err)
+
+	deployment := &cftool.Deployment{
+		Region:       "eu-west-1",
+		TemplateBody: []byte("Parameters: {InstanceType: {Type: String}, Password: {Type: String}, Environment: {Type: String}}\n"),
+		Parameters:   map[string]string{"Environment": "test"},
+	}
+
+	require.NoError(t, seedParameters(awsOpts, deployment, "live", ioutil.Discard))
+	require.Equal(t, map[string]string{"InstanceType": "m5.large", "Environment": "test"}, deployment.Parameters)
+
+	require.Error(t, seedParameters(awsOpts, deployment, "nonexistent", ioutil.Discard))
+}
+
+func TestCheckResourceCount(t *testing.T) {
+	template := func(count int) []byte {
+		body := "Resources:\n"
+		for i := 0; i < count; i++ {
+			body += fmt.Sprintf("  Queue%d: {Type: AWS::SQS::Queue}\n", i)
+		}
+
+		return []byte(body)
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, checkResourceCount(&cftool.Deployment{TemplateBody: template(10)}, &out))
+	require.Empty(t, out.String())
+
+	require.NoError(t, checkResourceCount(&cftool.Deployment{TemplateBody: template(460)}, &out))
+	require.Contains(t, out.String(), "460 of the 500 resources")
+
+	require.Error(t, checkResourceCount(&cftool.Deployment{TemplateBody: template(501)}, &out))
+}
+
+func TestParseParameters_overridesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	paramsPath := filepath.Join(dir, "params.json")
+	require.NoError(t, ioutil.WriteFile(paramsPath, []byte(`[
+  {"ParameterKey": "ImageTag", "ParameterValue": "latest"},
+  {"ParameterKey": "Replicas", "ParameterValue": "2"},
+  {"ParameterKey": "Environment", "ParameterValue": "test"}
+]`), 0600))
+
+	overridesPath := filepath.Join(dir, "overrides.json")
+	require.NoError(t, ioutil.WriteFile(overridesPath, []byte(`[
+  {"ParameterKey": "ImageTag", "ParameterValue": "abc123"},
+  {"ParameterKey": "Replicas", "ParameterValue": "4"},
+  {"ParameterKey": "Environment", "ParameterValue": "test"},
+  {"ParameterKey": "BuildId", "ParameterValue": "17"}
+]`), 0600))
+
+	w := &bytes.Buffer{}
+	params, err := parseParameters(UpdateOptions{
+		ParameterFiles: []string{paramsPath},
+		Parameters:     []string{"Replicas=3"},
+		OverridesFile:  overridesPath,
+	}, nil, w)
+	require.NoError(t, err)
+	require.Equal(t, cftool.Parameters{
+		"ImageTag":    "abc123",
+		"Replicas":    "4",
+		"Environment": "test",
+		"BuildId":     "17",
+	}, params)
+
+	require.Contains(t, w.String(), "ImageTag=abc123 (was latest)")
+	require.Contains(t, w.String(), "Replicas=4 (was 3)")
+	require.NotContains(t, w.String(), "Environment")
+	require.NotContains(t, w.String(), "BuildId")
+}
+
+func TestParseParameters_fromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	paramsPath := filepath.Join(dir, "params.json")
+	require.NoError(t, ioutil.WriteFile(paramsPath, []byte(`[
+  {"ParameterKey": "ImageTag", "ParameterValue": "latest"},
+  {"ParameterKey": "Replicas", "ParameterValue": "2"}
+]`), 0600))
+
+	os.Setenv("CFTOOL_TEST_IMAGE_TAG", "abc123")
+	os.Setenv("CFTOOL_TEST_REPLICAS", "4")
+	defer os.Unsetenv("CFTOOL_TEST_IMAGE_TAG")
+	defer os.Unsetenv("CFTOOL_TEST_REPLICAS")
+
+	w := &bytes.Buffer{}
+	params, err := parseParameters(UpdateOptions{
+		ParameterFiles:    []string{paramsPath},
+		Parameters:        []string{"Replicas=3"},
+		ParametersFromEnv: "CFTOOL_TEST",
+	}, []byte("Parameters:\n  ImageTag: {Type: String}\n  Replicas: {Type: Number}\n"), w)
+	require.NoError(t, err)
+	require.Equal(t, cftool.Parameters{"ImageTag": "abc123", "Replicas": "3"}, params)
+	require.Contains(t, w.String(), "ImageTag, Replicas")
+	require.NotContains(t, w.String(), "abc123")
+}
+
+func TestUpdateStack_AllowedRegions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	manifestPath := filepath.Join(dir, ".cftool.yml")
+	require.NoError(t, ioutil.WriteFile(manifestPath, []byte(`
+Version: "1.1"
+Global:
+  AllowedRegions: [eu-central-1]
+`), 0644))
+
+	template := filepath.Join(dir, "template.yml")
+	require.NoError(t, ioutil.WriteFile(template, []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n"), 0644))
+
+	update := func(region string, force bool) ([]result, string, error) {
+		buf := &bytes.Buffer{}
+		globalOpts := GlobalOptions{AWS: AWSOptions{Offline: true, Region: region}}
+		updateOpts := UpdateOptions{
+			StackName:    "app",
+			TemplateFile: template,
+			DryRun:       true,
+			Manifest:     manifestPath,
+			Force:        force,
+		}
+
+		results, err := updateStack(context.Background(), &globalOpts, updateOpts, buf)
+		return results, buf.String(), err
+	}
+
+	_, _, err = update("eu-west-1", false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "stack app: region eu-west-1 is not in AllowedRegions (eu-central-1); use --force")
+
+	results, out, err := update("eu-west-1", true)
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.Contains(t, out, "region eu-west-1 is not in AllowedRegions")
+
+	results, _, err = update("eu-central-1", false)
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+}
+
+func TestUpdateStack_DumpChangeSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	template := filepath.Join(dir, "template.yml")
+	require.NoError(t, ioutil.WriteFile(template, []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n"), 0644))
+
+	update := func(dump string) error {
+		globalOpts := GlobalOptions{
+			AWS:     AWSOptions{Offline: true},
+			Regions: []string{"eu-west-1", "us-east-1"},
+		}
+		updateOpts := UpdateOptions{
+			StackName:     "app",
+			TemplateFile:  template,
+			DryRun:        true,
+			DumpChangeSet: dump,
+		}
+
+		results, err := updateStack(context.Background(), &globalOpts, updateOpts, ioutil.Discard)
+		if err == nil {
+			err = summaryError(results)
+		}
+
+		return err
+	}
+
+	// The change sets of two regions don't fit in one file.
+	file := filepath.Join(dir, "plan.json")
+	require.EqualError(t, update(file), "--dump-changeset "+file+" must be an existing directory for 2 change sets")
+
+	dumpDir := filepath.Join(dir, "plan")
+	require.NoError(t, os.Mkdir(dumpDir, 0700))
+	require.NoError(t, update(dumpDir))
+
+	for _, region := range []string{"eu-west-1", "us-east-1"} {
+		_, err := os.Stat(filepath.Join(dumpDir, "app."+internal.OfflineAccountId+"."+region+".json"))
+		require.NoError(t, err, region)
+	}
+}
+
+func TestUpdateStack_InvalidParentManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// A manifest in an enclosing directory that has nothing to do with the
+	// stack, and doesn't even validate.
+	manifestPath := filepath.Join(dir, ".cftool.yml")
+	require.NoError(t, ioutil.WriteFile(manifestPath, []byte("Version: \"1.1\"\nStacks: nope\n"), 0644))
+
+	work := filepath.Join(dir, "work")
+	require.NoError(t, os.Mkdir(work, 0700))
+	template := filepath.Join(work, "template.yml")
+	require.NoError(t, ioutil.WriteFile(template, []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n"), 0644))
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(work))
+	defer os.Chdir(cwd)
+
+	update := func(manifest string) (string, error) {
+		buf := &bytes.Buffer{}
+		globalOpts := GlobalOptions{AWS: AWSOptions{Offline: true, Region: "eu-west-1"}}
+		updateOpts := UpdateOptions{StackName: "app", TemplateFile: template, DryRun: true, Manifest: manifest}
+		results, err := updateStack(context.Background(), &globalOpts, updateOpts, buf)
+		if err == nil {
+			err = summaryError(results)
+		}
+
+		return buf.String(), err
+	}
+
+	// Found by itself, it is only warned about.
+	out, err := update("")
+	require.NoError(t, err)
+	require.Contains(t, out, "WARNING! AllowedRegions of "+manifestPath+" not checked: ")
+
+	// Given with -f, it has to be valid.
+	_, err = update(manifestPath)
+	require.Error(t, err)
+}
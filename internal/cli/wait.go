@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"time"
+)
+
+// Wait attaches to an operation in progress on a stack, and monitors it until
+// it finishes. With a selector, it waits for each stack with its tags in turn.
+func Wait(c context.Context, globalOpts GlobalOptions, waitOpts WaitOptions) error {
+	if waitOpts.StackName == "" && len(waitOpts.Selector) == 0 {
+		return errors.New("expected a stack name (-n) or --selector")
+	} else if waitOpts.StackName != "" && len(waitOpts.Selector) > 0 {
+		return errors.New("expected a stack name (-n) or --selector, not both")
+	}
+
+	since, err := parseSince(waitOpts.Since, time.Now())
+	if err != nil {
+		return err
+	}
+
+	api, err := globalOpts.AWS.CloudFormationClient("")
+	if err != nil {
+		return err
+	}
+
+	stacks := []string{waitOpts.StackName}
+	if len(waitOpts.Selector) > 0 {
+		if stacks, err = selectStacks(api, waitOpts.Selector); err != nil {
+			return err
+		}
+	}
+
+	for i, stack := range stacks {
+		if len(stacks) > 1 {
+			if i > 0 {
+				fmt.Fprintf(color.Output, "\n")
+			}
+
+			pprint.Header(color.Output, "%s", stack)
+		}
+
+		deployer := cftool.NewDeployer(api, &cftool.Deployment{StackName: stack})
+		deployer.Interactive = globalOpts.Interactive()
+		deployer.Log = globalOpts.Log
+		deployer.EventLog = globalOpts.EventLog
+		deployer.RateLimiter = globalOpts.RateLimiter
+
+		if err := deployer.Wait(c, color.Output, since); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseSince parses either a duration before now, or an RFC 3339 timestamp. An
+// empty string gives the zero time.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.Errorf("--since %s: expected a duration such as 30m, or an RFC 3339 time", value)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2019, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	since, err := parseSince("", now)
+	require.NoError(t, err)
+	require.True(t, since.IsZero())
+
+	since, err = parseSince("30m", now)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(-30*time.Minute), since)
+
+	since, err = parseSince("2019-08-01T10:00:00Z", now)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(-2*time.Hour), since)
+
+	_, err = parseSince("yesterday", now)
+	require.Error(t, err)
+}
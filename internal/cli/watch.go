@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// watchInterval is how often watched files are checked for changes.
+const watchInterval = 500 * time.Millisecond
+
+// fileState is what is compared to tell whether a file has changed. A file
+// that doesn't exist has the zero state.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFiles(paths []string) map[string]fileState {
+	states := make(map[string]fileState, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			states[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+		} else {
+			states[path] = fileState{}
+		}
+	}
+
+	return states
+}
+
+// waitForChange polls the files until one of them is modified, created or
+// deleted, or the context is done. Polling works the same everywhere, also for
+// editors that save by replacing the file.
+func waitForChange(c context.Context, paths []string, interval time.Duration) error {
+	before := statFiles(paths)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Done():
+			return c.Err()
+		case <-ticker.C:
+		}
+
+		for path, state := range statFiles(paths) {
+			if state != before[path] {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitForChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	template := filepath.Join(dir, "template.yml")
+	params := filepath.Join(dir, "params.json")
+	require.NoError(t, ioutil.WriteFile(template, []byte("Resources: {}\n"), 0644))
+
+	c, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, waitForChange(c, []string{template, params}, 10*time.Millisecond))
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_ = ioutil.WriteFile(params, []byte("[]\n"), 0644)
+	}()
+
+	c, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, waitForChange(c, []string{template, params}, 10*time.Millisecond))
+}
+
+func TestMergeFiles(t *testing.T) {
+	require.Equal(t, []string{"a", "b", "c"}, mergeFiles([]string{"c", "a", ""}, []string{"b", "a"}))
+	require.Nil(t, mergeFiles([]string{""}, nil))
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"os"
+)
+
+// Whoami prints the identity that cftool acts as, along with the region,
+// profile and credentials in effect and where each of them comes from. It
+// helps to debug which setting takes precedence.
+func Whoami(c context.Context, globalOpts GlobalOptions, whoamiOpts WhoamiOptions) error {
+	sess, err := globalOpts.AWS.Session()
+	if err != nil {
+		return err
+	}
+
+	profile, source := profileSource(&globalOpts.AWS)
+	pprint.Field(color.Output, "Profile", fmt.Sprintf("%s (%s)", profile, source))
+
+	if region := aws.StringValue(sess.Config.Region); region != "" {
+		pprint.Field(color.Output, "Region", fmt.Sprintf("%s (%s)", region, regionSource(&globalOpts.AWS)))
+	} else {
+		pprint.Field(color.Output, "Region", "(not set)")
+	}
+
+	if globalOpts.AWS.Endpoint != "" {
+		pprint.Field(color.Output, "Endpoint", globalOpts.AWS.Endpoint+" (--endpoint)")
+	}
+
+	if bundle, source := globalOpts.AWS.caBundle(); bundle != "" {
+		pprint.Field(color.Output, "CA Bundle", fmt.Sprintf("%s (%s)", bundle, source))
+	}
+
+	if proxy, source := proxySource(&globalOpts.AWS); proxy != "" {
+		pprint.Field(color.Output, "Proxy", fmt.Sprintf("%s (%s)", proxy, source))
+	}
+
+	creds, err := sess.Config.Credentials.Get()
+	if err != nil {
+		return errors.Wrap(err, "get credentials")
+	}
+
+	pprint.Field(color.Output, "Provider", creds.ProviderName)
+
+	stsapi, err := globalOpts.AWS.STSClient()
+	if err != nil {
+		return err
+	}
+
+	id, err := stsapi.GetCallerIdentityWithContext(c, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return errors.Wrap(err, "get caller identity")
+	}
+
+	pprint.Field(color.Output, "Account", aws.StringValue(id.Account))
+	pprint.Field(color.Output, "Role", aws.StringValue(id.Arn))
+	return nil
+}
+
+// profileSource returns the profile in effect, and where it was set, in the
+// order of precedence used by the AWS SDK.
+func profileSource(awsOpts *AWSOptions) (string, string) {
+	if awsOpts.Profile != "" {
+		return awsOpts.Profile, "--profile"
+	}
+
+	for _, name := range []string{"AWS_PROFILE", "AWS_DEFAULT_PROFILE"} {
+		if value := os.Getenv(name); value != "" {
+			return value, "$" + name
+		}
+	}
+
+	return "default", "default"
+}
+
+// regionSource describes where the region in effect was set, in the order of
+// precedence used by the AWS SDK.
+func regionSource(awsOpts *AWSOptions) string {
+	if awsOpts.Region != "" {
+		return "--region"
+	}
+
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if os.Getenv(name) != "" {
+			return "$" + name
+		}
+	}
+
+	profile, _ := profileSource(awsOpts)
+	return "profile " + profile + " in the shared config file"
+}
+
+// proxySource returns the proxy in effect, if any, and where it was set. Like
+// Go's http.ProxyFromEnvironment, the lowercase variable is also read.
+func proxySource(awsOpts *AWSOptions) (string, string) {
+	if awsOpts.Proxy != "" {
+		return awsOpts.Proxy, "--proxy"
+	}
+
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy"} {
+		if value := os.Getenv(name); value != "" {
+			return value, "$" + name
+		}
+	}
+
+	return "", ""
+}
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestProfileAndRegionSource(t *testing.T) {
+	for _, name := range []string{"AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION"} {
+		defer os.Setenv(name, os.Getenv(name))
+		require.NoError(t, os.Unsetenv(name))
+	}
+
+	opts := AWSOptions{}
+	profile, source := profileSource(&opts)
+	require.Equal(t, "default", profile)
+	require.Equal(t, "default", source)
+	require.Equal(t, "profile default in the shared config file", regionSource(&opts))
+
+	require.NoError(t, os.Setenv("AWS_PROFILE", "dev"))
+	require.NoError(t, os.Setenv("AWS_DEFAULT_REGION", "eu-west-1"))
+	profile, source = profileSource(&opts)
+	require.Equal(t, "dev", profile)
+	require.Equal(t, "$AWS_PROFILE", source)
+	require.Equal(t, "$AWS_DEFAULT_REGION", regionSource(&opts))
+
+	opts = AWSOptions{Profile: "prod", Region: "us-east-1"}
+	profile, source = profileSource(&opts)
+	require.Equal(t, "prod", profile)
+	require.Equal(t, "--profile", source)
+	require.Equal(t, "--region", regionSource(&opts))
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"io"
 	"io/ioutil"
@@ -11,6 +12,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -20,8 +23,106 @@ type cachedCredentials struct {
 	Profile    string
 }
 
+// credentialExpiryWindow refreshes credentials a little before they expire,
+// so that they don't run out in the middle of a request.
+const credentialExpiryWindow = 1 * time.Minute
+
 func (c *cachedCredentials) IsExpired() bool {
-	return c.Expiration.Before(time.Now())
+	return c.Expiration.Add(-credentialExpiryWindow).Before(time.Now())
+}
+
+// configFilePath is the location of the shared AWS config file.
+func configFilePath() string {
+	if path := os.Getenv("AWS_CONFIG_FILE"); path != "" {
+		return path
+	}
+
+	homedir := os.Getenv("HOME")
+	if runtime.GOOS == "windows" {
+		homedir = os.Getenv("USERPROFILE")
+	}
+
+	return filepath.Join(homedir, ".aws", "config")
+}
+
+// profileChain describes the roles assumed for a profile in the shared config
+// file, following source_profile until the profile that holds the base
+// credentials, e.g. "target(arn:aws:iam::1:role/a) <- base". Roles assumed
+// with MFA include the device serial, e.g. "target(arn mfa=serial)".
+func profileChain(profile string) string {
+	sections := readConfigSections(configFilePath())
+	seen := make(map[string]bool)
+	var chain []string
+
+	for name := profile; name != "" && !seen[name]; {
+		seen[name] = true
+		section := sections[name]
+
+		if arn := section["role_arn"]; arn != "" {
+			if serial := section["mfa_serial"]; serial != "" {
+				arn += " mfa=" + serial
+			}
+
+			chain = append(chain, name+"("+arn+")")
+		} else {
+			chain = append(chain, name)
+		}
+
+		name = section["source_profile"]
+	}
+
+	return strings.Join(chain, " <- ")
+}
+
+// ProfilesForAccount returns the profiles in the shared config file that
+// assume a role in the given account, or sign in to it through SSO.
+func ProfilesForAccount(accountId string) []string {
+	var result []string
+
+	for name, section := range readConfigSections(configFilePath()) {
+		account := section["sso_account_id"]
+
+		if parsed, err := arn.Parse(section["role_arn"]); err == nil {
+			account = parsed.AccountID
+		}
+
+		if account == accountId {
+			result = append(result, name)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// readConfigSections reads the key-value pairs of each profile in an AWS
+// config file. Errors are ignored, as the file is optional.
+func readConfigSections(path string) map[string]map[string]string {
+	result := make(map[string]map[string]string)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return result
+	}
+
+	var section map[string]string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			name = strings.TrimSpace(strings.TrimPrefix(name, "profile "))
+			section = make(map[string]string)
+			result[name] = section
+
+		case section != nil && strings.Contains(line, "="):
+			kv := strings.SplitN(line, "=", 2)
+			section[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	return result
 }
 
 func getCacheDir() string {
@@ -60,12 +161,22 @@ func NewCachedCredentialProvider(
 		profile = os.Getenv("AWS_PROFILE")
 	}
 
+	if profile == "" {
+		profile = "default"
+	}
+
+	// Key the cache by the whole chain of roles, so that changing any role in
+	// the chain doesn't return credentials for the old one. The chain includes
+	// MFA serials, so credentials that took a token to get are only reused for
+	// the same device, and later runs don't prompt for a token again.
+	chain := profileChain(profile)
+
 	hash := md5.New()
-	_, _ = io.WriteString(hash, profile)
+	_, _ = io.WriteString(hash, chain)
 	digest := hex.EncodeToString(hash.Sum(nil))
 	credpath := filepath.Join(getCacheDir(), digest+".json")
 
-	cp := &cachedCredentialProvider{creds, cachedCredentials{}, credpath, profile}
+	cp := &cachedCredentialProvider{creds, cachedCredentials{}, credpath, chain}
 	cp.read()
 	return cp
 }
@@ -126,19 +237,35 @@ func (my *cachedCredentialProvider) write(v credentials.Value, exp time.Time) {
 
 func (my *cachedCredentialProvider) Retrieve() (credentials.Value, error) {
 	if !my.outer.IsExpired() {
-		return my.outer.Credential, nil
-	} else {
-		v, err := my.inner.Get()
+		v := my.outer.Credential
+		v.ProviderName += " (cached)"
+		return v, nil
+	}
 
-		if err == nil {
-			exp, _ := my.inner.ExpiresAt()
-			my.write(v, exp)
-		}
+	// Refresh the whole chain, rather than getting credentials from the inner
+	// provider that are about to expire.
+	my.inner.Expire()
 
+	v, err := my.inner.Get()
+	if err != nil {
 		return v, err
 	}
+
+	exp, err := my.inner.ExpiresAt()
+	if err != nil {
+		// Credentials that don't expire are not worth caching.
+		return v, nil
+	}
+
+	my.write(v, exp)
+	return v, nil
 }
 
 func (my *cachedCredentialProvider) IsExpired() bool {
-	return my.outer.IsExpired() && my.inner.IsExpired()
+	if my.outer.Expiration.IsZero() {
+		// Nothing is cached, e.g. because the credentials don't expire.
+		return my.inner.IsExpired()
+	}
+
+	return my.outer.IsExpired()
 }
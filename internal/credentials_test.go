@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeSTS issues credentials derived from the credentials it was called with,
+// like a real STS client created from the previous hop's credentials.
+type fakeSTS struct {
+	source *credentials.Credentials
+	calls  int
+}
+
+func (f *fakeSTS) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	v, err := f.source.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	f.calls += 1
+
+	return &sts.AssumeRoleOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String(v.AccessKeyID + ">" + *input.RoleArn),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(1 * time.Hour)),
+		},
+	}, nil
+}
+
+func TestCachedCredentials_Chain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+[profile base]
+region = eu-west-1
+
+[profile jump]
+role_arn = jump-role
+source_profile = base
+
+[profile target]
+role_arn = target-role
+source_profile = jump
+`), 0600))
+
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	defer os.Setenv("AWS_CONFIG_FILE", os.Getenv("AWS_CONFIG_FILE"))
+	require.NoError(t, os.Setenv("HOME", dir))
+	require.NoError(t, os.Setenv("AWS_CONFIG_FILE", configPath))
+
+	require.Equal(t, "target(target-role) <- jump(jump-role) <- base", profileChain("target"))
+
+	base := credentials.NewStaticCredentials("base", "secret", "")
+	jumpSTS := &fakeSTS{source: base}
+	jump := stscreds.NewCredentialsWithClient(jumpSTS, "jump-role")
+	targetSTS := &fakeSTS{source: jump}
+	target := stscreds.NewCredentialsWithClient(targetSTS, "target-role")
+
+	creds, err := WrapCredentialsWithCache("target", target)
+	require.NoError(t, err)
+
+	v, err := creds.Get()
+	require.NoError(t, err)
+	require.Equal(t, "base>jump-role>target-role", v.AccessKeyID)
+
+	// A new process reads the final credentials from the cache.
+	creds, err = WrapCredentialsWithCache("target", target)
+	require.NoError(t, err)
+	v, err = creds.Get()
+	require.NoError(t, err)
+	require.Equal(t, "base>jump-role>target-role", v.AccessKeyID)
+	require.Equal(t, 1, jumpSTS.calls)
+	require.Equal(t, 1, targetSTS.calls)
+
+	// Refreshing goes through the whole chain again.
+	provider := NewCachedCredentialProvider("target", target).(*cachedCredentialProvider)
+	provider.outer.Expiration = time.Now()
+	v, err = provider.Retrieve()
+	require.NoError(t, err)
+	require.Equal(t, "base>jump-role>target-role", v.AccessKeyID)
+	require.Equal(t, 2, targetSTS.calls)
+}
+
+// fakeMFASTS requires an MFA token, like a role whose trust policy has the
+// aws:MultiFactorAuthPresent condition.
+type fakeMFASTS struct {
+	calls int
+}
+
+func (f *fakeMFASTS) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	if input.SerialNumber == nil || input.TokenCode == nil {
+		return nil, errors.New("MultiFactorAuthentication failed")
+	}
+
+	f.calls += 1
+
+	return &sts.AssumeRoleOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String(*input.SerialNumber + ":" + *input.TokenCode),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(1 * time.Hour)),
+		},
+	}, nil
+}
+
+func TestCachedCredentials_MFA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config")
+	writeConfig := func(serial string) {
+		require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+[default]
+region = eu-west-1
+
+[profile admin]
+role_arn = admin-role
+mfa_serial = `+serial+`
+source_profile = default
+`), 0600))
+	}
+
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	defer os.Setenv("AWS_CONFIG_FILE", os.Getenv("AWS_CONFIG_FILE"))
+	require.NoError(t, os.Setenv("HOME", dir))
+	require.NoError(t, os.Setenv("AWS_CONFIG_FILE", configPath))
+
+	writeConfig("device-1")
+	require.Equal(t, "admin(admin-role mfa=device-1) <- default", profileChain("admin"))
+
+	prompts := 0
+	client := &fakeMFASTS{}
+	newCreds := func(serial string) *credentials.Credentials {
+		return stscreds.NewCredentialsWithClient(client, "admin-role", func(p *stscreds.AssumeRoleProvider) {
+			p.SerialNumber = aws.String(serial)
+			p.TokenProvider = func() (string, error) {
+				prompts += 1
+				return "123456", nil
+			}
+		})
+	}
+
+	creds, err := WrapCredentialsWithCache("admin", newCreds("device-1"))
+	require.NoError(t, err)
+	v, err := creds.Get()
+	require.NoError(t, err)
+	require.Equal(t, "device-1:123456", v.AccessKeyID)
+	require.Equal(t, 1, prompts)
+
+	// A new process reuses the session without asking for another token.
+	creds, err = WrapCredentialsWithCache("admin", newCreds("device-1"))
+	require.NoError(t, err)
+	v, err = creds.Get()
+	require.NoError(t, err)
+	require.Equal(t, "device-1:123456", v.AccessKeyID)
+	require.Equal(t, 1, prompts)
+	require.Equal(t, 1, client.calls)
+
+	// Another MFA device doesn't get the credentials cached for the first.
+	writeConfig("device-2")
+	creds, err = WrapCredentialsWithCache("admin", newCreds("device-2"))
+	require.NoError(t, err)
+	v, err = creds.Get()
+	require.NoError(t, err)
+	require.Equal(t, "device-2:123456", v.AccessKeyID)
+	require.Equal(t, 2, prompts)
+}
+
+func TestProfilesForAccount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+[default]
+region = eu-west-1
+
+[profile dev]
+role_arn = arn:aws:iam::111111111111:role/deploy
+source_profile = default
+
+[profile dev-admin]
+role_arn = arn:aws:iam::111111111111:role/admin
+source_profile = default
+
+[profile prod]
+sso_account_id = 222222222222
+`), 0600))
+
+	defer os.Setenv("AWS_CONFIG_FILE", os.Getenv("AWS_CONFIG_FILE"))
+	require.NoError(t, os.Setenv("AWS_CONFIG_FILE", configPath))
+
+	require.Equal(t, []string{"dev", "dev-admin"}, ProfilesForAccount("111111111111"))
+	require.Equal(t, []string{"prod"}, ProfilesForAccount("222222222222"))
+	require.Empty(t, ProfilesForAccount("333333333333"))
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// ErrLocked is returned when another deployment holds the lock of a stack.
+var ErrLocked = errors.New("stack is locked")
+
+// DynamoDBLock is a cftool.StackLock that keeps locks as items in a DynamoDB
+// table, whose partition key is the string attribute LockId. An item is only
+// written if there is none for the key yet, which makes acquiring the lock
+// atomic.
+type DynamoDBLock struct {
+	api    dynamodbiface.DynamoDBAPI
+	table  string
+	caller string
+
+	key    string
+	holder string
+}
+
+// NewDynamoDBLock returns a lock in the table, which will be held by the
+// caller, e.g. the ARN of the identity that deploys.
+func NewDynamoDBLock(api dynamodbiface.DynamoDBAPI, table string, caller string) *DynamoDBLock {
+	return &DynamoDBLock{api: api, table: table, caller: caller}
+}
+
+func (l *DynamoDBLock) Acquire(key string, force bool) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	holder := fmt.Sprintf("%s at %s", l.caller, now)
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(l.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"LockId":     {S: aws.String(key)},
+			"Holder":     {S: aws.String(holder)},
+			"Caller":     {S: aws.String(l.caller)},
+			"AcquiredAt": {S: aws.String(now)},
+		},
+	}
+
+	if !force {
+		input.ConditionExpression = aws.String("attribute_not_exists(LockId)")
+	}
+
+	_, err := l.api.PutItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return errors.Wrapf(ErrLocked, "held by %s", l.currentHolder(key))
+	} else if err != nil {
+		return errors.Wrapf(err, "lock %s in table %s", key, l.table)
+	}
+
+	l.key, l.holder = key, holder
+	return nil
+}
+
+// currentHolder describes who holds the lock for the key, as far as that can
+// be found out.
+func (l *DynamoDBLock) currentHolder(key string) string {
+	out, err := l.api.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(l.table),
+		Key:            map[string]*dynamodb.AttributeValue{"LockId": {S: aws.String(key)}},
+		ConsistentRead: aws.Bool(true),
+	})
+
+	if err != nil || out.Item["Holder"] == nil {
+		return "another deployment"
+	}
+
+	return aws.StringValue(out.Item["Holder"].S)
+}
+
+// Release deletes the lock only if this lock still holds it, so that a lock
+// taken over with force is not released by the deployment it was taken from.
+func (l *DynamoDBLock) Release() error {
+	if l.key == "" {
+		return nil
+	}
+
+	_, err := l.api.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:                 aws.String(l.table),
+		Key:                       map[string]*dynamodb.AttributeValue{"LockId": {S: aws.String(l.key)}},
+		ConditionExpression:       aws.String("Holder = :holder"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":holder": {S: aws.String(l.holder)}},
+	})
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		err = errors.Errorf("lock %s was taken over", l.key)
+	} else if err != nil {
+		err = errors.Wrapf(err, "unlock %s in table %s", l.key, l.table)
+	}
+
+	l.key, l.holder = "", ""
+	return err
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// fakeDynamoDB keeps items by LockId, and evaluates just the conditions that
+// DynamoDBLock uses.
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func conditionFailed() error {
+	return awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+}
+
+func (f *fakeDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	key := *input.Item["LockId"].S
+	if _, ok := f.items[key]; ok && input.ConditionExpression != nil {
+		return nil, conditionFailed()
+	}
+
+	f.items[key] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.items[*input.Key["LockId"].S]}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	key := *input.Key["LockId"].S
+	item, ok := f.items[key]
+	if !ok || *item["Holder"].S != *input.ExpressionAttributeValues[":holder"].S {
+		return nil, conditionFailed()
+	}
+
+	delete(f.items, key)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDynamoDBLock(t *testing.T) {
+	api := &fakeDynamoDB{items: make(map[string]map[string]*dynamodb.AttributeValue)}
+	alice := NewDynamoDBLock(api, "locks", "arn:aws:iam::1:user/alice")
+	bob := NewDynamoDBLock(api, "locks", "arn:aws:iam::1:user/bob")
+
+	require.NoError(t, alice.Acquire("mystack", false))
+
+	err := bob.Acquire("mystack", false)
+	require.Equal(t, ErrLocked, errors.Cause(err))
+	require.Contains(t, err.Error(), "held by arn:aws:iam::1:user/alice at ")
+
+	require.NoError(t, bob.Acquire("otherstack", false))
+	require.NoError(t, bob.Release())
+
+	require.NoError(t, alice.Release())
+	require.Empty(t, api.items)
+
+	// A lock that was forced away from its holder is not released by it.
+	require.NoError(t, alice.Acquire("mystack", false))
+	require.NoError(t, bob.Acquire("mystack", true))
+	require.EqualError(t, alice.Release(), "lock mystack was taken over")
+	require.Equal(t, aws.String("arn:aws:iam::1:user/bob"), api.items["mystack"]["Caller"].S)
+	require.NoError(t, bob.Release())
+	require.Empty(t, api.items)
+}
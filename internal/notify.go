@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"net/http"
+	"time"
+)
+
+// Notification is the payload published when a deployment has finished.
+type Notification struct {
+	StackName   string                 `json:"stackName"`
+	StackId     string                 `json:"stackId,omitempty"`
+	ChangeSetId string                 `json:"changeSetId,omitempty"`
+	Status      string                 `json:"status"`
+	Changes     map[string]interface{} `json:"changes,omitempty"`
+	Caller      string                 `json:"caller,omitempty"`
+	Comment     string                 `json:"comment,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+}
+
+type Notifier interface {
+	Notify(n *Notification) error
+}
+
+// NewNotification describes the outcome of the last deployment of d.
+func NewNotification(d *cftool.Deployer, caller string, err error) *Notification {
+	n := &Notification{
+		StackName:   d.StackName,
+		StackId:     d.StackId,
+		ChangeSetId: d.ChangeSetId,
+		Status:      string(d.FinalStatus),
+		Changes:     d.Changes(),
+		Caller:      caller,
+		Comment:     d.Comment,
+	}
+
+	if err != nil {
+		n.Error = err.Error()
+	}
+
+	if n.Status == "" {
+		n.Status = "UNKNOWN"
+	}
+
+	return n
+}
+
+type SNSNotifier struct {
+	api      snsiface.SNSAPI
+	topicArn string
+}
+
+func NewSNSNotifier(api snsiface.SNSAPI, topicArn string) *SNSNotifier {
+	return &SNSNotifier{api: api, topicArn: topicArn}
+}
+
+func (s *SNSNotifier) Notify(n *Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.api.Publish(&sns.PublishInput{
+		TopicArn: aws.String(s.topicArn),
+		Subject:  aws.String("cftool: " + n.StackName + " " + n.Status),
+		Message:  aws.String(string(data)),
+	})
+
+	return errors.Wrapf(err, "publish to %s", s.topicArn)
+}
+
+type WebhookNotifier struct {
+	client *http.Client
+	url    string
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		client: &http.Client{Timeout: 10 * time.Second},
+		url:    url,
+	}
+}
+
+func (h *WebhookNotifier) Notify(n *Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrapf(err, "post to %s", h.url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("post to %s: %s", h.url, resp.Status)
+	}
+
+	return nil
+}
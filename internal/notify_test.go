@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeSNS records what is published, or fails with err.
+type fakeSNS struct {
+	snsiface.SNSAPI
+	published []*sns.PublishInput
+	err       error
+}
+
+func (f *fakeSNS) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	f.published = append(f.published, input)
+	return &sns.PublishOutput{MessageId: aws.String("message")}, nil
+}
+
+func TestNewNotification(t *testing.T) {
+	d := cftool.NewDeployer(nil, &cftool.Deployment{StackName: "app"})
+	d.Comment = "release 42"
+
+	n := NewNotification(d, "arn:aws:iam::123456789012:user/alice", errors.New("stack failed"))
+	require.Equal(t, &Notification{
+		StackName: "app",
+		Status:    "UNKNOWN",
+		Caller:    "arn:aws:iam::123456789012:user/alice",
+		Comment:   "release 42",
+		Error:     "stack failed",
+	}, n)
+}
+
+func TestSNSNotifier(t *testing.T) {
+	api := &fakeSNS{}
+	topic := "arn:aws:sns:eu-west-1:123456789012:deployments"
+	n := &Notification{StackName: "app", Status: "UPDATE_COMPLETE"}
+
+	require.NoError(t, NewSNSNotifier(api, topic).Notify(n))
+	require.Len(t, api.published, 1)
+	require.Equal(t, topic, aws.StringValue(api.published[0].TopicArn))
+	require.Equal(t, "cftool: app UPDATE_COMPLETE", aws.StringValue(api.published[0].Subject))
+
+	var message Notification
+	require.NoError(t, json.Unmarshal([]byte(aws.StringValue(api.published[0].Message)), &message))
+	require.Equal(t, *n, message)
+
+	api.err = errors.New("AuthorizationError")
+	err := NewSNSNotifier(api, topic).Notify(n)
+	require.EqualError(t, err, "publish to "+topic+": AuthorizationError")
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received []map[string]interface{}
+	status := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var payload map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &payload))
+		received = append(received, payload)
+
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	n := &Notification{StackName: "app", Status: "UPDATE_ROLLBACK_COMPLETE", Error: "stack failed"}
+	require.NoError(t, NewWebhookNotifier(server.URL).Notify(n))
+	require.Equal(t, []map[string]interface{}{{
+		"stackName": "app",
+		"status":    "UPDATE_ROLLBACK_COMPLETE",
+		"error":     "stack failed",
+	}}, received)
+
+	// Anything but a 2xx response is a failure to notify.
+	status = http.StatusInternalServerError
+	err := NewWebhookNotifier(server.URL).Notify(n)
+	require.EqualError(t, err, "post to "+server.URL+": 500 Internal Server Error")
+
+	server.Close()
+	err = NewWebhookNotifier(server.URL).Notify(n)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "post to "+server.URL)
+}
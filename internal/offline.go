@@ -0,0 +1,725 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/ghodss/yaml"
+	"github.com/google/uuid"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OfflineAccountId is the account that offline mode pretends to deploy to.
+const OfflineAccountId = "000000000000"
+
+// OfflineCloudFormation simulates CloudFormation in memory, well enough to
+// create change sets and deploy them without AWS. Stacks start out empty, and
+// are lost when the process exits. Resources are not created; their changes
+// are derived from comparing the templates, and every operation succeeds
+// unless it changes one of the Failures.
+type OfflineCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	Region string
+
+	// Failures makes the operations that create or update the resources
+	// with these logical ids fail with the given reason, and roll back.
+	Failures map[string]string
+
+	mu     sync.Mutex
+	stacks map[string]*offlineStack
+}
+
+type offlineStack struct {
+	stack      cf.Stack
+	template   string
+	events     []*cf.StackEvent
+	changeSets map[string]*offlineChangeSet
+}
+
+type offlineChangeSet struct {
+	output   cf.DescribeChangeSetOutput
+	template string
+}
+
+func NewOfflineCloudFormation(region string) *OfflineCloudFormation {
+	return &OfflineCloudFormation{
+		Region: region,
+		stacks: make(map[string]*offlineStack),
+	}
+}
+
+func offlineNotFound(format string, args ...interface{}) error {
+	return awserr.New("ValidationError", fmt.Sprintf(format, args...), nil)
+}
+
+// find looks up a stack by name or by id. Deleted stacks can only be found by
+// id, as in CloudFormation.
+func (o *OfflineCloudFormation) find(ref *string) (*offlineStack, error) {
+	name := aws.StringValue(ref)
+
+	for _, s := range o.stacks {
+		if aws.StringValue(s.stack.StackId) == name {
+			return s, nil
+		}
+
+		if aws.StringValue(s.stack.StackName) == name &&
+			aws.StringValue(s.stack.StackStatus) != cf.StackStatusDeleteComplete {
+
+			return s, nil
+		}
+	}
+
+	return nil, offlineNotFound("Stack with id %s does not exist", name)
+}
+
+func (o *OfflineCloudFormation) DescribeStacks(input *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s, err := o.find(input.StackName)
+	if err != nil {
+		return nil, err
+	}
+
+	stack := s.stack
+	return &cf.DescribeStacksOutput{Stacks: []*cf.Stack{&stack}}, nil
+}
+
+// DescribeStacksPages lists every stack that wasn't deleted, in a single page,
+// unless a stack name is given.
+func (o *OfflineCloudFormation) DescribeStacksPages(
+	input *cf.DescribeStacksInput,
+	fn func(*cf.DescribeStacksOutput, bool) bool,
+) error {
+	if input.StackName != nil {
+		output, err := o.DescribeStacks(input)
+		if err != nil {
+			return err
+		}
+
+		fn(output, true)
+		return nil
+	}
+
+	o.mu.Lock()
+	var stacks []*cf.Stack
+	for _, s := range o.stacks {
+		if aws.StringValue(s.stack.StackStatus) != cf.StackStatusDeleteComplete {
+			stack := s.stack
+			stacks = append(stacks, &stack)
+		}
+	}
+	o.mu.Unlock()
+
+	sort.Slice(stacks, func(i, j int) bool {
+		return aws.StringValue(stacks[i].StackName) < aws.StringValue(stacks[j].StackName)
+	})
+
+	fn(&cf.DescribeStacksOutput{Stacks: stacks}, true)
+	return nil
+}
+
+// ValidateTemplate reports the capabilities the template needs: CAPABILITY_IAM
+// for IAM resources, CAPABILITY_NAMED_IAM if they are given names, and
+// CAPABILITY_AUTO_EXPAND for transforms. It doesn't validate anything else.
+func (o *OfflineCloudFormation) ValidateTemplate(input *cf.ValidateTemplateInput) (*cf.ValidateTemplateOutput, error) {
+	if input.TemplateBody == nil {
+		return nil, awserr.New("ValidationError", "templates in S3 are not available offline", nil)
+	}
+
+	var template struct {
+		Transform interface{}                         `json:"Transform"`
+		Resources map[string]*cftool.TemplateResource `json:"Resources"`
+	}
+
+	if err := yaml.Unmarshal([]byte(*input.TemplateBody), &template); err != nil {
+		return nil, awserr.New("ValidationError", err.Error(), nil)
+	}
+
+	var types []string
+	seen := make(map[string]bool)
+	named := false
+	for _, resource := range template.Resources {
+		if !strings.HasPrefix(resource.Type, "AWS::IAM::") {
+			continue
+		}
+
+		if !seen[resource.Type] {
+			seen[resource.Type] = true
+			types = append(types, resource.Type)
+		}
+
+		for _, property := range []string{"RoleName", "UserName", "GroupName", "ManagedPolicyName", "InstanceProfileName"} {
+			named = named || resource.Properties[property] != nil
+		}
+	}
+
+	output := &cf.ValidateTemplateOutput{}
+
+	if len(types) > 0 {
+		capability := cf.CapabilityCapabilityIam
+		if named {
+			capability = cf.CapabilityCapabilityNamedIam
+		}
+
+		sort.Strings(types)
+		output.Capabilities = append(output.Capabilities, aws.String(capability))
+		output.CapabilitiesReason = aws.String(fmt.Sprintf(
+			"The following resource(s) require capabilities: [%s]", strings.Join(types, ", ")))
+	}
+
+	if template.Transform != nil {
+		output.Capabilities = append(output.Capabilities, aws.String(cf.CapabilityCapabilityAutoExpand))
+	}
+
+	return output, nil
+}
+
+func (o *OfflineCloudFormation) GetTemplate(input *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s, err := o.find(input.StackName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cf.GetTemplateOutput{TemplateBody: aws.String(s.template)}, nil
+}
+
+func (o *OfflineCloudFormation) CreateChangeSetWithContext(
+	c aws.Context,
+	input *cf.CreateChangeSetInput,
+	opts ...request.Option,
+) (*cf.CreateChangeSetOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if input.TemplateBody == nil {
+		return nil, awserr.New("ValidationError", "templates in S3 are not available offline", nil)
+	}
+
+	s, err := o.find(input.StackName)
+	create := aws.StringValue(input.ChangeSetType) == cf.ChangeSetTypeCreate
+
+	// A stack that only has change sets to create it takes more of those,
+	// but can't be updated yet.
+	review := err == nil && aws.StringValue(s.stack.StackStatus) == cf.StackStatusReviewInProgress
+
+	switch {
+	case err == nil && create && !review:
+		return nil, awserr.New("AlreadyExistsException",
+			fmt.Sprintf("Stack [%s] already exists", aws.StringValue(input.StackName)), nil)
+
+	case review && !create:
+		return nil, awserr.New("ValidationError",
+			fmt.Sprintf("Stack:%s is in REVIEW_IN_PROGRESS state and can not be updated.", aws.StringValue(s.stack.StackId)), nil)
+
+	case err != nil && !create:
+		return nil, err
+
+	case err != nil:
+		s = &offlineStack{
+			stack: cf.Stack{
+				StackName:    input.StackName,
+				StackId:      aws.String(o.arn("stack", aws.StringValue(input.StackName))),
+				StackStatus:  aws.String(cf.StackStatusReviewInProgress),
+				CreationTime: aws.Time(time.Now()),
+			},
+			changeSets: make(map[string]*offlineChangeSet),
+		}
+
+		o.stacks[*s.stack.StackId] = s
+	}
+
+	changes, err := offlineChanges(s.template, *input.TemplateBody)
+	if err != nil {
+		return nil, awserr.New("ValidationError", err.Error(), nil)
+	}
+
+	output := cf.DescribeChangeSetOutput{
+		StackName:     s.stack.StackName,
+		StackId:       s.stack.StackId,
+		ChangeSetName: input.ChangeSetName,
+		ChangeSetId:   aws.String(o.arn("changeSet", aws.StringValue(input.ChangeSetName))),
+		Description:   input.Description,
+		Parameters:    input.Parameters,
+		Tags:          input.Tags,
+		Changes:       changes,
+		Status:        aws.String(cf.ChangeSetStatusCreateComplete),
+	}
+
+	if !create && len(changes) == 0 && *input.TemplateBody == s.template &&
+		reflect.DeepEqual(offlineParameters(input.Parameters), offlineParameters(s.stack.Parameters)) &&
+		(input.Tags == nil || reflect.DeepEqual(offlineTags(input.Tags), offlineTags(s.stack.Tags))) {
+
+		output.Status = aws.String(cf.ChangeSetStatusFailed)
+		output.StatusReason = aws.String(cftool.NoChangesReason + ".")
+	}
+
+	s.changeSets[aws.StringValue(input.ChangeSetName)] = &offlineChangeSet{output, *input.TemplateBody}
+
+	return &cf.CreateChangeSetOutput{Id: output.ChangeSetId, StackId: output.StackId}, nil
+}
+
+func (o *OfflineCloudFormation) findChangeSet(stackName *string, name *string) (*offlineStack, *offlineChangeSet, error) {
+	s, err := o.find(stackName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chset, ok := s.changeSets[aws.StringValue(name)]
+	if !ok {
+		return nil, nil, awserr.New("ChangeSetNotFound",
+			fmt.Sprintf("ChangeSet [%s] does not exist", aws.StringValue(name)), nil)
+	}
+
+	return s, chset, nil
+}
+
+func (o *OfflineCloudFormation) DescribeChangeSetWithContext(
+	c aws.Context,
+	input *cf.DescribeChangeSetInput,
+	opts ...request.Option,
+) (*cf.DescribeChangeSetOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	_, chset, err := o.findChangeSet(input.StackName, input.ChangeSetName)
+	if err != nil {
+		return nil, err
+	}
+
+	output := chset.output
+	return &output, nil
+}
+
+func (o *OfflineCloudFormation) DeleteChangeSet(input *cf.DeleteChangeSetInput) (*cf.DeleteChangeSetOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s, _, err := o.findChangeSet(input.StackName, input.ChangeSetName)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(s.changeSets, aws.StringValue(input.ChangeSetName))
+	return &cf.DeleteChangeSetOutput{}, nil
+}
+
+// ExecuteChangeSetWithContext completes the stack operation at once, with an
+// event for every changed resource.
+func (o *OfflineCloudFormation) ExecuteChangeSetWithContext(
+	c aws.Context,
+	input *cf.ExecuteChangeSetInput,
+	opts ...request.Option,
+) (*cf.ExecuteChangeSetOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s, chset, err := o.findChangeSet(input.StackName, input.ChangeSetName)
+	if err != nil {
+		return nil, err
+	}
+
+	operation := "UPDATE"
+	if aws.StringValue(s.stack.StackStatus) == cf.StackStatusReviewInProgress {
+		operation = "CREATE"
+	}
+
+	o.event(s, *s.stack.StackName, "AWS::CloudFormation::Stack", operation+"_IN_PROGRESS")
+
+	for _, change := range chset.output.Changes {
+		rc := change.ResourceChange
+		action := map[string]string{
+			cf.ChangeActionAdd:    "CREATE",
+			cf.ChangeActionModify: "UPDATE",
+			cf.ChangeActionRemove: "DELETE",
+		}[aws.StringValue(rc.Action)]
+
+		o.event(s, *rc.LogicalResourceId, *rc.ResourceType, action+"_IN_PROGRESS")
+
+		if reason, ok := o.Failures[*rc.LogicalResourceId]; ok && action != "DELETE" {
+			o.event(s, *rc.LogicalResourceId, *rc.ResourceType, action+"_FAILED")
+			s.events[0].ResourceStatusReason = aws.String(reason)
+			o.rollBack(s, operation)
+			return &cf.ExecuteChangeSetOutput{}, nil
+		}
+
+		o.event(s, *rc.LogicalResourceId, *rc.ResourceType, action+"_COMPLETE")
+	}
+
+	o.event(s, *s.stack.StackName, "AWS::CloudFormation::Stack", operation+"_COMPLETE")
+
+	s.template = chset.template
+	s.stack.Parameters = chset.output.Parameters
+	s.stack.StackStatus = aws.String(operation + "_COMPLETE")
+	s.changeSets = make(map[string]*offlineChangeSet)
+
+	if chset.output.Tags != nil {
+		s.stack.Tags = chset.output.Tags
+	}
+
+	if operation == "UPDATE" {
+		s.stack.LastUpdatedTime = aws.Time(time.Now())
+	}
+
+	return &cf.ExecuteChangeSetOutput{}, nil
+}
+
+// rollBack ends a failed operation: a stack that failed creation is left in
+// ROLLBACK_COMPLETE, and one that failed to update keeps its template.
+func (o *OfflineCloudFormation) rollBack(s *offlineStack, operation string) {
+	status := cf.StackStatusRollbackComplete
+	if operation == "UPDATE" {
+		status = cf.StackStatusUpdateRollbackComplete
+		s.stack.LastUpdatedTime = aws.Time(time.Now())
+	}
+
+	o.event(s, *s.stack.StackName, "AWS::CloudFormation::Stack", strings.Replace(status, "COMPLETE", "IN_PROGRESS", 1))
+	o.event(s, *s.stack.StackName, "AWS::CloudFormation::Stack", status)
+	s.stack.StackStatus = aws.String(status)
+	s.changeSets = make(map[string]*offlineChangeSet)
+}
+
+func (o *OfflineCloudFormation) DeleteStack(input *cf.DeleteStackInput) (*cf.DeleteStackOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s, err := o.find(input.StackName)
+	if err != nil {
+		return nil, err
+	}
+
+	o.event(s, *s.stack.StackName, "AWS::CloudFormation::Stack", cf.ResourceStatusDeleteInProgress)
+	o.event(s, *s.stack.StackName, "AWS::CloudFormation::Stack", cf.ResourceStatusDeleteComplete)
+	s.stack.StackStatus = aws.String(cf.StackStatusDeleteComplete)
+
+	return &cf.DeleteStackOutput{}, nil
+}
+
+func (o *OfflineCloudFormation) DeleteStackWithContext(
+	c aws.Context,
+	input *cf.DeleteStackInput,
+	opts ...request.Option,
+) (*cf.DeleteStackOutput, error) {
+	return o.DeleteStack(input)
+}
+
+func (o *OfflineCloudFormation) CancelUpdateStack(input *cf.CancelUpdateStackInput) (*cf.CancelUpdateStackOutput, error) {
+	return nil, awserr.New("ValidationError", "CancelUpdateStack cannot be called from current stack status", nil)
+}
+
+func (o *OfflineCloudFormation) DescribeStackEventsPages(
+	input *cf.DescribeStackEventsInput,
+	fn func(*cf.DescribeStackEventsOutput, bool) bool,
+) error {
+	o.mu.Lock()
+	s, err := o.find(input.StackName)
+	var events []*cf.StackEvent
+	if err == nil {
+		events = append(events, s.events...)
+	}
+	o.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	fn(&cf.DescribeStackEventsOutput{StackEvents: events}, true)
+	return nil
+}
+
+// ListStackResourcesPages lists the resources of the deployed template, each
+// with the status of its latest event.
+func (o *OfflineCloudFormation) ListStackResourcesPages(
+	input *cf.ListStackResourcesInput,
+	fn func(*cf.ListStackResourcesOutput, bool) bool,
+) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s, err := o.find(input.StackName)
+	if err != nil {
+		return err
+	}
+
+	resources, err := cftool.ParseTemplateResources([]byte(s.template))
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for id := range resources {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	var summaries []*cf.StackResourceSummary
+	for _, id := range ids {
+		summary := &cf.StackResourceSummary{
+			LogicalResourceId:  aws.String(id),
+			PhysicalResourceId: aws.String(*s.stack.StackName + "-" + id),
+			ResourceType:       aws.String(resources[id].Type),
+			ResourceStatus:     aws.String(cf.ResourceStatusCreateComplete),
+		}
+
+		for _, event := range s.events {
+			if aws.StringValue(event.LogicalResourceId) == id {
+				summary.ResourceStatus = event.ResourceStatus
+				summary.LastUpdatedTimestamp = event.Timestamp
+				break
+			}
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	fn(&cf.ListStackResourcesOutput{StackResourceSummaries: summaries}, true)
+	return nil
+}
+
+// DetectStackDrift finds no drift, since nothing changes offline stacks
+// other than cftool.
+func (o *OfflineCloudFormation) DetectStackDrift(input *cf.DetectStackDriftInput) (*cf.DetectStackDriftOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s, err := o.find(input.StackName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cf.DetectStackDriftOutput{StackDriftDetectionId: s.stack.StackId}, nil
+}
+
+func (o *OfflineCloudFormation) DescribeStackDriftDetectionStatus(
+	input *cf.DescribeStackDriftDetectionStatusInput,
+) (*cf.DescribeStackDriftDetectionStatusOutput, error) {
+	return &cf.DescribeStackDriftDetectionStatusOutput{
+		StackId:                   input.StackDriftDetectionId,
+		StackDriftDetectionId:     input.StackDriftDetectionId,
+		DetectionStatus:           aws.String(cf.StackDriftDetectionStatusDetectionComplete),
+		StackDriftStatus:          aws.String(cf.StackDriftStatusInSync),
+		DriftedStackResourceCount: aws.Int64(0),
+	}, nil
+}
+
+func (o *OfflineCloudFormation) DescribeStackResourceDriftsPages(
+	input *cf.DescribeStackResourceDriftsInput,
+	fn func(*cf.DescribeStackResourceDriftsOutput, bool) bool,
+) error {
+	fn(&cf.DescribeStackResourceDriftsOutput{}, true)
+	return nil
+}
+
+// event records a stack event. Events are kept newest first, as they are
+// listed by CloudFormation.
+func (o *OfflineCloudFormation) event(s *offlineStack, logicalId string, resourceType string, status string) {
+	event := &cf.StackEvent{
+		EventId:           aws.String(uuid.New().String()),
+		StackId:           s.stack.StackId,
+		StackName:         s.stack.StackName,
+		LogicalResourceId: aws.String(logicalId),
+		ResourceType:      aws.String(resourceType),
+		ResourceStatus:    aws.String(status),
+		Timestamp:         aws.Time(time.Now()),
+	}
+
+	s.events = append([]*cf.StackEvent{event}, s.events...)
+}
+
+func (o *OfflineCloudFormation) arn(resource string, name string) string {
+	return fmt.Sprintf("arn:aws:cloudformation:%s:%s:%s/%s/%s",
+		o.Region, OfflineAccountId, resource, name, uuid.New().String())
+}
+
+// offlineChanges compares the resources of two templates. A resource is
+// modified if its type or properties differ, with a detail for each property
+// that does; replacements are not predicted.
+func offlineChanges(oldBody string, newBody string) ([]*cf.Change, error) {
+	old := map[string]*cftool.TemplateResource{}
+	if oldBody != "" {
+		var err error
+		if old, err = cftool.ParseTemplateResources([]byte(oldBody)); err != nil {
+			return nil, err
+		}
+	}
+
+	resources, err := cftool.ParseTemplateResources([]byte(newBody))
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for id := range old {
+		ids = append(ids, id)
+	}
+
+	for id := range resources {
+		if _, ok := old[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+
+	var changes []*cf.Change
+	for _, id := range ids {
+		before, after := old[id], resources[id]
+		change := &cf.ResourceChange{
+			LogicalResourceId: aws.String(id),
+			Replacement:       aws.String(cf.ReplacementFalse),
+		}
+
+		switch {
+		case before == nil:
+			change.Action = aws.String(cf.ChangeActionAdd)
+			change.ResourceType = aws.String(after.Type)
+		case after == nil:
+			change.Action = aws.String(cf.ChangeActionRemove)
+			change.ResourceType = aws.String(before.Type)
+		case !reflect.DeepEqual(before, after):
+			change.Action = aws.String(cf.ChangeActionModify)
+			change.ResourceType = aws.String(after.Type)
+			change.Details = offlinePropertyDetails(before.Properties, after.Properties)
+		default:
+			continue
+		}
+
+		changes = append(changes, &cf.Change{
+			Type:           aws.String(cf.ChangeTypeResource),
+			ResourceChange: change,
+		})
+	}
+
+	return changes, nil
+}
+
+func offlinePropertyDetails(before map[string]interface{}, after map[string]interface{}) []*cf.ResourceChangeDetail {
+	var names []string
+	for name := range before {
+		names = append(names, name)
+	}
+
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	var details []*cf.ResourceChangeDetail
+	for _, name := range names {
+		if reflect.DeepEqual(before[name], after[name]) {
+			continue
+		}
+
+		details = append(details, &cf.ResourceChangeDetail{
+			ChangeSource: aws.String(cf.ChangeSourceDirectModification),
+			Evaluation:   aws.String(cf.EvaluationTypeStatic),
+			Target: &cf.ResourceTargetDefinition{
+				Attribute:          aws.String(cf.ResourceAttributeProperties),
+				Name:               aws.String(name),
+				RequiresRecreation: aws.String(cf.RequiresRecreationNever),
+			},
+		})
+	}
+
+	return details
+}
+
+func offlineParameters(params []*cf.Parameter) map[string]string {
+	result := make(map[string]string)
+	for _, p := range params {
+		result[aws.StringValue(p.ParameterKey)] = aws.StringValue(p.ParameterValue)
+	}
+
+	return result
+}
+
+func offlineTags(tags []*cf.Tag) map[string]string {
+	result := make(map[string]string)
+	for _, tag := range tags {
+		result[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	return result
+}
+
+// OfflineCloudWatch pretends that every alarm exists in the OfflineAccountId
+// account.
+type OfflineCloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+	Region string
+}
+
+func (o *OfflineCloudWatch) DescribeAlarms(input *cloudwatch.DescribeAlarmsInput) (*cloudwatch.DescribeAlarmsOutput, error) {
+	region := o.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	output := &cloudwatch.DescribeAlarmsOutput{}
+	for _, name := range aws.StringValueSlice(input.AlarmNames) {
+		output.MetricAlarms = append(output.MetricAlarms, &cloudwatch.MetricAlarm{
+			AlarmName: aws.String(name),
+			AlarmArn:  aws.String(fmt.Sprintf("arn:aws:cloudwatch:%s:%s:alarm:%s", region, OfflineAccountId, name)),
+		})
+	}
+
+	return output, nil
+}
+
+// OfflineSTS answers identity requests with a fixed identity in the
+// OfflineAccountId account, or, if RoleArn is set, as that role in the account
+// of its ARN.
+type OfflineSTS struct {
+	stsiface.STSAPI
+	RoleArn string
+}
+
+func (o *OfflineSTS) GetCallerIdentity(input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	if o.RoleArn != "" {
+		role, err := arn.Parse(o.RoleArn)
+		if err != nil {
+			return nil, awserr.New("ValidationError", fmt.Sprintf("invalid role %s", o.RoleArn), err)
+		}
+
+		return &sts.GetCallerIdentityOutput{
+			Account: aws.String(role.AccountID),
+			Arn: aws.String(fmt.Sprintf("arn:aws:sts::%s:assumed-role/%s/offline",
+				role.AccountID, strings.TrimPrefix(role.Resource, "role/"))),
+			UserId: aws.String("OFFLINE:offline"),
+		}, nil
+	}
+
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(OfflineAccountId),
+		Arn:     aws.String("arn:aws:iam::" + OfflineAccountId + ":user/offline"),
+		UserId:  aws.String("OFFLINE"),
+	}, nil
+}
+
+func (o *OfflineSTS) GetCallerIdentityWithContext(
+	c aws.Context,
+	input *sts.GetCallerIdentityInput,
+	opts ...request.Option,
+) (*sts.GetCallerIdentityOutput, error) {
+	return o.GetCallerIdentity(input)
+}
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/pkg/cftool"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOfflineCloudFormation(t *testing.T) {
+	api := NewOfflineCloudFormation("eu-west-1")
+
+	_, err := api.DescribeStacks(&cf.DescribeStacksInput{StackName: aws.String("mystack")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not exist")
+
+	deploy := func(changeSetType string, template string) *cf.DescribeChangeSetOutput {
+		name := aws.String("cs-" + changeSetType)
+		_, err := api.CreateChangeSetWithContext(nil, &cf.CreateChangeSetInput{
+			StackName:     aws.String("mystack"),
+			ChangeSetName: name,
+			ChangeSetType: aws.String(changeSetType),
+			TemplateBody:  aws.String(template),
+		})
+		require.NoError(t, err)
+
+		chset, err := api.DescribeChangeSetWithContext(nil, &cf.DescribeChangeSetInput{
+			StackName:     aws.String("mystack"),
+			ChangeSetName: name,
+		})
+		require.NoError(t, err)
+
+		if *chset.Status == cf.ChangeSetStatusCreateComplete {
+			_, err = api.ExecuteChangeSetWithContext(nil, &cf.ExecuteChangeSetInput{
+				StackName:     aws.String("mystack"),
+				ChangeSetName: name,
+			})
+			require.NoError(t, err)
+		}
+
+		return chset
+	}
+
+	actions := func(chset *cf.DescribeChangeSetOutput) []string {
+		var result []string
+		for _, change := range chset.Changes {
+			result = append(result, *change.ResourceChange.Action+" "+*change.ResourceChange.LogicalResourceId)
+		}
+
+		return result
+	}
+
+	v1 := "Resources:\n  Queue: {Type: AWS::SQS::Queue}\n  Topic: {Type: AWS::SNS::Topic}\n"
+	chset := deploy(cf.ChangeSetTypeCreate, v1)
+	require.Equal(t, []string{"Add Queue", "Add Topic"}, actions(chset))
+
+	stacks, err := api.DescribeStacks(&cf.DescribeStacksInput{StackName: aws.String("mystack")})
+	require.NoError(t, err)
+	require.Equal(t, cf.StackStatusCreateComplete, *stacks.Stacks[0].StackStatus)
+
+	v2 := "Resources:\n  Queue: {Type: AWS::SQS::Queue, Properties: {DelaySeconds: 10}}\n"
+	chset = deploy(cf.ChangeSetTypeUpdate, v2)
+	require.Equal(t, []string{"Modify Queue", "Remove Topic"}, actions(chset))
+
+	template, err := api.GetTemplate(&cf.GetTemplateInput{StackName: aws.String("mystack")})
+	require.NoError(t, err)
+	require.Equal(t, v2, *template.TemplateBody)
+
+	chset = deploy(cf.ChangeSetTypeUpdate, v2)
+	require.Equal(t, cf.ChangeSetStatusFailed, *chset.Status)
+	require.Contains(t, *chset.StatusReason, cftool.NoChangesReason)
+}
+
+func TestDeploy_offline(t *testing.T) {
+	api := NewOfflineCloudFormation("eu-west-1")
+	deployment := &cftool.Deployment{
+		StackName:    "mystack",
+		TemplateBody: []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n"),
+	}
+
+	d, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+	require.NoError(t, err)
+	require.Equal(t, cftool.StackStatus(cf.StackStatusCreateComplete), d.FinalStatus)
+	require.True(t, d.HasChanges)
+
+	d, err = cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true, DryRun: true, FailOnDrift: true}, ioutil.Discard)
+	require.NoError(t, err)
+	require.Equal(t, cftool.StackStatus("NO_CHANGE"), d.FinalStatus)
+}
+
+func TestDeploy_offlineDetailedChangeSet(t *testing.T) {
+	api := NewOfflineCloudFormation("eu-west-1")
+	deployment := &cftool.Deployment{
+		StackName: "mystack",
+		TemplateBody: []byte("" +
+			"Parameters: {Timeout: {Type: Number}}\n" +
+			"Resources:\n" +
+			"  Queue: {Type: AWS::SQS::Queue, Properties: {DelaySeconds: 5, VisibilityTimeout: 30}}\n"),
+		Parameters: map[string]string{"Timeout": "60"},
+	}
+
+	opts := cftool.Options{Yes: true, Unattended: true, DetailedChangeSet: true}
+	_, err := cftool.Deploy(context.Background(), api, deployment, opts, ioutil.Discard)
+	require.NoError(t, err)
+
+	deployment.TemplateBody = []byte("" +
+		"Parameters: {Timeout: {Type: Number}}\n" +
+		"Resources:\n" +
+		"  Queue:\n" +
+		"    Type: AWS::SQS::Queue\n" +
+		"    Properties:\n" +
+		"      DelaySeconds: 10\n" +
+		"      VisibilityTimeout: !Ref Timeout\n" +
+		"      RedrivePolicy: {deadLetterTargetArn: !GetAtt Dlq.Arn}\n" +
+		"  Dlq: {Type: AWS::SQS::Queue}\n")
+
+	w := &strings.Builder{}
+	opts.DryRun = true
+	_, err = cftool.Deploy(context.Background(), api, deployment, opts, w)
+	require.NoError(t, err)
+
+	out := w.String()
+	require.Contains(t, out, "Properties.DelaySeconds <- ... (direct modification)\n    Before: 5\n     After: 10\n")
+	require.Contains(t, out, "Properties.VisibilityTimeout <- ... (direct modification)\n    Before: 30\n     After: 60\n")
+	require.Contains(t, out, "Properties.RedrivePolicy <- ... (direct modification)\n    Before: (not set)\n     After: (known after apply)\n")
+}
+
+func TestDeploy_offlineRemovedTag(t *testing.T) {
+	api := NewOfflineCloudFormation("eu-west-1")
+	deployment := &cftool.Deployment{
+		StackName:    "mystack",
+		TemplateBody: []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n"),
+		Tags:         map[string]string{"Env": "prod", "Team": "platform"},
+	}
+
+	tags := func() map[string]string {
+		stacks, err := api.DescribeStacks(&cf.DescribeStacksInput{StackName: aws.String("mystack")})
+		require.NoError(t, err)
+		return offlineTags(stacks.Stacks[0].Tags)
+	}
+
+	_, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"Env": "prod", "Team": "platform"}, tags())
+
+	deployment.Tags = map[string]string{"Env": "prod"}
+	d, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+	require.NoError(t, err)
+	require.True(t, d.HasChanges)
+	require.Equal(t, map[string]string{"Env": "prod"}, tags())
+}
+
+func TestDeploy_offlineNoExecute(t *testing.T) {
+	api := NewOfflineCloudFormation("eu-west-1")
+	deployment := &cftool.Deployment{
+		StackName:    "mystack",
+		TemplateBody: []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n"),
+	}
+
+	dir, err := ioutil.TempDir("", "cftool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "changeset.json")
+	opts := cftool.Options{Unattended: true, NoExecute: true, DumpChangeSet: path}
+	d, err := cftool.Deploy(context.Background(), api, deployment, opts, ioutil.Discard)
+	require.NoError(t, err)
+	require.Equal(t, cftool.StackStatus("CHANGES_PENDING"), d.FinalStatus)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	var chset cf.DescribeChangeSetOutput
+	require.NoError(t, json.Unmarshal(data, &chset))
+	require.Equal(t, d.ChangeSetName, *chset.ChangeSetName)
+	require.Equal(t, "Queue", *chset.Changes[0].ResourceChange.LogicalResourceId)
+
+	// The change set is left to be executed.
+	_, err = api.ExecuteChangeSetWithContext(nil, &cf.ExecuteChangeSetInput{
+		StackName:     aws.String("mystack"),
+		ChangeSetName: aws.String(d.ChangeSetName),
+	})
+	require.NoError(t, err)
+}
+
+func TestDeploy_offlineNoExecuteNewStack(t *testing.T) {
+	api := NewOfflineCloudFormation("eu-west-1")
+	deployment := &cftool.Deployment{
+		StackName:    "mystack",
+		TemplateBody: []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n"),
+	}
+
+	_, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Unattended: true, NoExecute: true}, ioutil.Discard)
+	require.NoError(t, err)
+
+	stacks, err := api.DescribeStacks(&cf.DescribeStacksInput{StackName: aws.String("mystack")})
+	require.NoError(t, err)
+	require.Equal(t, cf.StackStatusReviewInProgress, *stacks.Stacks[0].StackStatus)
+
+	// The stack was never created, so creating it still needs confirmation.
+	_, err = cftool.Deploy(context.Background(), api, deployment, cftool.Options{Unattended: true}, ioutil.Discard)
+	require.Equal(t, cftool.ErrNoConfirmation, errors.Cause(err))
+
+	d, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+	require.NoError(t, err)
+	require.Equal(t, cftool.StackStatus(cf.StackStatusCreateComplete), d.FinalStatus)
+}
+
+func TestDeploy_offlineCapabilities(t *testing.T) {
+	api := NewOfflineCloudFormation("eu-west-1")
+	deployment := &cftool.Deployment{
+		StackName:           "mystack",
+		TemplateBody:        []byte("Resources:\n  Role: {Type: AWS::IAM::Role, Properties: {RoleName: deployer}}\n"),
+		AllowedCapabilities: []string{cf.CapabilityCapabilityIam},
+	}
+
+	_, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+	require.Equal(t, cftool.ErrCapabilities, errors.Cause(err))
+	require.Contains(t, err.Error(), "stack mystack needs CAPABILITY_NAMED_IAM (allowed: CAPABILITY_IAM): The following resource(s) require capabilities: [AWS::IAM::Role]")
+
+	deployment.AllowedCapabilities = []string{cf.CapabilityCapabilityNamedIam}
+	_, err = cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+	require.NoError(t, err)
+}
+
+func TestDeploy_offlineReplaceOnFailure(t *testing.T) {
+	api := NewOfflineCloudFormation("eu-west-1")
+	api.Failures = map[string]string{"Queue": "Resource handler returned message: \"Access Denied\""}
+	deployment := &cftool.Deployment{
+		StackName:    "mystack",
+		TemplateBody: []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n"),
+	}
+
+	// Every stack named mystack that was ever created.
+	created := func() int {
+		count := 0
+		for _, s := range api.stacks {
+			if *s.stack.StackName == "mystack" {
+				count++
+			}
+		}
+
+		return count
+	}
+
+	// Creation fails, and is retried once with a new stack.
+	opts := cftool.Options{Yes: true, Unattended: true, ReplaceOnFailure: true, DeleteFailedCreates: true}
+	_, err := cftool.Deploy(context.Background(), api, deployment, opts, ioutil.Discard)
+	require.Error(t, err)
+	require.Equal(t, 2, created())
+
+	// A stack that failed creation in an earlier run is replaced, and not
+	// again when its creation fails once more.
+	api = NewOfflineCloudFormation("eu-west-1")
+	api.Failures = map[string]string{"Queue": "Access Denied"}
+	_, err = cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true, NoDeleteOnRollback: true}, ioutil.Discard)
+	require.Error(t, err)
+	require.Equal(t, 1, created())
+
+	_, err = cftool.Deploy(context.Background(), api, deployment, opts, ioutil.Discard)
+	require.Error(t, err)
+	require.Equal(t, 2, created())
+
+	api.Failures = nil
+	d, err := cftool.Deploy(context.Background(), api, deployment, opts, ioutil.Discard)
+	require.NoError(t, err)
+	require.Equal(t, cftool.StackStatus(cf.StackStatusCreateComplete), d.FinalStatus)
+	require.Equal(t, 3, created())
+}
+
+func TestDelete_offline(t *testing.T) {
+	api := NewOfflineCloudFormation("eu-west-1")
+	deployment := &cftool.Deployment{
+		StackName:    "mystack",
+		TemplateBody: []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n  Bucket: {Type: AWS::S3::Bucket, DeletionPolicy: Retain}\n"),
+	}
+
+	_, err := cftool.Deploy(context.Background(), api, deployment, cftool.Options{Yes: true, Unattended: true}, ioutil.Discard)
+	require.NoError(t, err)
+
+	d := cftool.NewDeployer(api, &cftool.Deployment{StackName: "mystack"})
+	d.Unattended = true
+	require.Equal(t, cftool.ErrNoConfirmation, d.Delete(context.Background(), ioutil.Discard))
+
+	d.Yes = true
+	require.NoError(t, d.Delete(context.Background(), ioutil.Discard))
+	require.Equal(t, cftool.StackStatus(cf.StackStatusDeleteComplete), d.FinalStatus)
+}
@@ -9,9 +9,11 @@ import (
 
 func main() {
 	err := cli.Entry(context.Background(), os.Args)
+	code := cli.ExitCode(err)
 
-	if err != nil {
+	if code == cli.ExitError || code == cli.ExitStackFailed {
 		fmt.Printf("ERROR: %v", err)
-		os.Exit(1)
 	}
+
+	os.Exit(code)
 }
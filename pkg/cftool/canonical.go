@@ -0,0 +1,109 @@
+package cftool
+
+import (
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	yamlv3 "gopkg.in/yaml.v3"
+	"strings"
+)
+
+// CanonicalTemplate rewrites a JSON or YAML template into a canonical form,
+// so that templates that differ only in how they are written compare equal.
+// Short form intrinsic functions such as !Ref or !GetAtt are expanded to their
+// long form, keys are sorted, scalars become strings, and the result is
+// formatted as YAML.
+func CanonicalTemplate(body []byte) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(body, &doc); err != nil {
+		return nil, errors.Wrap(err, "parse template")
+	}
+
+	if len(doc.Content) == 0 {
+		return []byte{}, nil
+	}
+
+	value, err := canonicalValue(doc.Content[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(value)
+}
+
+func canonicalValue(node *yamlv3.Node) (interface{}, error) {
+	var value interface{}
+
+	switch node.Kind {
+	case yamlv3.AliasNode:
+		return canonicalValue(node.Alias)
+
+	case yamlv3.ScalarNode:
+		if node.Tag == "!!null" {
+			value = nil
+		} else {
+			value = node.Value
+		}
+
+	case yamlv3.SequenceNode:
+		items := make([]interface{}, len(node.Content))
+		for i, child := range node.Content {
+			item, err := canonicalValue(child)
+			if err != nil {
+				return nil, err
+			}
+
+			items[i] = item
+		}
+
+		value = items
+
+	case yamlv3.MappingNode:
+		fields := make(map[string]interface{})
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			field, err := canonicalValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			fields[node.Content[i].Value] = field
+		}
+
+		if arg, ok := fields["Fn::GetAtt"]; ok && len(fields) == 1 {
+			return intrinsic("GetAtt", arg), nil
+		}
+
+		value = fields
+
+	default:
+		return nil, errors.Errorf("line %d: unexpected yaml node", node.Line)
+	}
+
+	if !strings.HasPrefix(node.Tag, "!") || strings.HasPrefix(node.Tag, "!!") {
+		return value, nil
+	}
+
+	return intrinsic(strings.TrimPrefix(node.Tag, "!"), value), nil
+}
+
+// intrinsic expands the short form of an intrinsic function, given as a YAML
+// tag, to the long form.
+func intrinsic(name string, arg interface{}) interface{} {
+	switch name {
+	case "Ref", "Condition":
+		return map[string]interface{}{name: arg}
+
+	case "GetAtt":
+		// The short form also accepts "Resource.Attribute".
+		if s, ok := arg.(string); ok {
+			parts := strings.SplitN(s, ".", 2)
+			items := make([]interface{}, len(parts))
+			for i, part := range parts {
+				items[i] = part
+			}
+
+			arg = items
+		}
+	}
+
+	return map[string]interface{}{"Fn::" + name: arg}
+}
@@ -0,0 +1,50 @@
+package cftool
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCanonicalTemplate(t *testing.T) {
+	short := `
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      DelaySeconds: 10
+      QueueName: !Sub "${AWS::StackName}-queue"
+  Topic:
+    Type: AWS::SNS::Topic
+    Properties:
+      Subscription:
+        - Endpoint: !GetAtt Queue.Arn
+          Protocol: sqs
+      TopicName: !Join ["-", [!Ref Environment, topic]]
+`
+
+	long := `{
+  "Resources": {
+    "Topic": {
+      "Type": "AWS::SNS::Topic",
+      "Properties": {
+        "TopicName": {"Fn::Join": ["-", [{"Ref": "Environment"}, "topic"]]},
+        "Subscription": [{"Protocol": "sqs", "Endpoint": {"Fn::GetAtt": ["Queue", "Arn"]}}]
+      }
+    },
+    "Queue": {
+      "Type": "AWS::SQS::Queue",
+      "Properties": {"QueueName": {"Fn::Sub": "${AWS::StackName}-queue"}, "DelaySeconds": "10"}
+    }
+  }
+}`
+
+	a, err := CanonicalTemplate([]byte(short))
+	require.NoError(t, err)
+	b, err := CanonicalTemplate([]byte(long))
+	require.NoError(t, err)
+	require.Equal(t, string(a), string(b))
+	require.Contains(t, string(a), "Fn::GetAtt:\n          - Queue\n          - Arn\n")
+
+	_, err = CanonicalTemplate([]byte("Resources: ["))
+	require.Error(t, err)
+}
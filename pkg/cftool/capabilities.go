@@ -0,0 +1,98 @@
+package cftool
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+// ErrCapabilities is returned when a template needs capabilities that the
+// deployment doesn't allow.
+var ErrCapabilities = errors.New("template needs capabilities that are not allowed")
+
+// ParseCapabilities reads a list of allowed capabilities, which may leave out
+// the CAPABILITY_ prefix. "none" allows none, and gives an empty list rather
+// than nil, which allows all.
+func ParseCapabilities(values []string) ([]string, error) {
+	result := []string{}
+
+	for _, value := range values {
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if value == "NONE" {
+			continue
+		}
+
+		if !strings.HasPrefix(value, "CAPABILITY_") {
+			value = "CAPABILITY_" + value
+		}
+
+		switch value {
+		case cf.CapabilityCapabilityIam, cf.CapabilityCapabilityNamedIam, cf.CapabilityCapabilityAutoExpand:
+			result = append(result, value)
+		default:
+			return nil, errors.Errorf("unknown capability %s", value)
+		}
+	}
+
+	return result, nil
+}
+
+// allowsCapability reports whether the capability is among the allowed ones.
+// CAPABILITY_NAMED_IAM includes CAPABILITY_IAM, as in CloudFormation.
+func allowsCapability(allowed []string, capability string) bool {
+	for _, a := range allowed {
+		if a == capability || (a == cf.CapabilityCapabilityNamedIam && capability == cf.CapabilityCapabilityIam) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkCapabilities refuses to deploy a template that needs capabilities
+// outside AllowedCapabilities, as reported by ValidateTemplate. A nil list
+// allows all.
+func (d *Deployer) checkCapabilities(w io.Writer) error {
+	if d.AllowedCapabilities == nil {
+		return nil
+	}
+
+	input := cf.ValidateTemplateInput{}
+	if d.TemplateURL != "" {
+		input.TemplateURL = aws.String(d.TemplateURL)
+	} else {
+		input.TemplateBody = aws.String(string(d.TemplateBody))
+	}
+
+	output, err := d.client.ValidateTemplate(&input)
+	if err != nil {
+		return errors.Wrap(err, "validate template")
+	}
+
+	var denied []string
+	for _, capability := range aws.StringValueSlice(output.Capabilities) {
+		if !allowsCapability(d.AllowedCapabilities, capability) {
+			denied = append(denied, capability)
+		}
+	}
+
+	if len(denied) == 0 {
+		return nil
+	}
+
+	allowed := "none"
+	if len(d.AllowedCapabilities) > 0 {
+		allowed = strings.Join(d.AllowedCapabilities, ", ")
+	}
+
+	d.Log.Log(LevelError, d.StackName, "capabilities", map[string]interface{}{
+		"denied":  denied,
+		"allowed": d.AllowedCapabilities,
+		"reason":  aws.StringValue(output.CapabilitiesReason),
+	})
+
+	return errors.Wrapf(ErrCapabilities, "stack %s needs %s (allowed: %s): %s",
+		d.StackName, strings.Join(denied, ", "), allowed, aws.StringValue(output.CapabilitiesReason))
+}
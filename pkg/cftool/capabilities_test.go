@@ -0,0 +1,26 @@
+package cftool
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	capabilities, err := ParseCapabilities([]string{"none"})
+	require.NoError(t, err)
+	require.NotNil(t, capabilities)
+	require.Empty(t, capabilities)
+
+	capabilities, err = ParseCapabilities([]string{"iam", "CAPABILITY_AUTO_EXPAND"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"CAPABILITY_IAM", "CAPABILITY_AUTO_EXPAND"}, capabilities)
+
+	_, err = ParseCapabilities([]string{"ROOT"})
+	require.EqualError(t, err, "unknown capability CAPABILITY_ROOT")
+}
+
+func TestAllowsCapability(t *testing.T) {
+	require.True(t, allowsCapability([]string{"CAPABILITY_NAMED_IAM"}, "CAPABILITY_IAM"))
+	require.False(t, allowsCapability([]string{"CAPABILITY_IAM"}, "CAPABILITY_NAMED_IAM"))
+	require.False(t, allowsCapability(nil, "CAPABILITY_IAM"))
+}
@@ -1,16 +1,56 @@
 package cftool
 
+import (
+	"regexp"
+	"time"
+)
+
 type Deployment struct {
 	TenantLabel  string
 	StackLabel   string
 	Protected    bool
+	Confirm      string
 	Constants    map[string]string
 	Tags         map[string]string
 	AccountId    string
+	RoleArn      string
 	Region       string
 	StackName    string
 	TemplateBody []byte
 	Parameters   map[string]string
+
+	// TemplateURL, if set, is passed to CloudFormation instead of the body,
+	// which is then only needed for diffing.
+	TemplateURL string
+
+	// Files are the local template and parameter files the deployment was
+	// read from.
+	Files []string
+
+	// AllowedCapabilities, if not nil, are the only capabilities the template
+	// may need.
+	AllowedCapabilities []string
+
+	// AllowedResourceTypes, if not nil, are the only resource types a change
+	// set may add or modify, and DeniedResourceTypes those it may not. Both
+	// are patterns such as AWS::IAM::*.
+	AllowedResourceTypes []string
+	DeniedResourceTypes  []string
+
+	// RollbackAlarms are the names of CloudWatch alarms that roll back the
+	// stack if they go off during a deployment. They are resolved to
+	// RollbackTriggers, the ARNs of the alarms, before deploying.
+	RollbackAlarms   []string
+	RollbackTriggers []string
+
+	// ResourceTimeouts are how long resources of each type pattern are
+	// expected to be in progress. Resources that take longer are warned about
+	// while the stack is monitored.
+	ResourceTimeouts map[string]time.Duration
+
+	// ExpectedOutputs are the outputs the stack must have once deployed, by
+	// key, with patterns their values must match.
+	ExpectedOutputs map[string]*regexp.Regexp
 }
 
 type Parameters map[string]string
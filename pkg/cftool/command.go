@@ -0,0 +1,68 @@
+package cftool
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// CommandPrefix marks a parameter value as a shell command, whose output is
+// the actual value, e.g. "!cmd: ./latest-ami.sh".
+const CommandPrefix = "!cmd:"
+
+// RunParameterCommands replaces parameter values that are commands with their
+// output, without surrounding whitespace. Running commands must be allowed
+// explicitly; otherwise, or if a command fails, an error is returned.
+func RunParameterCommands(params map[string]string, allow bool) error {
+	var names []string
+	for name, value := range params {
+		if strings.HasPrefix(value, CommandPrefix) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		command := strings.TrimSpace(strings.TrimPrefix(params[name], CommandPrefix))
+
+		if !allow {
+			return errors.Errorf("parameter %s is a command, which requires --allow-exec: %s", name, command)
+		}
+
+		output, err := runCommand(command)
+		if err != nil {
+			return errors.Wrapf(err, "parameter %s: %s", name, command)
+		}
+
+		params[name] = output
+	}
+
+	return nil
+}
+
+func runCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.Wrap(err, msg)
+		}
+
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
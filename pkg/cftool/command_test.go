@@ -0,0 +1,24 @@
+package cftool
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRunParameterCommands(t *testing.T) {
+	params := map[string]string{
+		"ImageId":     "!cmd: echo ami-123",
+		"Environment": "test",
+	}
+
+	require.EqualError(t,
+		RunParameterCommands(params, false),
+		"parameter ImageId is a command, which requires --allow-exec: echo ami-123")
+
+	require.NoError(t, RunParameterCommands(params, true))
+	require.Equal(t, map[string]string{"ImageId": "ami-123", "Environment": "test"}, params)
+
+	err := RunParameterCommands(map[string]string{"ImageId": "!cmd: echo not found >&2; exit 3"}, true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "parameter ImageId: echo not found >&2; exit 3: not found: exit status 3")
+}
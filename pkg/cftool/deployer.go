@@ -0,0 +1,1953 @@
+package cftool
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrAbortedByUser = errors.New("aborted by user")
+
+// NoChangesReason is the status reason of a change set that failed because the
+// template and parameters are unchanged.
+const NoChangesReason = "The submitted information didn't contain changes"
+
+// ApprovalTag is the stack tag that records the comment given for the last
+// deployment that was commented.
+const ApprovalTag = "cftool:last-approval"
+
+// TemplateHashTag is the stack tag that records the SHA-256 of the template
+// deployed last by cftool, to detect changes made outside of it.
+const TemplateHashTag = "cftool:template-sha256"
+
+// maxTagValueLength is the longest value CloudFormation accepts for a tag.
+const maxTagValueLength = 256
+
+// maxDescriptionLength is the longest description CloudFormation accepts for
+// a change set.
+const maxDescriptionLength = 1024
+
+// ErrNoConfirmation is returned when confirmation is needed, but stdin is not
+// a terminal.
+var ErrNoConfirmation = errors.New("refusing to proceed without confirmation; pass --yes")
+
+// ErrProtected is returned when a protected stack would be changed without
+// typed confirmation.
+var ErrProtected = errors.New("stack is protected; type its name to confirm, or pass --i-understand")
+
+// ErrConfirmationRequired is returned when a stack whose change sets are
+// always confirmed would be changed, but stdin is not a terminal.
+var ErrConfirmationRequired = errors.New("stack always needs confirmation; run on a terminal, or pass --i-understand")
+
+// Confirmation policies of a deployment, which decide whether to ask before a
+// change set is executed. Without one, protected stacks are ConfirmProtected,
+// and others are confirmed unless Options.Yes is set.
+const (
+	// ConfirmAlways asks for y/n confirmation even with Options.Yes.
+	ConfirmAlways = "always"
+
+	// ConfirmNever executes change sets without asking.
+	ConfirmNever = "never"
+
+	// ConfirmProtected asks for the stack name to be typed.
+	ConfirmProtected = "protected"
+)
+
+// ErrStackFailed is returned when a stack operation ends in a failed or
+// rolled back state.
+var ErrStackFailed = errors.New("stack operation failed")
+
+// ErrStackBusy is returned by Deploy when another operation is in progress on
+// the stack, and WaitIfBusy is not set.
+var ErrStackBusy = errors.New("stack is currently busy; pass --wait-if-busy to wait for it")
+
+// ErrInterrupted is returned when the user pressed Ctrl-C while a change set
+// was created or executed.
+var ErrInterrupted = errors.New("interrupted")
+
+// interruptGrace is how long a second Ctrl-C is awaited to cancel an update,
+// after the first one interrupted monitoring it.
+const interruptGrace = 5 * time.Second
+
+// ErrChangesPending is returned by the command line in dry-run mode when a
+// change set contained changes, and detailed exit codes were requested.
+var ErrChangesPending = errors.New("changes pending")
+
+type StackStatus string
+
+func (status StackStatus) IsComplete() bool {
+	return strings.HasSuffix(string(status), "_COMPLETE")
+}
+
+func (status StackStatus) IsFailed() bool {
+	return strings.HasSuffix(string(status), "_FAILED")
+}
+
+func (status StackStatus) IsTerminal() bool {
+	return status.IsComplete() || status.IsFailed()
+}
+
+func (status StackStatus) IsRolledBack() bool {
+	return status.IsComplete() && strings.Contains(string(status), "ROLLBACK")
+}
+
+// IsBusy reports whether an operation is in progress on the stack. A stack in
+// REVIEW_IN_PROGRESS only has a change set that was never executed, so it
+// isn't busy.
+func (status StackStatus) IsBusy() bool {
+	return strings.HasSuffix(string(status), "_IN_PROGRESS") &&
+		status != cf.StackStatusReviewInProgress
+}
+
+// CloudFormation starts on a change set within seconds, unless it has a
+// problem of its own, so CREATE_PENDING is given less time than creating it.
+const (
+	DefaultChangeSetMaxWait    = 15 * time.Minute
+	DefaultChangeSetMaxPending = 2 * time.Minute
+)
+
+const (
+	DiffModeUnified    = "unified"
+	DiffModeSideBySide = "side-by-side"
+)
+
+// Options control how a Deployer deploys. The zero value prompts for
+// confirmation where needed, and executes change sets in full.
+type Options struct {
+	// ShowDiff shows a diff of the deployed and new template before the
+	// change set is created.
+	ShowDiff bool
+
+	// DiffOnly shows the diff of the deployed and new template, and stops
+	// there, without creating a change set or asking anything.
+	DiffOnly bool
+
+	// DiffMode is how TemplateDiff lays out the diff. Side-by-side falls back
+	// to unified if the output is not a terminal, or a narrow one.
+	DiffMode string
+
+	// IgnoreWhitespace makes TemplateDiff disregard changes in indentation,
+	// spacing and blank lines.
+	IgnoreWhitespace bool
+
+	// SemanticDiff makes TemplateDiff compare the templates in a canonical
+	// form, e.g. with !Ref expanded to {"Ref": ...}, rather than as written.
+	SemanticDiff bool
+
+	// HandleInterrupts catches Ctrl-C while a change set is created or
+	// executed. A pending change set is then deleted, and an update in
+	// progress can be cancelled. Otherwise, Ctrl-C terminates cftool.
+	HandleInterrupts bool
+
+	// Trace, if set, records the time spent waiting for the change set and
+	// the stack operation, and the calls made to poll them.
+	Trace *Trace
+
+	// RateLimiter, if set, spaces out the calls made to poll the change set
+	// and the stack operation. Deployers that run at the same time share one
+	// to stay within an overall budget.
+	RateLimiter *RateLimiter
+
+	// Interactive enables in-place progress updates while monitoring.
+	Interactive bool
+
+	// Unattended never prompts, as if stdin were not a terminal, e.g. because
+	// the output is not shown right away.
+	Unattended bool
+
+	// Log receives structured events. It may be nil.
+	Log *Logger
+
+	// EventLog, if set, receives every stack event seen while monitoring,
+	// whatever the terminal shows.
+	EventLog *Logger
+
+	// DryRun only shows the change set, and then deletes it.
+	DryRun bool
+
+	// NoExecute only shows the change set, and leaves it to be executed or
+	// deleted later.
+	NoExecute bool
+
+	// DumpChangeSet, if set, is the path the change set is written to as JSON
+	// before it is executed, e.g. for policy checks.
+	DumpChangeSet string
+
+	// OnlyChanged skips straight past stacks without changes, without printing
+	// their outputs.
+	OnlyChanged bool
+
+	// SortOutputs prints the outputs of the stack sorted by key, rather than
+	// in the order CloudFormation returns them.
+	SortOutputs bool
+
+	// KeepFailedChangeSet leaves change sets that failed to create in place,
+	// so they can be inspected.
+	KeepFailedChangeSet bool
+
+	// CancelOnTimeout cancels the stack update in progress if the context
+	// passed to Deploy expires while monitoring it.
+	CancelOnTimeout bool
+
+	// ChangeSetMaxWait bounds how long a change set may take to create, with
+	// DefaultChangeSetMaxWait if zero. ChangeSetMaxPending bounds how much of
+	// that time it may stay CREATE_PENDING, before CloudFormation starts on
+	// it, with DefaultChangeSetMaxPending if zero. A change set that takes
+	// longer fails to create.
+	ChangeSetMaxWait    time.Duration
+	ChangeSetMaxPending time.Duration
+
+	// FailOnDrift runs drift detection on an existing stack before creating
+	// the change set, and refuses to deploy if resources have drifted.
+	FailOnDrift bool
+
+	// Heartbeat, if set, is how often a line with the stack status and the
+	// time spent is printed while monitoring a stack operation, so that CI
+	// systems that buffer output see regular progress.
+	Heartbeat time.Duration
+
+	// WaitIfBusy makes Deploy wait for an operation already in progress on
+	// the stack to finish, and then deploy, rather than fail with
+	// ErrStackBusy.
+	WaitIfBusy bool
+
+	// Yes skips confirmation of change sets, and answers other prompts if
+	// stdin is not a terminal. It has no effect on protected stacks.
+	Yes bool
+
+	// DeleteFailedCreates deletes a stack that failed creation without asking.
+	// The deployment still fails.
+	DeleteFailedCreates bool
+
+	// NoDeleteOnRollback leaves a stack that failed creation in place without
+	// asking, so that scripts behave the same whether or not there is a
+	// terminal. The deployment fails either way.
+	NoDeleteOnRollback bool
+
+	// ReplaceOnFailure deletes a stack that failed creation without asking,
+	// and creates it again once. A stack left in ROLLBACK_COMPLETE by an
+	// earlier deployment is replaced as well.
+	ReplaceOnFailure bool
+
+	// RetainOnDelete are the logical ids of resources to keep if a stack that
+	// failed creation has to be deleted, and deleting them fails.
+	RetainOnDelete []string
+
+	// Comment is the reason for the deployment, e.g. a change ticket. It is
+	// logged, and recorded in the ApprovalTag of the stack.
+	Comment string
+
+	// Description is set on the change set, so that those browsing change
+	// sets in the console can tell who or what created them.
+	Description string
+
+	// RequiredTags are set as stack tags, in addition to those the stack has
+	// already. CloudFormation propagates them to most resources.
+	RequiredTags map[string]string
+
+	// TrackTemplate records the hash of the template in the TemplateHashTag
+	// of the stack. Stacks that have the tag already are always tracked.
+	TrackTemplate bool
+
+	// Lock, if set, is held under LockKey from before the change set is created
+	// until Deploy returns. ForceUnlock takes it even if it is held already.
+	Lock        StackLock
+	LockKey     string
+	ForceUnlock bool
+
+	// ChangeFilter restricts which changes of the change set are shown. The
+	// change set is still executed in full.
+	ChangeFilter pprint.ChangeFilter
+
+	// DetailedChangeSet shows the values before and after the change set of
+	// the properties it modifies, as far as they can be resolved from the
+	// deployed and the new template.
+	DetailedChangeSet bool
+
+	// IUnderstand executes change sets of protected stacks without asking for
+	// the stack name to be typed, and those of ConfirmAlways stacks without
+	// asking at all.
+	IUnderstand bool
+}
+
+// Deployer deploys a Deployment through a change set, and reports on it. The
+// options can be set directly on it, as they are embedded.
+type Deployer struct {
+	*Deployment
+	Options
+
+	client        cloudformationiface.CloudFormationAPI
+	ChangeSetName string
+
+	// StackId and ChangeSetId are the ARNs of the stack and change set, once
+	// known.
+	StackId     string
+	ChangeSetId string
+
+	// Outputs are the outputs of the stack by key, once it has been deployed.
+	Outputs map[string]string
+
+	// ExportChanges are the exports of the stack that the deployment added,
+	// modified or removed.
+	ExportChanges []ExportChange
+
+	// interrupts receives Ctrl-C presses while they are caught.
+	interrupts <-chan os.Signal
+
+	// HasChanges is set by Deploy if the change set contained changes.
+	HasChanges bool
+
+	// FinalStatus is the stack status once Deploy has finished, or NO_CHANGE.
+	FinalStatus StackStatus
+	changes     map[string]interface{}
+
+	// rootFailure is the first resource failure seen while monitoring.
+	rootFailure *cf.StackEvent
+
+	// replaced is set once a stack that failed creation was replaced, so
+	// that creation is only retried once.
+	replaced bool
+}
+
+// Changes summarises the change set by action, once it has been created.
+func (d *Deployer) Changes() map[string]interface{} {
+	return d.changes
+}
+
+// changeCount is the number of changes in the change set, or 0 before it has
+// been created, e.g. when waiting for an operation started elsewhere.
+func (d *Deployer) changeCount() int {
+	count, _ := d.changes["changes"].(int)
+	return count
+}
+
+// NewDeployer returns a Deployer for the deployment, which calls
+// CloudFormation through api. Set its options before calling Deploy.
+func NewDeployer(api cloudformationiface.CloudFormationAPI, d *Deployment) *Deployer {
+	return &Deployer{
+		Deployment: d,
+		client:     api,
+	}
+}
+
+// Deploy creates a change set for the deployment, executes it and waits for
+// the stack operation to finish, writing progress to w. It is the entry point
+// for programs that embed cftool. The returned Deployer tells the outcome,
+// e.g. in FinalStatus and Outputs, also if an error is returned.
+//
+// Prompts are read from stdin when it is a terminal. Programs that don't want
+// that set opts.Unattended, and opts.Yes to proceed without confirmation.
+// Protected stacks then also need opts.IUnderstand.
+func Deploy(
+	c context.Context,
+	api cloudformationiface.CloudFormationAPI,
+	deployment *Deployment,
+	opts Options,
+	w io.Writer,
+) (*Deployer, error) {
+	d := NewDeployer(api, deployment)
+	d.Options = opts
+	return d, d.Deploy(c, w)
+}
+
+func (d *Deployer) Deploy(c context.Context, w io.Writer) error {
+	d.traceCalls()
+	pprint.Field(w, "StackName", d.StackName)
+
+	stack, err := d.findStack()
+	if err != nil {
+		return errors.Wrapf(err, "describe stack %s", d.StackName)
+	}
+
+	if stack != nil {
+		d.StackId = aws.StringValue(stack.StackId)
+		pprint.Field(w, "StackId", d.StackId)
+	}
+
+	// A stack in REVIEW_IN_PROGRESS, e.g. left by --no-execute, was never
+	// created, so it takes a change set to create it, and confirming that.
+	exists := stack != nil && aws.StringValue(stack.StackStatus) != cf.StackStatusReviewInProgress
+
+	if d.DiffOnly {
+		return d.diffOnly(w, exists)
+	}
+
+	if exists && StackStatus(aws.StringValue(stack.StackStatus)).IsBusy() {
+		if !d.WaitIfBusy {
+			return errors.Wrapf(ErrStackBusy, "stack %s is %s", d.StackName, aws.StringValue(stack.StackStatus))
+		}
+
+		stack, err = d.waitUntilIdle(c, w, stack)
+		if err != nil {
+			return err
+		}
+
+		exists = stack != nil
+	}
+
+	if exists && d.ReplaceOnFailure && aws.StringValue(stack.StackStatus) == cf.StackStatusRollbackComplete {
+		if d.DryRun || d.NoExecute {
+			return errors.Errorf("stack %s failed creation before, and is only replaced when deploying", d.StackName)
+		}
+
+		fmt.Fprintf(w, "\nStack failed creation before. Deleting it to create it again.\n")
+		if err := d.replaceFailedStack(c, w); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "\n")
+		stack, exists = nil, false
+		d.replaced = true
+	}
+
+	// The exports before the deployment, to tell what it changes about them.
+	var exportsBefore []*cf.Output
+	if exists {
+		exportsBefore = stack.Outputs
+	}
+
+	if !exists && !d.DryRun && !d.NoExecute {
+		if err := d.confirm(w, d.Yes, "\nStack %s does not exist. Create?", d.StackName); err != nil {
+			return err
+		}
+	}
+
+	if exists && d.ShowDiff {
+		err := d.TemplateDiff(w)
+		if err != nil {
+			return errors.Wrap(err, "template diff")
+		}
+	}
+
+	if d.Protected && d.Comment == "" && !d.DryRun && !d.IUnderstand && d.interactiveInput() {
+		d.Comment, _ = pprint.PromptLine(w, "\nStack %s is protected. Comment on this deployment (optional):", d.StackName)
+	}
+
+	if len(d.Comment) > maxTagValueLength {
+		return errors.Errorf("comment is longer than %d characters", maxTagValueLength)
+	}
+
+	if len(d.Description) > maxDescriptionLength {
+		return errors.Errorf("description is longer than %d characters", maxDescriptionLength)
+	}
+
+	tags := make(map[string]string)
+	for key, value := range d.Tags {
+		tags[key] = value
+	}
+
+	for key, value := range d.RequiredTags {
+		tags[key] = value
+	}
+
+	if d.Comment != "" {
+		tags[ApprovalTag] = d.Comment
+	}
+
+	if exists {
+		if err := d.checkTemplateHash(w, stack); err != nil {
+			return err
+		}
+	}
+
+	if err := d.checkCapabilities(w); err != nil {
+		return err
+	}
+
+	if exists && d.FailOnDrift {
+		if err := d.checkDrift(c, w); err != nil {
+			return err
+		}
+	}
+
+	if (d.TrackTemplate || stackTag(stack, TemplateHashTag) != "") && len(d.TemplateBody) > 0 {
+		tags[TemplateHashTag] = templateHash(string(d.TemplateBody))
+	}
+
+	if d.Lock != nil {
+		if err := d.Lock.Acquire(d.LockKey, d.ForceUnlock); err != nil {
+			return err
+		}
+
+		defer d.releaseLock(w)
+	}
+
+	nochange := false
+	release := d.catchInterrupts()
+	cc, cancel := d.interruptible(c)
+	chset, err := d.createChangeSet(cc, !exists, stackTags(stack, tags, d.Tags != nil))
+	interrupted := cc.Err() != nil && c.Err() == nil
+	cancel()
+	release()
+
+	if interrupted {
+		d.discardInterruptedChangeSet(w, !exists)
+		return ErrInterrupted
+	}
+
+	if err != nil {
+		nochange = strings.Contains(err.Error(), NoChangesReason)
+
+		if chset != nil {
+			d.discardFailedChangeSet(w, chset, !exists, nochange)
+		}
+
+		if !nochange {
+			return errors.Wrap(err, "create change set")
+		}
+	}
+
+	if nochange {
+		fmt.Fprintf(w, "\nNo change.\n")
+		d.FinalStatus = "NO_CHANGE"
+		d.Log.Log(LevelInfo, d.StackName, "no-change", nil)
+
+		if d.OnlyChanged {
+			return nil
+		}
+	} else {
+		if !exists {
+			d.StackId = aws.StringValue(chset.StackId)
+			pprint.Field(w, "StackId", d.StackId)
+		}
+
+		d.ChangeSetId = aws.StringValue(chset.ChangeSetId)
+		pprint.Field(w, "ChangeSet", d.ChangeSetId)
+
+		var values pprint.PropertyChanges
+		if d.DetailedChangeSet && exists {
+			var verr error
+			if values, verr = d.propertyChanges(chset); verr != nil {
+				pprint.Warningf(w, "property values: %v", verr)
+			}
+		}
+
+		shown := pprint.DetailedChangeSet(w, chset, d.ChangeFilter, values)
+		d.HasChanges = true
+		d.changes = summarizeChangeSet(chset)
+
+		if !d.ChangeFilter.IsEmpty() {
+			fmt.Fprintf(w, "\nShowing %d of %d changes. ", shown, d.changes["changes"])
+			fmt.Fprintf(w, "In total: %d to add, %d to modify, %d to remove, %d to replace.\n",
+				d.changes["add"], d.changes["modify"], d.changes["remove"], d.changes["replace"])
+		}
+		d.Log.Log(LevelInfo, d.StackName, "change-set", d.changes)
+
+		if err := d.checkResourceTypes(w, chset); err != nil {
+			if derr := d.discardChangeSet(chset, !exists); derr != nil {
+				pprint.Warningf(w, "%v", derr)
+			}
+
+			return err
+		}
+
+		if d.DumpChangeSet != "" {
+			if err := writeChangeSet(d.DumpChangeSet, chset); err != nil {
+				return errors.Wrap(err, "dump change set")
+			}
+
+			pprint.Field(w, "Dumped", d.DumpChangeSet)
+		}
+
+		if d.NoExecute {
+			d.FinalStatus = "CHANGES_PENDING"
+			fmt.Fprintf(w, "\nNot executing change set %s.\n", d.ChangeSetName)
+			return nil
+		}
+
+		if d.DryRun {
+			d.FinalStatus = "CHANGES_PENDING"
+			fmt.Fprintf(w, "\nDry run. Deleting change set.\n")
+			return d.discardChangeSet(chset, !exists)
+		}
+
+		if err := d.confirmExecute(w); err != nil {
+			return err
+		}
+
+		if chset == nil {
+			return errors.New("expected non-nil chset")
+		}
+
+		if d.Comment != "" {
+			d.Log.Log(LevelInfo, d.StackName, "approval", map[string]interface{}{"comment": d.Comment})
+		}
+
+		since := time.Now()
+		release := d.catchInterrupts()
+
+		_, err = d.client.ExecuteChangeSetWithContext(c,
+			&cf.ExecuteChangeSetInput{
+				StackName:     chset.StackName,
+				ChangeSetName: chset.ChangeSetName,
+			})
+		if err != nil {
+			release()
+			return errors.Wrap(err, "execute change set")
+		}
+
+		stack, err := d.monitorStackUpdate(c, w, since)
+		release()
+
+		if errors.Cause(err) == ErrInterrupted {
+			return err
+		} else if err != nil {
+			if c.Err() != nil && d.CancelOnTimeout && exists {
+				d.cancelUpdate(w)
+			}
+
+			return errors.Wrap(err, "monitor stack update")
+		}
+
+		fmt.Fprintf(w, "\n")
+		pprint.Field(w, "Duration", time.Since(since).Round(time.Second))
+
+		status := StackStatus(*stack.StackStatus)
+		d.FinalStatus = status
+		if !exists && status == cf.StackStatusRollbackComplete && d.ReplaceOnFailure && !d.replaced {
+			failed := d.stackFailed(w, status)
+			fmt.Fprintf(w, "\nStack failed creation. Deleting it to create it again.\n")
+
+			if err := d.replaceFailedStack(c, w); err != nil {
+				return errors.Wrapf(err, "replace stack after %v", failed)
+			}
+
+			fmt.Fprintf(w, "\nRetrying creation of stack %s.\n\n", d.StackName)
+			d.replaced = true
+			d.rootFailure = nil
+
+			// The lock is still held, and released when this call returns.
+			lock := d.Lock
+			d.Lock = nil
+			err := d.Deploy(c, w)
+			d.Lock = lock
+			return err
+		}
+
+		if !exists && status == cf.StackStatusRollbackComplete {
+			if err := d.deleteFailedCreate(c, w); err != nil {
+				return err
+			}
+		}
+
+		if status == cf.StackStatusUpdateRollbackFailed {
+			fmt.Fprintf(w, "\nStack %s can't be updated until its rollback is continued, "+
+				"e.g. with 'cftool continue-rollback -n %s'.\n", d.StackName, d.StackName)
+		}
+
+		if status.IsFailed() || status.IsRolledBack() {
+			return d.stackFailed(w, status)
+		}
+	}
+
+	outputs, err := d.getStackOutputs()
+	if err != nil {
+		return errors.Wrap(err, "get stack outputs")
+	}
+
+	if d.SortOutputs {
+		sortOutputs(outputs)
+	}
+
+	d.Outputs = make(map[string]string)
+	for i, output := range outputs {
+		if i == 0 {
+			fmt.Fprintf(w, "\n")
+		}
+
+		pprint.StackOutput(w, output)
+		d.Outputs[aws.StringValue(output.OutputKey)] = aws.StringValue(output.OutputValue)
+	}
+
+	if len(outputs) > 0 {
+		d.Log.Log(LevelInfo, d.StackName, "outputs", map[string]interface{}{"outputs": outputFields(outputs)})
+	}
+
+	d.ExportChanges = compareExports(exportsBefore, outputs)
+	for i, change := range d.ExportChanges {
+		if i == 0 {
+			fmt.Fprintf(w, "\n")
+		}
+
+		pprint.ExportChange(w, change.Action, change.Name, change.Before, change.After)
+	}
+
+	if len(d.ExportChanges) > 0 {
+		d.Log.Log(LevelWarning, d.StackName, "exports-changed", map[string]interface{}{"exports": d.ExportChanges})
+	}
+
+	return d.checkOutputs(w)
+}
+
+// sortOutputs sorts outputs by key.
+func sortOutputs(outputs []*cf.Output) {
+	sort.SliceStable(outputs, func(i, j int) bool {
+		return aws.StringValue(outputs[i].OutputKey) < aws.StringValue(outputs[j].OutputKey)
+	})
+}
+
+// outputFields describes outputs for the log, leaving out empty fields.
+func outputFields(outputs []*cf.Output) []map[string]string {
+	result := make([]map[string]string, len(outputs))
+	for i, output := range outputs {
+		fields := map[string]string{
+			"key":   aws.StringValue(output.OutputKey),
+			"value": aws.StringValue(output.OutputValue),
+		}
+
+		if output.Description != nil {
+			fields["description"] = aws.StringValue(output.Description)
+		}
+
+		if output.ExportName != nil {
+			fields["exportName"] = aws.StringValue(output.ExportName)
+		}
+
+		result[i] = fields
+	}
+
+	return result
+}
+
+// interactiveInput reports whether prompts can be answered.
+func (d *Deployer) interactiveInput() bool {
+	return !d.Unattended && pprint.IsInteractiveInput()
+}
+
+// confirm prompts the user, and returns ErrAbortedByUser if they decline. When
+// stdin is not a terminal there is nobody to ask, so it only proceeds if
+// assumeYes is set.
+func (d *Deployer) confirm(w io.Writer, assumeYes bool, format string, args ...interface{}) error {
+	if !d.interactiveInput() {
+		if assumeYes {
+			return nil
+		}
+
+		return ErrNoConfirmation
+	}
+
+	if !pprint.Promptf(w, format, args...) {
+		return ErrAbortedByUser
+	}
+
+	return nil
+}
+
+// confirmExecute asks before the change set is executed, as the confirmation
+// policy of the deployment requires.
+func (d *Deployer) confirmExecute(w io.Writer) error {
+	policy := d.Confirm
+	if policy == "" && d.Protected {
+		policy = ConfirmProtected
+	}
+
+	switch policy {
+	case ConfirmNever:
+		return nil
+
+	case ConfirmProtected:
+		return d.confirmProtected(w)
+
+	case ConfirmAlways:
+		if d.IUnderstand {
+			pprint.Warningf(w, "executing change set for stack %s without confirmation", d.StackName)
+			return nil
+		}
+
+		if !d.interactiveInput() {
+			return ErrConfirmationRequired
+		}
+
+		return d.confirm(w, false, "\nExecute change set?")
+
+	case "":
+		if d.Yes {
+			return nil
+		}
+
+		return d.confirm(w, false, "\nExecute change set?")
+
+	default:
+		return errors.Errorf("unknown confirmation policy %q", policy)
+	}
+}
+
+// confirmProtected asks for the stack name to be typed before a protected
+// stack is changed. --yes does not suffice.
+func (d *Deployer) confirmProtected(w io.Writer) error {
+	if d.IUnderstand {
+		pprint.Warningf(w, "executing change set for protected stack %s", d.StackName)
+		return nil
+	}
+
+	if !d.interactiveInput() {
+		return ErrProtected
+	}
+
+	if !pprint.PromptTyped(w, d.StackName, "\nStack %s is protected. Execute change set?", d.StackName) {
+		return ErrAbortedByUser
+	}
+
+	return nil
+}
+
+// checkTemplateHash warns if the template of the stack is neither the one
+// cftool deployed last, according to the TemplateHashTag, nor the one about to
+// be deployed. That means someone changed it in some other way, and those
+// changes are about to be overwritten.
+func (d *Deployer) checkTemplateHash(w io.Writer, stack *cf.Stack) error {
+	recorded := stackTag(stack, TemplateHashTag)
+	if recorded == "" || len(d.TemplateBody) == 0 {
+		return nil
+	}
+
+	out, err := d.client.GetTemplate(&cf.GetTemplateInput{StackName: d.stackRef()})
+	if err != nil {
+		return errors.Wrap(err, "get template")
+	}
+
+	deployed := templateHash(aws.StringValue(out.TemplateBody))
+	if deployed != recorded && deployed != templateHash(string(d.TemplateBody)) {
+		pprint.Warningf(w, "the template of stack %s was changed outside of cftool since it last deployed it", d.StackName)
+		d.Log.Log(LevelWarning, d.StackName, "template-changed", map[string]interface{}{
+			"recorded": recorded,
+			"deployed": deployed,
+		})
+	}
+
+	return nil
+}
+
+func templateHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// releaseLock releases the lock taken by Deploy. Failure to do so is only a
+// warning, since the deployment itself is done.
+func (d *Deployer) releaseLock(w io.Writer) {
+	if err := d.Lock.Release(); err != nil {
+		pprint.Warningf(w, "unlock: %v", err)
+	}
+}
+
+// stackRef identifies the stack in API calls. Once known, the stack id is
+// preferred, since a deleted stack can only be described by its id.
+func (d *Deployer) stackRef() *string {
+	if d.StackId != "" {
+		return aws.String(d.StackId)
+	}
+
+	return aws.String(d.StackName)
+}
+
+func (d *Deployer) describeStack() (*cf.Stack, error) {
+	stacks, err := d.client.DescribeStacks(
+		&cf.DescribeStacksInput{StackName: d.stackRef()})
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "describe stack %s", d.StackName)
+	}
+
+	if len(stacks.Stacks) != 1 {
+		return nil, errors.Wrapf(err, "stack %s not found", d.StackName)
+	}
+
+	return stacks.Stacks[0], nil
+}
+
+// findStack describes the stack, or returns nil if it does not exist.
+func (d *Deployer) findStack() (*cf.Stack, error) {
+	stack, err := d.describeStack()
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return stack, nil
+}
+
+func (d *Deployer) stackExists() (bool, error) {
+	stack, err := d.findStack()
+	return stack != nil, err
+}
+
+// stackTag returns the value of a tag of the stack, or "" if it has none.
+func stackTag(stack *cf.Stack, key string) string {
+	if stack == nil {
+		return ""
+	}
+
+	for _, tag := range stack.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+
+	return ""
+}
+
+// managedTagPrefix starts the keys of the stack tags that cftool maintains
+// itself, such as ApprovalTag.
+const managedTagPrefix = "cftool:"
+
+// stackTags returns the tags to give a change set of the stack. Tags given to
+// a change set replace those of the stack, so unless the tags in set are
+// complete, the other tags of the stack are kept explicitly, and nil leaves
+// the tags alone if there are none to set. A complete set only keeps the tags
+// cftool maintains, so that tags removed from the manifest are removed from
+// the stack as well.
+func stackTags(stack *cf.Stack, set map[string]string, complete bool) []*cf.Tag {
+	if len(set) == 0 && !complete {
+		return nil
+	}
+
+	tags := []*cf.Tag{}
+	seen := make(map[string]bool)
+
+	if stack != nil {
+		for _, tag := range stack.Tags {
+			key := aws.StringValue(tag.Key)
+			value, ok := set[key]
+
+			if !ok && complete && !strings.HasPrefix(key, managedTagPrefix) {
+				continue
+			}
+
+			if ok {
+				tag = &cf.Tag{Key: tag.Key, Value: aws.String(value)}
+			}
+
+			seen[key] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	var keys []string
+	for key := range set {
+		if !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		tags = append(tags, &cf.Tag{Key: aws.String(key), Value: aws.String(set[key])})
+	}
+
+	return tags
+}
+
+func (d *Deployer) createChangeSet(
+	c context.Context,
+	create bool,
+	tags []*cf.Tag,
+) (*cf.DescribeChangeSetOutput, error) {
+	changeSetType := cf.ChangeSetTypeUpdate
+	if create {
+		changeSetType = cf.ChangeSetTypeCreate
+	}
+
+	d.ChangeSetName = "StackUpdate-" + uuid.New().String()
+
+	input := cf.CreateChangeSetInput{
+		StackName:     aws.String(d.StackName),
+		ChangeSetName: aws.String(d.ChangeSetName),
+		Parameters:    make([]*cf.Parameter, len(d.Parameters)),
+		ChangeSetType: aws.String(changeSetType),
+		Tags:          tags,
+		Capabilities: []*string{
+			aws.String("CAPABILITY_IAM"),
+			aws.String("CAPABILITY_NAMED_IAM"),
+		},
+	}
+
+	if d.Description != "" {
+		input.Description = aws.String(d.Description)
+	}
+
+	if len(d.RollbackTriggers) > 0 {
+		input.RollbackConfiguration = &cf.RollbackConfiguration{}
+		for _, arn := range d.RollbackTriggers {
+			input.RollbackConfiguration.RollbackTriggers = append(
+				input.RollbackConfiguration.RollbackTriggers,
+				&cf.RollbackTrigger{Arn: aws.String(arn), Type: aws.String("AWS::CloudWatch::Alarm")})
+		}
+	}
+
+	switch {
+	case d.TemplateURL != "":
+		input.TemplateURL = aws.String(d.TemplateURL)
+	case len(d.TemplateBody) > 0:
+		input.TemplateBody = aws.String(string(d.TemplateBody))
+	default:
+		return nil, errors.Errorf("no template body or url for stack %s", d.StackName)
+	}
+
+	index := 0
+	for key, value := range d.Parameters {
+		input.Parameters[index] = &cf.Parameter{
+			ParameterKey:   aws.String(key),
+			ParameterValue: aws.String(value),
+		}
+
+		index += 1
+	}
+
+	_, err := d.client.CreateChangeSetWithContext(c, &input)
+	if err != nil {
+		return d.changeSetAfterError(err)
+	}
+
+	var chset *cf.DescribeChangeSetOutput
+	started := time.Now()
+	defer func() { d.Trace.addChangeSetWait(time.Since(started)) }()
+
+	for done := false; !done; {
+		// It's probably not going to be ready immediately anyway, so let's wait
+		// at the start of the loop.
+		if err := sleep(c, 2*time.Second); err != nil {
+			return nil, err
+		}
+
+		if err := d.RateLimiter.wait(c); err != nil {
+			return nil, err
+		}
+
+		chset, err = d.client.DescribeChangeSetWithContext(c,
+			&cf.DescribeChangeSetInput{
+				StackName:     aws.String(d.StackName),
+				ChangeSetName: aws.String(d.ChangeSetName),
+			})
+		if err != nil {
+			return d.changeSetAfterError(errors.Wrap(err, "describe change set"))
+		}
+
+		switch *chset.Status {
+		case cf.ChangeSetStatusCreateComplete:
+			done = true
+
+		case cf.ChangeSetStatusFailed:
+			// Return the change set as well, so it can be inspected or
+			// cleaned up.
+			return chset, errors.Errorf(
+				"failed to create change set: %s", aws.StringValue(chset.StatusReason))
+
+		case cf.ChangeSetStatusDeleteComplete:
+			return nil, errors.New("change set removed unexpectedly")
+
+		default:
+			// Return the change set, so that it is cleaned up.
+			if err := d.checkChangeSetWait(aws.StringValue(chset.Status), time.Since(started)); err != nil {
+				return chset, err
+			}
+		}
+	}
+
+	return chset, nil
+}
+
+// checkChangeSetWait fails once a change set has spent longer in status than
+// ChangeSetMaxPending or ChangeSetMaxWait allow.
+func (d *Deployer) checkChangeSetWait(status string, waited time.Duration) error {
+	maxWait := d.ChangeSetMaxWait
+	if maxWait <= 0 {
+		maxWait = DefaultChangeSetMaxWait
+	}
+
+	pendingWait := d.ChangeSetMaxPending
+	if pendingWait <= 0 {
+		pendingWait = DefaultChangeSetMaxPending
+	}
+
+	waited = waited.Round(time.Second)
+
+	switch {
+	case status == cf.ChangeSetStatusCreatePending && waited >= pendingWait:
+		return errors.Errorf(
+			"change set still %s after %s: CloudFormation has not started to create it, "+
+				"which points to a problem on its side; try again later", status, waited)
+
+	case waited >= maxWait:
+		return errors.Errorf("change set still %s after %s", status, waited)
+	}
+
+	return nil
+}
+
+// changeSetAfterError looks up the change set after a call failed, so that its
+// status and the reason for it are not lost along with the error. The change
+// set is returned too if it exists, so it can be inspected or cleaned up.
+func (d *Deployer) changeSetAfterError(err error) (*cf.DescribeChangeSetOutput, error) {
+	chset, derr := d.describeChangeSet()
+	if derr != nil {
+		return nil, err
+	}
+
+	if reason := aws.StringValue(chset.StatusReason); reason != "" {
+		return chset, errors.Errorf("%v (change set %s: %s)", err, aws.StringValue(chset.Status), reason)
+	}
+
+	return chset, errors.Errorf("%v (change set %s)", err, aws.StringValue(chset.Status))
+}
+
+// describeChangeSet describes the change set being deployed. It doesn't take
+// a context, since it is used after the context may have failed.
+func (d *Deployer) describeChangeSet() (*cf.DescribeChangeSetOutput, error) {
+	return d.client.DescribeChangeSetWithContext(context.Background(), &cf.DescribeChangeSetInput{
+		StackName:     aws.String(d.StackName),
+		ChangeSetName: aws.String(d.ChangeSetName),
+	})
+}
+
+// discardFailedChangeSet reports a change set that could not be created, and
+// deletes it unless it should be kept for inspection. Change sets that failed
+// only because there were no changes are always deleted without comment.
+func (d *Deployer) discardFailedChangeSet(
+	w io.Writer,
+	chset *cf.DescribeChangeSetOutput,
+	created bool,
+	nochange bool,
+) {
+	if !nochange {
+		fmt.Fprintf(w, "\n")
+		pprint.Field(w, "ChangeSet", aws.StringValue(chset.ChangeSetId))
+		pprint.Field(w, "Status", aws.StringValue(chset.Status))
+
+		if reason := aws.StringValue(chset.StatusReason); reason != "" {
+			pprint.StatusReason(w, reason)
+		}
+
+		if d.KeepFailedChangeSet {
+			fmt.Fprintf(w, "\nKeeping failed change set %s.\n", aws.StringValue(chset.ChangeSetName))
+			return
+		}
+	}
+
+	if err := d.discardChangeSet(chset, created); err != nil {
+		pprint.Warningf(w, "%v", err)
+	}
+}
+
+// discardChangeSet deletes a change set that will not be executed. If the
+// change set was creating the stack, the empty stack is deleted as well.
+func (d *Deployer) discardChangeSet(chset *cf.DescribeChangeSetOutput, created bool) error {
+	if created {
+		_, err := d.client.DeleteStack(&cf.DeleteStackInput{
+			StackName: chset.StackName,
+		})
+
+		return errors.Wrap(err, "delete review stack")
+	}
+
+	_, err := d.client.DeleteChangeSet(&cf.DeleteChangeSetInput{
+		StackName:     chset.StackName,
+		ChangeSetName: chset.ChangeSetName,
+	})
+
+	return errors.Wrap(err, "delete change set")
+}
+
+// writeChangeSet writes the change set as JSON, as DescribeChangeSet returned
+// it.
+func writeChangeSet(path string, chset *cf.DescribeChangeSetOutput) error {
+	data, err := json.MarshalIndent(chset, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// getStackEvents returns the events that occurred after the event identified by
+// lastEventId, oldest first. Events from before since are never included, which
+// limits the first call (with an empty lastEventId) to the current operation.
+func (d *Deployer) getStackEvents(c context.Context, since time.Time, lastEventId string) ([]*cf.StackEvent, error) {
+	var result []*cf.StackEvent
+	var waitErr error
+
+	if err := d.RateLimiter.wait(c); err != nil {
+		return nil, err
+	}
+
+	// Events are listed newest first, so stop paging once a known event is
+	// reached.
+	err := d.client.DescribeStackEventsPages(
+		&cf.DescribeStackEventsInput{
+			StackName: d.stackRef(),
+		},
+		func(page *cf.DescribeStackEventsOutput, lastPage bool) bool {
+			for _, event := range page.StackEvents {
+				if aws.StringValue(event.EventId) == lastEventId ||
+					event.Timestamp.Before(since) {
+
+					return false
+				}
+
+				result = append(result, event)
+			}
+
+			// Every page is a call of its own.
+			if !lastPage {
+				waitErr = d.RateLimiter.wait(c)
+			}
+
+			return waitErr == nil
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "describe stack events")
+	} else if waitErr != nil {
+		return nil, waitErr
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+
+	return result, nil
+}
+
+func (d *Deployer) getStackOutputs() ([]*cf.Output, error) {
+	stack, err := d.client.DescribeStacks(
+		&cf.DescribeStacksInput{
+			StackName: aws.String(d.StackName),
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "describe stack")
+	}
+
+	return stack.Stacks[0].Outputs, nil
+}
+
+func (d *Deployer) monitorStackUpdate(c context.Context, w io.Writer, startTime time.Time) (stack *cf.Stack, err error) {
+	lastStatus := StackStatus("UNKNOWN")
+	lastEventId := ""
+	progress := pprint.NewProgress(w, d.Interactive)
+	cancelled := false
+	started := time.Now()
+	lastHeartbeat := started
+	watch := newResourceWatch(d.ResourceTimeouts)
+	counter := newResourceProgress(d.changeCount())
+	defer func() { d.Trace.addMonitor(time.Since(started)) }()
+
+	for i := 0; ; i++ {
+		if err := d.RateLimiter.wait(c); err != nil {
+			progress.End()
+			return nil, err
+		}
+
+		stack, err = d.describeStack()
+		if err != nil {
+			return nil, err
+		}
+
+		if stack == nil {
+			return nil, errors.New("unexpected nil stack")
+		}
+
+		status := StackStatus(*stack.StackStatus)
+		changed := status != lastStatus
+
+		if changed {
+			progress.End()
+		}
+
+		// Following resources for ResourceTimeouts needs the events of every
+		// poll rather than only those of status changes. The progress only
+		// needs them now and then.
+		if changed || watch != nil || counter.due(i) {
+			events, err := d.getStackEvents(c, startTime, lastEventId)
+			if err != nil {
+				return nil, errors.Wrap(err, "get stack events")
+			}
+
+			if len(events) > 0 {
+				lastEventId = *events[len(events)-1].EventId
+			}
+
+			for _, event := range events {
+				d.logStackEvent(event)
+				d.recordFailure(event)
+
+				watch.observe(event, time.Now())
+				counter.observe(event)
+
+				if !strings.HasSuffix(*event.ResourceStatus, "_FAILED") &&
+					!strings.HasSuffix(*event.ResourceStatus, "_ROLLBACK_IN_PROGRESS") {
+
+					continue
+				}
+
+				// Between status changes, the status line is still open.
+				if changed {
+					pprint.StackEvent(w, event)
+				} else {
+					noteStackEvent(progress, event)
+				}
+			}
+		}
+
+		// Progress towards a rollback isn't worth showing.
+		if strings.Contains(string(status), "ROLLBACK") {
+			progress.SetPercent(-1)
+		} else {
+			progress.SetPercent(counter.percent())
+		}
+
+		if changed {
+			lastStatus, i = status, 0
+			d.Log.Log(LevelInfo, d.StackName, "status", map[string]interface{}{
+				"status": string(status),
+			})
+			progress.Begin(string(status), status.IsTerminal())
+		}
+
+		if status.IsTerminal() {
+			progress.End()
+			break
+		}
+
+		sleepTime := 5 * time.Second
+
+		if i < 5 {
+			// Rapid updates for the first 10 seconds.
+			sleepTime = 2 * time.Second
+		}
+
+		if err := d.sleepInterruptibly(c, sleepTime); err == ErrInterrupted {
+			progress.End()
+			if err := d.onInterrupt(c, w, status, &cancelled); err != nil {
+				return nil, err
+			}
+
+			// Show the status again once monitoring resumes.
+			lastStatus = "UNKNOWN"
+			continue
+		} else if err != nil {
+			progress.End()
+			return nil, err
+		}
+
+		if d.Heartbeat > 0 && time.Since(lastHeartbeat) >= d.Heartbeat {
+			lastHeartbeat = time.Now()
+			d.heartbeat(c, progress, status, time.Since(started))
+		}
+
+		d.warnSlowResources(progress, watch.slow(time.Now()))
+
+		progress.Tick()
+	}
+
+	return stack, err
+}
+
+// noteStackEvent shows a failed stack event without breaking the progress
+// line, for events that are followed between status changes.
+func noteStackEvent(progress *pprint.Progress, event *cf.StackEvent) {
+	buf := &bytes.Buffer{}
+	pprint.StackEvent(buf, event)
+	progress.Note("%s", strings.TrimSuffix(buf.String(), "\n"))
+}
+
+// heartbeat notes that the stack is still in the status, how long it has been,
+// and how long until the context times out, if it does.
+func (d *Deployer) heartbeat(c context.Context, progress *pprint.Progress, status StackStatus, total time.Duration) {
+	total = total.Round(time.Second)
+	line := fmt.Sprintf("Still %s after %s, %s in total", status, progress.Elapsed(), total)
+	fields := map[string]interface{}{
+		"status":  string(status),
+		"elapsed": total.String(),
+	}
+
+	if deadline, ok := c.Deadline(); ok {
+		left := time.Until(deadline).Round(time.Second)
+		line += fmt.Sprintf(", timeout in %s", left)
+		fields["timeout"] = left.String()
+	}
+
+	progress.Note("%s.", line)
+	d.Log.Log(LevelInfo, d.StackName, "heartbeat", fields)
+}
+
+// Wait monitors an operation that is already in progress on the stack until it
+// finishes, e.g. after cftool was interrupted. Events are shown from since on,
+// or from the start of the current operation if since is zero.
+func (d *Deployer) Wait(c context.Context, w io.Writer, since time.Time) error {
+	pprint.Field(w, "StackName", d.StackName)
+
+	stack, err := d.findStack()
+	if err != nil {
+		return errors.Wrapf(err, "describe stack %s", d.StackName)
+	} else if stack == nil {
+		return errors.Errorf("stack %s does not exist", d.StackName)
+	}
+
+	d.StackId = aws.StringValue(stack.StackId)
+	pprint.Field(w, "StackId", d.StackId)
+
+	if since.IsZero() {
+		since = aws.TimeValue(stack.CreationTime)
+		if stack.LastUpdatedTime != nil {
+			since = *stack.LastUpdatedTime
+		}
+	}
+
+	pprint.Field(w, "Since", since.Local().Format(time.RFC3339))
+	fmt.Fprintf(w, "\n")
+
+	stack, err = d.monitorStackUpdate(c, w, since)
+	if err != nil {
+		return errors.Wrap(err, "monitor stack update")
+	}
+
+	status := StackStatus(*stack.StackStatus)
+	d.FinalStatus = status
+
+	if status.IsFailed() || status.IsRolledBack() {
+		return d.stackFailed(w, status)
+	}
+
+	return nil
+}
+
+// waitUntilIdle monitors the operation in progress on the stack until it
+// finishes, and returns the stack as it is then, or nil if the operation
+// deleted it.
+func (d *Deployer) waitUntilIdle(c context.Context, w io.Writer, stack *cf.Stack) (*cf.Stack, error) {
+	status := aws.StringValue(stack.StackStatus)
+	fmt.Fprintf(w, "\nStack is busy with another operation (%s). Waiting for it to finish.\n\n", status)
+	d.Log.Log(LevelInfo, d.StackName, "busy", map[string]interface{}{
+		"status": status,
+	})
+
+	since := aws.TimeValue(stack.CreationTime)
+	if stack.LastUpdatedTime != nil {
+		since = *stack.LastUpdatedTime
+	}
+
+	stack, err := d.monitorStackUpdate(c, w, since)
+	if err != nil {
+		return nil, errors.Wrap(err, "wait for stack")
+	}
+
+	// Failures of the other operation are not those of this deployment.
+	d.rootFailure = nil
+	fmt.Fprintf(w, "\n")
+
+	if aws.StringValue(stack.StackStatus) == cf.StackStatusDeleteComplete {
+		d.StackId = ""
+		return nil, nil
+	}
+
+	return stack, nil
+}
+
+// Delete deletes the stack after showing which of its resources will be
+// deleted and which retained, according to the deletion policies in its
+// deployed template, and asking for the stack name to be typed. Yes skips the
+// confirmation, and DryRun stops after the review.
+func (d *Deployer) Delete(c context.Context, w io.Writer) error {
+	pprint.Field(w, "StackName", d.StackName)
+
+	stack, err := d.findStack()
+	if err != nil {
+		return errors.Wrapf(err, "describe stack %s", d.StackName)
+	} else if stack == nil {
+		return errors.Errorf("stack %s does not exist", d.StackName)
+	}
+
+	d.StackId = aws.StringValue(stack.StackId)
+	pprint.Field(w, "StackId", d.StackId)
+	pprint.Field(w, "Status", aws.StringValue(stack.StackStatus))
+
+	out, err := d.client.GetTemplate(&cf.GetTemplateInput{StackName: d.stackRef()})
+	if err != nil {
+		return errors.Wrap(err, "get template")
+	}
+
+	policies, err := DeletionPolicies([]byte(aws.StringValue(out.TemplateBody)))
+	if err != nil {
+		return errors.Wrap(err, "deployed template")
+	}
+
+	fmt.Fprintf(w, "\n")
+	pprint.DeletionPolicies(w, policies)
+
+	if d.DryRun {
+		return nil
+	}
+
+	if !d.Yes {
+		if !d.interactiveInput() {
+			return ErrNoConfirmation
+		}
+
+		if !pprint.PromptTyped(w, d.StackName, "\nDelete stack %s?", d.StackName) {
+			return ErrAbortedByUser
+		}
+	}
+
+	fmt.Fprintf(w, "\n")
+	if err := d.deleteStack(c, w); err != nil {
+		return err
+	}
+
+	if d.FinalStatus.IsFailed() {
+		return d.stackFailed(w, d.FinalStatus)
+	}
+
+	return nil
+}
+
+// deleteStack deletes the stack, e.g. one whose creation failed.
+// CloudFormation only retains resources when deleting a stack that failed to
+// delete before, so the resources in RetainOnDelete are passed on a second
+// attempt, if the first one fails.
+func (d *Deployer) deleteStack(c context.Context, w io.Writer) error {
+	input := cf.DeleteStackInput{StackName: d.stackRef()}
+
+	for {
+		_, err := d.client.DeleteStackWithContext(c, &input)
+		if err != nil {
+			return errors.Wrap(err, "delete stack")
+		}
+
+		stack, err := d.monitorStackUpdate(c, w, time.Now())
+		if err != nil {
+			return errors.Wrap(err, "monitor stack delete")
+		}
+
+		d.FinalStatus = StackStatus(*stack.StackStatus)
+
+		if d.FinalStatus != cf.StackStatusDeleteFailed || len(d.RetainOnDelete) == 0 || input.RetainResources != nil {
+			return nil
+		}
+
+		fmt.Fprintf(w, "\nRetrying, retaining %s.\n", strings.Join(d.RetainOnDelete, ", "))
+		input.RetainResources = aws.StringSlice(d.RetainOnDelete)
+	}
+}
+
+// deleteFailedCreate deletes a stack that failed creation, which can't be
+// updated, if DeleteFailedCreates is set or the user agrees. Otherwise, it
+// explains how to go on.
+func (d *Deployer) deleteFailedCreate(c context.Context, w io.Writer) error {
+	remove := d.DeleteFailedCreates
+	if remove {
+		fmt.Fprintf(w, "\nStack failed creation. Deleting it.\n")
+	} else if !d.NoDeleteOnRollback {
+		err := d.confirm(w, d.Yes, "\nStack failed creation, and must be deleted. Continue?")
+		if err == ErrNoConfirmation {
+			pprint.Warningf(w, "not deleting stack %s: %v", d.StackName, err)
+		}
+
+		remove = err == nil
+	}
+
+	if remove {
+		return d.deleteStack(c, w)
+	}
+
+	fmt.Fprintf(w, "\nStack %s is left in %s, and can't be updated. Delete it before deploying again, "+
+		"e.g. with 'cftool delete -n %s', or deploy with --replace-on-failure.\n",
+		d.StackName, cf.StackStatusRollbackComplete, d.StackName)
+	return nil
+}
+
+// replaceFailedStack deletes a stack that failed creation, so that it can be
+// created again.
+func (d *Deployer) replaceFailedStack(c context.Context, w io.Writer) error {
+	d.Log.Log(LevelWarning, d.StackName, "replace", map[string]interface{}{"stackId": d.StackId})
+
+	if err := d.deleteStack(c, w); err != nil {
+		return err
+	} else if d.FinalStatus != cf.StackStatusDeleteComplete {
+		return errors.Errorf("stack %s is %s", d.StackName, d.FinalStatus)
+	}
+
+	// The deleted stack can still be described by its id, so forget it.
+	d.StackId = ""
+	return nil
+}
+
+// cancelUpdate asks CloudFormation to cancel the stack update in progress,
+// which rolls it back. Failure to do so is only a warning, since the update
+// may well have finished in the meantime.
+func (d *Deployer) cancelUpdate(w io.Writer) {
+	fmt.Fprintf(w, "\nCancelling update of stack %s.\n", d.StackName)
+
+	_, err := d.client.CancelUpdateStack(&cf.CancelUpdateStackInput{
+		StackName: aws.String(d.StackName),
+	})
+
+	if err != nil {
+		pprint.Warningf(w, "cancel update: %v", err)
+		return
+	}
+
+	d.Log.Log(LevelWarning, d.StackName, "cancel-update", nil)
+}
+
+// catchInterrupts delivers Ctrl-C presses to d.interrupts instead of letting
+// them terminate cftool, until the returned function is called. It does
+// nothing unless HandleInterrupts is set.
+func (d *Deployer) catchInterrupts() func() {
+	if !d.HandleInterrupts {
+		return func() {}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	d.interrupts = ch
+
+	return func() {
+		signal.Stop(ch)
+		d.interrupts = nil
+	}
+}
+
+// interruptible returns a context that is also cancelled by Ctrl-C, while it
+// is caught.
+func (d *Deployer) interruptible(c context.Context) (context.Context, context.CancelFunc) {
+	ic, cancel := context.WithCancel(c)
+	interrupts := d.interrupts
+
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ic.Done():
+		}
+	}()
+
+	return ic, cancel
+}
+
+// sleepInterruptibly is like sleep, but returns ErrInterrupted early if Ctrl-C
+// is pressed.
+func (d *Deployer) sleepInterruptibly(c context.Context, duration time.Duration) error {
+	t := time.NewTimer(duration)
+	defer t.Stop()
+
+	select {
+	case <-c.Done():
+		return c.Err()
+	case <-d.interrupts:
+		return ErrInterrupted
+	case <-t.C:
+		return nil
+	}
+}
+
+// onInterrupt explains that a stack operation carries on in AWS when cftool
+// is interrupted. An update can be cancelled with a second Ctrl-C, in which
+// case monitoring continues until it has rolled back.
+func (d *Deployer) onInterrupt(c context.Context, w io.Writer, status StackStatus, cancelled *bool) error {
+	if *cancelled {
+		return ErrInterrupted
+	}
+
+	d.FinalStatus = status
+	fmt.Fprintf(w, "\nInterrupted. Stack %s is still %s in AWS, and carries on without cftool.\n", d.StackName, status)
+	if status != cf.StackStatusUpdateInProgress {
+		fmt.Fprintf(w, "Follow it with: cftool wait -n %s\n", d.StackName)
+		return ErrInterrupted
+	}
+
+	fmt.Fprintf(w, "Press Ctrl-C again within %s to cancel the update, which rolls it back.\n", interruptGrace)
+
+	t := time.NewTimer(interruptGrace)
+	defer t.Stop()
+
+	select {
+	case <-c.Done():
+		return c.Err()
+	case <-d.interrupts:
+		*cancelled = true
+		d.cancelUpdate(w)
+		return nil
+	case <-t.C:
+		fmt.Fprintf(w, "Not cancelling. Follow the update with: cftool wait -n %s\n", d.StackName)
+		return ErrInterrupted
+	}
+}
+
+// discardInterruptedChangeSet deletes the change set that was being created
+// when Ctrl-C was pressed, if it got as far as CloudFormation.
+func (d *Deployer) discardInterruptedChangeSet(w io.Writer, created bool) {
+	chset, err := d.describeChangeSet()
+	if err != nil {
+		fmt.Fprintf(w, "\nInterrupted.\n")
+		return
+	}
+
+	fmt.Fprintf(w, "\nInterrupted. Deleting change set %s.\n", d.ChangeSetName)
+	if err := d.discardChangeSet(chset, created); err != nil {
+		pprint.Warningf(w, "%v", err)
+	}
+}
+
+// sleep waits for the duration, or returns early with the context's error
+// once it is done.
+func sleep(c context.Context, duration time.Duration) error {
+	t := time.NewTimer(duration)
+	defer t.Stop()
+
+	select {
+	case <-c.Done():
+		return c.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// recordFailure remembers the first resource that failed for its own reason,
+// as opposed to failures caused by a rollback or cancellation.
+func (d *Deployer) recordFailure(event *cf.StackEvent) {
+	status := aws.StringValue(event.ResourceStatus)
+
+	if d.rootFailure != nil ||
+		!StackStatus(status).IsFailed() ||
+		strings.Contains(status, "ROLLBACK") ||
+		aws.StringValue(event.ResourceStatusReason) == "" {
+
+		return
+	}
+
+	d.rootFailure = event
+}
+
+// stackFailed highlights the root failure, if any, so that it is the last
+// thing shown, and returns an error describing it.
+func (d *Deployer) stackFailed(w io.Writer, status StackStatus) error {
+	cause := d.rootFailure
+	if cause == nil {
+		return errors.Wrapf(ErrStackFailed, "stack %s: %s", d.StackName, status)
+	}
+
+	fmt.Fprintf(w, "\n")
+	pprint.StackFailure(w, cause)
+
+	return errors.Wrapf(
+		ErrStackFailed,
+		"stack %s: %s: %s %s: %s",
+		d.StackName,
+		status,
+		aws.StringValue(cause.ResourceType),
+		aws.StringValue(cause.LogicalResourceId),
+		aws.StringValue(cause.ResourceStatusReason))
+}
+
+func (d *Deployer) logStackEvent(event *cf.StackEvent) {
+	level := LevelInfo
+	if StackStatus(aws.StringValue(event.ResourceStatus)).IsFailed() {
+		level = LevelError
+	}
+
+	fields := map[string]interface{}{
+		"eventId":            aws.StringValue(event.EventId),
+		"timestamp":          aws.TimeValue(event.Timestamp),
+		"logicalResourceId":  aws.StringValue(event.LogicalResourceId),
+		"physicalResourceId": aws.StringValue(event.PhysicalResourceId),
+		"resourceType":       aws.StringValue(event.ResourceType),
+		"resourceStatus":     aws.StringValue(event.ResourceStatus),
+		"reason":             aws.StringValue(event.ResourceStatusReason),
+	}
+
+	d.Log.Log(level, d.StackName, "stack-event", fields)
+	d.EventLog.Log(level, d.StackName, "stack-event", fields)
+}
+
+// summarizeChangeSet counts the resource changes in a change set by action.
+// Replacements are counted separately from other modifications.
+func summarizeChangeSet(chset *cf.DescribeChangeSetOutput) map[string]interface{} {
+	counts := map[string]int{}
+	for _, change := range chset.Changes {
+		if change.ResourceChange == nil {
+			continue
+		}
+
+		action := aws.StringValue(change.ResourceChange.Action)
+		if aws.StringValue(change.ResourceChange.Replacement) == cf.ReplacementTrue {
+			action = "Replace"
+		}
+
+		counts[action] += 1
+	}
+
+	return map[string]interface{}{
+		"changeSetName": aws.StringValue(chset.ChangeSetName),
+		"changeSetId":   aws.StringValue(chset.ChangeSetId),
+		"stackId":       aws.StringValue(chset.StackId),
+		"changes":       len(chset.Changes),
+		"add":           counts[cf.ChangeActionAdd],
+		"modify":        counts[cf.ChangeActionModify],
+		"remove":        counts[cf.ChangeActionRemove],
+		"replace":       counts["Replace"],
+	}
+}
+
+func (d *Deployer) Whoami(w io.Writer, api stsiface.STSAPI, region string) (*sts.GetCallerIdentityOutput, error) {
+	// todo: replace this with something better
+
+	id, err := api.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	pprint.Whoami(w, &region, id)
+	return id, nil
+}
+
+// TemplateDiff prints the diff of the deployed and new template. It only
+// writes to w, and never prompts.
+func (d *Deployer) TemplateDiff(w io.Writer) error {
+	_, err := d.templateDiff(w)
+	return err
+}
+
+// diffOnly shows the template diff in place of deploying, and records whether
+// there is a change. A stack that doesn't exist has no template to compare.
+func (d *Deployer) diffOnly(w io.Writer, exists bool) error {
+	changed := true
+
+	if exists {
+		var err error
+		if changed, err = d.templateDiff(w); err != nil {
+			return errors.Wrap(err, "template diff")
+		}
+	} else {
+		fmt.Fprintf(w, "\nStack %s does not exist, so all of its template is new.\n", d.StackName)
+	}
+
+	d.HasChanges = changed
+	d.FinalStatus = "NO_CHANGE"
+	if changed {
+		d.FinalStatus = "CHANGES_PENDING"
+	}
+
+	return nil
+}
+
+// templateDiff prints the diff of the deployed and new template, and reports
+// whether they differ, as far as the options make out.
+func (d *Deployer) templateDiff(w io.Writer) (bool, error) {
+	fmt.Fprintf(w, "\n")
+
+	exists, err := d.stackExists()
+
+	switch {
+	case err != nil:
+		return false, errors.Wrapf(err, "describe stack %s", d.StackName)
+
+	case !exists:
+		return false, errors.Errorf("stack %s does not exist.", d.StackName)
+	}
+
+	if len(d.TemplateBody) == 0 {
+		return false, errors.Errorf("no template body to compare stack %s to", d.StackName)
+	}
+
+	out, err := d.client.GetTemplate(&cf.GetTemplateInput{
+		StackName: aws.String(d.StackName),
+	})
+
+	if err != nil {
+		return false, errors.Wrap(err, "get template")
+	}
+
+	before := []byte(*out.TemplateBody)
+	after := []byte(strings.ReplaceAll(string(d.TemplateBody), "\r", ""))
+
+	if d.SemanticDiff {
+		if before, err = CanonicalTemplate(before); err != nil {
+			return false, errors.Wrap(err, "deployed template")
+		}
+
+		if after, err = CanonicalTemplate(after); err != nil {
+			return false, errors.Wrap(err, "local template")
+		}
+
+		if bytes.Equal(before, after) {
+			pprint.ColDiffText.Fprint(w, "No logical change.\n")
+			return false, nil
+		}
+	}
+
+	a := difflib.SplitLines(string(before))
+	b := difflib.SplitLines(string(after))
+
+	if d.IgnoreWhitespace {
+		a, b = collapseWhitespace(a), collapseWhitespace(b)
+
+		if equalLines(a, b) {
+			pprint.ColDiffText.Fprint(w, "No meaningful change (whitespace only).\n")
+			return false, nil
+		}
+	}
+
+	if d.DiffMode == DiffModeSideBySide && d.Interactive {
+		if width := pprint.TerminalWidth(); width >= pprint.MinSideBySideWidth {
+			pprint.SideBySideDiff(w, a, b, width)
+			return !equalLines(a, b), nil
+		}
+	}
+
+	return !equalLines(a, b), errors.Wrap(pprint.UnifiedDiff(w, a, b), "unified diff")
+}
+
+// collapseWhitespace strips trailing whitespace from each line, collapses runs
+// of whitespace within it, and drops blank lines, so that respacing a template
+// does not show up in its diff. Leading indentation is kept, since in YAML it
+// decides what a key belongs to.
+func collapseWhitespace(lines []string) []string {
+	var result []string
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		result = append(result, indent+strings.Join(fields, " ")+"\n")
+	}
+
+	return result
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
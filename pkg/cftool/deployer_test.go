@@ -0,0 +1,655 @@
+package cftool
+
+import (
+	"bytes"
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	events []*cf.StackEvent
+
+	// statuses are returned by successive calls to DescribeStacks.
+	statuses []string
+	deletes  []*cf.DeleteStackInput
+	template string
+
+	// changeSet is returned by DescribeChangeSetWithContext, or an error if
+	// it is nil.
+	changeSet *cf.DescribeChangeSetOutput
+	cancels   int
+
+	// driftStatuses are returned by successive drift detection status
+	// checks, and drifts list the drifted resources.
+	driftStatuses []string
+	drifts        []*cf.StackResourceDrift
+
+	// resources are listed by stack name, and continues records the calls to
+	// ContinueUpdateRollback.
+	resources map[string][]*cf.StackResourceSummary
+	continues []*cf.ContinueUpdateRollbackInput
+}
+
+func (f *fakeCloudFormation) DetectStackDrift(input *cf.DetectStackDriftInput) (*cf.DetectStackDriftOutput, error) {
+	return &cf.DetectStackDriftOutput{StackDriftDetectionId: aws.String("detection")}, nil
+}
+
+func (f *fakeCloudFormation) DescribeStackDriftDetectionStatus(
+	input *cf.DescribeStackDriftDetectionStatusInput,
+) (*cf.DescribeStackDriftDetectionStatusOutput, error) {
+	status := f.driftStatuses[0]
+	f.driftStatuses = f.driftStatuses[1:]
+
+	out := &cf.DescribeStackDriftDetectionStatusOutput{
+		DetectionStatus: aws.String(cf.StackDriftDetectionStatusDetectionComplete),
+	}
+
+	if status == cf.StackDriftDetectionStatusDetectionInProgress {
+		out.DetectionStatus = aws.String(status)
+	} else {
+		out.StackDriftStatus = aws.String(status)
+	}
+
+	return out, nil
+}
+
+func (f *fakeCloudFormation) DescribeStackResourceDriftsPages(
+	input *cf.DescribeStackResourceDriftsInput,
+	fn func(*cf.DescribeStackResourceDriftsOutput, bool) bool,
+) error {
+	fn(&cf.DescribeStackResourceDriftsOutput{StackResourceDrifts: f.drifts}, true)
+	return nil
+}
+
+func (f *fakeCloudFormation) CancelUpdateStack(input *cf.CancelUpdateStackInput) (*cf.CancelUpdateStackOutput, error) {
+	f.cancels++
+	return &cf.CancelUpdateStackOutput{}, nil
+}
+
+func (f *fakeCloudFormation) DescribeChangeSetWithContext(
+	c aws.Context,
+	input *cf.DescribeChangeSetInput,
+	opts ...request.Option,
+) (*cf.DescribeChangeSetOutput, error) {
+	if f.changeSet == nil {
+		return nil, errors.New("ChangeSetNotFound")
+	}
+
+	return f.changeSet, nil
+}
+
+func (f *fakeCloudFormation) GetTemplate(input *cf.GetTemplateInput) (*cf.GetTemplateOutput, error) {
+	return &cf.GetTemplateOutput{TemplateBody: aws.String(f.template)}, nil
+}
+
+func (f *fakeCloudFormation) DescribeStacks(input *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+	status := f.statuses[0]
+	f.statuses = f.statuses[1:]
+
+	return &cf.DescribeStacksOutput{
+		Stacks: []*cf.Stack{{StackId: input.StackName, StackStatus: aws.String(status)}},
+	}, nil
+}
+
+func (f *fakeCloudFormation) DeleteStackWithContext(
+	c aws.Context,
+	input *cf.DeleteStackInput,
+	opts ...request.Option,
+) (*cf.DeleteStackOutput, error) {
+	copied := *input
+	f.deletes = append(f.deletes, &copied)
+	return &cf.DeleteStackOutput{}, nil
+}
+
+func (f *fakeCloudFormation) ListStackResourcesPages(
+	input *cf.ListStackResourcesInput,
+	fn func(*cf.ListStackResourcesOutput, bool) bool,
+) error {
+	fn(&cf.ListStackResourcesOutput{StackResourceSummaries: f.resources[aws.StringValue(input.StackName)]}, true)
+	return nil
+}
+
+func (f *fakeCloudFormation) ContinueUpdateRollbackWithContext(
+	c aws.Context,
+	input *cf.ContinueUpdateRollbackInput,
+	opts ...request.Option,
+) (*cf.ContinueUpdateRollbackOutput, error) {
+	f.continues = append(f.continues, input)
+	return &cf.ContinueUpdateRollbackOutput{}, nil
+}
+
+func (f *fakeCloudFormation) DescribeStackEventsPages(
+	input *cf.DescribeStackEventsInput,
+	fn func(*cf.DescribeStackEventsOutput, bool) bool,
+) error {
+	// Serve one event per page to exercise paging.
+	for i, event := range f.events {
+		page := &cf.DescribeStackEventsOutput{StackEvents: []*cf.StackEvent{event}}
+		if !fn(page, i == len(f.events)-1) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func stackEvent(id string, t time.Time) *cf.StackEvent {
+	return &cf.StackEvent{EventId: aws.String(id), Timestamp: aws.Time(t)}
+}
+
+func eventIds(events []*cf.StackEvent) []string {
+	var ids []string
+	for _, event := range events {
+		ids = append(ids, *event.EventId)
+	}
+
+	return ids
+}
+
+func TestDeployer_getStackEvents(t *testing.T) {
+	start := time.Date(2019, 8, 1, 12, 0, 0, 0, time.UTC)
+	api := &fakeCloudFormation{}
+	d := NewDeployer(api, &Deployment{StackName: "mystack"})
+
+	// Newest first, as returned by CloudFormation.
+	api.events = []*cf.StackEvent{
+		stackEvent("b", start),
+		stackEvent("a", start),
+		stackEvent("old", start.Add(-time.Second)),
+	}
+
+	events, err := d.getStackEvents(context.Background(), start, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, eventIds(events))
+
+	// Same timestamp as the previous batch, but not seen before.
+	api.events = append([]*cf.StackEvent{stackEvent("c", start)}, api.events...)
+
+	events, err = d.getStackEvents(context.Background(), start, "b")
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, eventIds(events))
+
+	events, err = d.getStackEvents(context.Background(), start, "c")
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func TestDeployer_traceCalls(t *testing.T) {
+	start := time.Date(2019, 8, 1, 12, 0, 0, 0, time.UTC)
+	api := &fakeCloudFormation{
+		events:    []*cf.StackEvent{stackEvent("b", start), stackEvent("a", start)},
+		statuses:  []string{cf.StackStatusUpdateComplete},
+		changeSet: &cf.DescribeChangeSetOutput{Status: aws.String(cf.ChangeSetStatusCreateComplete)},
+	}
+
+	d := NewDeployer(api, &Deployment{StackName: "mystack"})
+	d.Trace = &Trace{}
+	d.traceCalls()
+	d.traceCalls()
+
+	_, err := d.getStackEvents(context.Background(), start, "")
+	require.NoError(t, err)
+	_, err = d.describeStack()
+	require.NoError(t, err)
+	_, err = d.describeChangeSet()
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]int{"DescribeStackEvents": 2, "DescribeStacks": 1, "DescribeChangeSet": 1}, d.Trace.Calls)
+
+	// Without a Trace, nothing is recorded.
+	d = NewDeployer(api, &Deployment{StackName: "mystack"})
+	d.traceCalls()
+	require.Equal(t, api, d.client)
+	d.Trace.addMonitor(time.Second)
+}
+
+func TestDeployer_recordFailure(t *testing.T) {
+	d := NewDeployer(&fakeCloudFormation{}, &Deployment{StackName: "mystack"})
+
+	event := func(id string, status string, reason string) *cf.StackEvent {
+		return &cf.StackEvent{
+			EventId:              aws.String(id),
+			ResourceStatus:       aws.String(status),
+			ResourceStatusReason: aws.String(reason),
+		}
+	}
+
+	d.recordFailure(event("a", cf.ResourceStatusCreateInProgress, ""))
+	d.recordFailure(event("b", cf.ResourceStatusCreateFailed, ""))
+	d.recordFailure(event("c", cf.ResourceStatusCreateFailed, "Bucket already exists"))
+	d.recordFailure(event("d", cf.ResourceStatusUpdateFailed, "Resource update cancelled"))
+	require.Equal(t, "c", *d.rootFailure.EventId)
+
+	d.rootFailure = nil
+	d.recordFailure(event("e", "UPDATE_ROLLBACK_FAILED", "Rollback failed"))
+	require.Nil(t, d.rootFailure)
+}
+
+func TestCollapseWhitespace(t *testing.T) {
+	a := collapseWhitespace([]string{"Resources:\n", "  Bucket:\n", "    Type:  AWS::S3::Bucket\n"})
+	b := collapseWhitespace([]string{"Resources:  \n", "\n", "  Bucket:\n", "    Type: \tAWS::S3::Bucket  \n"})
+	require.Equal(t, []string{"Resources:\n", "  Bucket:\n", "    Type: AWS::S3::Bucket\n"}, a)
+	require.True(t, equalLines(a, b))
+	require.False(t, equalLines(a, a[1:]))
+}
+
+func TestSleep(t *testing.T) {
+	require.NoError(t, sleep(context.Background(), time.Millisecond))
+
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, sleep(c, time.Hour))
+}
+
+func TestDeployer_deleteStack(t *testing.T) {
+	api := &fakeCloudFormation{statuses: []string{cf.StackStatusDeleteFailed, cf.StackStatusDeleteComplete}}
+	d := NewDeployer(api, &Deployment{StackName: "mystack"})
+	d.StackId = "arn:mystack"
+	d.RetainOnDelete = []string{"Bucket"}
+
+	require.NoError(t, d.deleteStack(context.Background(), ioutil.Discard))
+	require.Equal(t, StackStatus(cf.StackStatusDeleteComplete), d.FinalStatus)
+	require.Len(t, api.deletes, 2)
+	require.Equal(t, "arn:mystack", *api.deletes[0].StackName)
+	require.Nil(t, api.deletes[0].RetainResources)
+	require.Equal(t, []string{"Bucket"}, aws.StringValueSlice(api.deletes[1].RetainResources))
+
+	// Without resources to retain, a failed deletion is not retried.
+	api = &fakeCloudFormation{statuses: []string{cf.StackStatusDeleteFailed}}
+	d = NewDeployer(api, &Deployment{StackName: "mystack"})
+
+	require.NoError(t, d.deleteStack(context.Background(), ioutil.Discard))
+	require.Equal(t, StackStatus(cf.StackStatusDeleteFailed), d.FinalStatus)
+	require.Len(t, api.deletes, 1)
+}
+
+func TestDeployer_replaceFailedStack(t *testing.T) {
+	api := &fakeCloudFormation{statuses: []string{cf.StackStatusDeleteComplete}}
+	d := NewDeployer(api, &Deployment{StackName: "mystack"})
+	d.StackId = "arn:mystack"
+
+	require.NoError(t, d.replaceFailedStack(context.Background(), ioutil.Discard))
+	require.Equal(t, "arn:mystack", *api.deletes[0].StackName)
+	require.Empty(t, d.StackId)
+
+	api = &fakeCloudFormation{statuses: []string{cf.StackStatusDeleteFailed}}
+	d = NewDeployer(api, &Deployment{StackName: "mystack"})
+	require.EqualError(t, d.replaceFailedStack(context.Background(), ioutil.Discard), "stack mystack is DELETE_FAILED")
+
+	// A dry run doesn't delete the stack to replace it.
+	api = &fakeCloudFormation{statuses: []string{cf.StackStatusRollbackComplete}}
+	d = NewDeployer(api, &Deployment{StackName: "mystack"})
+	d.ReplaceOnFailure = true
+	d.DryRun = true
+	require.EqualError(t, d.Deploy(context.Background(), ioutil.Discard), "stack mystack failed creation before, and is only replaced when deploying")
+	require.Empty(t, api.deletes)
+}
+
+func TestDeployer_deleteFailedCreate(t *testing.T) {
+	api := &fakeCloudFormation{}
+	d := NewDeployer(api, &Deployment{StackName: "mystack"})
+	d.NoDeleteOnRollback = true
+	d.Yes = true
+
+	w := &strings.Builder{}
+	require.NoError(t, d.deleteFailedCreate(context.Background(), w))
+	require.Empty(t, api.deletes)
+	require.Contains(t, w.String(), "Stack mystack is left in ROLLBACK_COMPLETE, and can't be updated.")
+
+	// Without a terminal, the stack is only deleted with --yes.
+	d = NewDeployer(api, &Deployment{StackName: "mystack"})
+	d.Unattended = true
+	w.Reset()
+	require.NoError(t, d.deleteFailedCreate(context.Background(), w))
+	require.Empty(t, api.deletes)
+	require.Contains(t, w.String(), "Delete it before deploying again")
+
+	api.statuses = []string{cf.StackStatusDeleteComplete}
+	d.DeleteFailedCreates = true
+	require.NoError(t, d.deleteFailedCreate(context.Background(), ioutil.Discard))
+	require.Len(t, api.deletes, 1)
+}
+
+func TestDeployer_heartbeat(t *testing.T) {
+	log := &bytes.Buffer{}
+	d := NewDeployer(&fakeCloudFormation{}, &Deployment{StackName: "mystack"})
+	d.Log = NewJSONLogger(log)
+
+	w := &strings.Builder{}
+	progress := pprint.NewProgress(w, false)
+	progress.Begin(cf.StackStatusUpdateInProgress, false)
+
+	d.heartbeat(context.Background(), progress, cf.StackStatusUpdateInProgress, 90*time.Second)
+	require.Equal(t, "UPDATE_IN_PROGRESS...\nStill UPDATE_IN_PROGRESS after 0s, 1m30s in total.\nUPDATE_IN_PROGRESS...", w.String())
+	require.Contains(t, log.String(), `"event":"heartbeat"`)
+	require.Contains(t, log.String(), `"elapsed":"1m30s"`)
+
+	c, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	w.Reset()
+	d.heartbeat(c, progress, cf.StackStatusUpdateInProgress, time.Minute)
+	require.Contains(t, w.String(), "1m0s in total, timeout in 1h0m0s.")
+}
+
+func TestDeployer_logStackEvent(t *testing.T) {
+	events := &bytes.Buffer{}
+	d := NewDeployer(&fakeCloudFormation{}, &Deployment{StackName: "mystack"})
+	d.EventLog = NewJSONLogger(events)
+
+	d.logStackEvent(&cf.StackEvent{
+		LogicalResourceId: aws.String("Queue"),
+		ResourceStatus:    aws.String(cf.ResourceStatusCreateComplete),
+		Timestamp:         aws.Time(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)),
+	})
+
+	require.Contains(t, events.String(), `"event":"stack-event"`)
+	require.Contains(t, events.String(), `"logicalResourceId":"Queue"`)
+	require.Contains(t, events.String(), `"resourceStatus":"CREATE_COMPLETE"`)
+	require.Contains(t, events.String(), `"timestamp":"2020-01-02T03:04:05Z"`)
+}
+
+func TestDeployer_Wait(t *testing.T) {
+	api := &fakeCloudFormation{statuses: []string{cf.StackStatusUpdateComplete, cf.StackStatusUpdateComplete}}
+	d := NewDeployer(api, &Deployment{StackName: "mystack"})
+	require.NoError(t, d.Wait(context.Background(), ioutil.Discard, time.Time{}))
+	require.Equal(t, StackStatus(cf.StackStatusUpdateComplete), d.FinalStatus)
+
+	api.statuses = []string{cf.StackStatusUpdateRollbackComplete, cf.StackStatusUpdateRollbackComplete}
+	err := d.Wait(context.Background(), ioutil.Discard, time.Time{})
+	require.Equal(t, ErrStackFailed, errors.Cause(err))
+}
+
+func TestDeployer_waitIfBusy(t *testing.T) {
+	api := &fakeCloudFormation{statuses: []string{cf.StackStatusUpdateInProgress}}
+	d := NewDeployer(api, &Deployment{StackName: "mystack"})
+	err := d.Deploy(context.Background(), ioutil.Discard)
+	require.Equal(t, ErrStackBusy, errors.Cause(err))
+	require.Contains(t, err.Error(), "stack mystack is UPDATE_IN_PROGRESS")
+
+	require.True(t, StackStatus(cf.StackStatusUpdateCompleteCleanupInProgress).IsBusy())
+	require.False(t, StackStatus(cf.StackStatusReviewInProgress).IsBusy())
+
+	// Failures of the operation waited for are not those of the deployment.
+	api = &fakeCloudFormation{statuses: []string{cf.StackStatusUpdateRollbackComplete}}
+	d = NewDeployer(api, &Deployment{StackName: "mystack"})
+	d.StackId = "arn:mystack"
+	d.rootFailure = &cf.StackEvent{}
+	stack, err := d.waitUntilIdle(context.Background(), ioutil.Discard, &cf.Stack{StackStatus: aws.String(cf.StackStatusUpdateRollbackInProgress)})
+	require.NoError(t, err)
+	require.Equal(t, cf.StackStatusUpdateRollbackComplete, *stack.StackStatus)
+	require.Nil(t, d.rootFailure)
+
+	// A stack that was deleted meanwhile is created again.
+	api.statuses = []string{cf.StackStatusDeleteComplete}
+	stack, err = d.waitUntilIdle(context.Background(), ioutil.Discard, &cf.Stack{StackStatus: aws.String(cf.StackStatusDeleteInProgress)})
+	require.NoError(t, err)
+	require.Nil(t, stack)
+	require.Empty(t, d.StackId)
+}
+
+func TestStackTags(t *testing.T) {
+	require.Nil(t, stackTags(&cf.Stack{}, nil, false))
+
+	stack := &cf.Stack{Tags: []*cf.Tag{
+		{Key: aws.String("Team"), Value: aws.String("platform")},
+		{Key: aws.String(ApprovalTag), Value: aws.String("ticket-1")},
+	}}
+
+	tags := stackTags(stack, map[string]string{ApprovalTag: "ticket-2: rotate keys", "CostCenter": "42"}, false)
+	require.Equal(t, []*cf.Tag{
+		{Key: aws.String("Team"), Value: aws.String("platform")},
+		{Key: aws.String(ApprovalTag), Value: aws.String("ticket-2: rotate keys")},
+		{Key: aws.String("CostCenter"), Value: aws.String("42")},
+	}, tags)
+	require.Equal(t, "ticket-1", *stack.Tags[1].Value)
+
+	tags = stackTags(nil, map[string]string{ApprovalTag: "ticket-3"}, false)
+	require.Equal(t, []*cf.Tag{{Key: aws.String(ApprovalTag), Value: aws.String("ticket-3")}}, tags)
+
+	// A complete set drops the tags it lacks, except for those cftool
+	// maintains itself.
+	tags = stackTags(stack, map[string]string{"CostCenter": "42"}, true)
+	require.Equal(t, []*cf.Tag{
+		{Key: aws.String(ApprovalTag), Value: aws.String("ticket-1")},
+		{Key: aws.String("CostCenter"), Value: aws.String("42")},
+	}, tags)
+
+	require.Equal(t, []*cf.Tag{}, stackTags(&cf.Stack{}, nil, true))
+}
+
+func TestDeployer_checkTemplateHash(t *testing.T) {
+	api := &fakeCloudFormation{}
+	d := NewDeployer(api, &Deployment{StackName: "mystack", TemplateBody: []byte("v2")})
+	stack := &cf.Stack{Tags: []*cf.Tag{{Key: aws.String(TemplateHashTag), Value: aws.String(templateHash("v1"))}}}
+
+	check := func(deployed string) string {
+		w := &strings.Builder{}
+		api.template = deployed
+		require.NoError(t, d.checkTemplateHash(w, stack))
+		return w.String()
+	}
+
+	require.Empty(t, check("v1"))
+	require.Empty(t, check("v2"))
+	require.Contains(t, check("changed in the console"), "changed outside of cftool")
+
+	// Stacks that were never tracked are not checked.
+	require.NoError(t, d.checkTemplateHash(nil, &cf.Stack{}))
+}
+
+func TestDeployer_changeSetAfterError(t *testing.T) {
+	api := &fakeCloudFormation{}
+	d := NewDeployer(api, &Deployment{StackName: "mystack"})
+
+	chset, err := d.changeSetAfterError(errors.New("throttled"))
+	require.Nil(t, chset)
+	require.EqualError(t, err, "throttled")
+
+	api.changeSet = &cf.DescribeChangeSetOutput{
+		Status:       aws.String(cf.ChangeSetStatusFailed),
+		StatusReason: aws.String("Template error: Unresolved resource dependencies [Queue]"),
+	}
+
+	chset, err = d.changeSetAfterError(errors.New("throttled"))
+	require.Equal(t, api.changeSet, chset)
+	require.EqualError(t, err, "throttled (change set FAILED: Template error: Unresolved resource dependencies [Queue])")
+}
+
+func TestDeployer_checkChangeSetWait(t *testing.T) {
+	d := NewDeployer(&fakeCloudFormation{}, &Deployment{StackName: "mystack"})
+
+	require.NoError(t, d.checkChangeSetWait(cf.ChangeSetStatusCreatePending, time.Minute))
+	require.EqualError(t, d.checkChangeSetWait(cf.ChangeSetStatusCreatePending, 2*time.Minute),
+		"change set still CREATE_PENDING after 2m0s: CloudFormation has not started to create it, "+
+			"which points to a problem on its side; try again later")
+	require.NoError(t, d.checkChangeSetWait(cf.ChangeSetStatusCreateInProgress, 10*time.Minute))
+	require.EqualError(t, d.checkChangeSetWait(cf.ChangeSetStatusCreateInProgress, 15*time.Minute),
+		"change set still CREATE_IN_PROGRESS after 15m0s")
+
+	d.ChangeSetMaxWait = time.Minute
+	require.EqualError(t, d.checkChangeSetWait(cf.ChangeSetStatusCreatePending, time.Minute),
+		"change set still CREATE_PENDING after 1m0s")
+
+	d.ChangeSetMaxPending = 30 * time.Second
+	require.Error(t, d.checkChangeSetWait(cf.ChangeSetStatusCreatePending, 30*time.Second))
+	require.NoError(t, d.checkChangeSetWait(cf.ChangeSetStatusCreateInProgress, 30*time.Second))
+}
+
+func TestDeployer_diffOnly_IgnoreWhitespace(t *testing.T) {
+	api := &fakeCloudFormation{
+		statuses: []string{cf.StackStatusUpdateComplete, cf.StackStatusUpdateComplete},
+		template: "Resources:\n  Topic:\n    Type: AWS::SNS::Topic\n    Properties:\n      TopicName: alerts\n",
+	}
+
+	d := NewDeployer(api, &Deployment{
+		StackName:    "mystack",
+		TemplateBody: []byte("Resources:  \n\n  Topic:\n    Type:   AWS::SNS::Topic\n    Properties:\n      TopicName: alerts\n"),
+	})
+	d.IgnoreWhitespace = true
+
+	w := &bytes.Buffer{}
+	require.NoError(t, d.diffOnly(w, true))
+	require.False(t, d.HasChanges)
+	require.Contains(t, w.String(), "No meaningful change (whitespace only).")
+
+	// Only the indentation changes, but Properties no longer belongs to Topic.
+	w.Reset()
+	d.TemplateBody = []byte("Resources:\n  Topic:\n    Type: AWS::SNS::Topic\n  Properties:\n    TopicName: alerts\n")
+	require.NoError(t, d.diffOnly(w, true))
+	require.True(t, d.HasChanges)
+	require.Equal(t, StackStatus("CHANGES_PENDING"), d.FinalStatus)
+	require.NotContains(t, w.String(), "whitespace only")
+}
+
+func TestDeployer_diffOnly(t *testing.T) {
+	api := &fakeCloudFormation{
+		statuses: []string{cf.StackStatusUpdateComplete, cf.StackStatusUpdateComplete},
+		template: "Resources: {}\n",
+	}
+
+	d := NewDeployer(api, &Deployment{StackName: "mystack", TemplateBody: []byte("Resources: {}\n")})
+	w := &bytes.Buffer{}
+	require.NoError(t, d.diffOnly(w, true))
+	require.False(t, d.HasChanges)
+	require.Equal(t, StackStatus("NO_CHANGE"), d.FinalStatus)
+
+	d.TemplateBody = []byte("Resources:\n  Topic:\n    Type: AWS::SNS::Topic\n")
+	require.NoError(t, d.diffOnly(w, true))
+	require.True(t, d.HasChanges)
+	require.Equal(t, StackStatus("CHANGES_PENDING"), d.FinalStatus)
+	require.Contains(t, w.String(), "+  Topic:")
+
+	w.Reset()
+	d = NewDeployer(api, &Deployment{StackName: "newstack"})
+	require.NoError(t, d.diffOnly(w, false))
+	require.True(t, d.HasChanges)
+	require.Equal(t, "\nStack newstack does not exist, so all of its template is new.\n", w.String())
+}
+
+func TestDeployer_onInterrupt(t *testing.T) {
+	api := &fakeCloudFormation{}
+	d := NewDeployer(api, &Deployment{StackName: "mystack"})
+	interrupts := make(chan os.Signal, 1)
+	d.interrupts = interrupts
+
+	// Creation can't be cancelled, so cftool exits right away.
+	cancelled := false
+	err := d.onInterrupt(context.Background(), ioutil.Discard, cf.StackStatusCreateInProgress, &cancelled)
+	require.Equal(t, ErrInterrupted, err)
+	require.Equal(t, StackStatus(cf.StackStatusCreateInProgress), d.FinalStatus)
+	require.Equal(t, 0, api.cancels)
+
+	// A second Ctrl-C cancels an update, and monitoring continues.
+	interrupts <- os.Interrupt
+	require.NoError(t, d.onInterrupt(context.Background(), ioutil.Discard, cf.StackStatusUpdateInProgress, &cancelled))
+	require.True(t, cancelled)
+	require.Equal(t, 1, api.cancels)
+
+	// Once cancelled, Ctrl-C stops monitoring the rollback.
+	err = d.onInterrupt(context.Background(), ioutil.Discard, cf.StackStatusUpdateRollbackInProgress, &cancelled)
+	require.Equal(t, ErrInterrupted, err)
+	require.Equal(t, 1, api.cancels)
+}
+
+func TestDeployer_interruptible(t *testing.T) {
+	d := NewDeployer(&fakeCloudFormation{}, &Deployment{StackName: "mystack"})
+	interrupts := make(chan os.Signal, 1)
+	d.interrupts = interrupts
+
+	c, cancel := d.interruptible(context.Background())
+	defer cancel()
+
+	interrupts <- os.Interrupt
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not cancelled by interrupt")
+	}
+
+	interrupts <- os.Interrupt
+	require.Equal(t, ErrInterrupted, d.sleepInterruptibly(context.Background(), time.Hour))
+}
+
+func TestDeployer_checkDrift(t *testing.T) {
+	api := &fakeCloudFormation{driftStatuses: []string{cf.StackDriftStatusInSync}}
+	d := NewDeployer(api, &Deployment{StackName: "mystack"})
+	require.NoError(t, d.checkDrift(context.Background(), ioutil.Discard))
+
+	api = &fakeCloudFormation{
+		driftStatuses: []string{cf.StackDriftDetectionStatusDetectionInProgress, cf.StackDriftStatusDrifted},
+		drifts: []*cf.StackResourceDrift{
+			{
+				LogicalResourceId:        aws.String("Queue"),
+				ResourceType:             aws.String("AWS::SQS::Queue"),
+				StackResourceDriftStatus: aws.String(cf.StackResourceDriftStatusModified),
+				PropertyDifferences: []*cf.PropertyDifference{
+					{PropertyPath: aws.String("/VisibilityTimeout"), ExpectedValue: aws.String("30"), ActualValue: aws.String("60")},
+				},
+			},
+		},
+	}
+	d = NewDeployer(api, &Deployment{StackName: "mystack"})
+
+	w := &strings.Builder{}
+	err := d.checkDrift(context.Background(), w)
+	require.Equal(t, ErrDrifted, errors.Cause(err))
+	require.EqualError(t, err, "1 drifted resources in stack mystack: stack has drifted")
+	require.Contains(t, w.String(), "Detecting drift.... DRIFTED\n")
+	require.Contains(t, w.String(), "~ AWS::SQS::Queue Queue\n     Drift: /VisibilityTimeout: 30 -> 60\n")
+}
+
+func TestDeployer_confirmExecute(t *testing.T) {
+	tests := []struct {
+		Confirm   string
+		Protected bool
+		Options   Options
+		Expect    error
+	}{
+		{"", false, Options{}, ErrNoConfirmation},
+		{"", false, Options{Yes: true}, nil},
+		{"", true, Options{Yes: true}, ErrProtected},
+		{ConfirmNever, false, Options{}, nil},
+		{ConfirmNever, true, Options{}, nil},
+		{ConfirmAlways, false, Options{Yes: true}, ErrConfirmationRequired},
+		{ConfirmAlways, false, Options{IUnderstand: true}, nil},
+		{ConfirmProtected, false, Options{Yes: true}, ErrProtected},
+		{ConfirmProtected, false, Options{IUnderstand: true}, nil},
+	}
+
+	for _, test := range tests {
+		d := NewDeployer(&fakeCloudFormation{}, &Deployment{StackName: "mystack", Confirm: test.Confirm, Protected: test.Protected})
+		d.Options = test.Options
+		d.Unattended = true
+		require.Equal(t, test.Expect, d.confirmExecute(ioutil.Discard), "%+v", test)
+	}
+
+	d := NewDeployer(&fakeCloudFormation{}, &Deployment{StackName: "mystack", Confirm: "sometimes"})
+	require.EqualError(t, d.confirmExecute(ioutil.Discard), `unknown confirmation policy "sometimes"`)
+}
+
+func TestSortOutputs(t *testing.T) {
+	outputs := []*cf.Output{
+		{OutputKey: aws.String("Topic"), OutputValue: aws.String("arn:topic")},
+		{OutputKey: aws.String("Bucket"), OutputValue: aws.String("my-bucket"), ExportName: aws.String("live-Bucket")},
+	}
+
+	sortOutputs(outputs)
+	require.Equal(t, "Bucket", *outputs[0].OutputKey)
+	require.Equal(t, []map[string]string{
+		{"key": "Bucket", "value": "my-bucket", "exportName": "live-Bucket"},
+		{"key": "Topic", "value": "arn:topic"},
+	}, outputFields(outputs))
+}
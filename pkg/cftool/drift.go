@@ -0,0 +1,96 @@
+package cftool
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"time"
+)
+
+// ErrDrifted is returned by Deploy with FailOnDrift if resources of the stack
+// were changed outside of CloudFormation.
+var ErrDrifted = errors.New("stack has drifted")
+
+const driftPollInterval = 2 * time.Second
+
+// checkDrift runs drift detection on the stack, and returns ErrDrifted after
+// showing the drifted resources if there are any. Executing a change set
+// would otherwise silently revert changes made outside of CloudFormation, to
+// the resources it updates. Detection that fails, typically for resource types
+// that don't support it, is only a warning.
+func (d *Deployer) checkDrift(c context.Context, w io.Writer) error {
+	fmt.Fprintf(w, "\nDetecting drift...")
+
+	out, err := d.client.DetectStackDrift(&cf.DetectStackDriftInput{StackName: d.stackRef()})
+	if err != nil {
+		fmt.Fprintf(w, "\n")
+		return errors.Wrap(err, "detect stack drift")
+	}
+
+	var status *cf.DescribeStackDriftDetectionStatusOutput
+	for {
+		status, err = d.client.DescribeStackDriftDetectionStatus(&cf.DescribeStackDriftDetectionStatusInput{
+			StackDriftDetectionId: out.StackDriftDetectionId,
+		})
+
+		if err != nil {
+			fmt.Fprintf(w, "\n")
+			return errors.Wrap(err, "describe stack drift detection status")
+		}
+
+		if aws.StringValue(status.DetectionStatus) != cf.StackDriftDetectionStatusDetectionInProgress {
+			break
+		}
+
+		if err := sleep(c, driftPollInterval); err != nil {
+			fmt.Fprintf(w, "\n")
+			return err
+		}
+
+		fmt.Fprintf(w, ".")
+	}
+
+	driftStatus := aws.StringValue(status.StackDriftStatus)
+	fmt.Fprintf(w, " %s\n", driftStatus)
+
+	if aws.StringValue(status.DetectionStatus) == cf.StackDriftDetectionStatusDetectionFailed {
+		pprint.Warningf(w, "drift detection failed: %s", aws.StringValue(status.DetectionStatusReason))
+	}
+
+	if driftStatus != cf.StackDriftStatusDrifted {
+		return nil
+	}
+
+	var drifts []*cf.StackResourceDrift
+	err = d.client.DescribeStackResourceDriftsPages(
+		&cf.DescribeStackResourceDriftsInput{
+			StackName: d.stackRef(),
+			StackResourceDriftStatusFilters: aws.StringSlice([]string{
+				cf.StackResourceDriftStatusModified,
+				cf.StackResourceDriftStatusDeleted,
+			}),
+		},
+		func(page *cf.DescribeStackResourceDriftsOutput, lastPage bool) bool {
+			drifts = append(drifts, page.StackResourceDrifts...)
+			return true
+		})
+
+	if err != nil {
+		return errors.Wrap(err, "describe stack resource drifts")
+	}
+
+	for _, drift := range drifts {
+		fmt.Fprintf(w, "\n")
+		pprint.ResourceDrift(w, drift)
+	}
+
+	d.Log.Log(LevelError, d.StackName, "drifted", map[string]interface{}{
+		"resources": len(drifts),
+	})
+
+	return errors.Wrapf(ErrDrifted, "%d drifted resources in stack %s", len(drifts), d.StackName)
+}
@@ -0,0 +1,63 @@
+package cftool
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// EnvParameters picks the parameter values given by environment variables
+// named PREFIX_NAME out of environ, as returned by os.Environ. NAME matches a
+// parameter declared by the template regardless of case and underscores, so
+// that CFN_IMAGE_TAG sets ImageTag, and variables matching no parameter are
+// ignored. Without a template body, NAME is taken as the parameter name as is.
+func EnvParameters(prefix string, environ []string, templateBody []byte) (map[string]string, error) {
+	prefix = strings.TrimSuffix(prefix, "_") + "_"
+
+	var declared map[string]string
+	if len(templateBody) > 0 {
+		params, err := ParseTemplateParameters(templateBody)
+		if err != nil {
+			return nil, err
+		}
+
+		declared = make(map[string]string, len(params))
+		for name := range params {
+			declared[normalizeEnvName(name)] = name
+		}
+	}
+
+	result := make(map[string]string)
+	sources := make(map[string]string)
+
+	for _, entry := range environ {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], prefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(parts[0], prefix)
+		if declared != nil {
+			var ok bool
+			if name, ok = declared[normalizeEnvName(name)]; !ok {
+				continue
+			}
+		}
+
+		if name == "" {
+			continue
+		}
+
+		if other, ok := sources[name]; ok {
+			return nil, errors.Errorf("both %s and %s set parameter %s", other, parts[0], name)
+		}
+
+		sources[name] = parts[0]
+		result[name] = parts[1]
+	}
+
+	return result, nil
+}
+
+func normalizeEnvName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
@@ -0,0 +1,30 @@
+package cftool
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEnvParameters(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"CFN_IMAGE_TAG=abc123",
+		"CFN_replicas=3",
+		"CFN_UNDECLARED=x",
+		"CFNX_IMAGE_TAG=other",
+		"CFN_Password=a=b",
+	}
+
+	template := []byte("Parameters:\n  ImageTag: {Type: String}\n  Replicas: {Type: Number}\n  Password: {Type: String, NoEcho: true}\n")
+
+	params, err := EnvParameters("CFN", environ, template)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"ImageTag": "abc123", "Replicas": "3", "Password": "a=b"}, params)
+
+	params, err = EnvParameters("CFN_", environ, nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"IMAGE_TAG": "abc123", "replicas": "3", "UNDECLARED": "x", "Password": "a=b"}, params)
+
+	_, err = EnvParameters("CFN", append(environ, "CFN_ImageTag=def456"), template)
+	require.EqualError(t, err, "both CFN_IMAGE_TAG and CFN_ImageTag set parameter ImageTag")
+}
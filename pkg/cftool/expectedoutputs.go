@@ -0,0 +1,83 @@
+package cftool
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"regexp"
+	"sort"
+)
+
+// ErrUnexpectedOutputs is returned when a deployed stack lacks outputs it is
+// expected to have, or their values don't match.
+var ErrUnexpectedOutputs = errors.New("stack outputs are not as expected")
+
+// ParseExpectedOutputs compiles the patterns that the values of the outputs
+// with each key are expected to match. An empty pattern only expects the
+// output to exist.
+func ParseExpectedOutputs(patterns map[string]string) (map[string]*regexp.Regexp, error) {
+	result := make(map[string]*regexp.Regexp)
+
+	for key, pattern := range patterns {
+		if key == "" {
+			return nil, errors.New("expected output without a key")
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "output %s", key)
+		}
+
+		result[key] = re
+	}
+
+	return result, nil
+}
+
+// unexpectedOutputs lists the expected outputs that are missing from outputs,
+// or whose values don't match, by key.
+func (d *Deployment) unexpectedOutputs(outputs map[string]string) []string {
+	keys := make([]string, 0, len(d.ExpectedOutputs))
+	for key := range d.ExpectedOutputs {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		re := d.ExpectedOutputs[key]
+		value, ok := outputs[key]
+
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s: missing", key))
+		case !re.MatchString(value):
+			problems = append(problems, fmt.Sprintf("%s: %q does not match %s", key, value, re))
+		}
+	}
+
+	return problems
+}
+
+// checkOutputs fails a deployment whose stack lacks the ExpectedOutputs, or
+// has values that don't match them, and lists them.
+func (d *Deployer) checkOutputs(w io.Writer) error {
+	problems := d.unexpectedOutputs(d.Outputs)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\n")
+	pprint.ColError.Fprintf(w, "Outputs not as expected:\n")
+	for _, problem := range problems {
+		fmt.Fprintf(w, "  %s\n", problem)
+	}
+
+	d.Log.Log(LevelError, d.StackName, "unexpected-outputs", map[string]interface{}{
+		"problems": problems,
+	})
+
+	return errors.Wrapf(ErrUnexpectedOutputs, "%d output(s)", len(problems))
+}
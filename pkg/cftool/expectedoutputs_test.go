@@ -0,0 +1,50 @@
+package cftool
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseExpectedOutputs(t *testing.T) {
+	expected, err := ParseExpectedOutputs(map[string]string{"Url": "^https://", "Arn": ""})
+	require.NoError(t, err)
+	require.Len(t, expected, 2)
+	require.Equal(t, "^https://", expected["Url"].String())
+	require.True(t, expected["Arn"].MatchString("anything"))
+
+	_, err = ParseExpectedOutputs(map[string]string{"Url": "("})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "output Url")
+
+	_, err = ParseExpectedOutputs(map[string]string{"": "x"})
+	require.EqualError(t, err, "expected output without a key")
+}
+
+func TestDeployer_checkOutputs(t *testing.T) {
+	expected, err := ParseExpectedOutputs(map[string]string{
+		"Url":   "^https://[a-z.]+$",
+		"Arn":   "",
+		"Queue": "",
+	})
+	require.NoError(t, err)
+
+	d := NewDeployer(nil, &Deployment{StackName: "mystack", ExpectedOutputs: expected})
+	d.Outputs = map[string]string{"Url": "http://example.com", "Arn": "arn:aws:sqs:eu-west-1:111111111111:q"}
+
+	buf := &bytes.Buffer{}
+	err = d.checkOutputs(buf)
+	require.Equal(t, ErrUnexpectedOutputs, errors.Cause(err))
+	require.EqualError(t, err, "2 output(s): stack outputs are not as expected")
+	require.Contains(t, buf.String(), "  Queue: missing\n")
+	require.Contains(t, buf.String(), `  Url: "http://example.com" does not match ^https://[a-z.]+$`)
+
+	d.Outputs["Url"] = "https://example.com"
+	d.Outputs["Queue"] = "q"
+	require.NoError(t, d.checkOutputs(buf))
+
+	// Without expectations, any outputs will do.
+	d = NewDeployer(nil, &Deployment{StackName: "mystack"})
+	require.NoError(t, d.checkOutputs(buf))
+}
@@ -0,0 +1,160 @@
+package cftool
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	yamlv3 "gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// IncludeKey marks a mapping whose contents come from a partial template, a
+// local file or one in S3, e.g. {"cftool::Include": "partials/tags.yml"}.
+// Unlike AWS::Include, which CloudFormation expands, cftool expands it before
+// the template is diffed or deployed.
+const IncludeKey = "cftool::Include"
+
+// maxIncludeDepth limits how deeply partials can include others, which also
+// stops a partial from including itself.
+const maxIncludeDepth = 10
+
+// FetchFunc returns the body of a template or partial in S3.
+type FetchFunc func(url string) ([]byte, error)
+
+// ResolveIncludes replaces the includes of the template with the partials
+// they refer to. A mapping that consists of the include alone is replaced by
+// the partial, whatever it is. Otherwise, the partial must be a mapping, and
+// its keys are added to those of the including mapping. Relative paths are
+// resolved against dir for the template, and against the directory of the
+// partial for partials. Local partials are added to Files.
+//
+// A template without includes is left as written. Otherwise, it is rewritten
+// as YAML, with comments kept.
+func (d *Deployment) ResolveIncludes(dir string, fetch FetchFunc) error {
+	if !bytes.Contains(d.TemplateBody, []byte(IncludeKey)) {
+		return nil
+	}
+
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(d.TemplateBody, &doc); err != nil {
+		return errors.Wrap(err, "parse template")
+	}
+
+	r := includeResolver{fetch: fetch}
+	if err := r.resolve(&doc, dir, 0); err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	enc := yamlv3.NewEncoder(&body)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+
+	d.TemplateBody = body.Bytes()
+	d.Files = append(d.Files, r.files...)
+	return nil
+}
+
+type includeResolver struct {
+	fetch FetchFunc
+	files []string
+}
+
+func (r *includeResolver) resolve(node *yamlv3.Node, dir string, depth int) error {
+	if node.Kind == yamlv3.MappingNode {
+		var content []*yamlv3.Node
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value != IncludeKey {
+				content = append(content, key, value)
+				continue
+			}
+
+			partial, err := r.load(value, dir, depth)
+			if err != nil {
+				return err
+			}
+
+			if len(node.Content) == 2 {
+				*node = *partial
+				return nil
+			}
+
+			if partial.Kind != yamlv3.MappingNode {
+				return errors.Errorf("line %d: %s must be a mapping to be merged with other keys", key.Line, value.Value)
+			}
+
+			content = append(content, partial.Content...)
+		}
+
+		node.Content = content
+	}
+
+	for _, child := range node.Content {
+		if err := r.resolve(child, dir, depth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load reads the partial that the include refers to, with its own includes
+// resolved.
+func (r *includeResolver) load(location *yamlv3.Node, dir string, depth int) (*yamlv3.Node, error) {
+	if location.Kind != yamlv3.ScalarNode || location.Value == "" {
+		return nil, errors.Errorf("line %d: %s needs the path or S3 URL of a partial", location.Line, IncludeKey)
+	}
+
+	if depth >= maxIncludeDepth {
+		return nil, errors.Errorf("line %d: includes nested too deeply, at %s", location.Line, location.Value)
+	}
+
+	var body []byte
+	var err error
+	partialDir := ""
+
+	if IsTemplateURL(location.Value) {
+		if r.fetch == nil {
+			return nil, errors.Errorf("cannot include %s, since S3 is not available", location.Value)
+		}
+
+		body, err = r.fetch(location.Value)
+	} else {
+		if dir == "" && !filepath.IsAbs(location.Value) {
+			return nil, errors.Errorf("cannot include %s relative to a template or partial in S3", location.Value)
+		}
+
+		path := location.Value
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		partialDir = filepath.Dir(path)
+		r.files = append(r.files, path)
+		body, err = ioutil.ReadFile(path)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "include %s", location.Value)
+	}
+
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(body, &doc); err != nil {
+		return nil, errors.Wrapf(err, "parse %s", location.Value)
+	}
+
+	if len(doc.Content) == 0 {
+		return nil, errors.Errorf("%s is empty", location.Value)
+	}
+
+	partial := doc.Content[0]
+	if err := r.resolve(partial, partialDir, depth+1); err != nil {
+		return nil, errors.Wrapf(err, "in %s", location.Value)
+	}
+
+	return partial, nil
+}
@@ -0,0 +1,75 @@
+package cftool
+
+import (
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeployment_ResolveIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name string, body string) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(body), 0644))
+	}
+
+	write("partials/parameters.yml", "Environment:\n  Type: String\ncftool::Include: team.yml\n")
+	write("partials/team.yml", "Team: {Type: String}\n")
+	write("partials/tags.json", `[{"Key": "Environment", "Value": {"Ref": "Environment"}}]`)
+
+	d := &Deployment{
+		TemplateBody: []byte(`# the queue
+Parameters:
+  cftool::Include: partials/parameters.yml
+  Size: {Type: Number}
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      QueueName: !Sub "${Team}-queue"
+      Tags:
+        cftool::Include: s3://bucket/tags.json
+`),
+	}
+
+	fetched := ""
+	err = d.ResolveIncludes(dir, func(url string) ([]byte, error) {
+		fetched = url
+		return ioutil.ReadFile(filepath.Join(dir, "partials/tags.json"))
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, "s3://bucket/tags.json", fetched)
+	require.Equal(t, `# the queue
+Parameters:
+  Environment:
+    Type: String
+  Team: {Type: String}
+  Size: {Type: Number}
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      QueueName: !Sub "${Team}-queue"
+      Tags: [{"Key": "Environment", "Value": {"Ref": "Environment"}}]
+`, string(d.TemplateBody))
+	require.Equal(t, []string{filepath.Join(dir, "partials/parameters.yml"), filepath.Join(dir, "partials/team.yml")}, d.Files)
+
+	// Templates without includes are left alone.
+	d = &Deployment{TemplateBody: []byte("Resources: {Queue: {Type: AWS::SQS::Queue}}\n")}
+	require.NoError(t, d.ResolveIncludes(dir, nil))
+	require.Equal(t, "Resources: {Queue: {Type: AWS::SQS::Queue}}\n", string(d.TemplateBody))
+
+	write("partials/loop.yml", "cftool::Include: loop.yml\n")
+	d = &Deployment{TemplateBody: []byte("Resources:\n  cftool::Include: partials/loop.yml\n")}
+	require.Error(t, d.ResolveIncludes(dir, nil))
+
+	d = &Deployment{TemplateBody: []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n  cftool::Include: s3://bucket/tags.json\n")}
+	require.EqualError(t, d.ResolveIncludes(dir, nil), "cannot include s3://bucket/tags.json, since S3 is not available")
+}
@@ -0,0 +1,11 @@
+package cftool
+
+// StackLock keeps two deployments of the same stack from running at once.
+type StackLock interface {
+	// Acquire takes the lock for the key, or fails if another deployment
+	// holds it. With force, the lock is taken regardless.
+	Acquire(key string, force bool) error
+
+	// Release gives up the lock, if it is still held.
+	Release() error
+}
@@ -0,0 +1,50 @@
+package cftool
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	LevelInfo    = "info"
+	LevelWarning = "warning"
+	LevelError   = "error"
+)
+
+type logRecord struct {
+	Time   time.Time              `json:"time"`
+	Level  string                 `json:"level"`
+	Stack  string                 `json:"stack,omitempty"`
+	Event  string                 `json:"event"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Logger writes significant events as JSON lines, for consumption by log
+// platforms. A nil Logger discards everything, so callers don't need to check.
+type Logger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONLogger(w io.Writer) *Logger {
+	return &Logger{enc: json.NewEncoder(w)}
+}
+
+func (l *Logger) Log(level string, stack string, event string, fields map[string]interface{}) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_ = l.enc.Encode(&logRecord{
+		Time:   time.Now().UTC(),
+		Level:  level,
+		Stack:  stack,
+		Event:  event,
+		Fields: fields,
+	})
+}
@@ -0,0 +1,75 @@
+package cftool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := NewJSONLogger(buf)
+
+	log.Log(LevelInfo, "app", "status", map[string]interface{}{"status": "UPDATE_IN_PROGRESS"})
+	log.Log(LevelError, "", "failed", nil)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	require.Equal(t, "info", record["level"])
+	require.Equal(t, "app", record["stack"])
+	require.Equal(t, "status", record["event"])
+	require.Equal(t, map[string]interface{}{"status": "UPDATE_IN_PROGRESS"}, record["fields"])
+
+	at, err := time.Parse(time.RFC3339Nano, record["time"].(string))
+	require.NoError(t, err)
+	require.Equal(t, time.UTC, at.Location())
+	require.WithinDuration(t, time.Now(), at, time.Minute)
+
+	// Empty stacks and fields are left out.
+	record = nil
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	require.Equal(t, "error", record["level"])
+	require.Equal(t, "failed", record["event"])
+	require.NotContains(t, record, "stack")
+	require.NotContains(t, record, "fields")
+}
+
+func TestLogger_concurrent(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := NewJSONLogger(buf)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			log.Log(LevelInfo, "app", "status", map[string]interface{}{"i": i})
+		}(i)
+	}
+	wg.Wait()
+
+	// Records of parallel deployments don't interleave.
+	scanner := bufio.NewScanner(buf)
+	n := 0
+	for scanner.Scan() {
+		var record logRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		n++
+	}
+	require.Equal(t, 10, n)
+}
+
+func TestLogger_nil(t *testing.T) {
+	var log *Logger
+	require.NotPanics(t, func() {
+		log.Log(LevelInfo, "app", "status", nil)
+	})
+}
@@ -0,0 +1,170 @@
+package cftool
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxTemplateBodySize is the largest template body ValidateTemplate accepts.
+// Larger templates have to be validated from S3.
+const maxTemplateBodySize = 51200
+
+// maxNestingDepth limits how deeply nested stacks are followed, which also
+// stops a template that nests itself.
+const maxNestingDepth = 10
+
+// NestedStack is a nested stack that a template declares.
+type NestedStack struct {
+	// Path is the logical id of the nested stack, after those of the nested
+	// stacks it is in, e.g. "Network/Subnets".
+	Path string
+
+	// TemplateURL is the location of its template as written, a URL or a
+	// local path as used with 'aws cloudformation package'.
+	TemplateURL string
+}
+
+// NestedStacks lists the nested stacks the template declares, by logical id.
+// Those whose TemplateURL is given by an intrinsic function can't be followed,
+// and are left out.
+func NestedStacks(body []byte) ([]NestedStack, error) {
+	resources, err := ParseTemplateResources(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []NestedStack
+	for id, resource := range resources {
+		if resource.Type != "AWS::CloudFormation::Stack" {
+			continue
+		}
+
+		location, ok := resource.Properties["TemplateURL"].(string)
+		if !ok || location == "" || strings.Contains(location, "${") {
+			continue
+		}
+
+		result = append(result, NestedStack{Path: id, TemplateURL: location})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+
+	return result, nil
+}
+
+// ValidateNestedStacks validates the templates of the nested stacks that the
+// template declares, and of the stacks nested in those in turn, with
+// ValidateTemplate. Relative paths are resolved against dir, or against the
+// directory of the template that declares them. Templates in S3 are validated
+// by URL, and fetched to find their own nested stacks. It returns the nested
+// stacks validated, or an error naming the one that failed.
+func ValidateNestedStacks(
+	api cloudformationiface.CloudFormationAPI,
+	body []byte,
+	dir string,
+	fetch FetchFunc,
+) ([]NestedStack, error) {
+	v := nestedValidator{api: api, fetch: fetch}
+	err := v.validate(body, dir, "", 0)
+	return v.validated, err
+}
+
+type nestedValidator struct {
+	api       cloudformationiface.CloudFormationAPI
+	fetch     FetchFunc
+	validated []NestedStack
+}
+
+func (v *nestedValidator) validate(body []byte, dir string, parent string, depth int) error {
+	nested, err := NestedStacks(body)
+	if err != nil {
+		return err
+	}
+
+	for _, stack := range nested {
+		stack.Path = parent + stack.Path
+
+		childBody, childDir, err := v.check(stack, dir, depth)
+		if err != nil {
+			return errors.Wrapf(err, "nested stack %s (%s)", stack.Path, stack.TemplateURL)
+		}
+
+		v.validated = append(v.validated, stack)
+
+		if childBody != nil {
+			if err := v.validate(childBody, childDir, stack.Path+"/", depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// check validates the template of a nested stack, and returns its body, if
+// it could be read, and the directory its own nested stacks are relative to.
+func (v *nestedValidator) check(stack NestedStack, dir string, depth int) ([]byte, string, error) {
+	if depth >= maxNestingDepth {
+		return nil, "", errors.New("stacks nested too deeply")
+	}
+
+	input := cf.ValidateTemplateInput{}
+	var body []byte
+	childDir := ""
+
+	if IsTemplateURL(stack.TemplateURL) {
+		u, err := ParseTemplateURL(stack.TemplateURL)
+		if err != nil {
+			return nil, "", err
+		}
+
+		input.TemplateURL = aws.String(u.URL)
+
+		if v.fetch != nil {
+			if body, err = v.fetch(stack.TemplateURL); err != nil {
+				return nil, "", err
+			}
+		}
+	} else {
+		if dir == "" && !filepath.IsAbs(stack.TemplateURL) {
+			return nil, "", errors.New("cannot read a local template relative to a template in S3")
+		}
+
+		path := stack.TemplateURL
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		var err error
+		if body, err = ioutil.ReadFile(path); err != nil {
+			return nil, "", err
+		}
+
+		// A larger template is uploaded to S3 by 'aws cloudformation
+		// package', and only checked for syntax here.
+		if len(body) > maxTemplateBodySize {
+			if _, err := ParseTemplateResources(body); err != nil {
+				return nil, "", err
+			}
+
+			return body, filepath.Dir(path), nil
+		}
+
+		input.TemplateBody = aws.String(string(body))
+		childDir = filepath.Dir(path)
+	}
+
+	if _, err := v.api.ValidateTemplate(&input); err != nil {
+		return nil, "", errors.Wrap(err, "validate template")
+	}
+
+	return body, childDir, nil
+}
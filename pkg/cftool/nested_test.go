@@ -0,0 +1,97 @@
+package cftool
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// validatingCloudFormation rejects templates that declare no Resources, and
+// records the templates it was asked to validate.
+type validatingCloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+	validated []string
+}
+
+func (v *validatingCloudFormation) ValidateTemplate(input *cf.ValidateTemplateInput) (*cf.ValidateTemplateOutput, error) {
+	if input.TemplateURL != nil {
+		v.validated = append(v.validated, *input.TemplateURL)
+		return &cf.ValidateTemplateOutput{}, nil
+	}
+
+	body := aws.StringValue(input.TemplateBody)
+	v.validated = append(v.validated, strings.SplitN(body, "\n", 2)[0])
+	if !strings.Contains(body, "Resources:") {
+		return nil, errors.New("ValidationError: Template format error: At least one Resources member must be defined.")
+	}
+
+	return &cf.ValidateTemplateOutput{}, nil
+}
+
+func TestValidateNestedStacks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name string, body string) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(body), 0644))
+	}
+
+	write("nested/network.yml", "# network\nResources:\n  Subnets:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: subnets.yml\n")
+	write("nested/subnets.yml", "# subnets\nResources:\n  Subnet: {Type: AWS::EC2::Subnet}\n")
+
+	body := []byte(`Resources:
+  Network:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: nested/network.yml
+  Shared:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: s3://bucket/shared.yml
+  Dynamic:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: !Sub "https://${Bucket}.s3.amazonaws.com/app.yml"
+`)
+
+	fetched := map[string]string{"s3://bucket/shared.yml": "Resources: {}\n"}
+	fetch := func(url string) ([]byte, error) {
+		return []byte(fetched[url]), nil
+	}
+
+	api := &validatingCloudFormation{}
+	nested, err := ValidateNestedStacks(api, body, dir, fetch)
+	require.NoError(t, err)
+	require.Equal(t, []NestedStack{
+		{Path: "Network", TemplateURL: "nested/network.yml"},
+		{Path: "Network/Subnets", TemplateURL: "subnets.yml"},
+		{Path: "Shared", TemplateURL: "s3://bucket/shared.yml"},
+	}, nested)
+	require.Equal(t, []string{"# network", "# subnets", "https://bucket.s3.amazonaws.com/shared.yml"}, api.validated)
+
+	write("nested/subnets.yml", "# subnets\nOutputs: {}\n")
+	_, err = ValidateNestedStacks(&validatingCloudFormation{}, body, dir, fetch)
+	require.EqualError(t, err, "nested stack Network/Subnets (subnets.yml): validate template: "+
+		"ValidationError: Template format error: At least one Resources member must be defined.")
+
+	write("nested/network.yml", "Resources:\n  Missing:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: missing.yml\n")
+	_, err = ValidateNestedStacks(&validatingCloudFormation{}, body, dir, fetch)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "nested stack Network/Missing (missing.yml): open ")
+
+	self := "Resources:\n  Self:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: self.yml\n"
+	write("self.yml", self)
+	_, err = ValidateNestedStacks(&validatingCloudFormation{}, []byte(self), dir, fetch)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "stacks nested too deeply")
+}
@@ -0,0 +1,121 @@
+package cftool
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// OutputPrefix marks a parameter value as a reference to an output of another
+// stack, e.g. "output:network:VpcId".
+const OutputPrefix = "output:"
+
+// ParseOutputRef splits a reference to a stack output into the stack and the
+// output key. It returns false if the value is not such a reference.
+func ParseOutputRef(value string) (stack string, key string, ok bool) {
+	if !strings.HasPrefix(value, OutputPrefix) {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, OutputPrefix), ":", 2)
+	if len(parts) != 2 {
+		return parts[0], "", true
+	}
+
+	return parts[0], parts[1], true
+}
+
+// HasOutputRefs reports whether any of the parameter values refer to a stack
+// output.
+func HasOutputRefs(params map[string]string) bool {
+	for _, value := range params {
+		if strings.HasPrefix(value, OutputPrefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResolveOutputRefs replaces parameter values that refer to stack outputs with
+// the values of those outputs, as returned by lookup.
+func ResolveOutputRefs(params map[string]string, lookup func(stack string, key string) (string, error)) error {
+	var names []string
+	for name, value := range params {
+		if strings.HasPrefix(value, OutputPrefix) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		stack, key, _ := ParseOutputRef(params[name])
+		if stack == "" || key == "" {
+			return errors.Errorf("parameter %s: expected %sSTACK:KEY, got %s", name, OutputPrefix, params[name])
+		}
+
+		value, err := lookup(stack, key)
+		if err != nil {
+			return errors.Wrapf(err, "parameter %s", name)
+		}
+
+		params[name] = value
+	}
+
+	return nil
+}
+
+// ExportChange is an export of a stack that a deployment added, modified or
+// removed. Other stacks may import exports, so changing them has an impact
+// beyond the stack.
+type ExportChange struct {
+	// Name is the export name, and Action one of cf.ChangeActionAdd, Modify
+	// and Remove.
+	Name   string
+	Action string
+
+	// Before and After are the values of the export, if it had one.
+	Before string `json:",omitempty"`
+	After  string `json:",omitempty"`
+}
+
+// compareExports lists the exports of the outputs after a deployment that
+// differ from those before it, by export name.
+func compareExports(before []*cf.Output, after []*cf.Output) []ExportChange {
+	exports := func(outputs []*cf.Output) map[string]string {
+		result := make(map[string]string)
+		for _, output := range outputs {
+			if output.ExportName != nil {
+				result[*output.ExportName] = aws.StringValue(output.OutputValue)
+			}
+		}
+
+		return result
+	}
+
+	a, b := exports(before), exports(after)
+	var changes []ExportChange
+
+	for name, value := range a {
+		if newValue, ok := b[name]; !ok {
+			changes = append(changes, ExportChange{Name: name, Action: cf.ChangeActionRemove, Before: value})
+		} else if newValue != value {
+			changes = append(changes, ExportChange{Name: name, Action: cf.ChangeActionModify, Before: value, After: newValue})
+		}
+	}
+
+	for name, value := range b {
+		if _, ok := a[name]; !ok {
+			changes = append(changes, ExportChange{Name: name, Action: cf.ChangeActionAdd, After: value})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes
+}
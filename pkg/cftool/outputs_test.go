@@ -0,0 +1,66 @@
+package cftool
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestResolveOutputRefs(t *testing.T) {
+	outputs := map[string]string{"network/VpcId": "vpc-123"}
+	lookup := func(stack string, key string) (string, error) {
+		if value, ok := outputs[stack+"/"+key]; ok {
+			return value, nil
+		}
+
+		return "", errors.Errorf("stack %s has no output %s", stack, key)
+	}
+
+	params := map[string]string{"Vpc": "output:network:VpcId", "Name": "app"}
+	require.True(t, HasOutputRefs(params))
+	require.NoError(t, ResolveOutputRefs(params, lookup))
+	require.Equal(t, map[string]string{"Vpc": "vpc-123", "Name": "app"}, params)
+	require.False(t, HasOutputRefs(params))
+
+	err := ResolveOutputRefs(map[string]string{"Subnet": "output:network:SubnetId"}, lookup)
+	require.EqualError(t, err, "parameter Subnet: stack network has no output SubnetId")
+
+	err = ResolveOutputRefs(map[string]string{"Vpc": "output:network"}, lookup)
+	require.EqualError(t, err, "parameter Vpc: expected output:STACK:KEY, got output:network")
+}
+
+func TestCompareExports(t *testing.T) {
+	output := func(key string, value string, export string) *cf.Output {
+		o := &cf.Output{OutputKey: aws.String(key), OutputValue: aws.String(value)}
+		if export != "" {
+			o.ExportName = aws.String(export)
+		}
+
+		return o
+	}
+
+	before := []*cf.Output{
+		output("VpcId", "vpc-1", "network-VpcId"),
+		output("SubnetId", "subnet-1", "network-SubnetId"),
+		output("ZoneId", "zone-1", "network-ZoneId"),
+		output("Name", "network", ""),
+	}
+
+	after := []*cf.Output{
+		output("VpcId", "vpc-1", "network-VpcId"),
+		output("SubnetId", "subnet-2", "network-SubnetId"),
+		output("ZoneId", "zone-1", "network-HostedZoneId"),
+		output("Name", "network-2", ""),
+	}
+
+	require.Equal(t, []ExportChange{
+		{Name: "network-HostedZoneId", Action: cf.ChangeActionAdd, After: "zone-1"},
+		{Name: "network-SubnetId", Action: cf.ChangeActionModify, Before: "subnet-1", After: "subnet-2"},
+		{Name: "network-ZoneId", Action: cf.ChangeActionRemove, Before: "zone-1"},
+	}, compareExports(before, after))
+
+	require.Empty(t, compareExports(before, before))
+	require.Len(t, compareExports(nil, after), 3)
+}
@@ -0,0 +1,36 @@
+package cftool
+
+import (
+	"strings"
+	"text/template"
+)
+
+var preprocessFuncs = template.FuncMap{
+	"split": strings.Split,
+	"join":  strings.Join,
+	"trim":  strings.TrimSpace,
+}
+
+// Preprocess renders the template body with Go's text/template, using the
+// deployment itself as data. Templates can thus refer to resolved values such
+// as {{.Parameters.Foo}} or {{.Constants.Bar}}.
+func (d *Deployment) Preprocess() error {
+	parsed, err := template.
+		New("Template").
+		Option("missingkey=error").
+		Funcs(preprocessFuncs).
+		Parse(string(d.TemplateBody))
+
+	if err != nil {
+		return err
+	}
+
+	w := strings.Builder{}
+	err = parsed.Execute(&w, d)
+	if err != nil {
+		return err
+	}
+
+	d.TemplateBody = []byte(w.String())
+	return nil
+}
@@ -0,0 +1,22 @@
+package cftool
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDeployment_Preprocess(t *testing.T) {
+	d := Deployment{
+		StackName:  "mystack",
+		Parameters: map[string]string{"Subnets": "a,b"},
+		TemplateBody: []byte(
+			"Description: {{.StackName}}\n" +
+				"{{range split .Parameters.Subnets \",\"}}- {{.}}\n{{end}}"),
+	}
+
+	require.NoError(t, d.Preprocess())
+	require.Equal(t, "Description: mystack\n- a\n- b\n", string(d.TemplateBody))
+
+	d.TemplateBody = []byte("{{.Parameters.Missing}}")
+	require.Error(t, d.Preprocess())
+}
@@ -0,0 +1,257 @@
+package cftool
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"strings"
+)
+
+// maskedValue stands for the value of a NoEcho parameter, as CloudFormation
+// shows it.
+const maskedValue = "****"
+
+// propertyChanges resolves the values before and after the change set of the
+// properties it modifies, from the deployed and the new template. References
+// to parameters and to resources that keep their physical id are resolved;
+// other intrinsic functions, and references to resources the change set adds
+// or replaces, are only known once it is executed.
+func (d *Deployer) propertyChanges(chset *cf.DescribeChangeSetOutput) (pprint.PropertyChanges, error) {
+	out, err := d.client.GetTemplate(&cf.GetTemplateInput{StackName: d.stackRef()})
+	if err != nil {
+		return nil, errors.Wrap(err, "get template")
+	}
+
+	before, err := canonicalResources([]byte(aws.StringValue(out.TemplateBody)))
+	if err != nil {
+		return nil, errors.Wrap(err, "deployed template")
+	}
+
+	var after map[string]*TemplateResource
+	if len(d.TemplateBody) > 0 {
+		if after, err = canonicalResources(d.TemplateBody); err != nil {
+			return nil, errors.Wrap(err, "local template")
+		}
+	}
+
+	beforeRefs, afterRefs, err := d.propertyRefs(chset)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(pprint.PropertyChanges)
+	for _, change := range chset.Changes {
+		rc := change.ResourceChange
+		if rc == nil || aws.StringValue(rc.Action) != cf.ChangeActionModify {
+			continue
+		}
+
+		id := aws.StringValue(rc.LogicalResourceId)
+		for _, detail := range rc.Details {
+			if detail.Target == nil || aws.StringValue(detail.Target.Attribute) != cf.ResourceAttributeProperties {
+				continue
+			}
+
+			name := aws.StringValue(detail.Target.Name)
+			if name == "" {
+				continue
+			}
+
+			if result[id] == nil {
+				result[id] = make(map[string]pprint.PropertyChange)
+			}
+
+			result[id][name] = pprint.PropertyChange{
+				Before: propertyValue(before, id, name, beforeRefs, pprint.UnknownValue),
+				After:  propertyValue(after, id, name, afterRefs, pprint.KnownAfterApply),
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// propertyRefs returns what Ref resolves to before and after the change set:
+// pseudo parameters, parameters, and the physical ids of resources. Resources
+// that the change set adds, replaces or removes are left out afterwards.
+func (d *Deployer) propertyRefs(chset *cf.DescribeChangeSetOutput) (map[string]string, map[string]string, error) {
+	stack, err := d.describeStack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	before := make(map[string]string)
+	after := make(map[string]string)
+
+	pseudo := map[string]string{
+		"AWS::StackName": aws.StringValue(stack.StackName),
+		"AWS::StackId":   aws.StringValue(stack.StackId),
+	}
+
+	if parsed, err := arn.Parse(aws.StringValue(stack.StackId)); err == nil {
+		pseudo["AWS::Region"] = parsed.Region
+		pseudo["AWS::AccountId"] = parsed.AccountID
+		pseudo["AWS::Partition"] = parsed.Partition
+	}
+
+	for name, value := range pseudo {
+		before[name], after[name] = value, value
+	}
+
+	for _, param := range stack.Parameters {
+		before[aws.StringValue(param.ParameterKey)] = aws.StringValue(param.ParameterValue)
+	}
+
+	if len(d.TemplateBody) > 0 {
+		params, err := ParseTemplateParameters(d.TemplateBody)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		resolved, err := d.ResolveParameters()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, param := range resolved {
+			switch {
+			case param.Source == ParameterMissing:
+			case params[param.Name] != nil && params[param.Name].IsNoEcho():
+				after[param.Name] = maskedValue
+			default:
+				after[param.Name] = param.Value
+			}
+		}
+	}
+
+	changing := make(map[string]bool)
+	for _, change := range chset.Changes {
+		rc := change.ResourceChange
+		if rc == nil {
+			continue
+		}
+
+		replacement := aws.StringValue(rc.Replacement)
+		if aws.StringValue(rc.Action) != cf.ChangeActionModify ||
+			replacement == cf.ReplacementTrue || replacement == cf.ReplacementConditional {
+
+			changing[aws.StringValue(rc.LogicalResourceId)] = true
+		}
+	}
+
+	err = d.client.ListStackResourcesPages(
+		&cf.ListStackResourcesInput{StackName: d.stackRef()},
+		func(page *cf.ListStackResourcesOutput, lastPage bool) bool {
+			for _, resource := range page.StackResourceSummaries {
+				id := aws.StringValue(resource.LogicalResourceId)
+				if resource.PhysicalResourceId == nil {
+					continue
+				}
+
+				before[id] = aws.StringValue(resource.PhysicalResourceId)
+				if !changing[id] {
+					after[id] = before[id]
+				}
+			}
+
+			return true
+		})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "list stack resources")
+	}
+
+	return before, after, nil
+}
+
+// canonicalResources reads the resources of a template, with intrinsic
+// functions in their long form.
+func canonicalResources(body []byte) (map[string]*TemplateResource, error) {
+	canonical, err := CanonicalTemplate(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTemplateResources(canonical)
+}
+
+// propertyValue formats the property of a resource with its references
+// resolved, or returns unknown if it can't be resolved. Strings are shown as
+// they are, and other values as JSON.
+func propertyValue(resources map[string]*TemplateResource, id string, name string, refs map[string]string, unknown string) string {
+	if resources == nil {
+		return unknown
+	}
+
+	resource := resources[id]
+	if resource == nil {
+		return unknown
+	}
+
+	value, ok := resource.Properties[name]
+	if !ok {
+		return pprint.UnsetValue
+	}
+
+	value, ok = resolveRefs(value, refs)
+	if !ok {
+		return unknown
+	}
+
+	if s, isString := value.(string); isString {
+		return s
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return unknown
+	}
+
+	return string(data)
+}
+
+// resolveRefs replaces Ref with the value it resolves to, and reports whether
+// all of value could be resolved. Other intrinsic functions can't be.
+func resolveRefs(value interface{}, refs map[string]string) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if name, ok := v["Ref"].(string); ok && len(v) == 1 {
+			resolved, ok := refs[name]
+			return resolved, ok
+		}
+
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if strings.HasPrefix(key, "Fn::") {
+				return nil, false
+			}
+
+			resolved, ok := resolveRefs(item, refs)
+			if !ok {
+				return nil, false
+			}
+
+			result[key] = resolved
+		}
+
+		return result, true
+
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved, ok := resolveRefs(item, refs)
+			if !ok {
+				return nil, false
+			}
+
+			result[i] = resolved
+		}
+
+		return result, true
+
+	default:
+		return value, true
+	}
+}
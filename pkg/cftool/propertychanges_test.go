@@ -0,0 +1,51 @@
+package cftool
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"testing"
+)
+
+func TestResolveRefs(t *testing.T) {
+	refs := map[string]string{"Timeout": "60", "Topic": "arn:aws:sns:eu-west-1:123456789012:topic"}
+
+	value, ok := resolveRefs(map[string]interface{}{
+		"Timeout": map[string]interface{}{"Ref": "Timeout"},
+		"Targets": []interface{}{map[string]interface{}{"Ref": "Topic"}, "literal"},
+	}, refs)
+	require.True(t, ok)
+	require.Equal(t, map[string]interface{}{
+		"Timeout": "60",
+		"Targets": []interface{}{"arn:aws:sns:eu-west-1:123456789012:topic", "literal"},
+	}, value)
+
+	_, ok = resolveRefs(map[string]interface{}{"Ref": "Queue"}, refs)
+	require.False(t, ok)
+
+	_, ok = resolveRefs([]interface{}{map[string]interface{}{"Fn::GetAtt": []interface{}{"Queue", "Arn"}}}, refs)
+	require.False(t, ok)
+}
+
+func TestPropertyValue(t *testing.T) {
+	resources, err := canonicalResources([]byte("" +
+		"Resources:\n" +
+		"  Queue:\n" +
+		"    Type: AWS::SQS::Queue\n" +
+		"    Properties:\n" +
+		"      VisibilityTimeout: !Ref Timeout\n" +
+		"      RedrivePolicy: {deadLetterTargetArn: !GetAtt Dlq.Arn, maxReceiveCount: 5}\n" +
+		"      Tags: [{Key: Env, Value: !Ref Env}]\n"))
+	require.NoError(t, err)
+
+	refs := map[string]string{"Timeout": "60", "Env": "prod"}
+	value := func(name string) string {
+		return propertyValue(resources, "Queue", name, refs, pprint.KnownAfterApply)
+	}
+
+	require.Equal(t, "60", value("VisibilityTimeout"))
+	require.Equal(t, `[{"Key":"Env","Value":"prod"}]`, value("Tags"))
+	require.Equal(t, pprint.KnownAfterApply, value("RedrivePolicy"))
+	require.Equal(t, pprint.UnsetValue, value("DelaySeconds"))
+	require.Equal(t, pprint.KnownAfterApply, propertyValue(resources, "Topic", "TopicName", refs, pprint.KnownAfterApply))
+	require.Equal(t, pprint.UnknownValue, propertyValue(nil, "Queue", "Tags", refs, pprint.UnknownValue))
+}
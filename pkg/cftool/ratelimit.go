@@ -0,0 +1,58 @@
+package cftool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out the calls that poll CloudFormation, so that stacks
+// monitored at the same time, e.g. by a parallel batch, stay within an
+// overall budget rather than be throttled. Each caller reserves the next free
+// slot, so calls are staggered in the order they were asked for, and those of
+// one stack keep their order. A nil RateLimiter doesn't limit anything.
+type RateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimiter allows perSecond calls a second, or returns nil, which
+// doesn't limit them, if perSecond is not positive.
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// reserve returns how long to wait for the next free slot, and takes it.
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return delay
+}
+
+// wait blocks until a call may be made, or returns the context's error once
+// it is done. The slot is used up either way.
+func (l *RateLimiter) wait(c context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	delay := l.reserve(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+
+	return sleep(c, delay)
+}
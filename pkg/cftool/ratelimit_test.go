@@ -0,0 +1,60 @@
+package cftool
+
+import (
+	"context"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	require.Nil(t, NewRateLimiter(0))
+	require.NoError(t, NewRateLimiter(-1).wait(context.Background()))
+
+	l := NewRateLimiter(4)
+	now := time.Now()
+
+	// Calls asked for at once are staggered.
+	require.Equal(t, time.Duration(0), l.reserve(now))
+	require.Equal(t, 250*time.Millisecond, l.reserve(now))
+	require.Equal(t, 500*time.Millisecond, l.reserve(now))
+
+	// An idle limiter doesn't make up for lost time.
+	later := now.Add(10 * time.Second)
+	require.Equal(t, time.Duration(0), l.reserve(later))
+	require.Equal(t, 250*time.Millisecond, l.reserve(later))
+
+	l = NewRateLimiter(1)
+	require.NoError(t, l.wait(context.Background()))
+
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, l.wait(c))
+}
+
+func TestDeployer_getStackEvents_RateLimiter(t *testing.T) {
+	start := time.Date(2019, 8, 1, 12, 0, 0, 0, time.UTC)
+	api := &fakeCloudFormation{events: []*cf.StackEvent{
+		stackEvent("c", start),
+		stackEvent("b", start),
+		stackEvent("a", start),
+	}}
+
+	d := NewDeployer(api, &Deployment{StackName: "mystack"})
+	d.RateLimiter = NewRateLimiter(1000)
+
+	// Each of the three pages takes a slot.
+	began := time.Now()
+	events, err := d.getStackEvents(context.Background(), start, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, eventIds(events))
+	require.True(t, d.RateLimiter.next.Sub(began) >= 3*time.Millisecond)
+
+	// Paging stops once the context is done.
+	d.RateLimiter = NewRateLimiter(0.1)
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = d.getStackEvents(c, start, "")
+	require.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,60 @@
+package cftool
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"strings"
+)
+
+// progressPolls is how many polls of the stack pass between fetching events
+// only to update the progress, to keep from listing events on every poll.
+const progressPolls = 6
+
+// resourceProgress estimates how far along a stack operation is, from the
+// number of resources that have completed out of those in the change set.
+// CloudFormation has no notion of progress, so this is only a rough guide.
+type resourceProgress struct {
+	total int
+	done  map[string]bool
+}
+
+func newResourceProgress(total int) *resourceProgress {
+	if total <= 0 {
+		return nil
+	}
+
+	return &resourceProgress{total: total, done: make(map[string]bool)}
+}
+
+// observe counts a resource once it has completed. A resource that is
+// replaced completes twice, but is only counted once. Events of the stack
+// itself are ignored.
+func (rp *resourceProgress) observe(event *cf.StackEvent) {
+	if rp == nil || aws.StringValue(event.PhysicalResourceId) == aws.StringValue(event.StackId) {
+		return
+	}
+
+	status := aws.StringValue(event.ResourceStatus)
+	if strings.HasSuffix(status, "_COMPLETE") && !strings.Contains(status, "ROLLBACK") {
+		rp.done[aws.StringValue(event.LogicalResourceId)] = true
+	}
+}
+
+// percent is the share of resources completed so far, or -1 if unknown.
+func (rp *resourceProgress) percent() int {
+	if rp == nil {
+		return -1
+	}
+
+	if len(rp.done) >= rp.total {
+		return 100
+	}
+
+	return len(rp.done) * 100 / rp.total
+}
+
+// due reports whether events should be fetched on the given poll of a status
+// to update the progress.
+func (rp *resourceProgress) due(poll int) bool {
+	return rp != nil && poll%progressPolls == 0
+}
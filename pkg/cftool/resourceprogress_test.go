@@ -0,0 +1,63 @@
+package cftool
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestResourceProgress(t *testing.T) {
+	event := func(id string, status string) *cf.StackEvent {
+		return &cf.StackEvent{
+			StackId:            aws.String("stack-id"),
+			LogicalResourceId:  aws.String(id),
+			PhysicalResourceId: aws.String(id + "-physical"),
+			ResourceStatus:     aws.String(status),
+		}
+	}
+
+	rp := newResourceProgress(4)
+	require.Equal(t, 0, rp.percent())
+
+	rp.observe(event("Queue", cf.ResourceStatusCreateInProgress))
+	rp.observe(event("Queue", cf.ResourceStatusCreateComplete))
+	require.Equal(t, 25, rp.percent())
+
+	// A replaced resource completes twice.
+	rp.observe(event("Bucket", cf.ResourceStatusCreateComplete))
+	rp.observe(event("Bucket", cf.ResourceStatusDeleteComplete))
+	require.Equal(t, 50, rp.percent())
+
+	// Neither the stack itself nor rollbacks count.
+	rp.observe(&cf.StackEvent{
+		StackId:            aws.String("stack-id"),
+		LogicalResourceId:  aws.String("app"),
+		PhysicalResourceId: aws.String("stack-id"),
+		ResourceStatus:     aws.String(cf.StackStatusUpdateCompleteCleanupInProgress),
+	})
+	rp.observe(event("Topic", cf.ResourceStatusUpdateComplete))
+	rp.observe(event("Role", "UPDATE_ROLLBACK_COMPLETE"))
+	require.Equal(t, 75, rp.percent())
+
+	rp.observe(event("Role", cf.ResourceStatusUpdateComplete))
+	rp.observe(event("Extra", cf.ResourceStatusUpdateComplete))
+	require.Equal(t, 100, rp.percent())
+
+	// Without a change set, the progress is unknown.
+	none := newResourceProgress(0)
+	none.observe(event("Queue", cf.ResourceStatusCreateComplete))
+	require.Equal(t, -1, none.percent())
+}
+
+func TestResourceProgress_due(t *testing.T) {
+	rp := newResourceProgress(4)
+	require.True(t, rp.due(0))
+	require.False(t, rp.due(1))
+	require.False(t, rp.due(progressPolls-1))
+	require.True(t, rp.due(progressPolls))
+
+	// Without a change set, there is no progress to update.
+	none := newResourceProgress(0)
+	require.False(t, none.due(0))
+}
@@ -0,0 +1,177 @@
+package cftool
+
+import (
+	"bytes"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ParseResourceTimeouts checks how long resources of each type are expected
+// to take, such as {"AWS::RDS::DBInstance": "40m", "*": "10m"}.
+func ParseResourceTimeouts(timeouts map[string]string) (map[string]time.Duration, error) {
+	result := make(map[string]time.Duration)
+
+	for pattern, value := range timeouts {
+		patterns, err := ParseResourceTypes([]string{pattern})
+		if err != nil {
+			return nil, err
+		}
+
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || timeout <= 0 {
+			return nil, errors.Errorf("invalid timeout %q for %s", value, pattern)
+		}
+
+		result[patterns[0]] = timeout
+	}
+
+	return result, nil
+}
+
+// resourceTimeout is how long a resource of the type is expected to take. An
+// exact type takes precedence over patterns, and longer patterns over shorter
+// ones, so that AWS::RDS::* overrides *.
+func resourceTimeout(timeouts map[string]time.Duration, resourceType string) (time.Duration, bool) {
+	if timeout, ok := timeouts[resourceType]; ok {
+		return timeout, true
+	}
+
+	best, found := "", false
+	for pattern := range timeouts {
+		ok, _ := path.Match(pattern, resourceType)
+		longer := len(pattern) > len(best) || len(pattern) == len(best) && pattern < best
+
+		if ok && (!found || longer) {
+			best, found = pattern, true
+		}
+	}
+
+	return timeouts[best], found
+}
+
+// resourceWatch follows the resources in progress from the stack events, to
+// notice those that take longer than expected for their type. The time on
+// CloudFormation's clock is reckoned from the first event seen, so that the
+// local clock being off doesn't matter.
+type resourceWatch struct {
+	timeouts map[string]time.Duration
+	pending  map[string]*cf.StackEvent
+	warned   map[string]bool
+
+	// origin is the timestamp of the first event, and seen the local time
+	// it was seen at.
+	origin time.Time
+	seen   time.Time
+}
+
+// slowResource is a resource that has been in progress for longer than
+// expected.
+type slowResource struct {
+	Event    *cf.StackEvent
+	Elapsed  time.Duration
+	Expected time.Duration
+}
+
+func newResourceWatch(timeouts map[string]time.Duration) *resourceWatch {
+	if len(timeouts) == 0 {
+		return nil
+	}
+
+	return &resourceWatch{
+		timeouts: timeouts,
+		pending:  make(map[string]*cf.StackEvent),
+		warned:   make(map[string]bool),
+	}
+}
+
+// observe notes that a resource started or finished an operation, as seen at
+// now. Events of the stack itself are ignored, as heartbeats already cover it.
+func (rw *resourceWatch) observe(event *cf.StackEvent, now time.Time) {
+	if rw == nil {
+		return
+	}
+
+	if rw.origin.IsZero() {
+		rw.origin, rw.seen = aws.TimeValue(event.Timestamp), now
+	}
+
+	if aws.StringValue(event.PhysicalResourceId) == aws.StringValue(event.StackId) {
+		return
+	}
+
+	id := aws.StringValue(event.LogicalResourceId)
+	status := aws.StringValue(event.ResourceStatus)
+
+	if !strings.HasSuffix(status, "_IN_PROGRESS") {
+		delete(rw.pending, id)
+		delete(rw.warned, id)
+		return
+	}
+
+	// A resource that is still in the same status, e.g. when a stack event
+	// only reports progress, keeps the time it started.
+	if last, ok := rw.pending[id]; ok && aws.StringValue(last.ResourceStatus) == status {
+		return
+	}
+
+	rw.pending[id] = event
+	delete(rw.warned, id)
+}
+
+// slow returns the resources that have been in progress for longer than their
+// timeout at now, on the local clock, each only once per operation.
+func (rw *resourceWatch) slow(now time.Time) []slowResource {
+	if rw == nil {
+		return nil
+	}
+
+	var ids []string
+	for id := range rw.pending {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	var result []slowResource
+	for _, id := range ids {
+		event := rw.pending[id]
+		timeout, ok := resourceTimeout(rw.timeouts, aws.StringValue(event.ResourceType))
+		if !ok || rw.warned[id] {
+			continue
+		}
+
+		if elapsed := rw.origin.Add(now.Sub(rw.seen)).Sub(aws.TimeValue(event.Timestamp)); elapsed > timeout {
+			rw.warned[id] = true
+			result = append(result, slowResource{event, elapsed.Round(time.Second), timeout})
+		}
+	}
+
+	return result
+}
+
+// warnSlowResources notes the resources that take longer than expected. They
+// may well still finish, so this is only a warning.
+func (d *Deployer) warnSlowResources(progress *pprint.Progress, slow []slowResource) {
+	for _, resource := range slow {
+		event := resource.Event
+		buf := &bytes.Buffer{}
+		pprint.Warningf(buf, "%s %s has been %s for %s, longer than the expected %s.",
+			aws.StringValue(event.ResourceType), aws.StringValue(event.LogicalResourceId),
+			aws.StringValue(event.ResourceStatus), resource.Elapsed, resource.Expected)
+		progress.Note("%s", strings.TrimSuffix(buf.String(), "\n"))
+
+		d.Log.Log(LevelWarning, d.StackName, "resource-slow", map[string]interface{}{
+			"logicalResourceId": aws.StringValue(event.LogicalResourceId),
+			"resourceType":      aws.StringValue(event.ResourceType),
+			"resourceStatus":    aws.StringValue(event.ResourceStatus),
+			"elapsed":           resource.Elapsed.String(),
+			"expected":          resource.Expected.String(),
+		})
+	}
+}
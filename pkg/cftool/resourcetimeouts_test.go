@@ -0,0 +1,108 @@
+package cftool
+
+import (
+	"bytes"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"testing"
+	"time"
+)
+
+func TestParseResourceTimeouts(t *testing.T) {
+	timeouts, err := ParseResourceTimeouts(map[string]string{
+		"AWS::RDS::*":                "40m",
+		"AWS::RDS::DBCluster":        "1h",
+		"AWS::CloudFront::*":         "30m",
+		"*":                          "10m",
+		"AWS::ElastiCache::CacheCl*": "20m",
+	})
+	require.NoError(t, err)
+
+	lookup := func(resourceType string) time.Duration {
+		timeout, ok := resourceTimeout(timeouts, resourceType)
+		require.True(t, ok, resourceType)
+		return timeout
+	}
+
+	require.Equal(t, 40*time.Minute, lookup("AWS::RDS::DBInstance"))
+	require.Equal(t, 1*time.Hour, lookup("AWS::RDS::DBCluster"))
+	require.Equal(t, 30*time.Minute, lookup("AWS::CloudFront::Distribution"))
+	require.Equal(t, 20*time.Minute, lookup("AWS::ElastiCache::CacheCluster"))
+	require.Equal(t, 10*time.Minute, lookup("AWS::SQS::Queue"))
+
+	_, ok := resourceTimeout(map[string]time.Duration{"AWS::RDS::*": time.Minute}, "AWS::SQS::Queue")
+	require.False(t, ok)
+
+	_, err = ParseResourceTimeouts(map[string]string{"AWS::RDS::*": "soon"})
+	require.EqualError(t, err, `invalid timeout "soon" for AWS::RDS::*`)
+
+	_, err = ParseResourceTimeouts(map[string]string{"AWS::RDS::[": "1m"})
+	require.EqualError(t, err, `invalid resource type "AWS::RDS::["`)
+}
+
+func TestResourceWatch(t *testing.T) {
+	// CloudFormation's clock is ahead of the local one, which doesn't
+	// matter, since time is reckoned from the first event.
+	local := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	server := local.Add(7 * time.Minute)
+
+	event := func(id string, resourceType string, status string, at time.Time) *cf.StackEvent {
+		return &cf.StackEvent{
+			StackId:            aws.String("stack-id"),
+			LogicalResourceId:  aws.String(id),
+			PhysicalResourceId: aws.String(id + "-physical"),
+			ResourceType:       aws.String(resourceType),
+			ResourceStatus:     aws.String(status),
+			Timestamp:          aws.Time(at),
+		}
+	}
+
+	watch := newResourceWatch(map[string]time.Duration{
+		"AWS::RDS::*": 40 * time.Minute,
+		"*":           10 * time.Minute,
+	})
+
+	watch.observe(&cf.StackEvent{
+		StackId:            aws.String("stack-id"),
+		LogicalResourceId:  aws.String("app"),
+		PhysicalResourceId: aws.String("stack-id"),
+		ResourceType:       aws.String("AWS::CloudFormation::Stack"),
+		ResourceStatus:     aws.String("UPDATE_IN_PROGRESS"),
+		Timestamp:          aws.Time(server),
+	}, local)
+	watch.observe(event("Database", "AWS::RDS::DBInstance", "CREATE_IN_PROGRESS", server), local)
+	watch.observe(event("Queue", "AWS::SQS::Queue", "CREATE_IN_PROGRESS", server), local)
+	watch.observe(event("Topic", "AWS::SNS::Topic", "CREATE_IN_PROGRESS", server), local)
+	watch.observe(event("Topic", "AWS::SNS::Topic", "CREATE_COMPLETE", server.Add(time.Minute)), local.Add(time.Minute))
+
+	// A second event in the same status doesn't restart the clock.
+	watch.observe(event("Queue", "AWS::SQS::Queue", "CREATE_IN_PROGRESS", server.Add(5*time.Minute)), local.Add(5*time.Minute))
+	require.Empty(t, watch.slow(local.Add(5*time.Minute)))
+
+	// The database is slow, but still within its window. The stack itself
+	// isn't watched.
+	slow := watch.slow(local.Add(30 * time.Minute))
+	require.Len(t, slow, 1)
+	require.Equal(t, "Queue", aws.StringValue(slow[0].Event.LogicalResourceId))
+	require.Equal(t, 10*time.Minute, slow[0].Expected)
+	require.Equal(t, 30*time.Minute, slow[0].Elapsed)
+
+	// Each resource is only warned about once.
+	require.Empty(t, watch.slow(local.Add(30*time.Minute)))
+
+	slow = watch.slow(local.Add(45 * time.Minute))
+	require.Len(t, slow, 1)
+	require.Equal(t, "Database", aws.StringValue(slow[0].Event.LogicalResourceId))
+
+	// Without timeouts, nothing is watched.
+	none := newResourceWatch(nil)
+	none.observe(event("Queue", "AWS::SQS::Queue", "CREATE_IN_PROGRESS", server), local)
+	require.Empty(t, none.slow(local.Add(time.Hour)))
+
+	buf := &bytes.Buffer{}
+	d := &Deployer{Deployment: &Deployment{StackName: "app"}}
+	d.warnSlowResources(pprint.NewProgress(buf, false), slow)
+	require.Contains(t, buf.String(), "AWS::RDS::DBInstance Database has been CREATE_IN_PROGRESS for 45m0s, longer than the expected 40m0s.")
+}
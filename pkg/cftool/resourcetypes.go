@@ -0,0 +1,98 @@
+package cftool
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrResourceTypes is returned when a change set changes resources of types
+// that the deployment doesn't allow.
+var ErrResourceTypes = errors.New("change set has resource types that are not allowed")
+
+// ParseResourceTypes checks a list of resource type patterns, such as
+// AWS::IAM::User or AWS::IAM::*, where * matches any part of a type name.
+func ParseResourceTypes(patterns []string) ([]string, error) {
+	result := []string{}
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return nil, errors.Errorf("invalid resource type %q", pattern)
+		}
+
+		result = append(result, pattern)
+	}
+
+	return result, nil
+}
+
+// matchResourceType returns the first pattern that matches the resource type.
+func matchResourceType(patterns []string, resourceType string) (string, bool) {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, resourceType); ok {
+			return pattern, true
+		}
+	}
+
+	return "", false
+}
+
+// resourceTypeViolations lists the resources that the change set adds or
+// modifies although their type is denied, or not allowed. Removing resources
+// is always allowed. A nil list of allowed types allows all.
+func (d *Deployment) resourceTypeViolations(chset *cf.DescribeChangeSetOutput) []string {
+	var violations []string
+
+	for _, change := range chset.Changes {
+		rc := change.ResourceChange
+		if rc == nil || aws.StringValue(rc.Action) == cf.ChangeActionRemove {
+			continue
+		}
+
+		resourceType := aws.StringValue(rc.ResourceType)
+		reason := ""
+
+		if pattern, ok := matchResourceType(d.DeniedResourceTypes, resourceType); ok {
+			reason = "denied by " + pattern
+		} else if _, ok := matchResourceType(d.AllowedResourceTypes, resourceType); !ok && d.AllowedResourceTypes != nil {
+			reason = "not in AllowedResourceTypes"
+		}
+
+		if reason != "" {
+			violations = append(violations,
+				fmt.Sprintf("%s %s: %s", resourceType, aws.StringValue(rc.LogicalResourceId), reason))
+		}
+	}
+
+	return violations
+}
+
+// checkResourceTypes refuses to execute a change set that changes resources
+// of types outside AllowedResourceTypes, or in DeniedResourceTypes, and lists
+// them.
+func (d *Deployer) checkResourceTypes(w io.Writer, chset *cf.DescribeChangeSetOutput) error {
+	violations := d.resourceTypeViolations(chset)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\n")
+	pprint.ColError.Fprintf(w, "Resource types not allowed:\n")
+	for _, violation := range violations {
+		fmt.Fprintf(w, "  %s\n", violation)
+	}
+
+	d.Log.Log(LevelError, d.StackName, "resource-types", map[string]interface{}{
+		"violations": violations,
+		"allowed":    d.AllowedResourceTypes,
+		"denied":     d.DeniedResourceTypes,
+	})
+
+	return errors.Wrapf(ErrResourceTypes, "%d resource(s)", len(violations))
+}
@@ -0,0 +1,58 @@
+package cftool
+
+import (
+	"bytes"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseResourceTypes(t *testing.T) {
+	types, err := ParseResourceTypes([]string{"AWS::IAM::*", " AWS::S3::Bucket"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"AWS::IAM::*", "AWS::S3::Bucket"}, types)
+
+	types, err = ParseResourceTypes([]string{})
+	require.NoError(t, err)
+	require.Equal(t, []string{}, types)
+
+	_, err = ParseResourceTypes([]string{"AWS::IAM::["})
+	require.EqualError(t, err, `invalid resource type "AWS::IAM::["`)
+}
+
+func TestDeployer_checkResourceTypes(t *testing.T) {
+	change := func(action string, resourceType string, logicalId string) *cf.Change {
+		return &cf.Change{ResourceChange: &cf.ResourceChange{
+			Action:            aws.String(action),
+			ResourceType:      aws.String(resourceType),
+			LogicalResourceId: aws.String(logicalId),
+		}}
+	}
+
+	chset := &cf.DescribeChangeSetOutput{Changes: []*cf.Change{
+		change(cf.ChangeActionAdd, "AWS::IAM::User", "User"),
+		change(cf.ChangeActionModify, "AWS::SNS::Topic", "Topic"),
+		change(cf.ChangeActionAdd, "AWS::S3::Bucket", "Bucket"),
+		change(cf.ChangeActionRemove, "AWS::IAM::Group", "Group"),
+	}}
+
+	w := &bytes.Buffer{}
+	d := NewDeployer(&fakeCloudFormation{}, &Deployment{StackName: "mystack"})
+	require.NoError(t, d.checkResourceTypes(w, chset))
+
+	d.DeniedResourceTypes = []string{"AWS::IAM::*"}
+	d.AllowedResourceTypes = []string{"AWS::S3::*", "AWS::IAM::User"}
+	err := d.checkResourceTypes(w, chset)
+	require.Equal(t, ErrResourceTypes, errors.Cause(err))
+	require.EqualError(t, err, "2 resource(s): change set has resource types that are not allowed")
+	require.Equal(t, "\nResource types not allowed:\n"+
+		"  AWS::IAM::User User: denied by AWS::IAM::*\n"+
+		"  AWS::SNS::Topic Topic: not in AllowedResourceTypes\n", w.String())
+
+	// Removing resources is always allowed.
+	d.AllowedResourceTypes = []string{}
+	chset.Changes = chset.Changes[3:]
+	require.NoError(t, d.checkResourceTypes(w, chset))
+}
@@ -0,0 +1,141 @@
+package cftool
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cftool/pkg/pprint"
+	"io"
+	"strings"
+	"time"
+)
+
+// ContinueRollback continues the rollback of a stack in UPDATE_ROLLBACK_FAILED,
+// which can't be updated otherwise. CloudFormation doesn't roll back the
+// resources in skip, given by logical id, or NestedStack.LogicalId for those of
+// nested stacks, but marks them as rolled back all the same. As that may leave
+// them inconsistent with the template, cftool asks before skipping any.
+func (d *Deployer) ContinueRollback(c context.Context, w io.Writer, skip []string) error {
+	pprint.Field(w, "StackName", d.StackName)
+
+	stack, err := d.findStack()
+	if err != nil {
+		return errors.Wrapf(err, "describe stack %s", d.StackName)
+	} else if stack == nil {
+		return errors.Errorf("stack %s does not exist", d.StackName)
+	}
+
+	d.StackId = aws.StringValue(stack.StackId)
+	pprint.Field(w, "StackId", d.StackId)
+
+	if status := aws.StringValue(stack.StackStatus); status != cf.StackStatusUpdateRollbackFailed {
+		return errors.Errorf("stack %s is %s, not %s", d.StackName, status, cf.StackStatusUpdateRollbackFailed)
+	}
+
+	if len(skip) > 0 {
+		if err := d.checkResourcesToSkip(skip); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "\n")
+		for _, id := range skip {
+			pprint.Warningf(w, "%s will not be rolled back, but marked as if it had been. "+
+				"It may be left inconsistent with the template, and need to be fixed by hand.", id)
+		}
+
+		d.Log.Log(LevelWarning, d.StackName, "skip-resources", map[string]interface{}{"resources": skip})
+
+		if !d.Yes {
+			if err := d.confirm(w, false, "\nContinue rollback, skipping %d resource(s)?", len(skip)); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\n")
+
+	input := &cf.ContinueUpdateRollbackInput{StackName: d.stackRef()}
+	if len(skip) > 0 {
+		input.ResourcesToSkip = aws.StringSlice(skip)
+	}
+
+	since := time.Now()
+	if _, err := d.client.ContinueUpdateRollbackWithContext(c, input); err != nil {
+		return errors.Wrap(err, "continue update rollback")
+	}
+
+	stack, err = d.monitorStackUpdate(c, w, since)
+	if err != nil {
+		return errors.Wrap(err, "monitor stack rollback")
+	}
+
+	d.FinalStatus = StackStatus(*stack.StackStatus)
+	if d.FinalStatus != cf.StackStatusUpdateRollbackComplete {
+		return d.stackFailed(w, d.FinalStatus)
+	}
+
+	return nil
+}
+
+// checkResourcesToSkip checks that the resources exist in the stack, or its
+// nested stacks, and that they failed to roll back, which are the only ones
+// CloudFormation can skip.
+func (d *Deployer) checkResourcesToSkip(skip []string) error {
+	for _, id := range skip {
+		path := strings.Split(id, ".")
+		stackName := d.StackName
+		var resource *cf.StackResourceSummary
+
+		for i, logicalId := range path {
+			if i > 0 {
+				if aws.StringValue(resource.ResourceType) != "AWS::CloudFormation::Stack" {
+					return errors.Errorf("cannot skip %s: %s is not a nested stack", id, strings.Join(path[:i], "."))
+				}
+
+				stackName = aws.StringValue(resource.PhysicalResourceId)
+			}
+
+			var err error
+			resource, err = d.findStackResource(stackName, logicalId)
+			if err != nil {
+				return err
+			} else if resource == nil {
+				return errors.Errorf("cannot skip %s: no resource %s in stack %s", id, logicalId, stackName)
+			}
+		}
+
+		if status := aws.StringValue(resource.ResourceStatus); status != cf.ResourceStatusUpdateFailed {
+			return errors.Errorf("cannot skip %s: it is %s, and only resources in %s can be skipped",
+				id, status, cf.ResourceStatusUpdateFailed)
+		}
+	}
+
+	return nil
+}
+
+// findStackResource returns the resource of the stack with the logical id, or
+// nil if there is none.
+func (d *Deployer) findStackResource(stackName string, logicalId string) (*cf.StackResourceSummary, error) {
+	var result *cf.StackResourceSummary
+
+	err := d.client.ListStackResourcesPages(
+		&cf.ListStackResourcesInput{StackName: aws.String(stackName)},
+		func(page *cf.ListStackResourcesOutput, lastPage bool) bool {
+			for _, resource := range page.StackResourceSummaries {
+				if aws.StringValue(resource.LogicalResourceId) == logicalId {
+					result = resource
+					return false
+				}
+			}
+
+			return true
+		})
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "list resources of stack %s", stackName)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,79 @@
+package cftool
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestDeployer_ContinueRollback(t *testing.T) {
+	resource := func(id string, resourceType string, status string) *cf.StackResourceSummary {
+		return &cf.StackResourceSummary{
+			LogicalResourceId:  aws.String(id),
+			PhysicalResourceId: aws.String(id + "-physical"),
+			ResourceType:       aws.String(resourceType),
+			ResourceStatus:     aws.String(status),
+		}
+	}
+
+	newDeployer := func(statuses ...string) (*Deployer, *fakeCloudFormation) {
+		api := &fakeCloudFormation{
+			statuses: statuses,
+			resources: map[string][]*cf.StackResourceSummary{
+				"mystack": {
+					resource("Queue", "AWS::SQS::Queue", cf.ResourceStatusUpdateFailed),
+					resource("Topic", "AWS::SNS::Topic", cf.ResourceStatusUpdateComplete),
+					resource("Network", "AWS::CloudFormation::Stack", cf.ResourceStatusUpdateFailed),
+				},
+				"Network-physical": {
+					resource("Vpc", "AWS::EC2::VPC", cf.ResourceStatusUpdateFailed),
+				},
+			},
+		}
+
+		d := NewDeployer(api, &Deployment{StackName: "mystack"})
+		d.Yes = true
+		d.Unattended = true
+		return d, api
+	}
+
+	w := &strings.Builder{}
+	d, api := newDeployer(cf.StackStatusUpdateRollbackFailed, cf.StackStatusUpdateRollbackComplete)
+	require.NoError(t, d.ContinueRollback(context.Background(), w, []string{"Queue", "Network.Vpc"}))
+	require.Len(t, api.continues, 1)
+	require.Equal(t, []string{"Queue", "Network.Vpc"}, aws.StringValueSlice(api.continues[0].ResourcesToSkip))
+	require.Contains(t, w.String(), "WARNING! Network.Vpc will not be rolled back, but marked as if it had been.")
+
+	// Without resources to skip, nothing needs confirming.
+	d, api = newDeployer(cf.StackStatusUpdateRollbackFailed, cf.StackStatusUpdateRollbackComplete)
+	d.Yes = false
+	require.NoError(t, d.ContinueRollback(context.Background(), w, nil))
+	require.Nil(t, api.continues[0].ResourcesToSkip)
+
+	d, _ = newDeployer(cf.StackStatusUpdateRollbackFailed)
+	d.Yes = false
+	require.Equal(t, ErrNoConfirmation, d.ContinueRollback(context.Background(), w, []string{"Queue"}))
+
+	// The resources must exist and have failed.
+	for skip, expect := range map[string]string{
+		"Bucket":      "cannot skip Bucket: no resource Bucket in stack mystack",
+		"Topic":       "cannot skip Topic: it is UPDATE_COMPLETE, and only resources in UPDATE_FAILED can be skipped",
+		"Queue.Vpc":   "cannot skip Queue.Vpc: Queue is not a nested stack",
+		"Network.Igw": "cannot skip Network.Igw: no resource Igw in stack Network-physical",
+	} {
+		d, api = newDeployer(cf.StackStatusUpdateRollbackFailed)
+		require.EqualError(t, d.ContinueRollback(context.Background(), w, []string{skip}), expect)
+		require.Empty(t, api.continues)
+	}
+
+	d, _ = newDeployer(cf.StackStatusUpdateComplete)
+	require.EqualError(t, d.ContinueRollback(context.Background(), w, nil), "stack mystack is UPDATE_COMPLETE, not UPDATE_ROLLBACK_FAILED")
+
+	// A rollback that fails again is reported as a failure.
+	d, _ = newDeployer(cf.StackStatusUpdateRollbackFailed, cf.StackStatusUpdateRollbackFailed)
+	err := d.ContinueRollback(context.Background(), w, nil)
+	require.EqualError(t, err, "stack mystack: UPDATE_ROLLBACK_FAILED: stack operation failed")
+}
@@ -0,0 +1,29 @@
+package cftool
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+)
+
+const maxStackNameLength = 128
+
+var stackNamePattern = regexp.MustCompile("^[a-zA-Z][-a-zA-Z0-9]*$")
+
+// Validate checks the name against CloudFormation's rules for stack names, so
+// that mistakes are caught before making any API calls.
+func (n StackName) Validate() error {
+	switch {
+	case n == "":
+		return errors.New("stack name is empty")
+	case len(n) > maxStackNameLength:
+		return errors.Errorf(
+			"stack name %s is %d characters long (at most %d allowed)",
+			n, len(n), maxStackNameLength)
+	case !stackNamePattern.MatchString(string(n)):
+		return errors.Errorf(
+			"stack name %s must start with a letter, and contain only letters, digits and hyphens",
+			n)
+	}
+
+	return nil
+}
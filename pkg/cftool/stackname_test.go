@@ -0,0 +1,20 @@
+package cftool
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestStackName_Validate(t *testing.T) {
+	valid := []StackName{"a", "live-mystack-us", "Stack1", StackName("a" + strings.Repeat("b", 127))}
+	invalid := []StackName{"", "1stack", "-stack", "my_stack", "my.stack", StackName(strings.Repeat("a", 129))}
+
+	for _, name := range valid {
+		require.NoError(t, name.Validate(), string(name))
+	}
+
+	for _, name := range invalid {
+		require.Error(t, name.Validate(), string(name))
+	}
+}
@@ -0,0 +1,478 @@
+package cftool
+
+import (
+	"fmt"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TemplateParameter is a parameter declared by a template.
+type TemplateParameter struct {
+	Type    string      `json:"Type"`
+	Default interface{} `json:"Default"`
+
+	AllowedValues         []interface{}   `json:"AllowedValues"`
+	AllowedPattern        string          `json:"AllowedPattern"`
+	MinLength             *templateNumber `json:"MinLength"`
+	MaxLength             *templateNumber `json:"MaxLength"`
+	MinValue              *templateNumber `json:"MinValue"`
+	MaxValue              *templateNumber `json:"MaxValue"`
+	ConstraintDescription string          `json:"ConstraintDescription"`
+
+	// NoEcho may be given as a boolean or a string.
+	NoEcho interface{} `json:"NoEcho"`
+}
+
+// templateNumber is a numeric attribute of a parameter, which templates may
+// give as either a number or a string.
+type templateNumber float64
+
+func (n *templateNumber) UnmarshalJSON(data []byte) error {
+	f, err := strconv.ParseFloat(strings.Trim(string(data), `"`), 64)
+	if err != nil {
+		return errors.Errorf("expected a number, got %s", data)
+	}
+
+	*n = templateNumber(f)
+	return nil
+}
+
+// DefaultValue returns the default of the parameter as CloudFormation would
+// pass it, if it has one.
+func (p *TemplateParameter) DefaultValue() (string, bool) {
+	switch v := p.Default.(type) {
+	case nil:
+		return "", false
+	case []interface{}:
+		// A list default is given as a YAML sequence, but passed like any
+		// other list parameter.
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = fmt.Sprint(item)
+		}
+		return strings.Join(values, ","), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// IsNoEcho reports whether CloudFormation masks the value of the parameter.
+func (p *TemplateParameter) IsNoEcho() bool {
+	return strings.EqualFold(fmt.Sprint(p.NoEcho), "true")
+}
+
+// ParseTemplateParameters reads the parameters declared by a JSON or YAML
+// template. Intrinsic function tags such as !Ref are not interpreted, which is
+// fine since they can't appear in parameter declarations anyway.
+func ParseTemplateParameters(body []byte) (map[string]*TemplateParameter, error) {
+	var template struct {
+		Parameters map[string]*TemplateParameter `json:"Parameters"`
+	}
+
+	if err := yaml.Unmarshal(body, &template); err != nil {
+		return nil, errors.Wrap(err, "parse template")
+	}
+
+	return template.Parameters, nil
+}
+
+// ParameterNames returns the names of the parameters in a stable order.
+func ParameterNames(params map[string]*TemplateParameter) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// FillDefaults sets parameters that have a default in the template, but no
+// explicit value, to that default. This makes the effective value visible in
+// the change set.
+func (d *Deployment) FillDefaults() error {
+	params, err := ParseTemplateParameters(d.TemplateBody)
+	if err != nil {
+		return err
+	}
+
+	if d.Parameters == nil {
+		d.Parameters = make(map[string]string)
+	}
+
+	for name, param := range params {
+		if _, ok := d.Parameters[name]; ok {
+			continue
+		}
+
+		if value, ok := param.DefaultValue(); ok {
+			d.Parameters[name] = value
+		}
+	}
+
+	return nil
+}
+
+// SeedParameters sets the parameters that the template declares, but that
+// have no explicit value, from values. Other values are ignored. The
+// parameters are copied first, as they may be shared with other deployments.
+func (d *Deployment) SeedParameters(values map[string]string) error {
+	params, err := ParseTemplateParameters(d.TemplateBody)
+	if err != nil {
+		return err
+	}
+
+	seeded := make(map[string]string)
+	for name, value := range d.Parameters {
+		seeded[name] = value
+	}
+
+	for name := range params {
+		if _, ok := seeded[name]; ok {
+			continue
+		}
+
+		if value, ok := values[name]; ok {
+			seeded[name] = value
+		}
+	}
+
+	d.Parameters = seeded
+	return nil
+}
+
+// Where the effective value of a parameter comes from.
+const (
+	ParameterExplicit   = "explicit"
+	ParameterDefault    = "default"
+	ParameterMissing    = "missing"
+	ParameterUndeclared = "undeclared"
+)
+
+// ResolvedParameter is the value a parameter will take when deployed.
+type ResolvedParameter struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// ResolveParameters lists the parameters of the template with their effective
+// values, followed by any explicit values for parameters the template doesn't
+// declare.
+func (d *Deployment) ResolveParameters() ([]ResolvedParameter, error) {
+	params, err := ParseTemplateParameters(d.TemplateBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []ResolvedParameter
+
+	for _, name := range ParameterNames(params) {
+		resolved := ResolvedParameter{Name: name, Source: ParameterMissing}
+
+		if value, ok := d.Parameters[name]; ok {
+			resolved.Value, resolved.Source = value, ParameterExplicit
+		} else if value, ok := params[name].DefaultValue(); ok {
+			resolved.Value, resolved.Source = value, ParameterDefault
+		}
+
+		result = append(result, resolved)
+	}
+
+	var undeclared []string
+	for name := range d.Parameters {
+		if _, ok := params[name]; !ok {
+			undeclared = append(undeclared, name)
+		}
+	}
+
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		result = append(result, ResolvedParameter{
+			Name:   name,
+			Value:  d.Parameters[name],
+			Source: ParameterUndeclared,
+		})
+	}
+
+	return result, nil
+}
+
+// Check validates a value against the constraints of the parameter, as
+// CloudFormation would when creating a change set.
+func (p *TemplateParameter) Check(value string) error {
+	if strings.HasPrefix(p.Type, "AWS::SSM::") {
+		// The value names an SSM parameter, whose value is not known here.
+		return nil
+	}
+
+	if err := p.check(value); err != nil {
+		if p.ConstraintDescription != "" {
+			return errors.Errorf("%v (%s)", err, p.ConstraintDescription)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (p *TemplateParameter) check(value string) error {
+	if len(p.AllowedValues) > 0 {
+		allowed := make([]string, len(p.AllowedValues))
+		for i, v := range p.AllowedValues {
+			allowed[i] = fmt.Sprint(v)
+		}
+
+		found := false
+		for _, v := range allowed {
+			found = found || v == value
+		}
+
+		if !found {
+			return errors.Errorf("value %q is not one of AllowedValues [%s]", value, strings.Join(allowed, ", "))
+		}
+	}
+
+	if p.AllowedPattern != "" {
+		// CloudFormation requires the whole value to match.
+		re, err := regexp.Compile("^(?:" + p.AllowedPattern + ")$")
+		if err != nil {
+			return errors.Wrapf(err, "AllowedPattern %s", p.AllowedPattern)
+		}
+
+		if !re.MatchString(value) {
+			return errors.Errorf("value %q does not match AllowedPattern %s", value, p.AllowedPattern)
+		}
+	}
+
+	length := templateNumber(utf8.RuneCountInString(value))
+
+	if p.MinLength != nil && length < *p.MinLength {
+		return errors.Errorf("value %q is shorter than MinLength %v", value, *p.MinLength)
+	}
+
+	if p.MaxLength != nil && length > *p.MaxLength {
+		return errors.Errorf("value %q is longer than MaxLength %v", value, *p.MaxLength)
+	}
+
+	var numbers []string
+	switch p.Type {
+	case "Number":
+		numbers = []string{value}
+	case "List<Number>":
+		numbers = strings.Split(value, ",")
+	}
+
+	for _, s := range numbers {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return errors.Errorf("value %q is not a number", s)
+		}
+
+		if p.MinValue != nil && templateNumber(f) < *p.MinValue {
+			return errors.Errorf("value %s is less than MinValue %v", s, *p.MinValue)
+		}
+
+		if p.MaxValue != nil && templateNumber(f) > *p.MaxValue {
+			return errors.Errorf("value %s is greater than MaxValue %v", s, *p.MaxValue)
+		}
+	}
+
+	return nil
+}
+
+// ValidateParameters checks the explicit parameter values against the
+// constraints declared by the template, and reports every value that
+// violates them.
+func (d *Deployment) ValidateParameters() error {
+	params, err := ParseTemplateParameters(d.TemplateBody)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+
+	for _, name := range ParameterNames(params) {
+		value, ok := d.Parameters[name]
+		if !ok {
+			continue
+		}
+
+		if err := params[name].Check(value); err != nil {
+			problems = append(problems, fmt.Sprintf("parameter %s: %v", name, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// TemplateResource is a resource declared by a template.
+type TemplateResource struct {
+	Type           string                 `json:"Type"`
+	Properties     map[string]interface{} `json:"Properties"`
+	DeletionPolicy interface{}            `json:"DeletionPolicy"`
+}
+
+// Deletion policies of template resources. DeletionPolicyConditional stands
+// for a policy given by an intrinsic function, which can't be resolved
+// locally.
+const (
+	DeletionPolicyDelete               = "Delete"
+	DeletionPolicySnapshot             = "Snapshot"
+	DeletionPolicyRetain               = "Retain"
+	DeletionPolicyRetainExceptOnCreate = "RetainExceptOnCreate"
+	DeletionPolicyConditional          = "Conditional"
+)
+
+// EffectiveDeletionPolicy returns the deletion policy CloudFormation applies
+// to the resource when its stack is deleted. Database clusters, and database
+// instances outside of a cluster, are snapshotted by default.
+func (r *TemplateResource) EffectiveDeletionPolicy() string {
+	switch policy := r.DeletionPolicy.(type) {
+	case string:
+		if policy != "" {
+			return policy
+		}
+	case nil:
+	default:
+		return DeletionPolicyConditional
+	}
+
+	switch r.Type {
+	case "AWS::RDS::DBCluster":
+		return DeletionPolicySnapshot
+	case "AWS::RDS::DBInstance":
+		if _, ok := r.Properties["DBClusterIdentifier"]; !ok {
+			return DeletionPolicySnapshot
+		}
+	}
+
+	return DeletionPolicyDelete
+}
+
+// DeletionPolicies groups the logical ids of the resources declared by a
+// template by their effective deletion policy.
+func DeletionPolicies(body []byte) (map[string][]string, error) {
+	resources, err := ParseTemplateResources(body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string][]string{}
+	for id, resource := range resources {
+		policy := resource.EffectiveDeletionPolicy()
+		result[policy] = append(result[policy], id)
+	}
+
+	for _, ids := range result {
+		sort.Strings(ids)
+	}
+
+	return result, nil
+}
+
+// ParseTemplateResources reads the resources declared by a JSON or YAML
+// template, by logical id. Intrinsic function tags such as !Ref are dropped,
+// leaving only their arguments.
+func ParseTemplateResources(body []byte) (map[string]*TemplateResource, error) {
+	var template struct {
+		Resources map[string]*TemplateResource `json:"Resources"`
+	}
+
+	if err := yaml.Unmarshal(body, &template); err != nil {
+		return nil, errors.Wrap(err, "parse template")
+	}
+
+	return template.Resources, nil
+}
+
+// MaxResources is the number of resources CloudFormation allows in a stack.
+const MaxResources = 500
+
+// ResourceCount returns the number of resources the template declares.
+func (d *Deployment) ResourceCount() (int, error) {
+	resources, err := ParseTemplateResources(d.TemplateBody)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(resources), nil
+}
+
+// CheckResources verifies that the template declares resources with the given
+// logical ids.
+func (d *Deployment) CheckResources(logicalIds []string) error {
+	resources, err := ParseTemplateResources(d.TemplateBody)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range logicalIds {
+		if _, ok := resources[id]; !ok {
+			return errors.Errorf("template has no resource %s", id)
+		}
+	}
+
+	return nil
+}
+
+// untaggedResourceTypes are resource types that don't receive the tags of the
+// stack, either because they can't be tagged at all, or because CloudFormation
+// doesn't propagate stack tags to them. The list is not exhaustive.
+var untaggedResourceTypes = map[string]bool{
+	"AWS::ApiGateway::Deployment":                true,
+	"AWS::ApiGateway::Method":                    true,
+	"AWS::ApiGateway::Resource":                  true,
+	"AWS::ApplicationAutoScaling::ScalingPolicy": true,
+	"AWS::AutoScaling::LaunchConfiguration":      true,
+	"AWS::CloudFormation::CustomResource":        true,
+	"AWS::CloudFormation::WaitConditionHandle":   true,
+	"AWS::EC2::LaunchTemplate":                   true,
+	"AWS::EC2::Route":                            true,
+	"AWS::EC2::SecurityGroupEgress":              true,
+	"AWS::EC2::SecurityGroupIngress":             true,
+	"AWS::EC2::SubnetRouteTableAssociation":      true,
+	"AWS::EC2::VPCGatewayAttachment":             true,
+	"AWS::ElasticLoadBalancingV2::ListenerRule":  true,
+	"AWS::IAM::InstanceProfile":                  true,
+	"AWS::IAM::ManagedPolicy":                    true,
+	"AWS::IAM::Policy":                           true,
+	"AWS::Lambda::EventSourceMapping":            true,
+	"AWS::Lambda::Permission":                    true,
+	"AWS::Lambda::Version":                       true,
+	"AWS::Logs::SubscriptionFilter":              true,
+	"AWS::S3::BucketPolicy":                      true,
+	"AWS::SNS::Subscription":                     true,
+	"AWS::SNS::TopicPolicy":                      true,
+	"AWS::SQS::QueuePolicy":                      true,
+}
+
+// UntaggedResources returns the logical ids of the resources in the template
+// that won't receive the tags of the stack, so they need to be tagged in the
+// template if they can be tagged at all.
+func (d *Deployment) UntaggedResources() ([]string, error) {
+	resources, err := ParseTemplateResources(d.TemplateBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for id, resource := range resources {
+		if untaggedResourceTypes[resource.Type] || strings.HasPrefix(resource.Type, "Custom::") {
+			result = append(result, id)
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
@@ -0,0 +1,238 @@
+package cftool
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const parametersTemplate = `
+Parameters:
+  Name:
+    Type: String
+  Count:
+    Type: Number
+    Default: 3
+  Subnets:
+    Type: CommaDelimitedList
+    Default: [a, b]
+  Env:
+    Type: String
+    Default: dev
+Resources:
+  Topic:
+    Type: AWS::SNS::Topic
+    Properties:
+      TopicName: !Ref Name
+`
+
+func TestParseTemplateParameters(t *testing.T) {
+	params, err := ParseTemplateParameters([]byte(parametersTemplate))
+	require.NoError(t, err)
+	require.Equal(t, []string{"Count", "Env", "Name", "Subnets"}, ParameterNames(params))
+	require.Equal(t, "Number", params["Count"].Type)
+
+	_, ok := params["Name"].DefaultValue()
+	require.False(t, ok)
+
+	value, ok := params["Count"].DefaultValue()
+	require.True(t, ok)
+	require.Equal(t, "3", value)
+
+	value, _ = params["Subnets"].DefaultValue()
+	require.Equal(t, "a,b", value)
+
+	params, err = ParseTemplateParameters([]byte(`{"Resources": {}}`))
+	require.NoError(t, err)
+	require.Empty(t, params)
+}
+
+func TestDeployment_FillDefaults(t *testing.T) {
+	d := Deployment{
+		TemplateBody: []byte(parametersTemplate),
+		Parameters:   map[string]string{"Name": "x", "Env": "prod"},
+	}
+
+	require.NoError(t, d.FillDefaults())
+	require.Equal(t, map[string]string{
+		"Name":    "x",
+		"Env":     "prod",
+		"Count":   "3",
+		"Subnets": "a,b",
+	}, d.Parameters)
+}
+
+func TestDeployment_ResolveParameters(t *testing.T) {
+	d := Deployment{
+		TemplateBody: []byte(parametersTemplate),
+		Parameters:   map[string]string{"Env": "prod", "Extra": "x"},
+	}
+
+	params, err := d.ResolveParameters()
+	require.NoError(t, err)
+	require.Equal(t, []ResolvedParameter{
+		{"Count", "3", ParameterDefault},
+		{"Env", "prod", ParameterExplicit},
+		{"Name", "", ParameterMissing},
+		{"Subnets", "a,b", ParameterDefault},
+		{"Extra", "x", ParameterUndeclared},
+	}, params)
+}
+
+func TestTemplateParameter_Check(t *testing.T) {
+	params, err := ParseTemplateParameters([]byte(`
+Parameters:
+  Env:
+    Type: String
+    AllowedValues: [dev, prod]
+  Name:
+    Type: String
+    AllowedPattern: "[a-z]+"
+    MinLength: "2"
+    MaxLength: 5
+    ConstraintDescription: lowercase letters only
+  Count:
+    Type: Number
+    MinValue: 1
+    MaxValue: 10
+  Ports:
+    Type: List<Number>
+    MaxValue: 65535
+  Ssm:
+    Type: AWS::SSM::Parameter::Value<String>
+    AllowedPattern: "x"
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		Name  string
+		Value string
+		Error string
+	}{
+		{"Env", "prod", ""},
+		{"Env", "test", `value "test" is not one of AllowedValues [dev, prod]`},
+		{"Name", "abc", ""},
+		{"Name", "abc1", `value "abc1" does not match AllowedPattern [a-z]+ (lowercase letters only)`},
+		{"Name", "a", `value "a" is shorter than MinLength 2 (lowercase letters only)`},
+		{"Name", "abcdef", `value "abcdef" is longer than MaxLength 5 (lowercase letters only)`},
+		{"Count", "10", ""},
+		{"Count", "0", "value 0 is less than MinValue 1"},
+		{"Count", "ten", `value "ten" is not a number`},
+		{"Ports", "80,443", ""},
+		{"Ports", "80,70000", "value 70000 is greater than MaxValue 65535"},
+		{"Ssm", "/my/param", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name+"="+test.Value, func(t *testing.T) {
+			err := params[test.Name].Check(test.Value)
+			if test.Error == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, test.Error)
+			}
+		})
+	}
+}
+
+func TestDeployment_ValidateParameters(t *testing.T) {
+	d := Deployment{
+		TemplateBody: []byte(`
+Parameters:
+  A:
+    Type: Number
+  B:
+    Type: String
+    AllowedValues: [x]
+  C:
+    Type: String
+`),
+		Parameters: map[string]string{"A": "a", "B": "y", "C": "z"},
+	}
+
+	require.EqualError(t, d.ValidateParameters(),
+		`parameter A: value "a" is not a number; parameter B: value "y" is not one of AllowedValues [x]`)
+
+	d.Parameters = map[string]string{"A": "1", "B": "x"}
+	require.NoError(t, d.ValidateParameters())
+}
+
+func TestDeployment_CheckResources(t *testing.T) {
+	d := Deployment{TemplateBody: []byte(parametersTemplate)}
+	require.NoError(t, d.CheckResources([]string{"Topic"}))
+	require.EqualError(t, d.CheckResources([]string{"Topic", "Bucket"}), "template has no resource Bucket")
+}
+
+func TestDeployment_UntaggedResources(t *testing.T) {
+	d := Deployment{TemplateBody: []byte(`
+Resources:
+  Topic:
+    Type: AWS::SNS::Topic
+  Subscription:
+    Type: AWS::SNS::Subscription
+  Lookup:
+    Type: Custom::Lookup
+  Policy:
+    Type: AWS::SNS::TopicPolicy
+`)}
+
+	untagged, err := d.UntaggedResources()
+	require.NoError(t, err)
+	require.Equal(t, []string{"Lookup", "Policy", "Subscription"}, untagged)
+}
+
+func TestDeployment_SeedParameters(t *testing.T) {
+	explicit := map[string]string{"Environment": "test"}
+	d := Deployment{
+		TemplateBody: []byte("Parameters:\n  Environment: {Type: String}\n  InstanceType: {Type: String}\n"),
+		Parameters:   explicit,
+	}
+
+	require.NoError(t, d.SeedParameters(map[string]string{
+		"Environment":  "live",
+		"InstanceType": "m5.large",
+		"Retired":      "x",
+	}))
+	require.Equal(t, map[string]string{"Environment": "test", "InstanceType": "m5.large"}, d.Parameters)
+	require.Equal(t, map[string]string{"Environment": "test"}, explicit)
+}
+
+func TestDeployment_ResourceCount(t *testing.T) {
+	d := &Deployment{TemplateBody: []byte("Resources:\n  Queue: {Type: AWS::SQS::Queue}\n  Topic: {Type: AWS::SNS::Topic}\n")}
+	count, err := d.ResourceCount()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	d = &Deployment{TemplateBody: []byte("Description: empty\n")}
+	count, err = d.ResourceCount()
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+}
+
+func TestDeletionPolicies(t *testing.T) {
+	policies, err := DeletionPolicies([]byte(`
+Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+  Bucket:
+    Type: AWS::S3::Bucket
+    DeletionPolicy: Retain
+  Logs:
+    Type: AWS::S3::Bucket
+    DeletionPolicy: !If [IsProduction, Retain, Delete]
+  Database:
+    Type: AWS::RDS::DBInstance
+  Cluster:
+    Type: AWS::RDS::DBCluster
+  Member:
+    Type: AWS::RDS::DBInstance
+    Properties:
+      DBClusterIdentifier: !Ref Cluster
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		DeletionPolicyDelete:      {"Member", "Queue"},
+		DeletionPolicySnapshot:    {"Cluster", "Database"},
+		DeletionPolicyRetain:      {"Bucket"},
+		DeletionPolicyConditional: {"Logs"},
+	}, policies)
+}
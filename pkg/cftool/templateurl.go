@@ -0,0 +1,73 @@
+package cftool
+
+import (
+	"github.com/pkg/errors"
+	"net/url"
+	"strings"
+)
+
+// TemplateURL is the location of a template in S3.
+type TemplateURL struct {
+	Bucket string
+	Key    string
+
+	// URL is the HTTPS URL of the object, as CloudFormation expects it.
+	URL string
+}
+
+// IsTemplateURL reports whether a template path is a URL rather than a file.
+func IsTemplateURL(path string) bool {
+	return strings.Contains(path, "://")
+}
+
+// ParseTemplateURL parses an s3://bucket/key URL, or an HTTPS URL of an S3
+// object in either virtual-hosted or path style.
+func ParseTemplateURL(s string) (*TemplateURL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse template url %s", s)
+	}
+
+	key := strings.TrimPrefix(u.Path, "/")
+
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" || key == "" {
+			return nil, errors.Errorf("template url %s: expected s3://bucket/key", s)
+		}
+
+		return &TemplateURL{
+			Bucket: u.Host,
+			Key:    key,
+			URL:    "https://" + u.Host + ".s3.amazonaws.com/" + key,
+		}, nil
+
+	case "https":
+		host := u.Hostname()
+		if !strings.HasSuffix(host, ".amazonaws.com") {
+			return nil, errors.Errorf("template url %s: not an S3 url", s)
+		}
+
+		result := &TemplateURL{URL: s}
+
+		if strings.HasPrefix(host, "s3.") || strings.HasPrefix(host, "s3-") {
+			// path style: https://s3.region.amazonaws.com/bucket/key
+			parts := strings.SplitN(key, "/", 2)
+			if len(parts) == 2 {
+				result.Bucket, result.Key = parts[0], parts[1]
+			}
+		} else if i := strings.Index(host, ".s3"); i > 0 {
+			// virtual-hosted style: https://bucket.s3.region.amazonaws.com/key
+			result.Bucket, result.Key = host[:i], key
+		}
+
+		if result.Bucket == "" || result.Key == "" {
+			return nil, errors.Errorf("template url %s: not an S3 url", s)
+		}
+
+		return result, nil
+
+	default:
+		return nil, errors.Errorf("template url %s: unsupported scheme %q (expected s3 or https)", s, u.Scheme)
+	}
+}
@@ -0,0 +1,46 @@
+package cftool
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseTemplateURL(t *testing.T) {
+	tests := []struct {
+		URL    string
+		Bucket string
+		Key    string
+		HTTPS  string
+	}{
+		{"s3://mybucket/path/stack.yml", "mybucket", "path/stack.yml", "https://mybucket.s3.amazonaws.com/path/stack.yml"},
+		{"https://mybucket.s3.amazonaws.com/stack.yml", "mybucket", "stack.yml", "https://mybucket.s3.amazonaws.com/stack.yml"},
+		{"https://mybucket.s3.eu-west-1.amazonaws.com/a/stack.yml", "mybucket", "a/stack.yml", "https://mybucket.s3.eu-west-1.amazonaws.com/a/stack.yml"},
+		{"https://s3-eu-west-1.amazonaws.com/mybucket/stack.yml", "mybucket", "stack.yml", "https://s3-eu-west-1.amazonaws.com/mybucket/stack.yml"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.URL, func(t *testing.T) {
+			u, err := ParseTemplateURL(test.URL)
+			require.NoError(t, err)
+			require.Equal(t, test.Bucket, u.Bucket)
+			require.Equal(t, test.Key, u.Key)
+			require.Equal(t, test.HTTPS, u.URL)
+		})
+	}
+
+	for _, bad := range []string{
+		"http://mybucket.s3.amazonaws.com/stack.yml",
+		"ftp://example.com/stack.yml",
+		"s3://mybucket",
+		"https://example.com/stack.yml",
+		"https://s3.amazonaws.com/mybucket",
+	} {
+		t.Run(bad, func(t *testing.T) {
+			_, err := ParseTemplateURL(bad)
+			require.Error(t, err)
+		})
+	}
+
+	require.True(t, IsTemplateURL("s3://mybucket/stack.yml"))
+	require.False(t, IsTemplateURL("stack.yml"))
+}
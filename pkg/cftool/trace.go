@@ -0,0 +1,93 @@
+package cftool
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"time"
+)
+
+// Trace records where a deployment spends its time, and how often it polls
+// CloudFormation meanwhile, to tune poll intervals and spot throttling. A nil
+// Trace records nothing, so callers don't need to check.
+type Trace struct {
+	// ChangeSetWait is the time spent waiting for change sets to be created,
+	// and Monitor the time spent monitoring stack operations.
+	ChangeSetWait time.Duration
+	Monitor       time.Duration
+
+	// Calls counts the calls to DescribeStacks, DescribeStackEvents and
+	// DescribeChangeSet. Every page of events counts as a call.
+	Calls map[string]int
+}
+
+func (t *Trace) call(operation string) {
+	if t == nil {
+		return
+	}
+
+	if t.Calls == nil {
+		t.Calls = make(map[string]int)
+	}
+
+	t.Calls[operation]++
+}
+
+func (t *Trace) addChangeSetWait(d time.Duration) {
+	if t != nil {
+		t.ChangeSetWait += d
+	}
+}
+
+func (t *Trace) addMonitor(d time.Duration) {
+	if t != nil {
+		t.Monitor += d
+	}
+}
+
+// Fields describes the trace for the log, with durations in seconds.
+func (t *Trace) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"change_set_wait": t.ChangeSetWait.Seconds(),
+		"monitor":         t.Monitor.Seconds(),
+		"calls":           t.Calls,
+	}
+}
+
+// tracingClient counts the calls a Deployer polls CloudFormation with.
+type tracingClient struct {
+	cloudformationiface.CloudFormationAPI
+	trace *Trace
+}
+
+// traceCalls makes the Deployer count its calls in Trace, if set.
+func (d *Deployer) traceCalls() {
+	if _, ok := d.client.(*tracingClient); d.Trace != nil && !ok {
+		d.client = &tracingClient{CloudFormationAPI: d.client, trace: d.Trace}
+	}
+}
+
+func (c *tracingClient) DescribeStacks(input *cf.DescribeStacksInput) (*cf.DescribeStacksOutput, error) {
+	c.trace.call("DescribeStacks")
+	return c.CloudFormationAPI.DescribeStacks(input)
+}
+
+func (c *tracingClient) DescribeStackEventsPages(
+	input *cf.DescribeStackEventsInput,
+	fn func(*cf.DescribeStackEventsOutput, bool) bool,
+) error {
+	return c.CloudFormationAPI.DescribeStackEventsPages(input, func(page *cf.DescribeStackEventsOutput, lastPage bool) bool {
+		c.trace.call("DescribeStackEvents")
+		return fn(page, lastPage)
+	})
+}
+
+func (c *tracingClient) DescribeChangeSetWithContext(
+	ctx aws.Context,
+	input *cf.DescribeChangeSetInput,
+	opts ...request.Option,
+) (*cf.DescribeChangeSetOutput, error) {
+	c.trace.call("DescribeChangeSet")
+	return c.CloudFormationAPI.DescribeChangeSetWithContext(ctx, input, opts...)
+}
@@ -0,0 +1,134 @@
+package manifest
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// JSONSchema describes the manifest format as a JSON Schema, for editors to
+// complete and check manifests with. It is generated from the types manifests
+// are read into, so that it follows them as they change. Constraints that the
+// types can't express are given by jsonschema field tags: "required", an
+// "enum" of values separated by |, or a "pattern". Fields tagged "-" are left
+// out.
+func JSONSchema() ([]byte, error) {
+	g := &schemaGenerator{definitions: make(map[string]interface{})}
+
+	root := g.object(reflect.TypeOf(Manifest{}))
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["title"] = "cftool manifest"
+	root["definitions"] = g.definitions
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+// schemaAlternatives is implemented by types whose fields may only be given in
+// some combinations, each one a list of the fields it requires.
+type schemaAlternatives interface {
+	schemaAlternatives() [][]string
+}
+
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+// schema describes a type. Structs are described once among the definitions,
+// and referred to.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+
+	case reflect.Struct:
+		if _, ok := g.definitions[t.Name()]; !ok {
+			g.definitions[t.Name()] = nil
+			g.definitions[t.Name()] = g.object(t)
+		}
+
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	}
+
+	// Any value, for types that manifests don't use yet.
+	return map[string]interface{}{}
+}
+
+// object describes the fields of a struct as the properties of an object.
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Name
+
+		if tag := field.Tag.Get("json"); tag != "" {
+			name = strings.Split(tag, ",")[0]
+		}
+
+		tag := field.Tag.Get("jsonschema")
+		if field.PkgPath != "" || name == "-" || tag == "-" {
+			continue
+		}
+
+		property := g.schema(field.Type)
+
+		for _, option := range strings.Split(tag, ",") {
+			kv := strings.SplitN(option, "=", 2)
+
+			switch {
+			case kv[0] == "required":
+				required = append(required, name)
+			case kv[0] == "enum" && len(kv) == 2:
+				property["enum"] = strings.Split(kv[1], "|")
+			case kv[0] == "pattern" && len(kv) == 2 && field.Type.Kind() == reflect.Map:
+				property["additionalProperties"].(map[string]interface{})["pattern"] = kv[1]
+			case kv[0] == "pattern" && len(kv) == 2:
+				property["pattern"] = kv[1]
+			}
+		}
+
+		properties[name] = property
+	}
+
+	result := map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties":           properties,
+	}
+
+	if len(required) > 0 {
+		result["required"] = required
+	}
+
+	if alternatives, ok := reflect.Zero(t).Interface().(schemaAlternatives); ok {
+		var oneOf []interface{}
+		for _, fields := range alternatives.schemaAlternatives() {
+			oneOf = append(oneOf, map[string]interface{}{"required": fields})
+		}
+
+		result["oneOf"] = oneOf
+	}
+
+	return result
+}
@@ -0,0 +1,110 @@
+package manifest
+
+import (
+	"encoding/json"
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// schemaPaths lists the properties a JSON schema allows, as paths such as
+// Stacks[].Targets[].Tenant, following references to definitions.
+func schemaPaths(root map[string]interface{}) []string {
+	definitions, _ := root["definitions"].(map[string]interface{})
+	var paths []string
+
+	var walk func(schema map[string]interface{}, path string)
+	walk = func(schema map[string]interface{}, path string) {
+		if ref, ok := schema["$ref"].(string); ok {
+			schema = definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+		}
+
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			walk(items, path+"[]")
+		}
+
+		if values, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+			walk(values, path+".*")
+		}
+
+		for _, key := range []string{"oneOf", "$oneOf"} {
+			alternatives, _ := schema[key].([]interface{})
+			for _, alternative := range alternatives {
+				walk(alternative.(map[string]interface{}), path)
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, property := range properties {
+			name = strings.TrimPrefix(path+"."+name, ".")
+			paths = append(paths, name)
+			walk(property.(map[string]interface{}), name)
+		}
+	}
+
+	walk(root, "")
+
+	sort.Strings(paths)
+	result := paths[:0]
+	for i, path := range paths {
+		if i == 0 || path != paths[i-1] {
+			result = append(result, path)
+		}
+	}
+
+	return result
+}
+
+func TestJSONSchema(t *testing.T) {
+	generated, err := JSONSchema()
+	require.NoError(t, err)
+
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(generated, &schema))
+
+	// The schema follows what the manifest is validated against when it is
+	// read, so that editors accept the same manifests as cftool.
+	data, err := yaml.YAMLToJSON(manifestSchema)
+	require.NoError(t, err)
+
+	var validation map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &validation))
+	require.Equal(t, schemaPaths(validation), schemaPaths(schema))
+	require.Contains(t, schemaPaths(schema), "Stacks[].Targets[].Override.Parameters[].File")
+
+	paths, err := filepath.Glob("testdata/*-manifest.yml")
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		manifest, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, validateSchema(generated, manifest), path)
+	}
+
+	err = validateSchema(generated, []byte(`
+Version: "1.1"
+Stacks:
+  - Label: app
+    Default:
+      Confirm: sometimes
+      Parameters:
+        - Key: Name
+`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Confirm")
+	require.Contains(t, err.Error(), "Must validate one and only one schema")
+
+	err = validateSchema(generated, []byte(`
+Version: "1.1"
+Global:
+  ResourceTimeouts:
+    "AWS::RDS::*": soon
+`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Does not match pattern")
+}
@@ -1,8 +1,11 @@
 package manifest
 
 import (
+	"github.com/pkg/errors"
 	"github.com/tetratom/cftool/pkg/cftool"
 	"io/ioutil"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"text/template"
 )
@@ -13,24 +16,88 @@ type Global struct {
 	Constants map[string]string
 	Tags      map[string]string
 	Default   *Defaults
+
+	// StackNamePrefix and StackNameSuffix are added to every stack name. They
+	// can include substitutions (as Go templates).
+	StackNamePrefix string
+	StackNameSuffix string
+
+	// StackNamePattern is a regular expression that every stack name must
+	// match.
+	StackNamePattern string
+
+	// AllowedRegions, if not empty, are the only regions stacks may be
+	// deployed to.
+	AllowedRegions []string
+
+	// ResourceTimeouts are how long resources are expected to be in progress,
+	// by resource type pattern, e.g. {"AWS::RDS::*": "40m"}.
+	ResourceTimeouts map[string]string `jsonschema:"pattern=^\\s*([0-9]*\\.?[0-9]+(ns|us|ms|s|m|h))+\\s*$"`
 }
 
 type Tenant struct {
-	Label     string
+	Label     string `jsonschema:"required"`
 	Default   *Defaults
 	Constants map[string]string
 	Tags      map[string]string
 }
 
 type Stack struct {
-	Label   string
+	Label   string `jsonschema:"required"`
 	Default *Defaults
 	Targets []*Target
-	Tags    map[string]string
+
+	// Tags are not read from manifests yet.
+	Tags map[string]string `jsonschema:"-"`
+
+	// EnabledFor and DisabledFor restrict the tenants the stack is deployed
+	// for by default, even if it has targets for others.
+	EnabledFor  []string
+	DisabledFor []string
+
+	// DependsOn lists the labels of stacks that must be deployed first.
+	DependsOn []string
+}
+
+func (s *Stack) enabledFor(tenantLabel string) bool {
+	for _, label := range s.DisabledFor {
+		if label == tenantLabel {
+			return false
+		}
+	}
+
+	if len(s.EnabledFor) == 0 {
+		return true
+	}
+
+	for _, label := range s.EnabledFor {
+		if label == tenantLabel {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Account is an account that deploy --each-account deploys stacks to, by
+// assuming the role.
+type Account struct {
+	Id      string `jsonschema:"required,pattern=^[0-9]{12}$"`
+	Label   string
+	RoleArn string `jsonschema:"required"`
+}
+
+// Name is the label of the account, or its id if it has none.
+func (a *Account) Name() string {
+	if a.Label != "" {
+		return a.Label
+	}
+
+	return a.Id
 }
 
 type Target struct {
-	Tenant   string
+	Tenant   string `jsonschema:"required"`
 	Override *Defaults
 }
 
@@ -52,6 +119,29 @@ type Defaults struct {
 
 	// Protected deployments ignore the --yes flag.
 	Protected *bool
+
+	// Confirm is the confirmation policy for executing change sets: always,
+	// never or protected. It takes precedence over Protected.
+	Confirm string `jsonschema:"enum=always|never|protected"`
+
+	// AllowedCapabilities, if set, are the only capabilities the template may
+	// need, e.g. [none] or [IAM].
+	AllowedCapabilities []string
+
+	// RollbackAlarms are the names of CloudWatch alarms, in the account and
+	// region of the stack, that roll it back if they go off.
+	RollbackAlarms []string
+
+	// AllowedResourceTypes, if set, are the only resource types a change set
+	// may add or modify, and DeniedResourceTypes those it may not, e.g.
+	// [AWS::IAM::User] or [AWS::IAM::*].
+	AllowedResourceTypes []string
+	DeniedResourceTypes  []string
+
+	// ExpectedOutputs are the outputs the stack must have after a deployment,
+	// by key, with regular expressions their values must match, or "" for
+	// any value.
+	ExpectedOutputs map[string]string
 }
 
 func (d Defaults) MergeFrom(other *Defaults) Defaults {
@@ -69,6 +159,7 @@ func (d Defaults) MergeFrom(other *Defaults) Defaults {
 	add(&d.Region, &other.Region)
 	add(&d.Template, &other.Template)
 	add(&d.StackName, &other.StackName)
+	add(&d.Confirm, &other.Confirm)
 
 	for _, p := range other.Parameters {
 		d.Parameters = append(d.Parameters, p)
@@ -78,6 +169,26 @@ func (d Defaults) MergeFrom(other *Defaults) Defaults {
 		d.Protected = other.Protected
 	}
 
+	if other.AllowedCapabilities != nil {
+		d.AllowedCapabilities = other.AllowedCapabilities
+	}
+
+	if other.RollbackAlarms != nil {
+		d.RollbackAlarms = other.RollbackAlarms
+	}
+
+	if other.AllowedResourceTypes != nil {
+		d.AllowedResourceTypes = other.AllowedResourceTypes
+	}
+
+	if other.DeniedResourceTypes != nil {
+		d.DeniedResourceTypes = other.DeniedResourceTypes
+	}
+
+	if other.ExpectedOutputs != nil {
+		d.ExpectedOutputs = other.ExpectedOutputs
+	}
+
 	return d
 }
 
@@ -88,11 +199,46 @@ type Parameter struct {
 	Value string
 }
 
+// schemaAlternatives says that a parameter is either a file, or a key and a
+// value.
+func (Parameter) schemaAlternatives() [][]string {
+	return [][]string{{"File"}, {"Key", "Value"}}
+}
+
 type Manifest struct {
-	Version string
+	Version string `jsonschema:"required,enum=1.1"`
 	Global  Global
 	Tenants []*Tenant
 	Stacks  []*Stack
+
+	// Accounts are the accounts that deploy --each-account deploys to.
+	Accounts []*Account
+
+	// BaseDir is the directory that relative template and parameter file paths
+	// are resolved against. ReadFromFile sets it to that of the manifest; if
+	// empty, paths are relative to the working directory.
+	BaseDir string `json:"-"`
+
+	// BaseDirRequired makes relative paths an error while BaseDir is empty,
+	// for manifests that weren't read from a file, e.g. from stdin, and so
+	// have no directory of their own.
+	BaseDirRequired bool `json:"-"`
+}
+
+func (m *Manifest) resolvePath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+
+	if m.BaseDir == "" {
+		if m.BaseDirRequired {
+			return "", errors.Errorf("cannot resolve relative path %s: the manifest was not read from a file, and no base directory was given", path)
+		}
+
+		return path, nil
+	}
+
+	return filepath.Join(m.BaseDir, path), nil
 }
 
 func applyTemplate(text string, data interface{}) (string, error) {
@@ -120,27 +266,111 @@ func extendMap(a, b map[string]string) {
 	}
 }
 
+func (m *Manifest) checkStackName(name string) error {
+	if m.Global.StackNamePattern == "" {
+		return nil
+	}
+
+	pattern, err := regexp.Compile(m.Global.StackNamePattern)
+	if err != nil {
+		return errors.Wrap(err, "StackNamePattern")
+	}
+
+	if !pattern.MatchString(name) {
+		return errors.Errorf(
+			"stack name %s does not match StackNamePattern %s",
+			name, m.Global.StackNamePattern)
+	}
+
+	return nil
+}
+
+// CheckRegion verifies that stacks may be deployed to the region, according to
+// AllowedRegions.
+func (m *Manifest) CheckRegion(region string) error {
+	if len(m.Global.AllowedRegions) == 0 {
+		return nil
+	}
+
+	for _, allowed := range m.Global.AllowedRegions {
+		if region == allowed {
+			return nil
+		}
+	}
+
+	return errors.Errorf(
+		"region %s is not in AllowedRegions (%s)",
+		region, strings.Join(m.Global.AllowedRegions, ", "))
+}
+
 func (m *Manifest) Deployment(
 	tenant *Tenant,
 	stack *Stack,
 	target *Target,
+) (result *cftool.Deployment, err error) {
+	return m.deployment(tenant, stack, target, "")
+}
+
+func (m *Manifest) deployment(
+	tenant *Tenant,
+	stack *Stack,
+	target *Target,
+	region string,
 ) (result *cftool.Deployment, err error) {
 	def := Defaults{}.
 		MergeFrom(m.Global.Default).
 		MergeFrom(tenant.Default).
 		MergeFrom(stack.Default).
-		MergeFrom(target.Override)
+		MergeFrom(target.Override).
+		MergeFrom(&Defaults{Region: region})
 
 	// set up the initial values
 	d := cftool.Deployment{
-		TenantLabel: tenant.Label,
-		StackLabel:  stack.Label,
+		TenantLabel:    tenant.Label,
+		StackLabel:     stack.Label,
+		Confirm:        def.Confirm,
+		RollbackAlarms: def.RollbackAlarms,
 	}
 
 	if def.Protected != nil {
 		d.Protected = *def.Protected
 	}
 
+	if def.AllowedCapabilities != nil {
+		d.AllowedCapabilities, err = cftool.ParseCapabilities(def.AllowedCapabilities)
+		if err != nil {
+			return nil, errors.Wrap(err, "AllowedCapabilities")
+		}
+	}
+
+	if def.AllowedResourceTypes != nil {
+		d.AllowedResourceTypes, err = cftool.ParseResourceTypes(def.AllowedResourceTypes)
+		if err != nil {
+			return nil, errors.Wrap(err, "AllowedResourceTypes")
+		}
+	}
+
+	if def.DeniedResourceTypes != nil {
+		d.DeniedResourceTypes, err = cftool.ParseResourceTypes(def.DeniedResourceTypes)
+		if err != nil {
+			return nil, errors.Wrap(err, "DeniedResourceTypes")
+		}
+	}
+
+	if def.ExpectedOutputs != nil {
+		d.ExpectedOutputs, err = cftool.ParseExpectedOutputs(def.ExpectedOutputs)
+		if err != nil {
+			return nil, errors.Wrap(err, "ExpectedOutputs")
+		}
+	}
+
+	if m.Global.ResourceTimeouts != nil {
+		d.ResourceTimeouts, err = cftool.ParseResourceTimeouts(m.Global.ResourceTimeouts)
+		if err != nil {
+			return nil, errors.Wrap(err, "ResourceTimeouts")
+		}
+	}
+
 	// externally we say it's the Deployment structure providing the data,
 	// but we build up this map instead to control the variables that
 	// are available. this is to enforce the order of templating operations.
@@ -179,22 +409,33 @@ func (m *Manifest) Deployment(
 	}
 	tpl["Region"] = d.Region
 
-	d.StackName = def.StackName
-	d.StackName, err = applyTemplate(def.StackName, tpl)
+	d.StackName, err = applyTemplate(
+		m.Global.StackNamePrefix+def.StackName+m.Global.StackNameSuffix, tpl)
 	if err != nil {
 		return
 	}
+
+	if err = m.checkStackName(d.StackName); err != nil {
+		return
+	}
 	tpl["StackName"] = d.StackName
 
 	templatePath, err := applyTemplate(def.Template, tpl)
 	if err != nil {
 		return
 	}
+	templatePath, err = m.resolvePath(templatePath)
+	if err != nil {
+		return nil, err
+	}
+
 	d.TemplateBody, err = ioutil.ReadFile(templatePath)
 	if err != nil {
 		return nil, err
 	}
 
+	d.Files = append(d.Files, templatePath)
+
 	d.Parameters = make(map[string]string)
 	for _, p := range def.Parameters {
 		switch {
@@ -204,11 +445,17 @@ func (m *Manifest) Deployment(
 				return nil, err
 			}
 
+			path, err = m.resolvePath(path)
+			if err != nil {
+				return nil, err
+			}
+
 			kvp, err := ReadParametersFromFile(path)
 			if err != nil {
 				return nil, err
 			}
 			extendMap(d.Parameters, kvp)
+			d.Files = append(d.Files, path)
 		default:
 			d.Parameters[p.Key], err = applyTemplate(p.Value, tpl)
 			if err != nil {
@@ -220,7 +467,145 @@ func (m *Manifest) Deployment(
 	return &d, nil
 }
 
+// FindAccounts returns the accounts with the given ids or labels, or all of
+// them if none are given, in the order they appear in the manifest.
+func (m *Manifest) FindAccounts(names []string) ([]*Account, error) {
+	if len(m.Accounts) == 0 {
+		return nil, errors.New("the manifest lists no Accounts")
+	}
+
+	if len(names) == 0 {
+		return m.Accounts, nil
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		found := false
+		for _, account := range m.Accounts {
+			if account.Id == name || account.Label == name {
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, errors.Errorf("no account %s in the manifest", name)
+		}
+
+		wanted[name] = true
+	}
+
+	var result []*Account
+	for _, account := range m.Accounts {
+		if wanted[account.Id] || wanted[account.Label] {
+			result = append(result, account)
+		}
+	}
+
+	return result, nil
+}
+
+// StackLabels lists the stacks with a target for the tenant, in the order
+// they appear in the manifest.
+func (m *Manifest) StackLabels(tenantLabel string) []string {
+	var result []string
+	for _, s := range m.Stacks {
+		for _, t := range s.Targets {
+			if t.Tenant == tenantLabel {
+				result = append(result, s.Label)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// IsStackEnabled reports whether the stack applies to the tenant, according to
+// its EnabledFor and DisabledFor lists. It is an error if there is no such
+// stack, so that a misspelt label isn't taken for a disabled stack.
+func (m *Manifest) IsStackEnabled(tenantLabel string, stackLabel string) (bool, error) {
+	for _, s := range m.Stacks {
+		if s.Label == stackLabel {
+			return s.enabledFor(tenantLabel), nil
+		}
+	}
+
+	return false, errors.Errorf("no stack %s in the manifest", stackLabel)
+}
+
+// OrderStacks sorts stack labels so that every stack comes after the stacks it
+// depends on, and otherwise keeps their order. Dependencies that are not among
+// the labels are ignored.
+func (m *Manifest) OrderStacks(labels []string) ([]string, error) {
+	included := make(map[string]bool)
+	for _, label := range labels {
+		included[label] = true
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+
+	state := make(map[string]int)
+	var result []string
+
+	var visit func(label string, path []string) error
+	visit = func(label string, path []string) error {
+		switch state[label] {
+		case done:
+			return nil
+		case visiting:
+			return errors.Errorf("stacks depend on each other: %s", strings.Join(append(path, label), " -> "))
+		}
+
+		state[label] = visiting
+
+		for _, dep := range m.StackDependencies(label) {
+			if included[dep] {
+				if err := visit(dep, append(path, label)); err != nil {
+					return err
+				}
+			}
+		}
+
+		state[label] = done
+		result = append(result, label)
+		return nil
+	}
+
+	for _, label := range labels {
+		if err := visit(label, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// StackDependencies returns the labels of the stacks that the stack depends
+// on.
+func (m *Manifest) StackDependencies(stackLabel string) []string {
+	for _, s := range m.Stacks {
+		if s.Label == stackLabel {
+			return s.DependsOn
+		}
+	}
+
+	return nil
+}
+
 func (m *Manifest) FindDeployment(tenantLabel string, stackLabel string) (*cftool.Deployment, bool, error) {
+	return m.FindDeploymentInRegion(tenantLabel, stackLabel, "")
+}
+
+// FindDeploymentInRegion is like FindDeployment, but overrides the region
+// given in the manifest unless region is empty.
+func (m *Manifest) FindDeploymentInRegion(
+	tenantLabel string,
+	stackLabel string,
+	region string,
+) (*cftool.Deployment, bool, error) {
 	var tenant *Tenant
 	for _, t := range m.Tenants {
 		if t.Label == tenantLabel {
@@ -250,6 +635,6 @@ func (m *Manifest) FindDeployment(tenantLabel string, stackLabel string) (*cftoo
 		return nil, false, nil
 	}
 
-	d, err := m.Deployment(tenant, stack, target)
+	d, err := m.deployment(tenant, stack, target, region)
 	return d, true, err
 }
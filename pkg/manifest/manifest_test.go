@@ -6,6 +6,8 @@ import (
 	"github.com/tetratom/cftool/pkg/cftool"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -40,6 +42,7 @@ func TestManifest_FindDeployment(t *testing.T) {
 				TemplateBody: readAll("testdata/templates/mystack.yml"),
 				Region:       "eu-west-1",
 				Protected:    false,
+				Confirm:      cftool.ConfirmNever,
 				StackLabel:   "mystack",
 				TenantLabel:  "test",
 				Tags: map[string]string{
@@ -51,6 +54,10 @@ func TestManifest_FindDeployment(t *testing.T) {
 					"TestAccountId": "222222222222",
 					"Some":          "const",
 				},
+				Files: []string{
+					"testdata/templates/mystack.yml",
+					"testdata/stacks/test/eu-west-1/test-mystack.json",
+				},
 			},
 		},
 		{
@@ -79,6 +86,10 @@ func TestManifest_FindDeployment(t *testing.T) {
 					"TestAccountId": "222222222222",
 					"Some":          "bax",
 				},
+				Files: []string{
+					"testdata/templates/mystack.yml",
+					"testdata/stacks/live-us/us-west-1/live-mystack-us.json",
+				},
 			},
 		},
 	}
@@ -97,3 +108,177 @@ func TestManifest_FindDeployment(t *testing.T) {
 		})
 	}
 }
+
+func TestManifest_FindDeploymentInRegion(t *testing.T) {
+	f, err := os.Open("testdata/mystack-manifest.yml")
+	defer f.Close()
+	require.NoError(t, err)
+	m, err := Read(f)
+	require.NoError(t, err)
+
+	actual, found, err := m.FindDeploymentInRegion("test", "mystack", "us-east-1")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "us-east-1", actual.Region)
+	assert.Equal(t, "Baz", actual.Parameters["Foo"])
+
+	actual, found, err = m.FindDeploymentInRegion("test", "mystack", "")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "eu-west-1", actual.Region)
+}
+
+func TestManifest_StackLabels(t *testing.T) {
+	f, err := os.Open("testdata/mystack-manifest.yml")
+	defer f.Close()
+	require.NoError(t, err)
+	m, err := Read(f)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"mystack"}, m.StackLabels("test"))
+	assert.Empty(t, m.StackLabels("nobody"))
+}
+
+func TestManifest_StackNameConvention(t *testing.T) {
+	f, err := os.Open("testdata/naming-manifest.yml")
+	defer f.Close()
+	require.NoError(t, err)
+	m, err := Read(f)
+	require.NoError(t, err)
+
+	actual, found, err := m.FindDeployment("live", "network")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "live-platform-network", actual.StackName)
+
+	_, _, err = m.FindDeployment("test", "network")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "test-platform-Network")
+}
+
+func TestManifest_CheckRegion(t *testing.T) {
+	m := &Manifest{}
+	require.NoError(t, m.CheckRegion("us-east-2"))
+
+	m.Global.AllowedRegions = []string{"eu-west-1", "eu-central-1"}
+	require.NoError(t, m.CheckRegion("eu-central-1"))
+	require.EqualError(t, m.CheckRegion("us-east-2"), "region us-east-2 is not in AllowedRegions (eu-west-1, eu-central-1)")
+}
+
+func TestManifest_FindAccounts(t *testing.T) {
+	m := &Manifest{}
+	_, err := m.FindAccounts(nil)
+	require.EqualError(t, err, "the manifest lists no Accounts")
+
+	staging := &Account{Id: "111111111111", Label: "staging", RoleArn: "arn:aws:iam::111111111111:role/deploy"}
+	prod := &Account{Id: "222222222222", RoleArn: "arn:aws:iam::222222222222:role/deploy"}
+	m.Accounts = []*Account{staging, prod}
+
+	accounts, err := m.FindAccounts(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []*Account{staging, prod}, accounts)
+
+	accounts, err = m.FindAccounts([]string{"222222222222", "staging"})
+	require.NoError(t, err)
+	assert.Equal(t, []*Account{staging, prod}, accounts)
+	assert.Equal(t, "222222222222", accounts[1].Name())
+
+	_, err = m.FindAccounts([]string{"prod"})
+	require.EqualError(t, err, "no account prod in the manifest")
+}
+
+func TestReadFromFile_BaseDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cftool-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	manifestPath := filepath.Join(dir, "manifest", ".cftool.yml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(manifestPath), 0700))
+	require.NoError(t, ioutil.WriteFile(manifestPath, []byte(`
+Version: "1.1"
+Tenants:
+  - Label: test
+Stacks:
+  - Label: mystack
+    Default:
+      Template: templates/mystack.yml
+      StackName: mystack
+    Targets:
+      - Tenant: test
+`), 0600))
+
+	m, err := ReadFromFile(manifestPath)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Dir(manifestPath), m.BaseDir)
+
+	// The template is looked for next to the manifest, not in the working
+	// directory.
+	_, _, err = m.FindDeployment("test", "mystack")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), filepath.Join(dir, "manifest", "templates", "mystack.yml"))
+
+	m.BaseDir = "testdata"
+	d, _, err := m.FindDeployment("test", "mystack")
+	require.NoError(t, err)
+	require.Equal(t, readAll("testdata/templates/mystack.yml"), d.TemplateBody)
+}
+
+func TestManifest_IsStackEnabled(t *testing.T) {
+	m, err := Read(strings.NewReader(`
+Version: "1.1"
+Tenants:
+  - Label: live
+  - Label: test
+Stacks:
+  - Label: monitoring
+    EnabledFor: [live]
+  - Label: sandbox
+    DisabledFor: [live]
+  - Label: network
+`))
+	require.NoError(t, err)
+
+	enabled := func(tenant string, stack string) bool {
+		ok, err := m.IsStackEnabled(tenant, stack)
+		require.NoError(t, err)
+		return ok
+	}
+
+	assert.True(t, enabled("live", "monitoring"))
+	assert.False(t, enabled("test", "monitoring"))
+	assert.False(t, enabled("live", "sandbox"))
+	assert.True(t, enabled("test", "sandbox"))
+	assert.True(t, enabled("test", "network"))
+
+	_, err = m.IsStackEnabled("test", "netwrok")
+	require.EqualError(t, err, "no stack netwrok in the manifest")
+}
+
+func TestManifest_OrderStacks(t *testing.T) {
+	m, err := Read(strings.NewReader(`
+Version: "1.1"
+Stacks:
+  - Label: app
+    DependsOn: [network, database]
+  - Label: database
+    DependsOn: [network]
+  - Label: network
+  - Label: monitoring
+`))
+	require.NoError(t, err)
+
+	order, err := m.OrderStacks([]string{"app", "monitoring", "database", "network"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"network", "database", "app", "monitoring"}, order)
+
+	// Dependencies that are not deployed don't change the order.
+	order, err = m.OrderStacks([]string{"monitoring", "app"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"monitoring", "app"}, order)
+
+	m.Stacks[2].DependsOn = []string{"app"}
+	_, err = m.OrderStacks([]string{"app"})
+	require.NoError(t, err)
+	_, err = m.OrderStacks([]string{"app", "network"})
+	require.EqualError(t, err, "stacks depend on each other: app -> network -> app")
+}
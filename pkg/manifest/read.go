@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 func readWithValidation(r io.Reader, schema []byte, out interface{}) error {
@@ -47,8 +48,15 @@ func ReadFromFile(path string) (*Manifest, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	return Read(f)
+	m, err := Read(f)
+	if err != nil {
+		return nil, err
+	}
+
+	m.BaseDir = filepath.Dir(path)
+	return m, nil
 }
 
 func ReadParameters(r io.Reader) (map[string]string, error) {
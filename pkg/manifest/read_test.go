@@ -2,6 +2,7 @@ package manifest
 
 import (
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 )
 
@@ -32,3 +33,22 @@ func TestReadParametersFromFile(t *testing.T) {
 		})
 	}
 }
+
+func TestRead_ResourceTimeouts(t *testing.T) {
+	read := func(timeout string) error {
+		_, err := Read(strings.NewReader(`
+Version: "1.1"
+Global:
+  ResourceTimeouts:
+    "AWS::RDS::*": "` + timeout + `"
+`))
+		return err
+	}
+
+	require.NoError(t, read("40m"))
+	require.NoError(t, read("1h30m"))
+
+	err := read("soon")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Global.ResourceTimeouts: Does not match pattern")
+}
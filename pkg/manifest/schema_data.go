@@ -30,6 +30,22 @@ properties:
     properties:
       Constants:
         $ref: "#/definitions/TagSet"
+      Tags:
+        $ref: "#/definitions/TagSet"
+      Default:
+        $ref: "#/definitions/Stack"
+      StackNamePrefix:
+        type: string
+      StackNameSuffix:
+        type: string
+      StackNamePattern:
+        type: string
+      AllowedRegions:
+        type: array
+        items:
+          type: string
+      ResourceTimeouts:
+        $ref: "#/definitions/ResourceTimeouts"
   Tenants:
     type: array
     items:
@@ -62,6 +78,34 @@ properties:
           type: array
           items:
             $ref: "#/definitions/Target"
+        EnabledFor:
+          type: array
+          items:
+            type: string
+        DisabledFor:
+          type: array
+          items:
+            type: string
+        DependsOn:
+          type: array
+          items:
+            type: string
+  Accounts:
+    type: array
+    items:
+      type: object
+      additionalProperties: false
+      required:
+        - Id
+        - RoleArn
+      properties:
+        Id:
+          type: string
+          pattern: "^[0-9]{12}$"
+        Label:
+          type: string
+        RoleArn:
+          type: string
 
 definitions:
   TagSet:
@@ -69,6 +113,12 @@ definitions:
     additionalProperties:
       type: string
 
+  ResourceTimeouts:
+    type: object
+    additionalProperties:
+      type: string
+      pattern: '^\s*([0-9]*\.?[0-9]+(ns|us|ms|s|m|h))+\s*$'
+
   Parameter:
     $oneOf:
       - type: object
@@ -95,6 +145,25 @@ definitions:
     properties:
       AccountId:
         type: string
+      AllowedCapabilities:
+        type: array
+        items:
+          type: string
+      AllowedResourceTypes:
+        type: array
+        items:
+          type: string
+      DeniedResourceTypes:
+        type: array
+        items:
+          type: string
+      ExpectedOutputs:
+        type: object
+        additionalProperties:
+          type: string
+      Confirm:
+        type: string
+        enum: [always, never, protected]
       Parameters:
         type: array
         items:
@@ -103,6 +172,10 @@ definitions:
         type: boolean
       Region:
         type: string
+      RollbackAlarms:
+        type: array
+        items:
+          type: string
       StackName:
         type: string
       Template:
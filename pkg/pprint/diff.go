@@ -0,0 +1,106 @@
+package pprint
+
+import (
+	"fmt"
+	"github.com/pmezard/go-difflib/difflib"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// MinSideBySideWidth is the narrowest terminal a side-by-side diff is
+// rendered in. Anything narrower leaves too little room for each column.
+const MinSideBySideWidth = 80
+
+// UnifiedDiff prints the difference between the lines a and b as a colored
+// unified diff without context.
+func UnifiedDiff(w io.Writer, a []string, b []string) error {
+	text, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:       a,
+		B:       b,
+		Context: 0,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) < 1 {
+			continue
+		}
+
+		col := ColDiffText
+
+		switch line[0] {
+		case '@':
+			col = ColDiffHeader
+		case '+':
+			col = ColDiffAdd
+		case '-':
+			col = ColDiffRemove
+		}
+
+		_, _ = col.Fprint(w, line)
+		fmt.Fprintf(w, "\n")
+	}
+
+	return nil
+}
+
+// SideBySideDiff prints the changed lines of a and b in two columns that fit
+// the given width, old on the left and new on the right.
+func SideBySideDiff(w io.Writer, a []string, b []string, width int) {
+	colWidth := (width - 3) / 2
+	matcher := difflib.NewMatcher(a, b)
+
+	for _, op := range matcher.GetOpCodes() {
+		if op.Tag == 'e' {
+			continue
+		}
+
+		_, _ = ColDiffHeader.Fprintf(w, "@@ %d,%d | %d,%d @@",
+			op.I1+1, op.I2-op.I1, op.J1+1, op.J2-op.J1)
+		fmt.Fprintf(w, "\n")
+
+		for i := 0; i < op.I2-op.I1 || i < op.J2-op.J1; i++ {
+			left, right := "", ""
+			sep := " "
+
+			if op.I1+i < op.I2 {
+				left = diffColumn(a[op.I1+i], colWidth)
+				sep = "<"
+			}
+
+			if op.J1+i < op.J2 {
+				right = diffColumn(b[op.J1+i], colWidth)
+				sep = ">"
+
+				if op.I1+i < op.I2 {
+					sep = "|"
+				}
+			}
+
+			_, _ = ColDiffRemove.Fprintf(w, "%-*s", colWidth, left)
+			_, _ = ColDiffText.Fprintf(w, " %s ", sep)
+			_, _ = ColDiffAdd.Fprint(w, right)
+			fmt.Fprintf(w, "\n")
+		}
+	}
+}
+
+// diffColumn prepares a line for a column of the given width, truncating it
+// if it is too long. Tabs are expanded so that the columns stay aligned.
+func diffColumn(line string, width int) string {
+	line = strings.TrimRight(line, "\r\n")
+	line = strings.ReplaceAll(line, "\t", "    ")
+
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+
+	runes := []rune(line)
+	return string(runes[:width-1]) + "…"
+}
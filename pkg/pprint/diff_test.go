@@ -0,0 +1,31 @@
+package pprint
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	w := &strings.Builder{}
+
+	err := UnifiedDiff(w, []string{"a\n", "b\n", "c\n"}, []string{"a\n", "B\n", "c\n"})
+	require.NoError(t, err)
+	require.Equal(t, "@@ -2 +2 @@\n-b\n+B\n", w.String())
+}
+
+func TestSideBySideDiff(t *testing.T) {
+	w := &strings.Builder{}
+
+	a := []string{"same\n", "old\n", "gone\n", "same\n"}
+	b := []string{"same\n", "new\n", "same\n", "added\tline\n"}
+
+	SideBySideDiff(w, a, b, 23)
+	require.Equal(t, ""+
+		"@@ 2,2 | 2,1 @@\n"+
+		"old        | new\n"+
+		"gone       < \n"+
+		"@@ 5,0 | 4,1 @@\n"+
+		"           > added    …\n",
+		w.String())
+}
@@ -14,3 +14,10 @@ func Field(w io.Writer, field string, value interface{}) {
 	BeginField(w, field)
 	fmt.Fprintf(w, "%s\n", value)
 }
+
+// Header prints a section heading, used to separate the output of several
+// deployments in a single run.
+func Header(w io.Writer, format string, args ...interface{}) {
+	ColField.Fprintf(w, "== "+format+" ==", args...)
+	fmt.Fprintf(w, "\n")
+}
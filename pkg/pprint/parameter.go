@@ -0,0 +1,24 @@
+package pprint
+
+import (
+	"io"
+)
+
+// Parameter prints the effective value of a stack parameter, and where it
+// comes from unless it was given explicitly.
+func Parameter(w io.Writer, name string, value string, source string) {
+	ColField.Fprintf(w, "%s: ", name)
+
+	switch source {
+	case "default":
+		Text.Fprintf(w, "%s ", value)
+		ColVerbose.Fprintf(w, "(template default)\n")
+	case "missing":
+		ColWarning.Fprintf(w, "(no value)\n")
+	case "undeclared":
+		Text.Fprintf(w, "%s ", value)
+		ColWarning.Fprintf(w, "(not declared by template)\n")
+	default:
+		Text.Fprintf(w, "%s\n", value)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/fatih/color"
 	"io"
+	"os"
 	"strings"
 )
 
@@ -33,6 +34,13 @@ var (
 	ColDiffText   = Text
 )
 
+// The colors of stack and deployment statuses, by outcome.
+var (
+	ColStatusComplete   = Green
+	ColStatusInProgress = Yellow
+	ColStatusFailed     = Red
+)
+
 func EnableColor() {
 	for _, col := range colors {
 		col.EnableColor()
@@ -45,11 +53,23 @@ func DisableColor() {
 	}
 }
 
+// IsInteractiveInput reports whether stdin is a terminal, on which prompts
+// can be answered.
+func IsInteractiveInput() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 func Promptf(w io.Writer, text string, args ...interface{}) bool {
 	for {
 		_, _ = fmt.Fprintf(w, text+" [y/n] ", args...)
 		var input string
-		_, _ = fmt.Scan(&input)
+		_, err := fmt.Scan(&input)
+		if err != nil {
+			// Nothing more to read, e.g. because stdin was piped.
+			_, _ = fmt.Fprintf(w, "\n")
+			return false
+		}
 
 		switch input {
 		case "y":
@@ -64,6 +84,78 @@ func Promptf(w io.Writer, text string, args ...interface{}) bool {
 	}
 }
 
+// PromptTyped asks the user to type the expected text to confirm, which is
+// harder to do by mistake than answering y.
+func PromptTyped(w io.Writer, expected string, text string, args ...interface{}) bool {
+	_, _ = fmt.Fprintf(w, text, args...)
+	_, _ = fmt.Fprintf(w, " Type %s to confirm: ", expected)
+
+	var input string
+	if _, err := fmt.Scanln(&input); err != nil {
+		_, _ = fmt.Fprintf(w, "\n")
+		return false
+	}
+
+	return input == expected
+}
+
+// PromptLine asks for a line of free text. It returns false if nothing could be
+// read, e.g. because stdin was closed.
+func PromptLine(w io.Writer, text string, args ...interface{}) (string, bool) {
+	_, _ = fmt.Fprintf(w, text+" ", args...)
+	return readLine(w, os.Stdin)
+}
+
+// PromptChoice presents a numbered menu of choices, and returns the index of
+// the one picked. It asks again until a valid number is given, and returns
+// false if nothing could be read.
+func PromptChoice(w io.Writer, text string, choices []string) (int, bool) {
+	return promptChoice(w, os.Stdin, text, choices)
+}
+
+func promptChoice(w io.Writer, r io.Reader, text string, choices []string) (int, bool) {
+	_, _ = fmt.Fprintf(w, "%s\n", text)
+	for i, choice := range choices {
+		_, _ = ColField.Fprintf(w, "% 4d) ", i+1)
+		_, _ = fmt.Fprintf(w, "%s\n", choice)
+	}
+
+	for {
+		_, _ = fmt.Fprintf(w, "Choice [1-%d]: ", len(choices))
+		line, ok := readLine(w, r)
+		if !ok {
+			return 0, false
+		}
+
+		var n int
+		if _, err := fmt.Sscanf(line, "%d", &n); err == nil && n >= 1 && n <= len(choices) {
+			return n - 1, true
+		}
+
+		_, _ = fmt.Fprintf(w, "Please answer a number from 1 to %d.\n", len(choices))
+	}
+}
+
+// readLine reads a byte at a time, so that nothing past the line is consumed
+// from r before later prompts get to it.
+func readLine(w io.Writer, r io.Reader) (string, bool) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n == 0 || err != nil {
+			_, _ = fmt.Fprintf(w, "\n")
+			return strings.TrimSpace(string(line)), false
+		}
+
+		if buf[0] == '\n' {
+			return strings.TrimSpace(string(line)), true
+		}
+
+		line = append(line, buf[0])
+	}
+}
+
 func Errorf(w io.Writer, format string, args ...interface{}) {
 	ColError.Fprintf(w, "ERROR! "+format, args...)
 	fmt.Fprintf(w, "\n")
@@ -33,3 +33,17 @@ func TestSmoke(t *testing.T) {
 		})
 	}
 }
+
+func TestPromptChoice(t *testing.T) {
+	w := &strings.Builder{}
+	i, ok := promptChoice(w, strings.NewReader("x\n3\n 2\n"), "Tenant:", []string{"dev", "prod"})
+	require.True(t, ok)
+	require.Equal(t, 1, i)
+	require.Equal(t, "Tenant:\n   1) dev\n   2) prod\n"+
+		"Choice [1-2]: Please answer a number from 1 to 2.\n"+
+		"Choice [1-2]: Please answer a number from 1 to 2.\n"+
+		"Choice [1-2]: ", w.String())
+
+	_, ok = promptChoice(w, strings.NewReader(""), "Tenant:", []string{"dev"})
+	require.False(t, ok)
+}
@@ -0,0 +1,152 @@
+package pprint
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// Progress displays the status of a long-running operation. On interactive
+// terminals it redraws a single line in place, showing a spinner and the time
+// spent in the current status. Otherwise it prints the status once followed
+// by a dot per tick.
+type Progress struct {
+	w           io.Writer
+	interactive bool
+	status      string
+	terminal    bool
+	started     time.Time
+	frame       int
+	active      bool
+
+	// percent is how far along the operation roughly is, or -1 if unknown.
+	// shown is the last percentage printed when not interactive.
+	percent int
+	shown   int
+}
+
+func NewProgress(w io.Writer, interactive bool) *Progress {
+	return &Progress{w: w, interactive: interactive, percent: -1, shown: -1}
+}
+
+// SetPercent sets how far along the operation roughly is, which is shown next
+// to the status from the next tick on. -1 hides it again.
+func (p *Progress) SetPercent(percent int) {
+	p.percent = percent
+}
+
+// Begin starts a new status line. Terminal statuses are printed without the
+// trailing ellipsis or spinner.
+func (p *Progress) Begin(status string, terminal bool) {
+	p.status = status
+	p.terminal = terminal
+	p.started = time.Now()
+	p.frame = 0
+	p.active = true
+	p.shown = -1
+
+	if p.interactive {
+		p.redraw()
+		return
+	}
+
+	fmt.Fprintf(p.w, "%s", status)
+
+	if !terminal {
+		fmt.Fprintf(p.w, "...")
+	}
+}
+
+// Tick advances the spinner, or prints a dot when not interactive. In place of
+// the dot, a percentage is printed whenever it changed.
+func (p *Progress) Tick() {
+	if !p.active {
+		return
+	}
+
+	if p.interactive {
+		p.frame += 1
+		p.redraw()
+		return
+	}
+
+	if p.percent >= 0 && p.percent != p.shown {
+		p.shown = p.percent
+		fmt.Fprintf(p.w, " %d%%", p.percent)
+		return
+	}
+
+	fmt.Fprintf(p.w, ".")
+}
+
+// End finishes the current status line, noting the time spent in it. If there
+// is no current line, it simply prints a line break.
+func (p *Progress) End() {
+	if p.interactive && p.active {
+		p.clear()
+		fmt.Fprintf(p.w, "%s", p.status)
+
+		if !p.terminal {
+			fmt.Fprintf(p.w, "...")
+		}
+	}
+
+	if p.active && !p.terminal {
+		fmt.Fprintf(p.w, " (%s)", p.Elapsed())
+	}
+
+	p.active = false
+	fmt.Fprintf(p.w, "\n")
+}
+
+// Note prints a line of its own without losing the current status, which
+// continues on the next line.
+func (p *Progress) Note(format string, args ...interface{}) {
+	if !p.active {
+		fmt.Fprintf(p.w, format+"\n", args...)
+		return
+	}
+
+	if p.interactive {
+		p.clear()
+		fmt.Fprintf(p.w, format+"\n", args...)
+		p.redraw()
+		return
+	}
+
+	fmt.Fprintf(p.w, "\n"+format+"\n", args...)
+	fmt.Fprintf(p.w, "%s", p.status)
+
+	if !p.terminal {
+		fmt.Fprintf(p.w, "...")
+	}
+}
+
+// Elapsed is the time spent in the current status.
+func (p *Progress) Elapsed() time.Duration {
+	return time.Since(p.started).Round(time.Second)
+}
+
+func (p *Progress) clear() {
+	fmt.Fprintf(p.w, "\r\033[K")
+}
+
+func (p *Progress) redraw() {
+	p.clear()
+
+	if p.terminal {
+		fmt.Fprintf(p.w, "%s", p.status)
+		return
+	}
+
+	ColField.Fprintf(p.w, "%s", spinnerFrames[p.frame%len(spinnerFrames)])
+	fmt.Fprintf(p.w, " %s ", p.status)
+
+	if p.percent >= 0 {
+		fmt.Fprintf(p.w, "%d%% ", p.percent)
+	}
+
+	ColVerbose.Fprintf(p.w, "(%s)", p.Elapsed())
+}
@@ -0,0 +1,67 @@
+package pprint
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	w := &strings.Builder{}
+
+	t.Run("non-interactive", func(t *testing.T) {
+		w.Reset()
+		p := NewProgress(w, false)
+		p.End()
+		p.Begin("UPDATE_IN_PROGRESS", false)
+		p.Tick()
+		p.Tick()
+		p.End()
+		p.Begin("UPDATE_COMPLETE", true)
+		p.End()
+		require.Equal(t, "\nUPDATE_IN_PROGRESS..... (0s)\nUPDATE_COMPLETE\n", w.String())
+	})
+
+	t.Run("non-interactive note", func(t *testing.T) {
+		w.Reset()
+		p := NewProgress(w, false)
+		p.Begin("UPDATE_IN_PROGRESS", false)
+		p.Tick()
+		p.Note("Still %s", "UPDATE_IN_PROGRESS")
+		p.Tick()
+		p.End()
+		p.Note("done")
+		require.Equal(t, "UPDATE_IN_PROGRESS....\nStill UPDATE_IN_PROGRESS\nUPDATE_IN_PROGRESS.... (0s)\ndone\n", w.String())
+	})
+
+	t.Run("non-interactive percent", func(t *testing.T) {
+		w.Reset()
+		p := NewProgress(w, false)
+		p.Begin("UPDATE_IN_PROGRESS", false)
+		p.SetPercent(0)
+		p.Tick()
+		p.Tick()
+		p.SetPercent(50)
+		p.Tick()
+		p.Tick()
+		p.End()
+		require.Equal(t, "UPDATE_IN_PROGRESS... 0%. 50%. (0s)\n", w.String())
+	})
+
+	t.Run("interactive percent", func(t *testing.T) {
+		w.Reset()
+		p := NewProgress(w, true)
+		p.SetPercent(40)
+		p.Begin("UPDATE_IN_PROGRESS", false)
+		require.Equal(t, "\r\033[K| UPDATE_IN_PROGRESS 40% (0s)", w.String())
+	})
+
+	t.Run("interactive terminal status", func(t *testing.T) {
+		w.Reset()
+		p := NewProgress(w, true)
+		p.Begin("UPDATE_COMPLETE", true)
+		p.Tick()
+		p.End()
+		require.Equal(t, "\r\033[KUPDATE_COMPLETE\r\033[KUPDATE_COMPLETE\r\033[KUPDATE_COMPLETE\n", w.String())
+	})
+}
@@ -3,7 +3,10 @@ package pprint
 import (
 	"fmt"
 	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/fatih/color"
 	"io"
+	"regexp"
+	"strings"
 )
 
 func str(s *string, def string) string {
@@ -37,7 +40,64 @@ func ChangeHeader(w io.Writer, action string, resourceType string, logicalResour
 	fmt.Fprintf(w, "\n")
 }
 
+// ChangeFilter selects the resource changes of a change set to display. The
+// zero value selects all of them.
+type ChangeFilter struct {
+	// ResourceType is a prefix of the resource type, e.g. "AWS::RDS::". A
+	// trailing "*" is ignored.
+	ResourceType string
+
+	// LogicalId matches the logical id of the resource, if set.
+	LogicalId *regexp.Regexp
+}
+
+// IsEmpty is true if the filter selects all changes.
+func (f ChangeFilter) IsEmpty() bool {
+	return f.ResourceType == "" && f.LogicalId == nil
+}
+
+func (f ChangeFilter) Match(change *cf.ResourceChange) bool {
+	prefix := strings.TrimSuffix(f.ResourceType, "*")
+	if !strings.HasPrefix(str(change.ResourceType, ""), prefix) {
+		return false
+	}
+
+	return f.LogicalId == nil || f.LogicalId.MatchString(str(change.LogicalResourceId, ""))
+}
+
 func ChangeSet(w io.Writer, cs *cf.DescribeChangeSetOutput) {
+	FilteredChangeSet(w, cs, ChangeFilter{})
+}
+
+// FilteredChangeSet shows the changes of a change set that match the filter,
+// and returns how many it showed.
+func FilteredChangeSet(w io.Writer, cs *cf.DescribeChangeSetOutput, filter ChangeFilter) int {
+	return DetailedChangeSet(w, cs, filter, nil)
+}
+
+// Placeholders for property values that couldn't be resolved before the change
+// set is executed, or that the template doesn't set.
+const (
+	UnknownValue    = "(unknown)"
+	KnownAfterApply = "(known after apply)"
+	UnsetValue      = "(not set)"
+)
+
+// PropertyChange is the value of a resource property before and after a
+// change set, as far as it could be resolved.
+type PropertyChange struct {
+	Before string
+	After  string
+}
+
+// PropertyChanges are property changes by logical id and property name.
+type PropertyChanges map[string]map[string]PropertyChange
+
+// DetailedChangeSet is FilteredChangeSet, but also shows the values before and
+// after the change of the properties that values has.
+func DetailedChangeSet(w io.Writer, cs *cf.DescribeChangeSetOutput, filter ChangeFilter, values PropertyChanges) int {
+	shown := 0
+
 	if len(cs.Changes) == 0 {
 		if *cs.Status != cf.ChangeSetStatusFailed {
 			fmt.Printf("\nOnly outputs have changed.\n")
@@ -45,10 +105,15 @@ func ChangeSet(w io.Writer, cs *cf.DescribeChangeSetOutput) {
 			fmt.Printf("\nNo changes.\n")
 		}
 
-		return
+		return shown
 	}
 
 	for _, change := range cs.Changes {
+		if change.ResourceChange != nil && !filter.Match(change.ResourceChange) {
+			continue
+		}
+
+		shown += 1
 		fmt.Fprintf(w, "\n") // Spacing.
 
 		if *change.Type != cf.ChangeTypeResource {
@@ -84,10 +149,122 @@ func ChangeSet(w io.Writer, cs *cf.DescribeChangeSetOutput) {
 			Field(w, " Resource", *change.PhysicalResourceId)
 		}
 
+		if len(change.Details) > 0 {
+			ChangeCause(w, change)
+		}
+
+		// A property may change for several reasons, but its values are
+		// only shown once.
+		properties := values[str(change.LogicalResourceId, "")]
+		seen := make(map[string]bool)
+
 		for _, detail := range change.Details {
 			ChangeSetDetail(w, detail)
+
+			if detail.Target == nil || str(detail.Target.Attribute, "") != cf.ResourceAttributeProperties {
+				continue
+			}
+
+			name := str(detail.Target.Name, "")
+			if value, ok := properties[name]; ok && !seen[name] {
+				seen[name] = true
+				PropertyValues(w, value)
+			}
 		}
 	}
+
+	return shown
+}
+
+// PropertyValues shows the value of a property before and after a change.
+// Placeholders for values that aren't known are highlighted.
+func PropertyValues(w io.Writer, value PropertyChange) {
+	show := func(field string, v string, col *color.Color) {
+		BeginField(w, field)
+		switch v {
+		case UnknownValue, KnownAfterApply, UnsetValue:
+			ColWarning.Fprintf(w, "%s", v)
+		default:
+			col.Fprintf(w, "%s", v)
+		}
+
+		fmt.Fprintf(w, "\n")
+	}
+
+	show("Before", value.Before, ColRemove)
+	show("After", value.After, ColAdd)
+}
+
+// ChangeCause summarizes what drives a resource change: edits to the resource
+// in the template, changed parameters, other resources it references, or
+// CloudFormation itself. A replacement that only parameters drive is
+// highlighted, since it is easily overlooked when reviewing a template change,
+// and can surprise when parameters keep their previous values.
+func ChangeCause(w io.Writer, change *cf.ResourceChange) {
+	var template, automatic bool
+	var params, resources []string
+
+	seen := make(map[string]bool)
+	add := func(list *[]string, entity string) {
+		if entity != "" && !seen[entity] {
+			seen[entity] = true
+			*list = append(*list, entity)
+		}
+	}
+
+	for _, detail := range change.Details {
+		switch str(detail.ChangeSource, "") {
+		case cf.ChangeSourceDirectModification:
+			template = true
+		case cf.ChangeSourceParameterReference:
+			add(&params, str(detail.CausingEntity, ""))
+		case cf.ChangeSourceResourceReference, cf.ChangeSourceResourceAttribute:
+			add(&resources, str(detail.CausingEntity, ""))
+		case cf.ChangeSourceAutomatic:
+			automatic = true
+		}
+	}
+
+	var causes []string
+	if template {
+		causes = append(causes, "template")
+	}
+
+	if len(params) > 0 {
+		causes = append(causes, plural(len(params), "parameter")+" "+strings.Join(params, ", "))
+	}
+
+	if len(resources) > 0 {
+		causes = append(causes, plural(len(resources), "resource")+" "+strings.Join(resources, ", "))
+	}
+
+	if automatic {
+		causes = append(causes, "automatic")
+	}
+
+	if len(causes) == 0 {
+		return
+	}
+
+	BeginField(w, "    Cause")
+	fmt.Fprintf(w, "%s", strings.Join(causes, "; "))
+
+	replacement := str(change.Replacement, "")
+	if len(params) > 0 && !template && (replacement == cf.ReplacementTrue || replacement == cf.ReplacementConditional) {
+		fmt.Fprintf(w, " (")
+		ColWarning.Fprintf(w, "replacement driven by parameters only")
+		fmt.Fprintf(w, ")")
+	}
+
+	fmt.Fprintf(w, "\n")
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+
+	return word + "s"
 }
 
 func ChangeSetDetail(w io.Writer, detail *cf.ResourceChangeDetail) {
@@ -175,7 +352,180 @@ func StackEvent(w io.Writer, event *cf.StackEvent) {
 	fmt.Fprintf(w, ": %s\n", str(event.ResourceStatusReason, "???"))
 }
 
+// StackFailure highlights the resource failure that caused a stack operation
+// to fail.
+func StackFailure(w io.Writer, event *cf.StackEvent) {
+	ColError.Fprintf(w, "Failed! %s", str(event.ResourceType, "???"))
+	ColLogicalId.Fprintf(w, " %s", str(event.LogicalResourceId, "???"))
+	fmt.Fprintf(w, "\n")
+	Field(w, "Reason", str(event.ResourceStatusReason, "???"))
+}
+
+// StatusReason prints why a change set or stack operation failed. CloudFormation
+// packs several problems into a single line, separated by "; " or listed in
+// brackets, so each problem and list item is put on a line of its own.
+func StatusReason(w io.Writer, reason string) {
+	BeginField(w, "Reason")
+	indent := strings.Repeat(" ", 12)
+
+	for i, line := range reasonLines(reason) {
+		if i > 0 {
+			fmt.Fprintf(w, "%s", indent)
+		}
+
+		fmt.Fprintf(w, "%s\n", line)
+	}
+}
+
+// reasonLines splits a status reason into lines at top-level "; " separators,
+// and expands bracketed lists of several items into one line per item.
+func reasonLines(reason string) []string {
+	var lines []string
+
+	for _, part := range splitTopLevel(strings.TrimSpace(reason), "; ") {
+		open := strings.Index(part, "[")
+		end := strings.LastIndex(part, "]")
+		if open < 0 || end < open {
+			lines = append(lines, part)
+			continue
+		}
+
+		items := splitTopLevel(part[open+1:end], ", ")
+		if len(items) < 2 {
+			lines = append(lines, part)
+			continue
+		}
+
+		lines = append(lines, strings.TrimSpace(part[:open]))
+		for _, item := range items {
+			lines = append(lines, "  - "+item)
+		}
+
+		if rest := strings.TrimSpace(part[end+1:]); rest != "" {
+			lines = append(lines, rest)
+		}
+	}
+
+	return lines
+}
+
+// splitTopLevel splits s at sep, except where sep is inside brackets or
+// parentheses.
+func splitTopLevel(s string, sep string) []string {
+	var parts []string
+	depth, start := 0, 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+		}
+
+		if depth == 0 && strings.HasPrefix(s[i:], sep) {
+			parts = append(parts, s[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// StackOutput prints the key and value of an output, followed by its export
+// name and description, if it has them.
 func StackOutput(w io.Writer, output *cf.Output) {
 	ColField.Fprintf(w, "%s: ", *output.OutputKey)
 	Text.Fprintf(w, "%s\n", *output.OutputValue)
+
+	if output.ExportName != nil {
+		fmt.Fprintf(w, "  Export: %s\n", *output.ExportName)
+	}
+
+	if description := str(output.Description, ""); description != "" {
+		fmt.Fprintf(w, "  %s\n", description)
+	}
+}
+
+// ExportChange prints a change to an export of a stack: the value it gets if
+// it is added, both values if it is modified, and a warning if it is removed,
+// since stacks can no longer import it then.
+func ExportChange(w io.Writer, action string, name string, before string, after string) {
+	switch action {
+	case cf.ChangeActionAdd:
+		ColAdd.Fprintf(w, "+ Export %s", name)
+		fmt.Fprintf(w, ": %s\n", after)
+
+	case cf.ChangeActionModify:
+		ColModify.Fprintf(w, "~ Export %s", name)
+		fmt.Fprintf(w, ": %s -> %s\n", before, after)
+
+	case cf.ChangeActionRemove:
+		ColRemove.Fprintf(w, "- Export %s", name)
+		fmt.Fprintf(w, ": %s ", before)
+		ColWarning.Fprintf(w, "(stacks can no longer import it)")
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// deletionPolicies lists the deletion policies in the order they are printed,
+// with what happens to their resources when the stack is deleted. The colors
+// are referenced, since a theme may replace them.
+var deletionPolicies = []struct {
+	name   string
+	col    **color.Color
+	effect string
+}{
+	{"Delete", &ColRemove, "deleted"},
+	{"Snapshot", &ColModify, "deleted after a final snapshot"},
+	{"Retain", &ColAdd, "retained"},
+	{"RetainExceptOnCreate", &ColAdd, "retained"},
+	{"Conditional", &ColWarning, "depends on a condition"},
+}
+
+// DeletionPolicies prints the logical ids of a stack's resources grouped by
+// deletion policy, so the effect of deleting the stack is clear.
+func DeletionPolicies(w io.Writer, policies map[string][]string) {
+	for _, policy := range deletionPolicies {
+		ids := policies[policy.name]
+		if len(ids) == 0 {
+			continue
+		}
+
+		(*policy.col).Fprintf(w, "%s", policy.name)
+		fmt.Fprintf(w, " (%d, %s):\n", len(ids), policy.effect)
+
+		for _, id := range ids {
+			ColLogicalId.Fprintf(w, "  %s\n", id)
+		}
+	}
+}
+
+// ResourceDrift shows how a resource differs from its template, property by
+// property, with the expected value in red and the actual one in green.
+func ResourceDrift(w io.Writer, drift *cf.StackResourceDrift) {
+	action := cf.ChangeActionModify
+	if str(drift.StackResourceDriftStatus, "") == cf.StackResourceDriftStatusDeleted {
+		action = cf.ChangeActionRemove
+	}
+
+	ChangeHeader(w, action, str(drift.ResourceType, "???"), str(drift.LogicalResourceId, "???"))
+
+	if drift.PhysicalResourceId != nil {
+		Field(w, " Resource", *drift.PhysicalResourceId)
+	}
+
+	if action == cf.ChangeActionRemove {
+		Field(w, "    Drift", "deleted")
+	}
+
+	for _, diff := range drift.PropertyDifferences {
+		BeginField(w, "    Drift")
+		fmt.Fprintf(w, "%s: ", str(diff.PropertyPath, "???"))
+		ColDiffRemove.Fprintf(w, "%s", str(diff.ExpectedValue, ""))
+		fmt.Fprintf(w, " -> ")
+		ColDiffAdd.Fprintf(w, "%s", str(diff.ActualValue, ""))
+		fmt.Fprintf(w, "\n")
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	cf "github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/stretchr/testify/require"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -64,6 +65,7 @@ func TestPPrintChangeSet(t *testing.T) {
 + AWS::Resource MyResource
 
 ~ AWS::ModifiedResource MyResource
+     Cause: resource MyProp
     Change: MyAtt.MyProperty <- !GetAtt MyProp (conditional replacement)
 
 - AWS::ReplacedResource MyResource
@@ -81,3 +83,128 @@ func TestPPrintChangeSet(t *testing.T) {
 		})
 	}
 }
+
+func TestChangeCause(t *testing.T) {
+	detail := func(source string, entity string) *cf.ResourceChangeDetail {
+		d := &cf.ResourceChangeDetail{ChangeSource: aws.String(source)}
+		if entity != "" {
+			d.CausingEntity = aws.String(entity)
+		}
+		return d
+	}
+
+	w := &strings.Builder{}
+	ChangeCause(w, &cf.ResourceChange{
+		Replacement: aws.String(cf.ReplacementFalse),
+		Details: []*cf.ResourceChangeDetail{
+			detail(cf.ChangeSourceDirectModification, ""),
+			detail(cf.ChangeSourceParameterReference, "ImageTag"),
+			detail(cf.ChangeSourceParameterReference, "Replicas"),
+			detail(cf.ChangeSourceParameterReference, "ImageTag"),
+			detail(cf.ChangeSourceResourceAttribute, "Bucket.Arn"),
+		},
+	})
+	require.Equal(t, "     Cause: template; parameters ImageTag, Replicas; resource Bucket.Arn\n", w.String())
+
+	w.Reset()
+	ChangeCause(w, &cf.ResourceChange{
+		Replacement: aws.String(cf.ReplacementTrue),
+		Details:     []*cf.ResourceChangeDetail{detail(cf.ChangeSourceParameterReference, "Environment")},
+	})
+	require.Equal(t, "     Cause: parameter Environment (replacement driven by parameters only)\n", w.String())
+
+	w.Reset()
+	ChangeCause(w, &cf.ResourceChange{
+		Replacement: aws.String(cf.ReplacementTrue),
+		Details: []*cf.ResourceChangeDetail{
+			detail(cf.ChangeSourceParameterReference, "Environment"),
+			detail(cf.ChangeSourceDirectModification, ""),
+		},
+	})
+	require.Equal(t, "     Cause: template; parameter Environment\n", w.String())
+}
+
+func TestPPrintFilteredChangeSet(t *testing.T) {
+	change := func(resourceType string, logicalId string) *cf.Change {
+		return &cf.Change{
+			Type: aws.String("Resource"),
+			ResourceChange: &cf.ResourceChange{
+				ResourceType:      aws.String(resourceType),
+				Action:            aws.String(cf.ChangeActionAdd),
+				LogicalResourceId: aws.String(logicalId),
+			},
+		}
+	}
+
+	cs := &cf.DescribeChangeSetOutput{
+		Changes: []*cf.Change{
+			change("AWS::RDS::DBInstance", "Database"),
+			change("AWS::RDS::DBSubnetGroup", "SubnetGroup"),
+			change("AWS::S3::Bucket", "DatabaseBackups"),
+		},
+	}
+
+	w := &strings.Builder{}
+	shown := FilteredChangeSet(w, cs, ChangeFilter{ResourceType: "AWS::RDS::*"})
+	require.Equal(t, 2, shown)
+	require.Equal(t, "\n+ AWS::RDS::DBInstance Database\n\n+ AWS::RDS::DBSubnetGroup SubnetGroup\n", w.String())
+
+	w.Reset()
+	shown = FilteredChangeSet(w, cs, ChangeFilter{LogicalId: regexp.MustCompile("^Database")})
+	require.Equal(t, 2, shown)
+	require.Equal(t, "\n+ AWS::RDS::DBInstance Database\n\n+ AWS::S3::Bucket DatabaseBackups\n", w.String())
+
+	w.Reset()
+	shown = FilteredChangeSet(w, cs, ChangeFilter{ResourceType: "AWS::S3::", LogicalId: regexp.MustCompile("^Database$")})
+	require.Equal(t, 0, shown)
+	require.Empty(t, w.String())
+}
+
+func TestPPrintStackFailure(t *testing.T) {
+	w := &strings.Builder{}
+	StackFailure(w, &cf.StackEvent{
+		ResourceType:         aws.String("AWS::S3::Bucket"),
+		LogicalResourceId:    aws.String("MyBucket"),
+		ResourceStatusReason: aws.String("Bucket already exists"),
+	})
+	require.Equal(t, "Failed! AWS::S3::Bucket MyBucket\n    Reason: Bucket already exists\n", w.String())
+}
+
+func TestStackOutput(t *testing.T) {
+	w := &strings.Builder{}
+	StackOutput(w, &cf.Output{OutputKey: aws.String("Queue"), OutputValue: aws.String("https://sqs/queue")})
+	StackOutput(w, &cf.Output{
+		OutputKey:   aws.String("BucketName"),
+		OutputValue: aws.String("my-bucket"),
+		Description: aws.String("Bucket for uploads."),
+		ExportName:  aws.String("live-BucketName"),
+	})
+	require.Equal(t, "Queue: https://sqs/queue\nBucketName: my-bucket\n  Export: live-BucketName\n  Bucket for uploads.\n", w.String())
+}
+
+func TestStatusReason(t *testing.T) {
+	w := &strings.Builder{}
+	StatusReason(w, "No updates are to be performed.")
+	require.Equal(t, "    Reason: No updates are to be performed.\n", w.String())
+
+	w.Reset()
+	StatusReason(w, "Template format error: Unresolved resource dependencies [Queue, Topic] in the Resources block of the template; "+
+		"Parameter values specified for a template which does not require them (Name).")
+	require.Equal(t, ""+
+		"    Reason: Template format error: Unresolved resource dependencies\n"+
+		"              - Queue\n"+
+		"              - Topic\n"+
+		"            in the Resources block of the template\n"+
+		"            Parameter values specified for a template which does not require them (Name).\n",
+		w.String())
+
+	w.Reset()
+	StatusReason(w, "The following hook(s) failed: [AWS::EarlyValidation::ResourceExistenceCheck]")
+	require.Equal(t, "    Reason: The following hook(s) failed: [AWS::EarlyValidation::ResourceExistenceCheck]\n", w.String())
+}
+
+func TestPropertyValues(t *testing.T) {
+	w := &strings.Builder{}
+	PropertyValues(w, PropertyChange{Before: "30", After: KnownAfterApply})
+	require.Equal(t, "    Before: 30\n     After: (known after apply)\n", w.String())
+}
@@ -0,0 +1,110 @@
+package pprint
+
+import (
+	"fmt"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/fatih/color"
+	"io"
+	"strings"
+	"time"
+)
+
+// StatusRow is one deployment in a StatusTable.
+type StatusRow struct {
+	Label   string
+	Status  string
+	Elapsed time.Duration
+	Note    string
+}
+
+// StatusTable prints one row per deployment with its status and the time it
+// took, aligned in columns.
+func StatusTable(w io.Writer, rows []StatusRow) {
+	labelWidth, statusWidth := 0, 0
+
+	for _, row := range rows {
+		if len(row.Label) > labelWidth {
+			labelWidth = len(row.Label)
+		}
+
+		if len(row.Status) > statusWidth {
+			statusWidth = len(row.Status)
+		}
+	}
+
+	for _, row := range rows {
+		ColField.Fprintf(w, "%-*s", labelWidth, row.Label)
+		fmt.Fprintf(w, "  ")
+		if row.Elapsed > 0 || row.Note != "" {
+			statusColor(row.Status).Fprintf(w, "%-*s", statusWidth, row.Status)
+		} else {
+			statusColor(row.Status).Fprintf(w, "%s", row.Status)
+		}
+
+		if row.Elapsed > 0 {
+			fmt.Fprintf(w, "  %s", row.Elapsed.Round(time.Second))
+		}
+
+		if row.Note != "" {
+			fmt.Fprintf(w, "  (%s)", row.Note)
+		}
+
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func statusColor(status string) *color.Color {
+	switch {
+	case strings.Contains(status, "FAILED"),
+		strings.Contains(status, "ROLLBACK"),
+		status == "ABORTED":
+		return ColStatusFailed
+	case strings.HasSuffix(status, "_IN_PROGRESS"):
+		return ColStatusInProgress
+	case strings.HasSuffix(status, "_COMPLETE"):
+		return ColStatusComplete
+	default:
+		return Text
+	}
+}
+
+// ResourceTable prints one row per stack resource with its logical id, type,
+// status and physical id, aligned in columns under a header. The reason is
+// added for resources that failed.
+func ResourceTable(w io.Writer, resources []*cf.StackResourceSummary) {
+	header := []string{"LogicalId", "Type", "Status", "PhysicalId"}
+	widths := make([]int, len(header))
+	for i, title := range header {
+		widths[i] = len(title)
+	}
+
+	rows := make([][]string, len(resources))
+	for i, resource := range resources {
+		rows[i] = []string{
+			str(resource.LogicalResourceId, ""),
+			str(resource.ResourceType, ""),
+			str(resource.ResourceStatus, ""),
+			str(resource.PhysicalResourceId, "-"),
+		}
+
+		for j, cell := range rows[i] {
+			if len(cell) > widths[j] {
+				widths[j] = len(cell)
+			}
+		}
+	}
+
+	ColField.Fprintf(w, "%-*s  %-*s  %-*s  %s\n",
+		widths[0], header[0], widths[1], header[1], widths[2], header[2], header[3])
+
+	for i, row := range rows {
+		ColLogicalId.Fprintf(w, "%-*s", widths[0], row[0])
+		fmt.Fprintf(w, "  %-*s  ", widths[1], row[1])
+		statusColor(row[2]).Fprintf(w, "%-*s", widths[2], row[2])
+		fmt.Fprintf(w, "  %s\n", row[3])
+
+		if reason := resources[i].ResourceStatusReason; reason != nil && strings.Contains(row[2], "FAILED") {
+			fmt.Fprintf(w, "  %s\n", *reason)
+		}
+	}
+}
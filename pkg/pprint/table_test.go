@@ -0,0 +1,54 @@
+package pprint
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	cf "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusTable(t *testing.T) {
+	w := &strings.Builder{}
+
+	StatusTable(w, []StatusRow{
+		{Label: "network", Status: "UPDATE_COMPLETE", Elapsed: 61 * time.Second},
+		{Label: "db", Status: "NO_CHANGE", Elapsed: 4 * time.Second},
+		{Label: "app", Status: "FAILED", Note: "boom"},
+		{Label: "web", Status: "PENDING"},
+	})
+
+	require.Equal(t, ""+
+		"network  UPDATE_COMPLETE  1m1s\n"+
+		"db       NO_CHANGE        4s\n"+
+		"app      FAILED           (boom)\n"+
+		"web      PENDING\n",
+		w.String())
+}
+
+func TestResourceTable(t *testing.T) {
+	w := &strings.Builder{}
+
+	ResourceTable(w, []*cf.StackResourceSummary{
+		{
+			LogicalResourceId:  aws.String("Queue"),
+			ResourceType:       aws.String("AWS::SQS::Queue"),
+			ResourceStatus:     aws.String("CREATE_COMPLETE"),
+			PhysicalResourceId: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/queue"),
+		},
+		{
+			LogicalResourceId:    aws.String("Bucket"),
+			ResourceType:         aws.String("AWS::S3::Bucket"),
+			ResourceStatus:       aws.String("CREATE_FAILED"),
+			ResourceStatusReason: aws.String("bucket already exists"),
+		},
+	})
+
+	require.Equal(t, ""+
+		"LogicalId  Type             Status           PhysicalId\n"+
+		"Queue      AWS::SQS::Queue  CREATE_COMPLETE  https://sqs.eu-west-1.amazonaws.com/123456789012/queue\n"+
+		"Bucket     AWS::S3::Bucket  CREATE_FAILED    -\n"+
+		"  bucket already exists\n",
+		w.String())
+}
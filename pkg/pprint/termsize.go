@@ -0,0 +1,16 @@
+package pprint
+
+import (
+	"os"
+	"strconv"
+)
+
+// TerminalWidth returns the width of the terminal on stdout, or 0 if it is
+// not known. $COLUMNS takes precedence, if set.
+func TerminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+
+	return terminalWidth(os.Stdout)
+}
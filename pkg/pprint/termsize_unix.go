@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package pprint
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+func terminalWidth(f *os.File) int {
+	ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0
+	}
+
+	return int(ws.Col)
+}
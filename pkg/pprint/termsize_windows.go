@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package pprint
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+func terminalWidth(f *os.File) int {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(f.Fd()), &info); err != nil {
+		return 0
+	}
+
+	return int(info.Window.Right - info.Window.Left + 1)
+}
@@ -0,0 +1,130 @@
+package pprint
+
+import (
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ThemeEnv names the environment variable that overrides the colors, as a
+// comma-separated list of NAME=COLOR, e.g. "diff-add=blue,diff-remove=208".
+const ThemeEnv = "CFTOOL_COLORS"
+
+// themeColors maps the names a theme can set to the colors they override.
+var themeColors = map[string]**color.Color{
+	"field":              &ColField,
+	"add":                &ColAdd,
+	"modify":             &ColModify,
+	"remove":             &ColRemove,
+	"logical-id":         &ColLogicalId,
+	"warning":            &ColWarning,
+	"error":              &ColError,
+	"verbose":            &ColVerbose,
+	"diff-header":        &ColDiffHeader,
+	"diff-add":           &ColDiffAdd,
+	"diff-remove":        &ColDiffRemove,
+	"diff-text":          &ColDiffText,
+	"status-complete":    &ColStatusComplete,
+	"status-in-progress": &ColStatusInProgress,
+	"status-failed":      &ColStatusFailed,
+}
+
+var namedAttributes = map[string]color.Attribute{
+	"default":   color.Reset,
+	"bold":      color.Bold,
+	"faint":     color.Faint,
+	"italic":    color.Italic,
+	"underline": color.Underline,
+	"black":     color.FgBlack,
+	"red":       color.FgRed,
+	"green":     color.FgGreen,
+	"yellow":    color.FgYellow,
+	"blue":      color.FgBlue,
+	"magenta":   color.FgMagenta,
+	"cyan":      color.FgCyan,
+	"white":     color.FgWhite,
+}
+
+// SetTheme overrides colors by name, e.g. "diff-add=green,diff-remove=bold+208".
+// A color is a name such as red or bright-red, a number from the 256-color
+// palette, or several of them joined with +, e.g. to add bold or underline.
+// If any of it is invalid, no color is changed. It must be called before
+// DisableColor to take effect.
+func SetTheme(theme string) error {
+	overrides := make(map[string]*color.Color)
+
+	for _, item := range strings.Split(theme, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("%s: expected NAME=COLOR", item)
+		}
+
+		name := strings.TrimSpace(parts[0])
+		if _, ok := themeColors[name]; !ok {
+			return errors.Errorf("unknown color name %s (expected one of %s)", name, strings.Join(themeNames(), ", "))
+		}
+
+		col, err := parseColor(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return errors.Wrap(err, name)
+		}
+
+		overrides[name] = col
+	}
+
+	for name, col := range overrides {
+		*themeColors[name] = col
+		colors = append(colors, col)
+	}
+
+	return nil
+}
+
+func parseColor(spec string) (*color.Color, error) {
+	var attrs []color.Attribute
+
+	for _, part := range strings.Split(spec, "+") {
+		part = strings.ToLower(strings.TrimSpace(part))
+
+		if n, err := strconv.Atoi(part); err == nil {
+			if n < 0 || n > 255 {
+				return nil, errors.Errorf("color %d is not between 0 and 255", n)
+			}
+
+			attrs = append(attrs, 38, 5, color.Attribute(n))
+			continue
+		}
+
+		bright := strings.HasPrefix(part, "bright-")
+		attr, ok := namedAttributes[strings.TrimPrefix(part, "bright-")]
+		switch {
+		case !ok:
+			return nil, errors.Errorf("unknown color %q", part)
+		case bright && (attr < color.FgBlack || attr > color.FgWhite):
+			return nil, errors.Errorf("unknown color %q", part)
+		case bright:
+			attr += color.FgHiBlack - color.FgBlack
+		}
+
+		attrs = append(attrs, attr)
+	}
+
+	return color.New(attrs...), nil
+}
+
+func themeNames() []string {
+	var names []string
+	for name := range themeColors {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,38 @@
+package pprint
+
+import (
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestSetTheme(t *testing.T) {
+	defer func(add, remove, failed *color.Color) {
+		ColDiffAdd, ColDiffRemove, ColStatusFailed = add, remove, failed
+	}(ColDiffAdd, ColDiffRemove, ColStatusFailed)
+
+	require.NoError(t, SetTheme(""))
+	require.Equal(t, Green, ColDiffAdd)
+
+	require.NoError(t, SetTheme("diff-add=blue, diff-remove=bold+208,status-failed=bright-magenta"))
+	require.True(t, ColDiffAdd.Equals(color.New(color.FgBlue)))
+	require.True(t, ColDiffRemove.Equals(color.New(color.Bold, 38, 5, 208)))
+	require.True(t, ColStatusFailed.Equals(color.New(color.FgHiMagenta)))
+	require.Equal(t, Red, ColRemove)
+
+	w := &strings.Builder{}
+	ColDiffRemove.EnableColor()
+	ColDiffRemove.Fprint(w, "x")
+	require.True(t, strings.HasPrefix(w.String(), "\x1b[1;38;5;208mx"))
+
+	add := ColDiffAdd
+	require.EqualError(t, SetTheme("diff-add=red,diff-removed=red"), "unknown color name diff-removed (expected one of "+
+		"add, diff-add, diff-header, diff-remove, diff-text, error, field, logical-id, modify, remove, "+
+		"status-complete, status-failed, status-in-progress, verbose, warning)")
+	require.EqualError(t, SetTheme("diff-add=purple"), `diff-add: unknown color "purple"`)
+	require.EqualError(t, SetTheme("diff-add=bright-bold"), `diff-add: unknown color "bright-bold"`)
+	require.EqualError(t, SetTheme("diff-add=256"), "diff-add: color 256 is not between 0 and 255")
+	require.EqualError(t, SetTheme("diff-add"), "diff-add: expected NAME=COLOR")
+	require.Equal(t, add, ColDiffAdd)
+}